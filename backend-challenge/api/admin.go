@@ -0,0 +1,261 @@
+package api
+
+import (
+	"backend-challenge/models"
+	"backend-challenge/service"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid input")
+		return
+	}
+
+	created, err := h.svc.CreateProduct(r.Context(), product)
+	if err != nil {
+		h.sendProductError(w, product.ID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *Handler) ReplaceProduct(w http.ResponseWriter, r *http.Request) {
+	productID := strings.TrimPrefix(r.URL.Path, "/api/admin/product/")
+
+	var product models.Product
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid input")
+		return
+	}
+	if product.ID != "" && product.ID != productID {
+		h.sendError(w, http.StatusBadRequest, "error", "Product ID does not match the URL")
+		return
+	}
+	product.ID = productID
+
+	updated, err := h.svc.ReplaceProduct(r.Context(), product)
+	if err != nil {
+		h.sendProductError(w, productID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *Handler) PatchProduct(w http.ResponseWriter, r *http.Request) {
+	productID := strings.TrimPrefix(r.URL.Path, "/api/admin/product/")
+
+	var patch models.ProductPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid input")
+		return
+	}
+
+	updated, err := h.svc.PatchProduct(r.Context(), productID, patch)
+	if err != nil {
+		h.sendProductError(w, productID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// SetProductStock sets the units of a product left to sell. A null stock
+// stops tracking it.
+func (h *Handler) SetProductStock(w http.ResponseWriter, r *http.Request) {
+	productID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/admin/product/"), "/stock")
+	if productID == "" || strings.Contains(productID, "/") {
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid product ID")
+		return
+	}
+
+	var req models.StockReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid input")
+		return
+	}
+
+	updated, err := h.svc.SetProductStock(r.Context(), productID, req.Stock)
+	if err != nil {
+		h.sendProductError(w, productID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	productID := strings.TrimPrefix(r.URL.Path, "/api/admin/product/")
+
+	if err := h.svc.DeleteProduct(r.Context(), productID); err != nil {
+		h.sendProductError(w, productID, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ListCoupons(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r)
+
+	coupons, err := h.svc.ListCoupons(r.Context(), limit, offset)
+	if err != nil {
+		log.Printf("Error listing coupons: %v", err)
+		h.sendError(w, http.StatusInternalServerError, "error", "Failed to list coupons")
+		return
+	}
+	if coupons == nil {
+		coupons = []models.Coupon{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupons)
+}
+
+func (h *Handler) CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	var coupon models.Coupon
+	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid input")
+		return
+	}
+
+	created, err := h.svc.CreateCoupon(r.Context(), coupon)
+	if err != nil {
+		h.sendCouponError(w, coupon.Code, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *Handler) DeactivateCoupon(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, "/api/admin/coupon/")
+
+	if err := h.svc.DeactivateCoupon(r.Context(), code); err != nil {
+		h.sendCouponError(w, code, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.svc.ListWebhooks(r.Context())
+	if err != nil {
+		log.Printf("Error listing webhooks: %v", err)
+		h.sendError(w, http.StatusInternalServerError, "error", "Failed to list webhooks")
+		return
+	}
+	if webhooks == nil {
+		webhooks = []models.Webhook{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid input")
+		return
+	}
+
+	created, err := h.svc.CreateWebhook(r.Context(), req)
+	if err != nil {
+		h.sendWebhookError(w, "", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/admin/webhook/")
+
+	if err := h.svc.DeleteWebhook(r.Context(), id); err != nil {
+		h.sendWebhookError(w, id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/admin/webhook/"), "/deliveries")
+	limit, offset := parsePagination(r)
+
+	deliveries, err := h.svc.ListWebhookDeliveries(r.Context(), id, limit, offset)
+	if err != nil {
+		h.sendWebhookError(w, id, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// sendWebhookError maps errors from the webhook admin operations to responses
+func (h *Handler) sendWebhookError(w http.ResponseWriter, id string, err error) {
+	var invalid *service.InvalidWebhookError
+	switch {
+	case errors.As(err, &invalid):
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid webhook: "+invalid.Reason)
+	case errors.Is(err, service.ErrWebhookNotFound):
+		h.sendError(w, http.StatusNotFound, "error", "Webhook not found")
+	default:
+		log.Printf("Error handling webhook %s: %v", id, err)
+		h.sendError(w, http.StatusInternalServerError, "error", "Failed to handle webhook")
+	}
+}
+
+// sendCouponError maps errors from the coupon admin operations to responses
+func (h *Handler) sendCouponError(w http.ResponseWriter, code string, err error) {
+	var malformed *service.MalformedCouponError
+	switch {
+	case errors.As(err, &malformed):
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid coupon: "+malformed.Reason)
+	case errors.Is(err, service.ErrCouponNotFound):
+		h.sendError(w, http.StatusNotFound, "error", "Coupon not found")
+	case errors.Is(err, service.ErrCouponExists):
+		h.sendError(w, http.StatusConflict, "error", "Coupon already exists")
+	default:
+		log.Printf("Error saving coupon %s: %v", code, err)
+		h.sendError(w, http.StatusInternalServerError, "error", "Failed to save coupon")
+	}
+}
+
+// sendProductError maps errors from the product admin operations to responses
+func (h *Handler) sendProductError(w http.ResponseWriter, productID string, err error) {
+	var invalid *service.InvalidProductError
+	switch {
+	case errors.As(err, &invalid):
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid product: "+invalid.Reason)
+	case errors.Is(err, service.ErrProductNotFound):
+		h.sendError(w, http.StatusNotFound, "error", "Product not found")
+	case errors.Is(err, service.ErrProductExists):
+		h.sendError(w, http.StatusConflict, "error", "Product already exists")
+	default:
+		log.Printf("Error saving product %s: %v", productID, err)
+		h.sendError(w, http.StatusInternalServerError, "error", "Failed to save product")
+	}
+}
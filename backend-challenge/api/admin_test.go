@@ -0,0 +1,598 @@
+package api
+
+import (
+	"backend-challenge/db"
+	"backend-challenge/db/mocks"
+	"backend-challenge/models"
+	"backend-challenge/service"
+	"backend-challenge/tax"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+)
+
+func TestAdminProducts(t *testing.T) {
+	waffle := &models.Product{ID: "1", Name: "Waffle with Berries", Category: "Waffle", Price: aud(650)}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		handler        func(*Handler) http.HandlerFunc
+		mockSetup      func(*mocks.MockDatabase)
+		expectedStatus int
+		checkResponse  func(*testing.T, *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "create",
+			method:  "POST",
+			path:    "/api/admin/product",
+			body:    `{"id":"10","name":"Lemon Tart","category":"Tart","price":5.25}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.CreateProduct },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateProduct(gomock.Any(), &models.Product{ID: "10", Name: "Lemon Tart", Category: "Tart", Price: aud(525), TaxCategory: tax.Standard}).Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var product models.Product
+				if err := json.NewDecoder(w.Body).Decode(&product); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if product.ID != "10" || product.Name != "Lemon Tart" {
+					t.Errorf("Unexpected product: %+v", product)
+				}
+			},
+		},
+		{
+			name:           "create - invalid JSON",
+			method:         "POST",
+			path:           "/api/admin/product",
+			body:           `{`,
+			handler:        func(h *Handler) http.HandlerFunc { return h.CreateProduct },
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "create - validation error",
+			method:         "POST",
+			path:           "/api/admin/product",
+			body:           `{"id":"10","name":"Lemon Tart","category":"Tart","price":0}`,
+			handler:        func(h *Handler) http.HandlerFunc { return h.CreateProduct },
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage("Invalid product: price must be positive"),
+		},
+		{
+			name:    "create - duplicate ID",
+			method:  "POST",
+			path:    "/api/admin/product",
+			body:    `{"id":"1","name":"Waffle","category":"Waffle","price":6.5}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.CreateProduct },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateProduct(gomock.Any(), gomock.Any()).Return(db.ErrProductExists)
+			},
+			expectedStatus: http.StatusConflict,
+			checkResponse:  expectErrorMessage("Product already exists"),
+		},
+		{
+			name:    "create - database error",
+			method:  "POST",
+			path:    "/api/admin/product",
+			body:    `{"id":"10","name":"Lemon Tart","category":"Tart","price":5.25}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.CreateProduct },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateProduct(gomock.Any(), gomock.Any()).Return(errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:    "replace",
+			method:  "PUT",
+			path:    "/api/admin/product/1",
+			body:    `{"name":"Waffle","category":"Waffle","price":7}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.ReplaceProduct },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().UpdateProduct(gomock.Any(), &models.Product{ID: "1", Name: "Waffle", Category: "Waffle", Price: aud(700), TaxCategory: tax.Standard}).Return(nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Name: "Waffle", Category: "Waffle", Price: aud(700), Stock: intPtr(0), SoldOut: true}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var product models.Product
+				if err := json.NewDecoder(w.Body).Decode(&product); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				// Stock isn't replaced, so the response reports the stored stock
+				if product.Price != aud(700) || product.Stock == nil || *product.Stock != 0 || !product.SoldOut {
+					t.Errorf("Unexpected product: %+v", product)
+				}
+			},
+		},
+		{
+			name:           "replace - mismatched ID",
+			method:         "PUT",
+			path:           "/api/admin/product/1",
+			body:           `{"id":"2","name":"Waffle","category":"Waffle","price":7}`,
+			handler:        func(h *Handler) http.HandlerFunc { return h.ReplaceProduct },
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage("Product ID does not match the URL"),
+		},
+		{
+			name:    "replace - not found",
+			method:  "PUT",
+			path:    "/api/admin/product/missing",
+			body:    `{"name":"Waffle","category":"Waffle","price":7}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.ReplaceProduct },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().UpdateProduct(gomock.Any(), gomock.Any()).Return(db.ErrProductNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:    "patch",
+			method:  "PATCH",
+			path:    "/api/admin/product/1",
+			body:    `{"price":7.5}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.PatchProduct },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Name: "Waffle with Berries", Category: "Waffle", Price: aud(650)}, nil)
+				m.EXPECT().UpdateProduct(gomock.Any(), &models.Product{ID: "1", Name: "Waffle with Berries", Category: "Waffle", Price: aud(750), TaxCategory: tax.Standard}).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var product models.Product
+				if err := json.NewDecoder(w.Body).Decode(&product); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if product.Price != aud(750) || product.Name != waffle.Name {
+					t.Errorf("Unexpected product: %+v", product)
+				}
+			},
+		},
+		{
+			name:    "patch - validation error",
+			method:  "PATCH",
+			path:    "/api/admin/product/1",
+			body:    `{"category":" "}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.PatchProduct },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Name: "Waffle with Berries", Category: "Waffle", Price: aud(650)}, nil)
+			},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage("Invalid product: category is required"),
+		},
+		{
+			name:    "patch - not found",
+			method:  "PATCH",
+			path:    "/api/admin/product/missing",
+			body:    `{"price":7.5}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.PatchProduct },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "missing").Return(nil, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:    "set stock",
+			method:  "PUT",
+			path:    "/api/admin/product/1/stock",
+			body:    `{"stock":12}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.SetProductStock },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().SetProductStock(gomock.Any(), "1", intPtr(12)).Return(nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Name: "Waffle", Category: "Waffle", Price: aud(650), Stock: intPtr(12)}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var product models.Product
+				if err := json.NewDecoder(w.Body).Decode(&product); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if product.Stock == nil || *product.Stock != 12 || product.SoldOut {
+					t.Errorf("Unexpected product: %+v", product)
+				}
+			},
+		},
+		{
+			name:    "set stock - stop tracking",
+			method:  "PUT",
+			path:    "/api/admin/product/1/stock",
+			body:    `{"stock":null}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.SetProductStock },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().SetProductStock(gomock.Any(), "1", nil).Return(nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(waffle, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "set stock - negative",
+			method:         "PUT",
+			path:           "/api/admin/product/1/stock",
+			body:           `{"stock":-1}`,
+			handler:        func(h *Handler) http.HandlerFunc { return h.SetProductStock },
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage("Invalid product: stock must not be negative"),
+		},
+		{
+			name:    "set stock - not found",
+			method:  "PUT",
+			path:    "/api/admin/product/missing/stock",
+			body:    `{"stock":3}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.SetProductStock },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().SetProductStock(gomock.Any(), "missing", intPtr(3)).Return(db.ErrProductNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:    "delete",
+			method:  "DELETE",
+			path:    "/api/admin/product/1",
+			handler: func(h *Handler) http.HandlerFunc { return h.DeleteProduct },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().DeleteProduct(gomock.Any(), "1").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:    "delete - not found",
+			method:  "DELETE",
+			path:    "/api/admin/product/missing",
+			handler: func(h *Handler) http.HandlerFunc { return h.DeleteProduct },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().DeleteProduct(gomock.Any(), "missing").Return(db.ErrProductNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			tt.mockSetup(mockDB)
+			svc := service.New(mockDB)
+			handler := NewHandler(svc)
+
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			tt.handler(handler)(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if tt.checkResponse != nil {
+				tt.checkResponse(t, w)
+			}
+		})
+	}
+}
+
+func TestAdminCoupons(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		handler        func(*Handler) http.HandlerFunc
+		mockSetup      func(*mocks.MockDatabase)
+		expectedStatus int
+		checkResponse  func(*testing.T, *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "list",
+			method:  "GET",
+			path:    "/api/admin/coupon?limit=2",
+			handler: func(h *Handler) http.HandlerFunc { return h.ListCoupons },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ListCoupons(gomock.Any(), 2, 0).Return([]models.Coupon{
+					{Code: "BIRTHDAY", Redemptions: 3},
+					{Code: "BUYGETON"},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var coupons []models.Coupon
+				if err := json.NewDecoder(w.Body).Decode(&coupons); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if len(coupons) != 2 || coupons[0].Redemptions != 3 {
+					t.Errorf("Unexpected coupons: %+v", coupons)
+				}
+			},
+		},
+		{
+			name:    "list - empty",
+			method:  "GET",
+			path:    "/api/admin/coupon",
+			handler: func(h *Handler) http.HandlerFunc { return h.ListCoupons },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ListCoupons(gomock.Any(), 0, 0).Return(nil, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				if body := w.Body.String(); body != "[]\n" {
+					t.Errorf("Expected empty array, got %q", body)
+				}
+			},
+		},
+		{
+			name:    "list - database error",
+			method:  "GET",
+			path:    "/api/admin/coupon",
+			handler: func(h *Handler) http.HandlerFunc { return h.ListCoupons },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ListCoupons(gomock.Any(), 0, 0).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:    "create",
+			method:  "POST",
+			path:    "/api/admin/coupon",
+			body:    `{"code":"SPRING25","rule":{"type":"percentage","value":25},"maxPerCustomer":1}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.CreateCoupon },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateCoupon(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var coupon models.Coupon
+				if err := json.NewDecoder(w.Body).Decode(&coupon); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if coupon.Code != "SPRING25" || coupon.Rule == nil || coupon.Rule.Value != 25 || coupon.MaxPerCustomer != 1 {
+					t.Errorf("Unexpected coupon: %+v", coupon)
+				}
+			},
+		},
+		{
+			name:           "create - invalid JSON",
+			method:         "POST",
+			path:           "/api/admin/coupon",
+			body:           `{`,
+			handler:        func(h *Handler) http.HandlerFunc { return h.CreateCoupon },
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "create - invalid rule",
+			method:         "POST",
+			path:           "/api/admin/coupon",
+			body:           `{"code":"SPRING25","rule":{"type":"bogus"}}`,
+			handler:        func(h *Handler) http.HandlerFunc { return h.CreateCoupon },
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage(`Invalid coupon: coupon SPRING25: unknown rule type "bogus"`),
+		},
+		{
+			name:    "create - length rejected by policy",
+			method:  "POST",
+			path:    "/api/admin/coupon",
+			body:    `{"code":"SHORT"}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.CreateCoupon },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateCoupon(gomock.Any(), gomock.Any()).Return(db.ErrCouponCodeLength)
+			},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage("Invalid coupon: code length is not allowed by the coupon policy"),
+		},
+		{
+			name:    "create - code taken",
+			method:  "POST",
+			path:    "/api/admin/coupon",
+			body:    `{"code":"HAPPYHRS"}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.CreateCoupon },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateCoupon(gomock.Any(), gomock.Any()).Return(db.ErrCouponExists)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:    "deactivate",
+			method:  "DELETE",
+			path:    "/api/admin/coupon/HAPPYHRS",
+			handler: func(h *Handler) http.HandlerFunc { return h.DeactivateCoupon },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().DeactivateCoupon(gomock.Any(), "HAPPYHRS").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:    "deactivate - not found",
+			method:  "DELETE",
+			path:    "/api/admin/coupon/NOTINDB88",
+			handler: func(h *Handler) http.HandlerFunc { return h.DeactivateCoupon },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().DeactivateCoupon(gomock.Any(), "NOTINDB88").Return(db.ErrCouponNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			tt.mockSetup(mockDB)
+			svc := service.New(mockDB)
+			handler := NewHandler(svc)
+
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			tt.handler(handler)(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if tt.checkResponse != nil {
+				tt.checkResponse(t, w)
+			}
+		})
+	}
+}
+
+func TestAdminWebhooks(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		handler        func(*Handler) http.HandlerFunc
+		mockSetup      func(*mocks.MockDatabase)
+		expectedStatus int
+		checkResponse  func(*testing.T, *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "create",
+			method:  "POST",
+			path:    "/api/admin/webhook",
+			body:    `{"url":"https://fulfilment.example.com/hooks","events":["order.placed","order.status_changed"]}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.CreateWebhook },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateWebhook(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var webhook models.Webhook
+				if err := json.NewDecoder(w.Body).Decode(&webhook); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if webhook.ID == "" || webhook.Secret == "" || len(webhook.Events) != 2 {
+					t.Errorf("Unexpected webhook: %+v", webhook)
+				}
+			},
+		},
+		{
+			name:           "create - invalid JSON",
+			method:         "POST",
+			path:           "/api/admin/webhook",
+			body:           `{`,
+			handler:        func(h *Handler) http.HandlerFunc { return h.CreateWebhook },
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "create - unknown event",
+			method:         "POST",
+			path:           "/api/admin/webhook",
+			body:           `{"url":"https://fulfilment.example.com/hooks","events":["order.eaten"]}`,
+			handler:        func(h *Handler) http.HandlerFunc { return h.CreateWebhook },
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage("Invalid webhook: unknown event type order.eaten"),
+		},
+		{
+			name:    "list - secrets omitted",
+			method:  "GET",
+			path:    "/api/admin/webhook",
+			handler: func(h *Handler) http.HandlerFunc { return h.ListWebhooks },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ListWebhooks(gomock.Any()).Return([]models.Webhook{
+					{ID: "wh1", URL: "https://fulfilment.example.com/hooks", Events: []string{models.EventOrderPlaced}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				if bytes.Contains(w.Body.Bytes(), []byte("secret")) {
+					t.Errorf("Expected no secrets, got %s", w.Body.String())
+				}
+			},
+		},
+		{
+			name:    "delete",
+			method:  "DELETE",
+			path:    "/api/admin/webhook/wh1",
+			handler: func(h *Handler) http.HandlerFunc { return h.DeleteWebhook },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().DeleteWebhook(gomock.Any(), "wh1").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:    "delete - not found",
+			method:  "DELETE",
+			path:    "/api/admin/webhook/missing",
+			handler: func(h *Handler) http.HandlerFunc { return h.DeleteWebhook },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().DeleteWebhook(gomock.Any(), "missing").Return(db.ErrWebhookNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:    "deliveries",
+			method:  "GET",
+			path:    "/api/admin/webhook/wh1/deliveries?limit=10",
+			handler: func(h *Handler) http.HandlerFunc { return h.ListWebhookDeliveries },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ListWebhookDeliveries(gomock.Any(), "wh1", 10, 0).Return([]models.WebhookDelivery{
+					{ID: 1, WebhookID: "wh1", EventID: 7, EventType: models.EventOrderPlaced, Status: models.DeliveryPending, Attempts: 2, LastStatusCode: 503},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var deliveries []models.WebhookDelivery
+				if err := json.NewDecoder(w.Body).Decode(&deliveries); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if len(deliveries) != 1 || deliveries[0].LastStatusCode != 503 || deliveries[0].Attempts != 2 {
+					t.Errorf("Unexpected deliveries: %+v", deliveries)
+				}
+			},
+		},
+		{
+			name:    "deliveries - not found",
+			method:  "GET",
+			path:    "/api/admin/webhook/missing/deliveries",
+			handler: func(h *Handler) http.HandlerFunc { return h.ListWebhookDeliveries },
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ListWebhookDeliveries(gomock.Any(), "missing", 0, 0).Return(nil, db.ErrWebhookNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			tt.mockSetup(mockDB)
+			svc := service.New(mockDB)
+			handler := NewHandler(svc)
+
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			tt.handler(handler)(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if tt.checkResponse != nil {
+				tt.checkResponse(t, w)
+			}
+		})
+	}
+}
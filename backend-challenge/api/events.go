@@ -0,0 +1,125 @@
+package api
+
+import (
+	"backend-challenge/models"
+	"backend-challenge/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sseHeartbeat is how often an idle stream sends a comment, so proxies
+	// keep the connection open and dead clients are noticed
+	sseHeartbeat = 15 * time.Second
+
+	// sseWriteTimeout bounds each write to a stream. The server's WriteTimeout
+	// covers the whole response, which a stream outlives, so it is replaced
+	// by this per-write deadline.
+	sseWriteTimeout = 10 * time.Second
+)
+
+// StreamOrderEvents streams an order's status changes as Server-Sent Events.
+// Each event's ID is its position in the order history, so a client that
+// reconnects with Last-Event-ID only gets the changes it missed. The stream
+// ends once the order reaches a final status.
+func (h *Handler) StreamOrderEvents(w http.ResponseWriter, r *http.Request) {
+	orderID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/order/"), "/events")
+	if orderID == "" || strings.Contains(orderID, "/") {
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid order ID")
+		return
+	}
+
+	// An invalid Last-Event-ID replays the whole history
+	lastID, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+
+	stream, err := h.svc.StreamOrderEvents(r.Context(), orderID, lastID)
+	if errors.Is(err, service.ErrOrderNotFound) {
+		h.sendError(w, http.StatusNotFound, "error", "Order not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error streaming order %s: %v", orderID, err)
+		h.sendError(w, http.StatusInternalServerError, "error", "Failed to stream order events")
+		return
+	}
+	defer stream.Close()
+
+	// Nothing more will happen to the order; 204 tells EventSource not to reconnect
+	if stream.Final && len(stream.Backlog) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(write func() error) bool {
+		if err := rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return false
+		}
+		if err := write(); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	sendEvent := func(e models.OrderEvent) bool {
+		lastID = e.ID
+		return send(func() error { return writeSSEEvent(w, e) })
+	}
+
+	if !send(func() error { return nil }) {
+		return
+	}
+	for _, e := range stream.Backlog {
+		if !sendEvent(e) {
+			return
+		}
+	}
+	if stream.Final {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if !send(func() error { _, err := fmt.Fprint(w, ": ping\n\n"); return err }) {
+				return
+			}
+		case e, ok := <-stream.Events:
+			// A closed channel means the server is shutting down or the client
+			// fell behind; either way it reconnects with Last-Event-ID
+			if !ok {
+				return
+			}
+			if e.ID <= lastID {
+				continue
+			}
+			if !sendEvent(e) || service.FinalOrderStatus(e.To) {
+				return
+			}
+		}
+	}
+}
+
+// writeSSEEvent writes e as a "status" event
+func writeSSEEvent(w http.ResponseWriter, e models.OrderEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", e.ID, data)
+	return err
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"backend-challenge/db/mocks"
+	"backend-challenge/models"
+	"backend-challenge/service"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+)
+
+func TestStreamOrderEvents(t *testing.T) {
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cancelled := &models.Order{ID: "abc", Status: models.OrderCancelled, History: []models.OrderStatusChange{
+		{To: models.OrderPlaced, At: at},
+		{From: models.OrderPlaced, To: models.OrderAccepted, Actor: "kitchen", At: at},
+		{From: models.OrderAccepted, To: models.OrderCancelled, Actor: "kitchen", Reason: "closing", At: at},
+	}}
+
+	tests := []struct {
+		name           string
+		path           string
+		lastEventID    string
+		mockSetup      func(*mocks.MockDatabase)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:        "resumes after Last-Event-ID and ends at final status",
+			path:        "/api/order/abc/events",
+			lastEventID: "1",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(cancelled, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: "id: 2\nevent: status\ndata: " +
+				`{"id":2,"orderId":"abc","from":"placed","to":"accepted","actor":"kitchen","at":"2025-06-01T12:00:00Z"}` + "\n\n" +
+				"id: 3\nevent: status\ndata: " +
+				`{"id":3,"orderId":"abc","from":"accepted","to":"cancelled","actor":"kitchen","reason":"closing","at":"2025-06-01T12:00:00Z"}` + "\n\n",
+		},
+		{
+			name:        "final order already seen",
+			path:        "/api/order/abc/events",
+			lastEventID: "3",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(cancelled, nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "not found",
+			path: "/api/order/missing/events",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "missing").Return(nil, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "missing order ID",
+			path:           "/api/order//events",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "database error",
+			path: "/api/order/abc/events",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			tt.mockSetup(mockDB)
+			handler := NewHandler(service.New(mockDB))
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			w := httptest.NewRecorder()
+
+			handler.StreamOrderEvents(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedBody != "" {
+				if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+					t.Errorf("Expected event stream, got %s", ct)
+				}
+				if w.Body.String() != tt.expectedBody {
+					t.Errorf("Unexpected body:\n%s", w.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -2,17 +2,23 @@ package api
 
 import (
 	"backend-challenge/models"
+	"backend-challenge/money"
+	"backend-challenge/ratelimit"
 	"backend-challenge/service"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type Handler struct {
-	svc *service.Service
+	svc     *service.Service
+	limiter ratelimit.Limiter
+	limits  ratelimit.Policies
 }
 
 func NewHandler(svc *service.Service) *Handler {
@@ -20,27 +26,26 @@ func NewHandler(svc *service.Service) *Handler {
 }
 
 func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request) {
-	// Parse pagination query parameters
-	limit := 0 // 0 means no limit
-	offset := 0
-
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-			limit = parsedLimit
-			if limit > 100 {
-				limit = 100 // Max limit of 100
-			}
-		}
+	limit, offset := parsePagination(r)
+	currency, ok := requestCurrency(r)
+	if !ok {
+		h.sendError(w, http.StatusBadRequest, "error", "Unsupported currency")
+		return
 	}
-
-	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
-		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
-		}
+	filter, err := parseProductFilter(r)
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, "error", err.Error())
+		return
 	}
 
-	products, err := h.svc.GetAllProducts(r.Context(), limit, offset)
+	w.Header().Add("Vary", "Accept-Currency")
+	products, err := h.svc.GetAllProducts(r.Context(), filter, limit, offset, currency)
 	if err != nil {
+		var unavailable *service.PriceUnavailableError
+		if errors.As(err, &unavailable) {
+			h.sendError(w, http.StatusUnprocessableEntity, "error", priceUnavailableMessage(unavailable))
+			return
+		}
 		log.Printf("Error fetching products: %v", err)
 		h.sendError(w, http.StatusInternalServerError, "error", "Failed to fetch products")
 		return
@@ -59,8 +64,20 @@ func (h *Handler) GetProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product, err := h.svc.GetProductByID(r.Context(), productID)
+	currency, ok := requestCurrency(r)
+	if !ok {
+		h.sendError(w, http.StatusBadRequest, "error", "Unsupported currency")
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Currency")
+	product, err := h.svc.GetProductByID(r.Context(), productID, currency)
 	if err != nil {
+		var unavailable *service.PriceUnavailableError
+		if errors.As(err, &unavailable) {
+			h.sendError(w, http.StatusUnprocessableEntity, "error", priceUnavailableMessage(unavailable))
+			return
+		}
 		log.Printf("Error fetching product %s: %v", productID, err)
 		h.sendError(w, http.StatusInternalServerError, "error", "Failed to fetch product")
 		return
@@ -87,6 +104,12 @@ func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var ok bool
+	if req.Currency, ok = requestCurrency(r); !ok {
+		h.sendError(w, http.StatusBadRequest, "error", "Unsupported currency")
+		return
+	}
+
 	for _, item := range req.Items {
 		if item.ProductID == "" {
 			h.sendError(w, http.StatusBadRequest, "error", "Product ID is required")
@@ -98,16 +121,62 @@ func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Clients that keep sending unknown codes are cut off from trying more
+	if req.CouponCode != "" && h.limiter != nil && h.limits.CouponFailures.Enabled() {
+		if res := h.limiter.Peek(couponFailureKey(r), h.limits.CouponFailures); !res.Allowed {
+			sendRateLimited(w, res, "Too many invalid coupon codes")
+			return
+		}
+	}
+
 	order, err := h.svc.PlaceOrder(r.Context(), req)
 	if err != nil {
 		if errors.Is(err, service.ErrInvalidCoupon) {
+			if h.limiter != nil {
+				h.limiter.Take(couponFailureKey(r), h.limits.CouponFailures)
+			}
 			h.sendError(w, http.StatusUnprocessableEntity, "error", "Invalid coupon code")
 			return
 		}
+		if errors.Is(err, service.ErrCouponExpired) {
+			h.sendError(w, http.StatusUnprocessableEntity, "error", "Coupon has expired")
+			return
+		}
+		if errors.Is(err, service.ErrCouponNotYetActive) {
+			h.sendError(w, http.StatusUnprocessableEntity, "error", "Coupon is not active yet")
+			return
+		}
+		if errors.Is(err, service.ErrCouponExhausted) {
+			h.sendError(w, http.StatusUnprocessableEntity, "error", "Coupon has been fully redeemed")
+			return
+		}
+		if errors.Is(err, service.ErrCouponAlreadyUsed) {
+			h.sendError(w, http.StatusUnprocessableEntity, "error", "Coupon has already been used by this customer")
+			return
+		}
+		if errors.Is(err, service.ErrCustomerRequired) {
+			h.sendError(w, http.StatusUnprocessableEntity, "error", "Coupon requires a customerId")
+			return
+		}
+		var notApplicable *service.CouponNotApplicableError
+		if errors.As(err, &notApplicable) {
+			h.sendError(w, http.StatusUnprocessableEntity, "error", "Coupon does not apply: "+notApplicable.Reason)
+			return
+		}
 		if errors.Is(err, service.ErrProductNotFound) {
 			h.sendError(w, http.StatusUnprocessableEntity, "error", "Product not found")
 			return
 		}
+		var stockErr *service.InsufficientStockError
+		if errors.As(err, &stockErr) {
+			sendStockError(w, stockErr.ProductIDs)
+			return
+		}
+		var unavailable *service.PriceUnavailableError
+		if errors.As(err, &unavailable) {
+			h.sendError(w, http.StatusUnprocessableEntity, "error", priceUnavailableMessage(unavailable))
+			return
+		}
 		log.Printf("Error placing order: %v", err)
 		h.sendError(w, http.StatusInternalServerError, "error", "Failed to place order")
 		return
@@ -117,11 +186,78 @@ func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(order)
 }
 
+func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	orderID := strings.TrimPrefix(r.URL.Path, "/api/order/")
+
+	if orderID == "" {
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid order ID")
+		return
+	}
+
+	order, err := h.svc.GetOrderByID(r.Context(), orderID)
+	if err != nil {
+		log.Printf("Error fetching order %s: %v", orderID, err)
+		h.sendError(w, http.StatusInternalServerError, "error", "Failed to fetch order")
+		return
+	}
+
+	if order == nil {
+		h.sendError(w, http.StatusNotFound, "error", "Order not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// UpdateOrderStatus moves an order to the status in the body, recording the
+// API key that made the change
+func (h *Handler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	orderID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/order/"), "/status")
+	if orderID == "" || strings.Contains(orderID, "/") {
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid order ID")
+		return
+	}
+
+	var req models.OrderStatusReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "error", "Invalid input")
+		return
+	}
+
+	var actor string
+	if key := authenticatedKey(r.Context()); key != nil {
+		actor = key.ID
+	}
+
+	order, err := h.svc.UpdateOrderStatus(r.Context(), orderID, req, actor)
+	if err != nil {
+		var transition *service.StatusTransitionError
+		switch {
+		case errors.Is(err, service.ErrInvalidOrderStatus):
+			h.sendError(w, http.StatusBadRequest, "error", "Invalid order status")
+		case errors.Is(err, service.ErrOrderNotFound):
+			h.sendError(w, http.StatusNotFound, "error", "Order not found")
+		case errors.As(err, &transition):
+			h.sendError(w, http.StatusConflict, "error", "Order can't move from "+transition.From+" to "+transition.To)
+		case errors.Is(err, service.ErrOrderStatusConflict):
+			h.sendError(w, http.StatusConflict, "error", "Order status changed, reload the order and retry")
+		default:
+			log.Printf("Error updating order %s status: %v", orderID, err)
+			h.sendError(w, http.StatusInternalServerError, "error", "Failed to update order status")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	// Check database connectivity
 	ctx := r.Context()
 	// Just fetch one product to test connectivity
-	_, err := h.svc.GetAllProducts(ctx, 1, 0)
+	_, err := h.svc.GetAllProducts(ctx, models.ProductFilter{}, 1, 0, "")
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -139,6 +275,123 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// parsePagination reads the limit and offset query parameters, ignoring invalid values
+func parsePagination(r *http.Request) (limit, offset int) {
+	// 0 means no limit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+			if limit > 100 {
+				limit = 100 // Max limit of 100
+			}
+		}
+	}
+
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
+			offset = parsedOffset
+		}
+	}
+
+	return limit, offset
+}
+
+// maxProductQueryLength caps the q parameter of product listings
+const maxProductQueryLength = 100
+
+// parseProductFilter reads the category, q, minPrice, maxPrice and sort query
+// parameters of a product listing. Unlike pagination, invalid values are
+// errors, since ignoring them would list products the client filtered out.
+func parseProductFilter(r *http.Request) (models.ProductFilter, error) {
+	query := r.URL.Query()
+	filter := models.ProductFilter{
+		Category: strings.TrimSpace(query.Get("category")),
+		Query:    strings.TrimSpace(query.Get("q")),
+	}
+	if utf8.RuneCountInString(filter.Query) > maxProductQueryLength {
+		return filter, fmt.Errorf("Invalid q: must be at most %d characters", maxProductQueryLength)
+	}
+
+	var err error
+	if filter.MinPrice, err = parsePriceBound(r, "minPrice"); err != nil {
+		return filter, err
+	}
+	if filter.MaxPrice, err = parsePriceBound(r, "maxPrice"); err != nil {
+		return filter, err
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && filter.MinPrice.Amount > filter.MaxPrice.Amount {
+		return filter, errors.New("Invalid price range: minPrice must not be greater than maxPrice")
+	}
+
+	if s := query.Get("sort"); s != "" {
+		seen := make(map[string]bool)
+		for _, field := range strings.Split(s, ",") {
+			field = strings.TrimSpace(field)
+			order := models.ProductSort{Field: strings.TrimPrefix(field, "-"), Descending: strings.HasPrefix(field, "-")}
+			if !models.ValidProductSortField(order.Field) {
+				return filter, fmt.Errorf("Invalid sort field %q: sort by name, category or price, with a leading - for descending order", field)
+			}
+			if seen[order.Field] {
+				return filter, fmt.Errorf("Sort field %q is repeated", order.Field)
+			}
+			seen[order.Field] = true
+			filter.Sort = append(filter.Sort, order)
+		}
+	}
+	return filter, nil
+}
+
+// parsePriceBound reads a price in AUD from the named query parameter; nil
+// means it wasn't given
+func parsePriceBound(r *http.Request, name string) (*money.Money, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	price, err := money.Parse(s, money.DefaultCurrency)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s: %v", name, err)
+	}
+	if price.Amount < 0 {
+		return nil, fmt.Errorf("Invalid %s: must not be negative", name)
+	}
+	return &price, nil
+}
+
+// requestCurrency reads the currency the client wants prices in from the
+// currency query parameter or, failing that, the Accept-Currency header. The
+// header may list several currencies, most preferred first, and the first
+// supported one is used. It returns "" if no currency was asked for, and false
+// if none of the currencies asked for is supported.
+func requestCurrency(r *http.Request) (string, bool) {
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		currency = strings.ToUpper(currency)
+		return currency, money.ValidCurrency(currency)
+	}
+
+	header := r.Header.Get("Accept-Currency")
+	if header == "" {
+		return "", true
+	}
+	for _, part := range strings.Split(header, ",") {
+		// Preference parameters such as ;q=0.5 are ignored
+		currency, _, _ := strings.Cut(part, ";")
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		if currency == "*" {
+			return "", true
+		}
+		if money.ValidCurrency(currency) {
+			return currency, true
+		}
+	}
+	return "", false
+}
+
+// priceUnavailableMessage explains which product can't be priced in the currency asked for
+func priceUnavailableMessage(err *service.PriceUnavailableError) string {
+	return "Product " + err.ProductID + " has no price in " + err.Currency
+}
+
 func (h *Handler) sendError(w http.ResponseWriter, statusCode int, errType, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -148,3 +401,18 @@ func (h *Handler) sendError(w http.ResponseWriter, statusCode int, errType, mess
 		Message: message,
 	})
 }
+
+// sendStockError responds to an order that asks for more than is in stock,
+// naming the products that are short
+func sendStockError(w http.ResponseWriter, productIDs []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(models.StockErrorResponse{
+		ErrorResponse: models.ErrorResponse{
+			Code:    http.StatusConflict,
+			Type:    "error",
+			Message: "Insufficient stock",
+		},
+		ProductIDs: productIDs,
+	})
+}
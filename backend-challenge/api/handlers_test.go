@@ -1,19 +1,59 @@
 package api
 
 import (
+	"backend-challenge/db"
 	"backend-challenge/db/mocks"
 	"backend-challenge/models"
+	"backend-challenge/money"
 	"backend-challenge/service"
 	"bytes"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"go.uber.org/mock/gomock"
 )
 
+// expectErrorMessage checks the message of an error response
+func expectErrorMessage(message string) func(*testing.T, *httptest.ResponseRecorder) {
+	return func(t *testing.T, w *httptest.ResponseRecorder) {
+		var resp models.ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resp.Message != message {
+			t.Errorf("Expected message %q, got %q", message, resp.Message)
+		}
+	}
+}
+
+// expectStockError checks for an insufficient stock response naming productIDs
+func expectStockError(productIDs ...string) func(*testing.T, *httptest.ResponseRecorder) {
+	return func(t *testing.T, w *httptest.ResponseRecorder) {
+		var resp models.StockErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resp.Message != "Insufficient stock" || !slices.Equal(resp.ProductIDs, productIDs) {
+			t.Errorf("Unexpected response: %+v, want products %v", resp, productIDs)
+		}
+	}
+}
+
+// aud returns an amount in cents of the store currency
+func aud(cents int64) money.Money {
+	return money.New(cents, money.DefaultCurrency)
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
 func TestListProducts(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -25,7 +65,7 @@ func TestListProducts(t *testing.T) {
 		{
 			name: "success",
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetAllProducts(gomock.Any(), 0, 0).Return([]models.Product{}, nil)
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 0, 0).Return([]models.Product{}, nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
@@ -33,7 +73,7 @@ func TestListProducts(t *testing.T) {
 			name:        "with limit > 100 capped to 100",
 			queryParams: "?limit=200",
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetAllProducts(gomock.Any(), 100, 0).Return([]models.Product{}, nil)
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 100, 0).Return([]models.Product{}, nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
@@ -41,7 +81,7 @@ func TestListProducts(t *testing.T) {
 			name:        "with offset",
 			queryParams: "?offset=10",
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetAllProducts(gomock.Any(), 0, 10).Return([]models.Product{}, nil)
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 0, 10).Return([]models.Product{}, nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
@@ -49,17 +89,125 @@ func TestListProducts(t *testing.T) {
 			name:        "with limit and offset",
 			queryParams: "?limit=20&offset=5",
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetAllProducts(gomock.Any(), 20, 5).Return([]models.Product{}, nil)
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 20, 5).Return([]models.Product{}, nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
 		{
 			name: "database error",
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetAllProducts(gomock.Any(), 0, 0).Return(nil, errors.New("database error"))
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 0, 0).Return(nil, errors.New("database error"))
 			},
 			expectedStatus: http.StatusInternalServerError,
 		},
+		{
+			name:        "priced in requested currency",
+			queryParams: "?currency=nzd",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 0, 0).Return([]models.Product{
+					{ID: "1", Price: aud(650), Prices: map[string]money.Money{"NZD": money.New(750, "NZD")}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var products []models.Product
+				if err := json.NewDecoder(w.Body).Decode(&products); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if len(products) != 1 || products[0].Price != money.New(750, "NZD") {
+					t.Errorf("Expected product priced at 7.50 NZD, got %+v", products)
+				}
+			},
+		},
+		{
+			name:        "with filters and sort",
+			queryParams: "?category=Waffle&q=+berries+&minPrice=4.5&maxPrice=10&sort=price,-name&limit=5",
+			mockSetup: func(m *mocks.MockDatabase) {
+				minPrice, maxPrice := aud(450), aud(1000)
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{
+					Category: "Waffle",
+					Query:    "berries",
+					MinPrice: &minPrice,
+					MaxPrice: &maxPrice,
+					Sort:     []models.ProductSort{{Field: "price"}, {Field: "name", Descending: true}},
+				}, 5, 0).Return([]models.Product{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid min price",
+			queryParams:    "?minPrice=cheap",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage(`Invalid minPrice: invalid amount "cheap"`),
+		},
+		{
+			name:           "price with too many decimals",
+			queryParams:    "?maxPrice=6.505",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage(`Invalid maxPrice: amount "6.505" has more than 2 decimal places`),
+		},
+		{
+			name:           "negative price",
+			queryParams:    "?minPrice=-1",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage("Invalid minPrice: must not be negative"),
+		},
+		{
+			name:           "min price above max price",
+			queryParams:    "?minPrice=8&maxPrice=6.50",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage("Invalid price range: minPrice must not be greater than maxPrice"),
+		},
+		{
+			name:           "unknown sort field",
+			queryParams:    "?sort=price,-stock",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse: expectErrorMessage(
+				`Invalid sort field "-stock": sort by name, category or price, with a leading - for descending order`),
+		},
+		{
+			name:           "empty sort field",
+			queryParams:    "?sort=price,",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse: expectErrorMessage(
+				`Invalid sort field "": sort by name, category or price, with a leading - for descending order`),
+		},
+		{
+			name:           "repeated sort field",
+			queryParams:    "?sort=price,-price",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage(`Sort field "price" is repeated`),
+		},
+		{
+			name:           "query too long",
+			queryParams:    "?q=" + strings.Repeat("a", 101),
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage("Invalid q: must be at most 100 characters"),
+		},
+		{
+			name:           "unsupported currency",
+			queryParams:    "?currency=USD",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage("Unsupported currency"),
+		},
+		{
+			name:        "no price in currency",
+			queryParams: "?currency=GBP",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 0, 0).Return([]models.Product{{ID: "1", Price: aud(650)}}, nil)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			checkResponse:  expectErrorMessage("Product 1 has no price in GBP"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -89,6 +237,40 @@ func TestListProducts(t *testing.T) {
 	}
 }
 
+func TestRequestCurrency(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		header string
+		want   string
+		wantOK bool
+	}{
+		{name: "none", want: "", wantOK: true},
+		{name: "query", query: "?currency=GBP", want: "GBP", wantOK: true},
+		{name: "query is case insensitive", query: "?currency=nzd", want: "NZD", wantOK: true},
+		{name: "query wins over header", query: "?currency=GBP", header: "NZD", want: "GBP", wantOK: true},
+		{name: "unsupported query", query: "?currency=USD", header: "NZD", wantOK: false},
+		{name: "header", header: "NZD", want: "NZD", wantOK: true},
+		{name: "first supported in header", header: "USD, gbp;q=0.8, NZD;q=0.5", want: "GBP", wantOK: true},
+		{name: "header wildcard", header: "USD, *", want: "", wantOK: true},
+		{name: "no supported in header", header: "USD, EUR", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/product"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("Accept-Currency", tt.header)
+			}
+
+			got, ok := requestCurrency(req)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("requestCurrency() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
 func TestGetProduct(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -105,7 +287,7 @@ func TestGetProduct(t *testing.T) {
 					ID:       "1",
 					Name:     "Test Product",
 					Category: "Test",
-					Price:    9.99,
+					Price:    aud(999),
 				}, nil)
 			},
 			expectedStatus: http.StatusOK,
@@ -171,8 +353,10 @@ func TestGetProduct(t *testing.T) {
 
 func TestPlaceOrder(t *testing.T) {
 	tests := []struct {
-		name           string
-		orderReq       interface{}
+		name     string
+		orderReq interface{}
+		// acceptCurrency is sent as the Accept-Currency header
+		acceptCurrency string
 		mockSetup      func(*mocks.MockDatabase)
 		expectedStatus int
 		checkResponse  func(*testing.T, *httptest.ResponseRecorder)
@@ -187,8 +371,9 @@ func TestPlaceOrder(t *testing.T) {
 					ID:       "1",
 					Name:     "Waffle",
 					Category: "Breakfast",
-					Price:    6.5,
+					Price:    aud(650),
 				}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
@@ -212,9 +397,13 @@ func TestPlaceOrder(t *testing.T) {
 			},
 			mockSetup: func(m *mocks.MockDatabase) {
 				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", Rule: &models.CouponRule{
+					Code: "HAPPYHRS", Type: models.CouponRulePercentage, Value: 18,
+				}}, nil)
 				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{
-					ID: "1", Name: "Waffle", Category: "Breakfast", Price: 6.5,
+					ID: "1", Name: "Waffle", Category: "Breakfast", Price: aud(650),
 				}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
@@ -223,6 +412,9 @@ func TestPlaceOrder(t *testing.T) {
 				if order.CouponCode != "HAPPYHRS" {
 					t.Errorf("Expected coupon HAPPYHRS, got %s", order.CouponCode)
 				}
+				if order.Discounts != aud(117) || order.Total != aud(533) {
+					t.Errorf("Expected discounts 1.17 and total 5.33, got %v and %v", order.Discounts, order.Total)
+				}
 			},
 		},
 		{
@@ -236,6 +428,93 @@ func TestPlaceOrder(t *testing.T) {
 			},
 			expectedStatus: http.StatusUnprocessableEntity,
 		},
+		{
+			name: "coupon does not apply",
+			orderReq: models.OrderReq{
+				Items:      []models.OrderItem{{ProductID: "1", Quantity: 1}},
+				CouponCode: "OVER9000",
+			},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "OVER9000").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "OVER9000").Return(&models.Coupon{Code: "OVER9000", Rule: &models.CouponRule{
+					Code: "OVER9000", Type: models.CouponRuleFixedAmount, Amount: 1000, MinSubtotal: 9000,
+				}}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{
+					ID: "1", Name: "Waffle", Category: "Breakfast", Price: aud(650),
+				}, nil)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			checkResponse:  expectErrorMessage("Coupon does not apply: minimum basket of 90.00 AUD not met"),
+		},
+		{
+			name: "coupon expired",
+			orderReq: models.OrderReq{
+				Items:      []models.OrderItem{{ProductID: "1", Quantity: 1}},
+				CouponCode: "HAPPYHRS",
+			},
+			mockSetup: func(m *mocks.MockDatabase) {
+				endsAt := time.Now().Add(-time.Hour)
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", EndsAt: &endsAt}, nil)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			checkResponse:  expectErrorMessage("Coupon has expired"),
+		},
+		{
+			name: "coupon not yet active",
+			orderReq: models.OrderReq{
+				Items:      []models.OrderItem{{ProductID: "1", Quantity: 1}},
+				CouponCode: "HAPPYHRS",
+			},
+			mockSetup: func(m *mocks.MockDatabase) {
+				startsAt := time.Now().Add(time.Hour)
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", StartsAt: &startsAt}, nil)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			checkResponse:  expectErrorMessage("Coupon is not active yet"),
+		},
+		{
+			name: "coupon exhausted",
+			orderReq: models.OrderReq{
+				Items:      []models.OrderItem{{ProductID: "1", Quantity: 1}},
+				CouponCode: "HAPPYHRS",
+			},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", MaxRedemptions: 1, Redemptions: 1}, nil)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			checkResponse:  expectErrorMessage("Coupon has been fully redeemed"),
+		},
+		{
+			name: "coupon already used",
+			orderReq: models.OrderReq{
+				Items:      []models.OrderItem{{ProductID: "1", Quantity: 1}},
+				CouponCode: "HAPPYHRS",
+				CustomerID: "alice",
+			},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", MaxPerCustomer: 1}, nil)
+				m.EXPECT().CountCustomerRedemptions(gomock.Any(), "HAPPYHRS", "alice").Return(1, nil)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			checkResponse:  expectErrorMessage("Coupon has already been used by this customer"),
+		},
+		{
+			name: "coupon needs a customer",
+			orderReq: models.OrderReq{
+				Items:      []models.OrderItem{{ProductID: "1", Quantity: 1}},
+				CouponCode: "HAPPYHRS",
+			},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", MaxPerCustomer: 1}, nil)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			checkResponse:  expectErrorMessage("Coupon requires a customerId"),
+		},
 		{
 			name: "product not found",
 			orderReq: models.OrderReq{
@@ -246,6 +525,69 @@ func TestPlaceOrder(t *testing.T) {
 			},
 			expectedStatus: http.StatusUnprocessableEntity,
 		},
+		{
+			name: "out of stock",
+			orderReq: models.OrderReq{
+				Items: []models.OrderItem{{ProductID: "1", Quantity: 3}},
+			},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Name: "Waffle", Category: "Breakfast", Price: aud(650), Stock: intPtr(2)}, nil)
+			},
+			expectedStatus: http.StatusConflict,
+			checkResponse:  expectStockError("1"),
+		},
+		{
+			name: "sold out while ordering",
+			orderReq: models.OrderReq{
+				Items: []models.OrderItem{{ProductID: "1", Quantity: 1}},
+			},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Name: "Waffle", Category: "Breakfast", Price: aud(650), Stock: intPtr(1)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(&db.InsufficientStockError{ProductIDs: []string{"1"}})
+			},
+			expectedStatus: http.StatusConflict,
+			checkResponse:  expectStockError("1"),
+		},
+		{
+			name:           "priced in requested currency",
+			orderReq:       models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 2}}},
+			acceptCurrency: "NZD",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{
+					ID: "1", Name: "Waffle", Category: "Breakfast", Price: aud(650),
+					Prices: map[string]money.Money{"NZD": money.New(750, "NZD")},
+				}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var order models.Order
+				if err := json.NewDecoder(w.Body).Decode(&order); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if order.Total != money.New(1500, "NZD") {
+					t.Errorf("Expected total of 15.00 NZD, got %v", order.Total)
+				}
+			},
+		},
+		{
+			name:           "unsupported currency",
+			orderReq:       models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}},
+			acceptCurrency: "USD",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage("Unsupported currency"),
+		},
+		{
+			name:           "no price in currency",
+			orderReq:       models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}},
+			acceptCurrency: "GBP",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Name: "Waffle", Category: "Breakfast", Price: aud(650)}, nil)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			checkResponse:  expectErrorMessage("Product 1 has no price in GBP"),
+		},
 		{
 			name:           "empty items",
 			orderReq:       `{"items":[]}`,
@@ -298,6 +640,9 @@ func TestPlaceOrder(t *testing.T) {
 
 			req := httptest.NewRequest("POST", "/api/order", bytes.NewReader(body))
 			req.Header.Set("Content-Type", "application/json")
+			if tt.acceptCurrency != "" {
+				req.Header.Set("Accept-Currency", tt.acceptCurrency)
+			}
 			w := httptest.NewRecorder()
 
 			handler.PlaceOrder(w, req)
@@ -313,6 +658,205 @@ func TestPlaceOrder(t *testing.T) {
 	}
 }
 
+func TestGetOrder(t *testing.T) {
+	tests := []struct {
+		name           string
+		orderID        string
+		mockSetup      func(*mocks.MockDatabase)
+		expectedStatus int
+		checkResponse  func(*testing.T, *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "success",
+			orderID: "abc",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(&models.Order{
+					ID:         "abc",
+					Items:      []models.OrderItem{{ProductID: "1", Quantity: 2}},
+					Lines:      []models.OrderLine{{ProductID: "1", Quantity: 2, UnitPrice: aud(650), Amount: aud(1300)}},
+					CouponCode: "HAPPYHRS",
+					Subtotal:   aud(1300),
+					Discounts:  aud(234),
+					Total:      aud(1066),
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var order models.Order
+				if err := json.NewDecoder(w.Body).Decode(&order); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if order.ID != "abc" || order.CouponCode != "HAPPYHRS" || order.Total != aud(1066) {
+					t.Errorf("Unexpected order: %+v", order)
+				}
+			},
+		},
+		{
+			name:           "empty order ID",
+			orderID:        "",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "not found",
+			orderID: "missing",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "missing").Return(nil, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:    "database error",
+			orderID: "abc",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			tt.mockSetup(mockDB)
+			svc := service.New(mockDB)
+			handler := NewHandler(svc)
+
+			req := httptest.NewRequest("GET", "/api/order/"+tt.orderID, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetOrder(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.checkResponse != nil {
+				tt.checkResponse(t, w)
+			}
+		})
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		mockSetup      func(*mocks.MockDatabase)
+		expectedStatus int
+		checkResponse  func(*testing.T, *httptest.ResponseRecorder)
+	}{
+		{
+			name: "success",
+			path: "/api/order/abc/status",
+			body: `{"status":"accepted"}`,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(&models.Order{ID: "abc", Status: models.OrderPlaced}, nil)
+				m.EXPECT().UpdateOrderStatus(gomock.Any(), "abc", gomock.Any()).Return(nil)
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(&models.Order{ID: "abc", Status: models.OrderAccepted}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var order models.Order
+				if err := json.NewDecoder(w.Body).Decode(&order); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if order.Status != models.OrderAccepted {
+					t.Errorf("Unexpected order: %+v", order)
+				}
+			},
+		},
+		{
+			name:           "invalid JSON",
+			path:           "/api/order/abc/status",
+			body:           `{`,
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing order ID",
+			path:           "/api/order//status",
+			body:           `{"status":"accepted"}`,
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown status",
+			path:           "/api/order/abc/status",
+			body:           `{"status":"eaten"}`,
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorMessage("Invalid order status"),
+		},
+		{
+			name: "not found",
+			path: "/api/order/missing/status",
+			body: `{"status":"accepted"}`,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "missing").Return(nil, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "transition not allowed",
+			path: "/api/order/abc/status",
+			body: `{"status":"placed"}`,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(&models.Order{ID: "abc", Status: models.OrderCompleted}, nil)
+			},
+			expectedStatus: http.StatusConflict,
+			checkResponse:  expectErrorMessage("Order can't move from completed to placed"),
+		},
+		{
+			name: "changed concurrently",
+			path: "/api/order/abc/status",
+			body: `{"status":"accepted"}`,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(&models.Order{ID: "abc", Status: models.OrderPlaced}, nil)
+				m.EXPECT().UpdateOrderStatus(gomock.Any(), "abc", gomock.Any()).Return(db.ErrOrderStatusChanged)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "database error",
+			path: "/api/order/abc/status",
+			body: `{"status":"accepted"}`,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			tt.mockSetup(mockDB)
+			handler := NewHandler(service.New(mockDB))
+
+			req := httptest.NewRequest("PATCH", tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.UpdateOrderStatus(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.checkResponse != nil {
+				tt.checkResponse(t, w)
+			}
+		})
+	}
+}
+
 func TestHealthCheck(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -323,7 +867,7 @@ func TestHealthCheck(t *testing.T) {
 		{
 			name: "healthy",
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetAllProducts(gomock.Any(), 1, 0).Return([]models.Product{}, nil)
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 1, 0).Return([]models.Product{}, nil)
 			},
 			expectedStatus: http.StatusOK,
 			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
@@ -337,7 +881,7 @@ func TestHealthCheck(t *testing.T) {
 		{
 			name: "unhealthy",
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetAllProducts(gomock.Any(), 1, 0).Return(nil, errors.New("db error"))
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 1, 0).Return(nil, errors.New("db error"))
 			},
 			expectedStatus: http.StatusServiceUnavailable,
 			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"backend-challenge/models"
+	"backend-challenge/service"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+)
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyMiddleware makes requests with an Idempotency-Key header safe to
+// retry. The first request is handled and its response stored; retries with
+// the same body get the stored response back instead of running again. It runs
+// after AuthMiddleware, so each API key has its own idempotency keys.
+func IdempotencyMiddleware(svc *service.Service, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			sendJSONError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendJSONError(w, http.StatusBadRequest, "Invalid input")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var apiKeyID string
+		if apiKey := authenticatedKey(r.Context()); apiKey != nil {
+			apiKeyID = apiKey.ID
+		}
+		fingerprint := requestFingerprint(r, body)
+
+		stored, err := svc.BeginIdempotentRequest(r.Context(), apiKeyID, key, fingerprint)
+		switch {
+		case errors.Is(err, service.ErrIdempotencyKeyReused):
+			sendJSONError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			return
+		case errors.Is(err, service.ErrIdempotencyKeyInFlight):
+			sendJSONError(w, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+			return
+		case err != nil:
+			log.Printf("Error reserving idempotency key: %v", err)
+			sendJSONError(w, http.StatusInternalServerError, "Failed to process Idempotency-Key")
+			return
+		case stored != nil:
+			for name, value := range stored.Headers {
+				w.Header().Set(name, value)
+			}
+			if stored.ContentType != "" {
+				w.Header().Set("Content-Type", stored.ContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.StatusCode)
+			w.Write(stored.Body)
+			return
+		}
+
+		before := w.Header().Clone()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		// Store the outcome even if the client has gone, so its retry is answered.
+		// Rate limited requests are as transient as server errors, so neither is
+		// kept for replay.
+		ctx := context.WithoutCancel(r.Context())
+		if rec.status == http.StatusTooManyRequests || rec.status >= http.StatusInternalServerError {
+			if err := svc.AbortIdempotentRequest(ctx, apiKeyID, key); err != nil {
+				log.Printf("Error releasing idempotency key: %v", err)
+			}
+			return
+		}
+		err = svc.CompleteIdempotentRequest(ctx, &models.IdempotentRequest{
+			APIKeyID:    apiKeyID,
+			Key:         key,
+			Fingerprint: fingerprint,
+			StatusCode:  rec.status,
+			ContentType: rec.Header().Get("Content-Type"),
+			Headers:     handlerHeaders(before, rec.Header()),
+			Body:        rec.body.Bytes(),
+		})
+		if err != nil {
+			log.Printf("Error storing idempotent response: %v", err)
+		}
+	}
+}
+
+// requestFingerprint hashes the parts of a request a retry must repeat,
+// including the currency it asks to be priced in
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	if currency, _ := requestCurrency(r); currency != "" {
+		io.WriteString(h, "currency "+currency+"\n")
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// handlerHeaders returns the headers other than Content-Type that were set
+// or changed between before and after
+func handlerHeaders(before, after http.Header) map[string]string {
+	var headers map[string]string
+	for name, values := range after {
+		if name == "Content-Type" || slices.Equal(before[name], values) {
+			continue
+		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[name] = after.Get(name)
+	}
+	return headers
+}
+
+// responseRecorder passes a response through while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
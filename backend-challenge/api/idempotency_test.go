@@ -0,0 +1,209 @@
+package api
+
+import (
+	"backend-challenge/db/mocks"
+	"backend-challenge/models"
+	"backend-challenge/service"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	const body = `{"items":[{"productId":"1","quantity":1}]}`
+
+	tests := []struct {
+		name              string
+		key               string
+		mockSetup         func(*mocks.MockDatabase)
+		handlerStatus     int
+		expectedStatus    int
+		expectedBody      string
+		shouldCallHandler bool
+		replayed          bool
+		headers           map[string]string
+	}{
+		{
+			name:              "no key",
+			mockSetup:         func(m *mocks.MockDatabase) {},
+			handlerStatus:     http.StatusOK,
+			expectedStatus:    http.StatusOK,
+			expectedBody:      body,
+			shouldCallHandler: true,
+		},
+		{
+			name: "first request is stored",
+			key:  "k1",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil)
+				m.EXPECT().CompleteIdempotencyKey(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, req *models.IdempotentRequest) error {
+						if req.APIKeyID != "demo" || req.Key != "k1" || req.StatusCode != http.StatusCreated ||
+							req.ContentType != "application/json" || string(req.Body) != body ||
+							len(req.Headers) != 1 || req.Headers["Cache-Control"] != "no-store" {
+							t.Errorf("Unexpected stored response %+v", req)
+						}
+						return nil
+					})
+			},
+			handlerStatus:     http.StatusCreated,
+			expectedStatus:    http.StatusCreated,
+			expectedBody:      body,
+			shouldCallHandler: true,
+		},
+		{
+			name: "retry is replayed",
+			key:  "k1",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, req *models.IdempotentRequest, _ any) (*models.IdempotentRequest, error) {
+						return &models.IdempotentRequest{
+							Fingerprint: req.Fingerprint, StatusCode: http.StatusOK, ContentType: "application/json",
+							Headers: map[string]string{"Cache-Control": "no-store"}, Body: []byte(`{"id":"first"}`),
+						}, nil
+					})
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":"first"}`,
+			replayed:       true,
+			headers:        map[string]string{"Cache-Control": "no-store"},
+		},
+		{
+			name: "key reused for another body",
+			key:  "k1",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), gomock.Any()).Return(&models.IdempotentRequest{Fingerprint: "other", StatusCode: http.StatusOK}, nil)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "request still in flight",
+			key:  "k1",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, req *models.IdempotentRequest, _ any) (*models.IdempotentRequest, error) {
+						return &models.IdempotentRequest{Fingerprint: req.Fingerprint}, nil
+					})
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "server error frees the key",
+			key:  "k1",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil)
+				m.EXPECT().ReleaseIdempotencyKey(gomock.Any(), "demo", "k1").Return(nil)
+			},
+			handlerStatus:     http.StatusInternalServerError,
+			expectedStatus:    http.StatusInternalServerError,
+			shouldCallHandler: true,
+		},
+		{
+			name: "rate limited request frees the key",
+			key:  "k1",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil)
+				m.EXPECT().ReleaseIdempotencyKey(gomock.Any(), "demo", "k1").Return(nil)
+			},
+			handlerStatus:     http.StatusTooManyRequests,
+			expectedStatus:    http.StatusTooManyRequests,
+			shouldCallHandler: true,
+		},
+		{
+			name: "database error",
+			key:  "k1",
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "key too long",
+			key:            strings.Repeat("k", maxIdempotencyKeyLength+1),
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			tt.mockSetup(mockDB)
+			svc := service.New(mockDB)
+
+			handlerCalled := false
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				handlerCalled = true
+				// The handler still sees the whole body
+				b, _ := io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Cache-Control", "no-store")
+				w.WriteHeader(tt.handlerStatus)
+				if tt.handlerStatus < http.StatusInternalServerError {
+					w.Write(b)
+				}
+			}
+
+			req := httptest.NewRequest("POST", "/api/order", strings.NewReader(body))
+			if tt.key != "" {
+				req.Header.Set("Idempotency-Key", tt.key)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), apiKeyKey, &models.APIKey{ID: "demo"}))
+			w := httptest.NewRecorder()
+
+			IdempotencyMiddleware(svc, handler)(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if handlerCalled != tt.shouldCallHandler {
+				t.Errorf("Expected handler called = %v, got %v", tt.shouldCallHandler, handlerCalled)
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, w.Body.String())
+			}
+			if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.replayed {
+				t.Errorf("Expected replayed = %v, got %v", tt.replayed, replayed)
+			}
+			for name, value := range tt.headers {
+				if got := w.Header().Get(name); got != value {
+					t.Errorf("Expected %s header %q, got %q", name, value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/order", nil)
+	a := requestFingerprint(req, []byte(`{"items":[]}`))
+
+	if b := requestFingerprint(req, []byte(`{"items":[]}`)); a != b {
+		t.Error("Expected the same request to have the same fingerprint")
+	}
+	if b := requestFingerprint(req, []byte(`{"items":[1]}`)); a == b {
+		t.Error("Expected a different body to change the fingerprint")
+	}
+	if b := requestFingerprint(httptest.NewRequest("POST", "/api/other", nil), []byte(`{"items":[]}`)); a == b {
+		t.Error("Expected a different path to change the fingerprint")
+	}
+
+	nzd := httptest.NewRequest("POST", "/api/order?currency=NZD", nil)
+	if b := requestFingerprint(nzd, []byte(`{"items":[]}`)); a == b {
+		t.Error("Expected a different currency to change the fingerprint")
+	}
+	header := httptest.NewRequest("POST", "/api/order", nil)
+	header.Header.Set("Accept-Currency", "nzd")
+	if requestFingerprint(header, []byte(`{"items":[]}`)) != requestFingerprint(nzd, []byte(`{"items":[]}`)) {
+		t.Error("Expected the same currency to give the same fingerprint however it is asked for")
+	}
+}
@@ -2,44 +2,61 @@ package api
 
 import (
 	"backend-challenge/models"
+	"backend-challenge/service"
 	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"os"
 
 	"github.com/google/uuid"
 )
 
-func getValidAPIKey() string {
-	// Allow API key to be set via environment variable, default to "apitest"
-	// Could be improved by having a proper config loaded on startup and not fetching the var everytime
-	if key := os.Getenv("API_KEY"); key != "" {
-		return key
-	}
-	return "apitest"
-}
-
-func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	validAPIKey := getValidAPIKey()
+// AuthMiddleware authenticates the api_key header against the stored keys.
+// Unknown or disabled keys get 401, and keys without the route's scope get 403.
+func AuthMiddleware(svc *service.Service, scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		apiKey := r.Header.Get("api_key")
-		if apiKey != validAPIKey {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(models.ErrorResponse{
-				Code:    http.StatusUnauthorized,
-				Type:    "error",
-				Message: "Invalid or missing API key",
-			})
+		key, err := svc.Authenticate(r.Context(), r.Header.Get("api_key"))
+		switch {
+		case errors.Is(err, service.ErrInvalidAPIKey):
+			sendJSONError(w, http.StatusUnauthorized, "Invalid or missing API key")
+			return
+		case err != nil:
+			log.Printf("Error authenticating API key: %v", err)
+			sendJSONError(w, http.StatusInternalServerError, "Failed to authenticate API key")
+			return
+		case !key.HasScope(scope):
+			sendJSONError(w, http.StatusForbidden, "API key lacks the "+scope+" scope")
 			return
 		}
-		next(w, r)
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey, key)))
 	}
 }
 
+// authenticatedKey returns the key AuthMiddleware accepted for the request
+func authenticatedKey(ctx context.Context) *models.APIKey {
+	key, _ := ctx.Value(apiKeyKey).(*models.APIKey)
+	return key
+}
+
+// sendJSONError writes an error response for middleware and helpers that
+// run outside a Handler
+func sendJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{
+		Code:    status,
+		Type:    "error",
+		Message: message,
+	})
+}
+
 type contextKey string
 
-const requestIDKey contextKey = "requestID"
+const (
+	requestIDKey contextKey = "requestID"
+	apiKeyKey    contextKey = "apiKey"
+)
 
 // RequestIDMiddleware adds a request ID to each request
 func RequestIDMiddleware(next http.Handler) http.Handler {
@@ -63,9 +80,9 @@ func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, api_key, X-Request-ID")
-		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, api_key, X-Request-ID, Idempotency-Key, Last-Event-ID, Accept-Currency")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Idempotent-Replayed, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After")
 		w.Header().Set("Access-Control-Max-Age", "3600")
 
 		// Handle preflight requests
@@ -1,70 +1,153 @@
 package api
 
 import (
+	"backend-challenge/db/mocks"
+	"backend-challenge/models"
+	"backend-challenge/service"
+	"errors"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
 )
 
 func TestAuthMiddleware(t *testing.T) {
+	customerKey := &models.APIKey{ID: "demo", Scopes: []string{models.ScopeCreateOrder, models.ScopeReadOrders}}
+	expired := time.Now().Add(-time.Minute)
+	overlapEnds := time.Now().Add(time.Hour)
+	justUsed := time.Now().Add(-10 * time.Second)
+
 	tests := []struct {
 		name              string
 		apiKey            string
-		envKey            string
+		scope             string
+		mockSetup         func(*mocks.MockDatabase)
 		expectedStatus    int
 		shouldCallHandler bool
 	}{
 		{
-			name:              "valid key",
-			apiKey:            "apitest",
+			name:   "valid key",
+			apiKey: "apitest",
+			scope:  models.ScopeCreateOrder,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetAPIKeyByHash(gomock.Any(), service.HashAPIKey("apitest")).Return(customerKey, nil)
+				m.EXPECT().TouchAPIKey(gomock.Any(), "demo", gomock.Any()).Return(nil)
+			},
 			expectedStatus:    http.StatusOK,
 			shouldCallHandler: true,
 		},
 		{
 			name:              "missing key",
 			apiKey:            "",
+			scope:             models.ScopeCreateOrder,
+			mockSetup:         func(m *mocks.MockDatabase) {},
+			expectedStatus:    http.StatusUnauthorized,
+			shouldCallHandler: false,
+		},
+		{
+			name:   "invalid key",
+			apiKey: "wrongkey",
+			scope:  models.ScopeCreateOrder,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetAPIKeyByHash(gomock.Any(), service.HashAPIKey("wrongkey")).Return(nil, nil)
+			},
+			expectedStatus:    http.StatusUnauthorized,
+			shouldCallHandler: false,
+		},
+		{
+			name:   "disabled key",
+			apiKey: "apitest",
+			scope:  models.ScopeCreateOrder,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetAPIKeyByHash(gomock.Any(), gomock.Any()).Return(&models.APIKey{ID: "demo", Scopes: customerKey.Scopes, Disabled: true}, nil)
+			},
 			expectedStatus:    http.StatusUnauthorized,
 			shouldCallHandler: false,
 		},
 		{
-			name:              "invalid key",
-			apiKey:            "wrongkey",
+			name:   "expired key",
+			apiKey: "apitest",
+			scope:  models.ScopeCreateOrder,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetAPIKeyByHash(gomock.Any(), gomock.Any()).Return(&models.APIKey{ID: "demo", Scopes: customerKey.Scopes, ExpiresAt: &expired}, nil)
+			},
 			expectedStatus:    http.StatusUnauthorized,
 			shouldCallHandler: false,
 		},
 		{
-			name:              "custom env key - valid",
-			apiKey:            "customkey",
-			envKey:            "customkey",
+			name:   "rotated key within overlap",
+			apiKey: "apitest",
+			scope:  models.ScopeCreateOrder,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetAPIKeyByHash(gomock.Any(), gomock.Any()).Return(&models.APIKey{ID: "demo", Scopes: customerKey.Scopes, ExpiresAt: &overlapEnds, ReplacedBy: "next"}, nil)
+				m.EXPECT().TouchAPIKey(gomock.Any(), "demo", gomock.Any()).Return(nil)
+			},
 			expectedStatus:    http.StatusOK,
 			shouldCallHandler: true,
 		},
 		{
-			name:              "custom env key - old key rejected",
-			apiKey:            "apitest",
-			envKey:            "customkey",
-			expectedStatus:    http.StatusUnauthorized,
+			name:   "recently used key is not recorded again",
+			apiKey: "apitest",
+			scope:  models.ScopeCreateOrder,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetAPIKeyByHash(gomock.Any(), gomock.Any()).Return(&models.APIKey{ID: "demo", Scopes: customerKey.Scopes, LastUsedAt: &justUsed}, nil)
+			},
+			expectedStatus:    http.StatusOK,
+			shouldCallHandler: true,
+		},
+		{
+			name:   "failing to record use does not fail the request",
+			apiKey: "apitest",
+			scope:  models.ScopeCreateOrder,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetAPIKeyByHash(gomock.Any(), gomock.Any()).Return(customerKey, nil)
+				m.EXPECT().TouchAPIKey(gomock.Any(), "demo", gomock.Any()).Return(errors.New("database is locked"))
+			},
+			expectedStatus:    http.StatusOK,
+			shouldCallHandler: true,
+		},
+		{
+			name:   "missing scope",
+			apiKey: "apitest",
+			scope:  models.ScopeAdmin,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetAPIKeyByHash(gomock.Any(), gomock.Any()).Return(customerKey, nil)
+				m.EXPECT().TouchAPIKey(gomock.Any(), "demo", gomock.Any()).Return(nil)
+			},
+			expectedStatus:    http.StatusForbidden,
+			shouldCallHandler: false,
+		},
+		{
+			name:   "database error",
+			apiKey: "apitest",
+			scope:  models.ScopeCreateOrder,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetAPIKeyByHash(gomock.Any(), gomock.Any()).Return(nil, errors.New("db error"))
+			},
+			expectedStatus:    http.StatusInternalServerError,
 			shouldCallHandler: false,
 		},
+		{
+			name:              "static key",
+			apiKey:            "statickey",
+			scope:             models.ScopeAdmin,
+			mockSetup:         func(m *mocks.MockDatabase) {},
+			expectedStatus:    http.StatusOK,
+			shouldCallHandler: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Save original env value to avoid test pollution
-			originalKey := os.Getenv("API_KEY")
-			if tt.envKey != "" {
-				os.Setenv("API_KEY", tt.envKey)
-			} else {
-				os.Unsetenv("API_KEY")
-			}
-			defer func() {
-				if originalKey != "" {
-					os.Setenv("API_KEY", originalKey)
-				} else {
-					os.Unsetenv("API_KEY")
-				}
-			}()
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			tt.mockSetup(mockDB)
+			svc := service.New(mockDB)
+			svc.AddStaticAPIKey("statickey", models.APIKey{ID: "static", Scopes: []string{models.ScopeAdmin}})
 
 			handlerCalled := false
 			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -73,7 +156,7 @@ func TestAuthMiddleware(t *testing.T) {
 				w.Write([]byte("success"))
 			})
 
-			wrapped := AuthMiddleware(handler)
+			wrapped := AuthMiddleware(svc, tt.scope, handler)
 
 			req := httptest.NewRequest("POST", "/api/order", nil)
 			if tt.apiKey != "" {
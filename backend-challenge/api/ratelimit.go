@@ -0,0 +1,77 @@
+package api
+
+import (
+	"backend-challenge/ratelimit"
+	"backend-challenge/service"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SetRateLimiter turns on rate limiting. Without it every request is let through.
+func (h *Handler) SetRateLimiter(limiter ratelimit.Limiter, policies ratelimit.Policies) {
+	h.limiter = limiter
+	h.limits = policies
+}
+
+// RateLimitMiddleware takes a token from the bucket that keyFunc picks for the
+// request and answers 429 once it is empty. A nil limiter disables the check.
+func RateLimitMiddleware(limiter ratelimit.Limiter, policy ratelimit.Policy, keyFunc func(*http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	if limiter == nil || !policy.Enabled() {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := limiter.Take(keyFunc(r), policy)
+		if !res.Allowed {
+			sendRateLimited(w, res, "Too many requests")
+			return
+		}
+		setRateLimitHeaders(w, res)
+		next(w, r)
+	}
+}
+
+// productReadKey buckets anonymous product reads by client IP
+func productReadKey(r *http.Request) string {
+	return "products:ip:" + clientIP(r)
+}
+
+// orderKey buckets order placement by API key. It runs after AuthMiddleware,
+// so the header holds a valid key; only its hash is kept in the limiter.
+func orderKey(r *http.Request) string {
+	return "orders:key:" + service.HashAPIKey(r.Header.Get("api_key"))
+}
+
+// couponFailureKey buckets unknown coupon codes by client IP rather than by
+// key, so one shopper guessing codes can't lock out a storefront's shared key
+func couponFailureKey(r *http.Request) string {
+	return "coupon_failures:ip:" + clientIP(r)
+}
+
+// clientIP returns the host part of the connection's remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, res ratelimit.Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+}
+
+func sendRateLimited(w http.ResponseWriter, res ratelimit.Result, message string) {
+	setRateLimitHeaders(w, res)
+	w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+	sendJSONError(w, http.StatusTooManyRequests, message)
+}
+
+// ceilSeconds rounds up so clients never retry before a token is available
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"backend-challenge/db/mocks"
+	"backend-challenge/models"
+	"backend-challenge/ratelimit"
+	"backend-challenge/service"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	policy := ratelimit.Policy{Limit: 2, Period: time.Minute}
+	handler := RateLimitMiddleware(ratelimit.NewMemory(), policy, productReadKey, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/product", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	w := request("192.0.2.1:1234")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != "1" || w.Header().Get("RateLimit-Reset") != "30" {
+		t.Errorf("Unexpected rate limit headers: %v", w.Header())
+	}
+
+	// The port changes between connections but the client is the same
+	request("192.0.2.1:5678")
+	w = request("192.0.2.1:9999")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "30" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Unexpected rate limit headers: %v", w.Header())
+	}
+
+	if w := request("192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected other clients to keep their own limit, got %d", w.Code)
+	}
+
+	t.Run("no limiter", func(t *testing.T) {
+		called := 0
+		handler := RateLimitMiddleware(nil, policy, productReadKey, func(w http.ResponseWriter, r *http.Request) { called++ })
+		for i := 0; i < 3; i++ {
+			handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/product", nil))
+		}
+		if called != 3 {
+			t.Errorf("Expected every request through, got %d", called)
+		}
+	})
+}
+
+func TestRouter_RateLimits(t *testing.T) {
+	policies := ratelimit.Policies{
+		Products:       ratelimit.Policy{Limit: 1, Period: time.Minute},
+		Orders:         ratelimit.Policy{Limit: 3, Period: time.Minute},
+		CouponFailures: ratelimit.Policy{Limit: 1, Period: time.Hour},
+	}
+
+	newRouter := func(t *testing.T, mockSetup func(*mocks.MockDatabase)) http.Handler {
+		ctrl := gomock.NewController(t)
+		mockDB := mocks.NewMockDatabase(ctrl)
+		expectTestAPIKeys(mockDB)
+		mockSetup(mockDB)
+		h := NewHandler(service.New(mockDB))
+		h.SetRateLimiter(ratelimit.NewMemory(), policies)
+		return h.SetupRoutes()
+	}
+
+	do := func(router http.Handler, method, path, apiKey string, body interface{}) int {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		if apiKey != "" {
+			req.Header.Set("api_key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("product reads", func(t *testing.T) {
+		router := newRouter(t, func(m *mocks.MockDatabase) {
+			m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 0, 0).Return([]models.Product{}, nil)
+		})
+		if code := do(router, "GET", "/api/product", "", nil); code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", code)
+		}
+		if code := do(router, "GET", "/api/product/1", "", nil); code != http.StatusTooManyRequests {
+			t.Errorf("Expected product reads to share a limit, got %d", code)
+		}
+	})
+
+	t.Run("orders per key", func(t *testing.T) {
+		order := models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}}
+		router := newRouter(t, func(m *mocks.MockDatabase) {
+			m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil).Times(3)
+			m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil).Times(3)
+		})
+		for i := 0; i < 3; i++ {
+			if code := do(router, "POST", "/api/order", "apitest", order); code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d", code)
+			}
+		}
+		if code := do(router, "POST", "/api/order", "apitest", order); code != http.StatusTooManyRequests {
+			t.Errorf("Expected 429, got %d", code)
+		}
+		// Unauthenticated requests are rejected before they use the key's tokens
+		if code := do(router, "POST", "/api/order", "", order); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", code)
+		}
+	})
+
+	t.Run("coupon failures", func(t *testing.T) {
+		router := newRouter(t, func(m *mocks.MockDatabase) {
+			m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+			m.EXPECT().IsCouponValid(gomock.Any(), "GUESS001").Return(false, nil)
+			m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
+		})
+		items := []models.OrderItem{{ProductID: "1", Quantity: 1}}
+
+		if code := do(router, "POST", "/api/order", "apitest", models.OrderReq{Items: items, CouponCode: "GUESS001"}); code != http.StatusUnprocessableEntity {
+			t.Fatalf("Expected 422, got %d", code)
+		}
+		// The next code is refused without being checked
+		if code := do(router, "POST", "/api/order", "apitest", models.OrderReq{Items: items, CouponCode: "GUESS002"}); code != http.StatusTooManyRequests {
+			t.Errorf("Expected 429, got %d", code)
+		}
+		// Orders without a coupon still go through
+		if code := do(router, "POST", "/api/order", "apitest", models.OrderReq{Items: items}); code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", code)
+		}
+	})
+}
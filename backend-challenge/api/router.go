@@ -1,6 +1,7 @@
 package api
 
 import (
+	"backend-challenge/models"
 	"net/http"
 	"strings"
 )
@@ -22,7 +23,7 @@ func (h *Handler) SetupRoutes() http.Handler {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		h.ListProducts(w, r)
+		RateLimitMiddleware(h.limiter, h.limits.Products, productReadKey, h.ListProducts)(w, r)
 	})
 
 	mux.HandleFunc("/api/product/", func(w http.ResponseWriter, r *http.Request) {
@@ -31,7 +32,7 @@ func (h *Handler) SetupRoutes() http.Handler {
 			return
 		}
 		if strings.HasPrefix(r.URL.Path, "/api/product/") && r.URL.Path != "/api/product/" {
-			h.GetProduct(w, r)
+			RateLimitMiddleware(h.limiter, h.limits.Products, productReadKey, h.GetProduct)(w, r)
 		} else {
 			http.NotFound(w, r)
 		}
@@ -42,7 +43,128 @@ func (h *Handler) SetupRoutes() http.Handler {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		AuthMiddleware(h.PlaceOrder)(w, r)
+		AuthMiddleware(h.svc, models.ScopeCreateOrder,
+			RateLimitMiddleware(h.limiter, h.limits.Orders, orderKey,
+				IdempotencyMiddleware(h.svc, h.PlaceOrder)))(w, r)
+	})
+
+	mux.HandleFunc("/api/order/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/order/" {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/events") {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			AuthMiddleware(h.svc, models.ScopeReadOrders, h.StreamOrderEvents)(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/status") {
+			if r.Method != http.MethodPatch {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			AuthMiddleware(h.svc, models.ScopeManageOrders, h.UpdateOrderStatus)(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		AuthMiddleware(h.svc, models.ScopeReadOrders, h.GetOrder)(w, r)
+	})
+
+	mux.HandleFunc("/api/admin/product", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		AuthMiddleware(h.svc, models.ScopeAdmin, h.CreateProduct)(w, r)
+	})
+
+	mux.HandleFunc("/api/admin/product/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/stock") {
+			if r.Method != http.MethodPut {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			AuthMiddleware(h.svc, models.ScopeAdmin, h.SetProductStock)(w, r)
+			return
+		}
+
+		var next http.HandlerFunc
+		switch r.Method {
+		case http.MethodPut:
+			next = h.ReplaceProduct
+		case http.MethodPatch:
+			next = h.PatchProduct
+		case http.MethodDelete:
+			next = h.DeleteProduct
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path != "/api/admin/product/" {
+			AuthMiddleware(h.svc, models.ScopeAdmin, next)(w, r)
+		} else {
+			http.NotFound(w, r)
+		}
+	})
+
+	mux.HandleFunc("/api/admin/coupon", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			AuthMiddleware(h.svc, models.ScopeAdmin, h.ListCoupons)(w, r)
+		case http.MethodPost:
+			AuthMiddleware(h.svc, models.ScopeAdmin, h.CreateCoupon)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/admin/coupon/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path != "/api/admin/coupon/" {
+			AuthMiddleware(h.svc, models.ScopeAdmin, h.DeactivateCoupon)(w, r)
+		} else {
+			http.NotFound(w, r)
+		}
+	})
+
+	mux.HandleFunc("/api/admin/webhook", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			AuthMiddleware(h.svc, models.ScopeAdmin, h.ListWebhooks)(w, r)
+		case http.MethodPost:
+			AuthMiddleware(h.svc, models.ScopeAdmin, h.CreateWebhook)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/admin/webhook/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/admin/webhook/" {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/deliveries") {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			AuthMiddleware(h.svc, models.ScopeAdmin, h.ListWebhookDeliveries)(w, r)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		AuthMiddleware(h.svc, models.ScopeAdmin, h.DeleteWebhook)(w, r)
 	})
 
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -5,6 +5,7 @@ import (
 	"backend-challenge/models"
 	"backend-challenge/service"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -14,6 +15,21 @@ import (
 	"go.uber.org/mock/gomock"
 )
 
+// expectTestAPIKeys resolves apitest to a customer key, admintest to an admin
+// key and stafftest to a key that manages orders
+func expectTestAPIKeys(m *mocks.MockDatabase) {
+	keys := map[string]*models.APIKey{
+		service.HashAPIKey("apitest"):   {ID: "demo", Scopes: []string{models.ScopeCreateOrder, models.ScopeReadOrders}},
+		service.HashAPIKey("admintest"): {ID: "admin", Scopes: []string{models.ScopeAdmin}},
+		service.HashAPIKey("stafftest"): {ID: "kitchen", Scopes: []string{models.ScopeManageOrders}},
+	}
+	m.EXPECT().GetAPIKeyByHash(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, hash string) (*models.APIKey, error) {
+			return keys[hash], nil
+		}).AnyTimes()
+	m.EXPECT().TouchAPIKey(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+}
+
 func TestRouter(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -29,7 +45,7 @@ func TestRouter(t *testing.T) {
 			method: "GET",
 			path:   "/api/product",
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetAllProducts(gomock.Any(), 0, 0).Return([]models.Product{}, nil)
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 0, 0).Return([]models.Product{}, nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
@@ -72,7 +88,8 @@ func TestRouter(t *testing.T) {
 			},
 			headers: map[string]string{"api_key": "apitest"},
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Name: "Test", Price: 10}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Name: "Test", Price: aud(1000)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
@@ -93,6 +110,190 @@ func TestRouter(t *testing.T) {
 			mockSetup:      func(m *mocks.MockDatabase) {},
 			expectedStatus: http.StatusUnauthorized,
 		},
+		{
+			name:    "GET /api/order/:id",
+			method:  "GET",
+			path:    "/api/order/abc",
+			headers: map[string]string{"api_key": "apitest"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(&models.Order{ID: "abc"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "GET /api/order/:id - missing auth",
+			method:         "GET",
+			path:           "/api/order/abc",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "DELETE /api/order/:id - wrong method",
+			method:         "DELETE",
+			path:           "/api/order/abc",
+			headers:        map[string]string{"api_key": "apitest"},
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "GET /api/order/ - trailing slash only",
+			method:         "GET",
+			path:           "/api/order/",
+			headers:        map[string]string{"api_key": "apitest"},
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:    "POST /api/admin/product",
+			method:  "POST",
+			path:    "/api/admin/product",
+			body:    models.Product{ID: "10", Name: "Lemon Tart", Category: "Tart", Price: aud(525)},
+			headers: map[string]string{"api_key": "admintest"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateProduct(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "POST /api/admin/product - customer key",
+			method:         "POST",
+			path:           "/api/admin/product",
+			body:           models.Product{ID: "10", Name: "Lemon Tart", Category: "Tart", Price: aud(525)},
+			headers:        map[string]string{"api_key": "apitest"},
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "POST /api/order - admin key",
+			method: "POST",
+			path:   "/api/order",
+			body: models.OrderReq{
+				Items: []models.OrderItem{{ProductID: "1", Quantity: 1}},
+			},
+			headers:        map[string]string{"api_key": "admintest"},
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "GET /api/admin/product - wrong method",
+			method:         "GET",
+			path:           "/api/admin/product",
+			headers:        map[string]string{"api_key": "admintest"},
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:    "DELETE /api/admin/product/:id",
+			method:  "DELETE",
+			path:    "/api/admin/product/1",
+			headers: map[string]string{"api_key": "admintest"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().DeleteProduct(gomock.Any(), "1").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "DELETE /api/admin/product/:id - missing auth",
+			method:         "DELETE",
+			path:           "/api/admin/product/1",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "GET /api/admin/product/:id - wrong method",
+			method:         "GET",
+			path:           "/api/admin/product/1",
+			headers:        map[string]string{"api_key": "admintest"},
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "PATCH /api/admin/product/ - trailing slash only",
+			method:         "PATCH",
+			path:           "/api/admin/product/",
+			headers:        map[string]string{"api_key": "admintest"},
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:    "GET /api/admin/coupon",
+			method:  "GET",
+			path:    "/api/admin/coupon",
+			headers: map[string]string{"api_key": "admintest"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().ListCoupons(gomock.Any(), 0, 0).Return([]models.Coupon{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "GET /api/admin/coupon - missing auth",
+			method:         "GET",
+			path:           "/api/admin/coupon",
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "PUT /api/admin/coupon - wrong method",
+			method:         "PUT",
+			path:           "/api/admin/coupon",
+			headers:        map[string]string{"api_key": "admintest"},
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:    "DELETE /api/admin/coupon/:code",
+			method:  "DELETE",
+			path:    "/api/admin/coupon/HAPPYHRS",
+			headers: map[string]string{"api_key": "admintest"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().DeactivateCoupon(gomock.Any(), "HAPPYHRS").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "DELETE /api/admin/coupon/ - trailing slash only",
+			method:         "DELETE",
+			path:           "/api/admin/coupon/",
+			headers:        map[string]string{"api_key": "admintest"},
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:    "PATCH /api/order/:id/status",
+			method:  "PATCH",
+			path:    "/api/order/abc/status",
+			body:    models.OrderStatusReq{Status: models.OrderAccepted},
+			headers: map[string]string{"api_key": "stafftest"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(&models.Order{ID: "abc", Status: models.OrderPlaced}, nil)
+				m.EXPECT().UpdateOrderStatus(gomock.Any(), "abc", gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ string, change models.OrderStatusChange) error {
+						if change.Actor != "kitchen" {
+							t.Errorf("Expected the staff key as actor, got %q", change.Actor)
+						}
+						return nil
+					})
+				m.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(&models.Order{ID: "abc", Status: models.OrderAccepted}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "PATCH /api/order/:id/status - customer key",
+			method:         "PATCH",
+			path:           "/api/order/abc/status",
+			body:           models.OrderStatusReq{Status: models.OrderCancelled},
+			headers:        map[string]string{"api_key": "apitest"},
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "GET /api/order/:id/status - wrong method",
+			method:         "GET",
+			path:           "/api/order/abc/status",
+			headers:        map[string]string{"api_key": "stafftest"},
+			mockSetup:      func(m *mocks.MockDatabase) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
 		{
 			name:           "POST /public/openapi.yaml - wrong method",
 			method:         "POST",
@@ -105,7 +306,7 @@ func TestRouter(t *testing.T) {
 			method: "GET",
 			path:   "/health",
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetAllProducts(gomock.Any(), 1, 0).Return([]models.Product{}, nil)
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 1, 0).Return([]models.Product{}, nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
@@ -114,7 +315,7 @@ func TestRouter(t *testing.T) {
 			method: "GET",
 			path:   "/health",
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetAllProducts(gomock.Any(), 1, 0).Return(nil, errors.New("db error"))
+				m.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 1, 0).Return(nil, errors.New("db error"))
 			},
 			expectedStatus: http.StatusServiceUnavailable,
 		},
@@ -133,6 +334,7 @@ func TestRouter(t *testing.T) {
 			defer ctrl.Finish()
 
 			mockDB := mocks.NewMockDatabase(ctrl)
+			expectTestAPIKeys(mockDB)
 			tt.mockSetup(mockDB)
 
 			svc := service.New(mockDB)
@@ -0,0 +1,293 @@
+// Package coupon finds valid coupon codes in the vendor couponbase files.
+//
+// A code is valid when it has an accepted length and appears in enough of the
+// files, as decided by a Policy. The files are too large to intersect in
+// memory, so Import streams each one concurrently into hash-partitioned shard
+// files on disk, then counts the files containing each code one shard at a
+// time. Peak memory is bounded by the size of a single shard rather than by
+// the size of the inputs.
+package coupon
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Options configures an import run
+type Options struct {
+	// Policy decides which codes are valid
+	Policy Policy
+
+	// Shards is the number of partitions codes are spread over on disk. More
+	// shards lower peak memory, but each input file keeps one shard file open
+	// per partition while it is being read.
+	Shards int
+
+	// TempDir holds the shard files; defaults to the system temp directory
+	TempDir string
+
+	// Logger receives progress messages when set
+	Logger *log.Logger
+}
+
+// DefaultOptions returns the default policy split over 128 shards
+func DefaultOptions() Options {
+	return Options{
+		Policy: DefaultPolicy(),
+		Shards: 128,
+	}
+}
+
+// Match is a valid code together with the sources it was found in
+type Match struct {
+	Code string
+	// Sources holds the base names of the files containing the code
+	Sources []string
+}
+
+// progressInterval is the number of lines read between progress messages
+const progressInterval = 5_000_000
+
+// Import reads the gzipped coupon files and calls emit for every code that has
+// a valid length and appears in at least opts.Policy.MinSources of them. Codes
+// are emitted sorted within each shard, but not globally.
+func Import(ctx context.Context, paths []string, opts Options, emit func(Match) error) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no coupon files given")
+	}
+	if len(paths) > 64 {
+		return fmt.Errorf("at most 64 coupon files are supported, got %d", len(paths))
+	}
+	if err := opts.Policy.Validate(); err != nil {
+		return err
+	}
+	if opts.Policy.MinSources > len(paths) {
+		return fmt.Errorf("codes must appear in %d sources but only %d files were given", opts.Policy.MinSources, len(paths))
+	}
+
+	sources := make([]string, len(paths))
+	seenSources := make(map[string]bool, len(paths))
+	for i, path := range paths {
+		sources[i] = filepath.Base(path)
+		if seenSources[sources[i]] {
+			return fmt.Errorf("duplicate source %s", sources[i])
+		}
+		seenSources[sources[i]] = true
+	}
+
+	if opts.Shards < 1 {
+		opts.Shards = 1
+	}
+
+	workDir, err := os.MkdirTemp(opts.TempDir, "coupon-import-")
+	if err != nil {
+		return fmt.Errorf("failed to create shard directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	if err := partitionFiles(ctx, paths, workDir, opts); err != nil {
+		return err
+	}
+
+	for shard := 0; shard < opts.Shards; shard++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := countShard(workDir, shard, sources, opts.Policy, emit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// partitionFiles streams every input file concurrently into its own set of shard files
+func partitionFiles(ctx context.Context, paths []string, workDir string, opts Options) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(paths))
+	for i, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = partitionFile(ctx, path, i, workDir, opts)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func partitionFile(ctx context.Context, path string, fileIdx int, workDir string, opts Options) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer gz.Close()
+
+	// Shard files are closed once written, since a failed close can mean lost
+	// data; the deferred close only covers files an early return leaves open
+	files := make([]*os.File, 0, opts.Shards)
+	defer func() {
+		for _, sf := range files {
+			sf.Close()
+		}
+	}()
+	shards := make([]*bufio.Writer, opts.Shards)
+	for n := range shards {
+		sf, err := os.Create(shardPath(workDir, fileIdx, n))
+		if err != nil {
+			return fmt.Errorf("failed to create shard file: %w", err)
+		}
+		files = append(files, sf)
+		shards[n] = bufio.NewWriter(sf)
+	}
+
+	reader := bufio.NewReaderSize(gz, 64*1024)
+	lines, kept := 0, 0
+	for {
+		line, err := readLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		lines++
+		if lines%progressInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			opts.logf("%s: %d lines, %d candidate codes", path, lines, kept)
+		}
+
+		code := strings.TrimSpace(line)
+		if !opts.Policy.ValidLength(code) {
+			continue
+		}
+		kept++
+		w := shards[shardOf(code, opts.Shards)]
+		_, err = w.WriteString(code)
+		if err == nil {
+			err = w.WriteByte('\n')
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write shard file: %w", err)
+		}
+	}
+
+	for n, w := range shards {
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to write shard file: %w", err)
+		}
+		if err := files[n].Close(); err != nil {
+			return fmt.Errorf("failed to close shard file: %w", err)
+		}
+	}
+
+	opts.logf("%s: done, %d lines, %d candidate codes", path, lines, kept)
+	return nil
+}
+
+// readLine returns the next line without its terminator. Lines too long for
+// the reader's buffer are read in full, since they must still be consumed.
+func readLine(r *bufio.Reader) (string, error) {
+	line, isPrefix, err := r.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if !isPrefix {
+		return string(line), nil
+	}
+
+	var sb strings.Builder
+	sb.Write(line)
+	for isPrefix {
+		line, isPrefix, err = r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		sb.Write(line)
+	}
+	return sb.String(), nil
+}
+
+// countShard loads one shard from every file and emits the codes found in enough of them
+func countShard(workDir string, shard int, sources []string, policy Policy, emit func(Match) error) error {
+	seen := make(map[string]uint64)
+	for fileIdx := range sources {
+		f, err := os.Open(shardPath(workDir, fileIdx, shard))
+		if err != nil {
+			return fmt.Errorf("failed to open shard file: %w", err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			seen[scanner.Text()] |= 1 << fileIdx
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read shard file: %w", err)
+		}
+	}
+
+	valid := make([]string, 0)
+	for code, mask := range seen {
+		if policy.EnoughSources(bits.OnesCount64(mask)) {
+			valid = append(valid, code)
+		}
+	}
+	sort.Strings(valid)
+
+	for _, code := range valid {
+		match := Match{Code: code}
+		for fileIdx, source := range sources {
+			if seen[code]&(1<<fileIdx) != 0 {
+				match.Sources = append(match.Sources, source)
+			}
+		}
+		if err := emit(match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func shardOf(code string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(code))
+	return int(h.Sum32() % uint32(shards))
+}
+
+func shardPath(workDir string, fileIdx, shard int) string {
+	return filepath.Join(workDir, fmt.Sprintf("%02d-%04d", fileIdx, shard))
+}
+
+func (o Options) logf(format string, args ...interface{}) {
+	if o.Logger != nil {
+		o.Logger.Printf(format, args...)
+	}
+}
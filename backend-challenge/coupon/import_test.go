@@ -0,0 +1,163 @@
+package coupon
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeGzip writes lines to a gzipped fixture file and returns its path
+func writeGzip(t *testing.T, dir, name string, lines []string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create fixture: %v", err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Failed to close fixture: %v", err)
+	}
+	return path
+}
+
+// importAll runs an import and returns the sources of each matched code
+func importAll(t *testing.T, paths []string, opts Options) map[string]string {
+	t.Helper()
+
+	matches := make(map[string]string)
+	err := Import(context.Background(), paths, opts, func(m Match) error {
+		matches[m.Code] = strings.Join(m.Sources, ",")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	return matches
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{
+		writeGzip(t, dir, "couponbase1.gz", []string{"HAPPYHRS", "FIFTYOFF", "SUPER100", "SHORT", "ONLYINONE1", "  BIRTHDAY  ", "HAPPYHRS"}),
+		writeGzip(t, dir, "couponbase2.gz", []string{"HAPPYHRS", "BIRTHDAY", "TOOLONGCODE1", "TOOLONGCODE1", "ONLYINTWO2"}),
+		writeGzip(t, dir, "couponbase3.gz", []string{"FIFTYOFF", "TOOLONGCODE1", "ONLYINTHREE", "", strings.Repeat("x", 200000)}),
+	}
+
+	tests := []struct {
+		name   string
+		shards int
+	}{
+		{"single shard", 1},
+		{"many shards", 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Shards = tt.shards
+			opts.TempDir = t.TempDir()
+
+			got := importAll(t, paths, opts)
+
+			want := map[string]string{
+				"BIRTHDAY": "couponbase1.gz,couponbase2.gz",
+				"FIFTYOFF": "couponbase1.gz,couponbase3.gz",
+				"HAPPYHRS": "couponbase1.gz,couponbase2.gz",
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Import() = %v, want %v", got, want)
+			}
+
+			// Shard files are removed once the import completes
+			entries, _ := os.ReadDir(opts.TempDir)
+			if len(entries) != 0 {
+				t.Errorf("Expected temp directory to be cleaned up, found %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestImport_Policy(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{
+		writeGzip(t, dir, "vendor1.gz", []string{"ALLFOUR", "THREEOFFOUR12", "TWO"}),
+		writeGzip(t, dir, "vendor2.gz", []string{"ALLFOUR", "THREEOFFOUR12", "TWO"}),
+		writeGzip(t, dir, "vendor3.gz", []string{"ALLFOUR", "THREEOFFOUR12"}),
+		writeGzip(t, dir, "vendor4.gz", []string{"ALLFOUR"}),
+	}
+
+	// 3-of-4 sources with 3-13 character codes
+	opts := DefaultOptions()
+	opts.Policy = Policy{MinLength: 3, MaxLength: 13, MinSources: 3}
+	opts.TempDir = t.TempDir()
+
+	got := importAll(t, paths, opts)
+
+	want := map[string]string{
+		"ALLFOUR":       "vendor1.gz,vendor2.gz,vendor3.gz,vendor4.gz",
+		"THREEOFFOUR12": "vendor1.gz,vendor2.gz,vendor3.gz",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Import() = %v, want %v", got, want)
+	}
+}
+
+func TestImport_InvalidOptions(t *testing.T) {
+	dir := t.TempDir()
+	path := writeGzip(t, dir, "couponbase1.gz", []string{"HAPPYHRS"})
+	other := writeGzip(t, dir, "couponbase2.gz", []string{"HAPPYHRS"})
+
+	tests := []struct {
+		name   string
+		paths  []string
+		modify func(*Options)
+	}{
+		{"no files", nil, func(o *Options) {}},
+		{"more files required than given", []string{path}, func(o *Options) {}},
+		{"bad length range", []string{path, other}, func(o *Options) { o.Policy.MinLength, o.Policy.MaxLength = 10, 8 }},
+		{"duplicate source", []string{path, path}, func(o *Options) {}},
+		{"missing file", []string{path, filepath.Join(dir, "missing.gz")}, func(o *Options) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.TempDir = t.TempDir()
+			tt.modify(&opts)
+
+			err := Import(context.Background(), tt.paths, opts, func(Match) error { return nil })
+			if err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestImport_Cancelled(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{
+		writeGzip(t, dir, "couponbase1.gz", []string{"HAPPYHRS"}),
+		writeGzip(t, dir, "couponbase2.gz", []string{"HAPPYHRS"}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opts := DefaultOptions()
+	opts.TempDir = t.TempDir()
+	err := Import(ctx, paths, opts, func(Match) error { return nil })
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package coupon
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Policy decides which codes count as valid coupons. It is shared by the
+// import, which applies it to the vendor files, and by the runtime validator.
+type Policy struct {
+	// MinLength and MaxLength bound the accepted code length, inclusive
+	MinLength int
+	MaxLength int
+
+	// MinSources is the number of source files a code must appear in
+	MinSources int
+}
+
+// DefaultPolicy returns the challenge rules: 8-10 characters, in at least two sources
+func DefaultPolicy() Policy {
+	return Policy{MinLength: 8, MaxLength: 10, MinSources: 2}
+}
+
+// PolicyFromEnv returns the default policy overridden by the COUPON_MIN_LENGTH,
+// COUPON_MAX_LENGTH and COUPON_MIN_SOURCES environment variables
+func PolicyFromEnv() (Policy, error) {
+	p := DefaultPolicy()
+	for name, field := range map[string]*int{
+		"COUPON_MIN_LENGTH":  &p.MinLength,
+		"COUPON_MAX_LENGTH":  &p.MaxLength,
+		"COUPON_MIN_SOURCES": &p.MinSources,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid %s %q: %w", name, value, err)
+		}
+		*field = n
+	}
+
+	if err := p.Validate(); err != nil {
+		return Policy{}, err
+	}
+	return p, nil
+}
+
+// Validate checks the policy is internally consistent
+func (p Policy) Validate() error {
+	if p.MinLength < 1 || p.MaxLength < p.MinLength {
+		return fmt.Errorf("invalid coupon length range %d-%d", p.MinLength, p.MaxLength)
+	}
+	if p.MinSources < 1 {
+		return fmt.Errorf("coupons must appear in at least 1 source, got %d", p.MinSources)
+	}
+	return nil
+}
+
+// ValidLength reports whether a code has an accepted length
+func (p Policy) ValidLength(code string) bool {
+	return len(code) >= p.MinLength && len(code) <= p.MaxLength
+}
+
+// EnoughSources reports whether a code found in n sources meets the threshold
+func (p Policy) EnoughSources(n int) bool {
+	return n >= p.MinSources
+}
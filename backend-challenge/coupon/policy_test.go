@@ -0,0 +1,60 @@
+package coupon
+
+import "testing"
+
+func TestPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    Policy
+		wantErr bool
+	}{
+		{"defaults", nil, Policy{MinLength: 8, MaxLength: 10, MinSources: 2}, false},
+		{
+			"campaign override",
+			map[string]string{"COUPON_MIN_LENGTH": "6", "COUPON_MAX_LENGTH": "12", "COUPON_MIN_SOURCES": "3"},
+			Policy{MinLength: 6, MaxLength: 12, MinSources: 3},
+			false,
+		},
+		{"not a number", map[string]string{"COUPON_MIN_SOURCES": "two"}, Policy{}, true},
+		{"inverted range", map[string]string{"COUPON_MIN_LENGTH": "12", "COUPON_MAX_LENGTH": "6"}, Policy{}, true},
+		{"zero sources", map[string]string{"COUPON_MIN_SOURCES": "0"}, Policy{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"COUPON_MIN_LENGTH", "COUPON_MAX_LENGTH", "COUPON_MIN_SOURCES"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			got, err := PolicyFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("PolicyFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_ValidLength(t *testing.T) {
+	p := Policy{MinLength: 6, MaxLength: 12, MinSources: 3}
+
+	for code, want := range map[string]bool{
+		"SHORT":         false,
+		"SIXSIX":        true,
+		"TWELVECHARS1":  true,
+		"THIRTEENCHARS": false,
+	} {
+		if got := p.ValidLength(code); got != want {
+			t.Errorf("ValidLength(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"backend-challenge/coupon"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+)
+
+// couponBatchSize is the number of codes written to the database per transaction
+const couponBatchSize = 1000
+
+// runCoupons handles the coupons subcommand:
+//
+//	backend-challenge coupons import [-db path] [-shards n] [-tmp dir] couponbase1.gz couponbase2.gz ...
+//
+// Which codes are valid is decided by the same coupon.PolicyFromEnv the server uses.
+func runCoupons(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "import" {
+		return fmt.Errorf("usage: backend-challenge coupons import [flags] FILE...")
+	}
+
+	policy, err := coupon.PolicyFromEnv()
+	if err != nil {
+		return err
+	}
+	opts := coupon.DefaultOptions()
+	opts.Policy = policy
+
+	fs := flag.NewFlagSet("coupons import", flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db", "data/store.db", "SQLite database path, or a sqlite:// or postgres:// DSN")
+	fs.IntVar(&opts.Shards, "shards", opts.Shards, "Number of on-disk partitions; more lowers peak memory")
+	fs.StringVar(&opts.TempDir, "tmp", "", "Directory for partition files (default system temp directory)")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no coupon files given")
+	}
+	opts.Logger = log.New(out, "", log.LstdFlags)
+
+	database, err := openMigrated(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	total := 0
+	batch := make([]coupon.Match, 0, couponBatchSize)
+	flush := func() error {
+		if err := database.InsertCoupons(ctx, batch); err != nil {
+			return err
+		}
+		total += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	err = coupon.Import(ctx, fs.Args(), opts, func(match coupon.Match) error {
+		batch = append(batch, match)
+		if len(batch) == couponBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import coupons: %w", err)
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("failed to import coupons: %w", err)
+	}
+
+	fmt.Fprintf(out, "Imported %d valid coupons into %s\n", total, *dbPath)
+	return nil
+}
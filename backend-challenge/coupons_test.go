@@ -0,0 +1,60 @@
+package main
+
+import (
+	"backend-challenge/db"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCouponFile(t *testing.T, dir, name string, codes ...string) string {
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write([]byte(strings.Join(codes, "\n")))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return path
+}
+
+func TestRunCoupons_Import(t *testing.T) {
+	dbPath := copyTestDB(t)
+	dir := t.TempDir()
+	files := []string{
+		writeCouponFile(t, dir, "couponbase1.gz", "NEWCODE1", "NEWCODE2", "HAPPYHRS"),
+		writeCouponFile(t, dir, "couponbase2.gz", "NEWCODE1", "HAPPYHRS", "SHORT"),
+		writeCouponFile(t, dir, "couponbase3.gz", "NEWCODE2", "LONELYCODE"),
+	}
+
+	var out bytes.Buffer
+	args := append([]string{"import", "-db", dbPath, "-shards", "4", "-tmp", dir}, files...)
+	require.NoError(t, runCoupons(context.Background(), args, &out))
+	assert.Contains(t, out.String(), "Imported 3 valid coupons")
+
+	database, err := db.Open(dbPath)
+	require.NoError(t, err)
+	defer database.Close()
+
+	for code, want := range map[string]bool{"NEWCODE1": true, "NEWCODE2": true, "HAPPYHRS": true, "LONELYCODE": false} {
+		valid, err := database.IsCouponValid(context.Background(), code)
+		require.NoError(t, err)
+		assert.Equal(t, want, valid, code)
+	}
+}
+
+func TestRunCoupons_Usage(t *testing.T) {
+	var out bytes.Buffer
+	assert.Error(t, runCoupons(context.Background(), nil, &out))
+	assert.Error(t, runCoupons(context.Background(), []string{"export"}, &out))
+	assert.Error(t, runCoupons(context.Background(), []string{"import"}, &out))
+}
@@ -0,0 +1,48 @@
+-- Demo data: the coupons, products and API key of the example store. Load it
+-- into a database the migrations have built, as make init does.
+-- Run: sqlite3 data/store.db < data/seed.sql, or psql "$DSN" -f data/seed.sql
+
+-- Insert valid coupons (from coupon processing)
+INSERT INTO valid_coupons (code) VALUES ('BIRTHDAY');
+INSERT INTO valid_coupons (code) VALUES ('BUYGETON');
+INSERT INTO valid_coupons (code) VALUES ('FIFTYOFF');
+INSERT INTO valid_coupons (code) VALUES ('FREEZAAA');
+INSERT INTO valid_coupons (code) VALUES ('GNULINUX');
+INSERT INTO valid_coupons (code) VALUES ('HAPPYHRS');
+INSERT INTO valid_coupons (code) VALUES ('OVER9000');
+INSERT INTO valid_coupons (code) VALUES ('SIXTYOFF');
+
+-- Insert coupon rules
+INSERT INTO coupon_rules (code, rule_type, value, amount, product_id, min_subtotal) VALUES ('BIRTHDAY', 'free_item', 0, 0, '7', 0);
+INSERT INTO coupon_rules (code, rule_type, value, amount, product_id, min_subtotal) VALUES ('BUYGETON', 'cheapest_free', 0, 0, NULL, 0);
+INSERT INTO coupon_rules (code, rule_type, value, amount, product_id, min_subtotal) VALUES ('FIFTYOFF', 'percentage', 50, 0, NULL, 0);
+INSERT INTO coupon_rules (code, rule_type, value, amount, product_id, min_subtotal) VALUES ('FREEZAAA', 'free_item', 0, 0, '5', 0);
+INSERT INTO coupon_rules (code, rule_type, value, amount, product_id, min_subtotal) VALUES ('GNULINUX', 'percentage', 10, 0, NULL, 0);
+INSERT INTO coupon_rules (code, rule_type, value, amount, product_id, min_subtotal) VALUES ('HAPPYHRS', 'percentage', 18, 0, NULL, 0);
+INSERT INTO coupon_rules (code, rule_type, value, amount, product_id, min_subtotal) VALUES ('OVER9000', 'fixed_amount', 0, 1000, NULL, 9000);
+INSERT INTO coupon_rules (code, rule_type, value, amount, product_id, min_subtotal) VALUES ('SIXTYOFF', 'percentage', 60, 0, NULL, 5000);
+
+-- Insert products
+INSERT INTO products (id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop) VALUES ('1', 'Waffle with Berries', 'Waffle', 650, 'https://orderfoodonline.deno.dev/public/images/image-waffle-thumbnail.jpg', 'https://orderfoodonline.deno.dev/public/images/image-waffle-mobile.jpg', 'https://orderfoodonline.deno.dev/public/images/image-waffle-tablet.jpg', 'https://orderfoodonline.deno.dev/public/images/image-waffle-desktop.jpg');
+INSERT INTO products (id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop) VALUES ('2', 'Vanilla Bean Crème Brûlée', 'Crème Brûlée', 700, 'https://orderfoodonline.deno.dev/public/images/image-creme-brulee-thumbnail.jpg', 'https://orderfoodonline.deno.dev/public/images/image-creme-brulee-mobile.jpg', 'https://orderfoodonline.deno.dev/public/images/image-creme-brulee-tablet.jpg', 'https://orderfoodonline.deno.dev/public/images/image-creme-brulee-desktop.jpg');
+INSERT INTO products (id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop) VALUES ('3', 'Macaron Mix of Five', 'Macaron', 800, 'https://orderfoodonline.deno.dev/public/images/image-macaron-thumbnail.jpg', 'https://orderfoodonline.deno.dev/public/images/image-macaron-mobile.jpg', 'https://orderfoodonline.deno.dev/public/images/image-macaron-tablet.jpg', 'https://orderfoodonline.deno.dev/public/images/image-macaron-desktop.jpg');
+INSERT INTO products (id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop) VALUES ('4', 'Classic Tiramisu', 'Tiramisu', 550, 'https://orderfoodonline.deno.dev/public/images/image-tiramisu-thumbnail.jpg', 'https://orderfoodonline.deno.dev/public/images/image-tiramisu-mobile.jpg', 'https://orderfoodonline.deno.dev/public/images/image-tiramisu-tablet.jpg', 'https://orderfoodonline.deno.dev/public/images/image-tiramisu-desktop.jpg');
+INSERT INTO products (id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop) VALUES ('5', 'Pistachio Baklava', 'Baklava', 400, 'https://orderfoodonline.deno.dev/public/images/image-baklava-thumbnail.jpg', 'https://orderfoodonline.deno.dev/public/images/image-baklava-mobile.jpg', 'https://orderfoodonline.deno.dev/public/images/image-baklava-tablet.jpg', 'https://orderfoodonline.deno.dev/public/images/image-baklava-desktop.jpg');
+INSERT INTO products (id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop) VALUES ('6', 'Lemon Meringue Pie', 'Pie', 500, 'https://orderfoodonline.deno.dev/public/images/image-meringue-thumbnail.jpg', 'https://orderfoodonline.deno.dev/public/images/image-meringue-mobile.jpg', 'https://orderfoodonline.deno.dev/public/images/image-meringue-tablet.jpg', 'https://orderfoodonline.deno.dev/public/images/image-meringue-desktop.jpg');
+INSERT INTO products (id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop) VALUES ('7', 'Red Velvet Cake', 'Cake', 450, 'https://orderfoodonline.deno.dev/public/images/image-cake-thumbnail.jpg', 'https://orderfoodonline.deno.dev/public/images/image-cake-mobile.jpg', 'https://orderfoodonline.deno.dev/public/images/image-cake-tablet.jpg', 'https://orderfoodonline.deno.dev/public/images/image-cake-desktop.jpg');
+INSERT INTO products (id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop) VALUES ('8', 'Salted Caramel Brownie', 'Brownie', 450, 'https://orderfoodonline.deno.dev/public/images/image-brownie-thumbnail.jpg', 'https://orderfoodonline.deno.dev/public/images/image-brownie-mobile.jpg', 'https://orderfoodonline.deno.dev/public/images/image-brownie-tablet.jpg', 'https://orderfoodonline.deno.dev/public/images/image-brownie-desktop.jpg');
+INSERT INTO products (id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop) VALUES ('9', 'Vanilla Panna Cotta', 'Panna Cotta', 650, 'https://orderfoodonline.deno.dev/public/images/image-panna-cotta-thumbnail.jpg', 'https://orderfoodonline.deno.dev/public/images/image-panna-cotta-mobile.jpg', 'https://orderfoodonline.deno.dev/public/images/image-panna-cotta-tablet.jpg', 'https://orderfoodonline.deno.dev/public/images/image-panna-cotta-desktop.jpg');
+
+-- Insert the New Zealand store's prices; the UK prices are converted
+INSERT INTO product_prices (product_id, currency, price) VALUES ('1', 'NZD', 750);
+INSERT INTO product_prices (product_id, currency, price) VALUES ('2', 'NZD', 800);
+INSERT INTO product_prices (product_id, currency, price) VALUES ('3', 'NZD', 900);
+INSERT INTO product_prices (product_id, currency, price) VALUES ('4', 'NZD', 600);
+INSERT INTO product_prices (product_id, currency, price) VALUES ('5', 'NZD', 450);
+INSERT INTO product_prices (product_id, currency, price) VALUES ('6', 'NZD', 550);
+INSERT INTO product_prices (product_id, currency, price) VALUES ('7', 'NZD', 500);
+INSERT INTO product_prices (product_id, currency, price) VALUES ('8', 'NZD', 500);
+INSERT INTO product_prices (product_id, currency, price) VALUES ('9', 'NZD', 750);
+
+-- Insert the demo API key "apitest"
+INSERT INTO api_keys (id, key_hash, owner, scopes, created_at) VALUES ('demo', 'e81cbf18a5239377aa4972773d34cc2b81ebc672879581bce29a0a4c414bf117', 'demo', 'create_order read_orders', '2025-01-01 00:00:00+00:00');
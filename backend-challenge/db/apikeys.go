@@ -0,0 +1,161 @@
+package db
+
+import (
+	"backend-challenge/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// apiKeyColumns selects an API key in the order scanAPIKey expects
+const apiKeyColumns = `id, owner, scopes, disabled, created_at, expires_at, last_used_at, replaced_by FROM api_keys`
+
+func (db *DB) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` WHERE key_hash = ?`
+
+	key, err := scanAPIKey(db.QueryRowContext(ctx, query, keyHash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	return key, nil
+}
+
+func (db *DB) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` WHERE id = ?`
+
+	key, err := scanAPIKey(db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns every key, including disabled and expired ones, oldest first
+func (db *DB) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` ORDER BY created_at, id`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list api keys: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, rows.Err()
+}
+
+// CreateAPIKey stores a key under its hash. The key itself is never stored.
+func (db *DB) CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error {
+	return createAPIKey(ctx, db.DB, key, keyHash)
+}
+
+// DisableAPIKey revokes a key immediately
+func (db *DB) DisableAPIKey(ctx context.Context, id string) error {
+	res, err := db.ExecContext(ctx, `UPDATE api_keys SET disabled = TRUE WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to disable api key: %w", err)
+	}
+	return requireRow(res, ErrAPIKeyNotFound)
+}
+
+// RotateAPIKey stores newKey as the replacement for the enabled key oldID,
+// which keeps working until oldExpiresAt, or its own expiry if that is sooner
+func (db *DB) RotateAPIKey(ctx context.Context, oldID string, newKey *models.APIKey, newHash string, oldExpiresAt time.Time) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin api key transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	old, err := scanAPIKey(tx.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` WHERE id = ?`, oldID))
+	if err == sql.ErrNoRows || (err == nil && old.Disabled) {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get api key: %w", err)
+	}
+	if old.ExpiresAt != nil && old.ExpiresAt.Before(oldExpiresAt) {
+		oldExpiresAt = *old.ExpiresAt
+	}
+
+	if err := createAPIKey(ctx, tx, newKey, newHash); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE api_keys SET replaced_by = ?, expires_at = ? WHERE id = ?`,
+		newKey.ID, oldExpiresAt, oldID)
+	if err != nil {
+		return fmt.Errorf("failed to rotate api key: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit api key rotation: %w", err)
+	}
+	return nil
+}
+
+// TouchAPIKey records when a key was last used
+func (db *DB) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	_, err := db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = ? WHERE id = ?`, usedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to record api key use: %w", err)
+	}
+	return nil
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func createAPIKey(ctx context.Context, exec execer, key *models.APIKey, keyHash string) error {
+	query := `INSERT INTO api_keys (id, key_hash, owner, scopes, disabled, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (key_hash) DO NOTHING`
+
+	res, err := exec.ExecContext(ctx, query, key.ID, keyHash, key.Owner,
+		strings.Join(key.Scopes, " "), key.Disabled, key.CreatedAt, nullTime(key.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+	return requireRow(res, ErrAPIKeyExists)
+}
+
+// scanAPIKey scans apiKeyColumns into an APIKey
+func scanAPIKey(scanner rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+	var replacedBy sql.NullString
+	err := scanner.Scan(&key.ID, &key.Owner, &scopes, &key.Disabled, &key.CreatedAt,
+		&expiresAt, &lastUsedAt, &replacedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Fields(scopes)
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	key.ReplacedBy = replacedBy.String
+
+	return &key, nil
+}
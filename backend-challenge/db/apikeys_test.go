@@ -0,0 +1,146 @@
+package db
+
+import (
+	"backend-challenge/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// apitestHash is the SHA-256 of the seeded demo key "apitest"
+const apitestHash = "e81cbf18a5239377aa4972773d34cc2b81ebc672879581bce29a0a4c414bf117"
+
+func TestGetAPIKeyByHash(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	key, err := db.GetAPIKeyByHash(ctx, apitestHash)
+	if err != nil {
+		t.Fatalf("Failed to get api key: %v", err)
+	}
+	if key == nil || key.ID != "demo" || key.Disabled {
+		t.Fatalf("Expected enabled demo key, got %+v", key)
+	}
+	if !key.HasScope(models.ScopeCreateOrder) || !key.HasScope(models.ScopeReadOrders) || key.HasScope(models.ScopeAdmin) {
+		t.Errorf("Unexpected scopes: %v", key.Scopes)
+	}
+
+	key, err = db.GetAPIKeyByHash(ctx, "unknown")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if key != nil {
+		t.Errorf("Expected nil for unknown key, got %+v", key)
+	}
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	key := &models.APIKey{
+		ID:        "ops",
+		Owner:     "ops team",
+		Scopes:    []string{models.ScopeAdmin, models.ScopeReadOrders},
+		Disabled:  true,
+		CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := db.CreateAPIKey(ctx, key, "ops-hash"); err != nil {
+		t.Fatalf("Failed to create api key: %v", err)
+	}
+
+	saved, err := db.GetAPIKeyByHash(ctx, "ops-hash")
+	if err != nil {
+		t.Fatalf("Failed to get api key: %v", err)
+	}
+	if saved == nil || saved.Owner != "ops team" || !saved.Disabled || len(saved.Scopes) != 2 || !saved.CreatedAt.Equal(key.CreatedAt) {
+		t.Errorf("API key mismatch: got %+v", saved)
+	}
+
+	key.ID = "ops-2"
+	if err := db.CreateAPIKey(ctx, key, "ops-hash"); !errors.Is(err, ErrAPIKeyExists) {
+		t.Errorf("Expected ErrAPIKeyExists, got %v", err)
+	}
+}
+
+func TestDisableAPIKey(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	if err := db.DisableAPIKey(ctx, "demo"); err != nil {
+		t.Fatalf("Failed to disable api key: %v", err)
+	}
+	key, err := db.GetAPIKey(ctx, "demo")
+	if err != nil {
+		t.Fatalf("Failed to get api key: %v", err)
+	}
+	if key == nil || !key.Disabled {
+		t.Errorf("Expected disabled key, got %+v", key)
+	}
+
+	if err := db.DisableAPIKey(ctx, "missing"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Expected ErrAPIKeyNotFound, got %v", err)
+	}
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	next := &models.APIKey{ID: "next", Owner: "demo", Scopes: []string{models.ScopeCreateOrder}, CreatedAt: now}
+	if err := db.RotateAPIKey(ctx, "demo", next, "next-hash", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to rotate api key: %v", err)
+	}
+
+	old, err := db.GetAPIKey(ctx, "demo")
+	if err != nil {
+		t.Fatalf("Failed to get api key: %v", err)
+	}
+	if old.ReplacedBy != "next" || old.ExpiresAt == nil || !old.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected old key to expire after the overlap, got %+v", old)
+	}
+	if saved, err := db.GetAPIKeyByHash(ctx, "next-hash"); err != nil || saved == nil || saved.ID != "next" {
+		t.Errorf("Expected new key to be stored, got %+v, %v", saved, err)
+	}
+
+	// A longer overlap never extends the old key's expiry
+	later := &models.APIKey{ID: "later", Owner: "demo", Scopes: []string{models.ScopeCreateOrder}, CreatedAt: now}
+	if err := db.RotateAPIKey(ctx, "demo", later, "later-hash", now.Add(48*time.Hour)); err != nil {
+		t.Fatalf("Failed to rotate api key: %v", err)
+	}
+	old, err = db.GetAPIKey(ctx, "demo")
+	if err != nil {
+		t.Fatalf("Failed to get api key: %v", err)
+	}
+	if !old.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected expiry to stay at %v, got %v", now.Add(time.Hour), old.ExpiresAt)
+	}
+
+	missing := &models.APIKey{ID: "orphan", Owner: "demo", Scopes: []string{models.ScopeCreateOrder}, CreatedAt: now}
+	if err := db.RotateAPIKey(ctx, "missing", missing, "orphan-hash", now); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Expected ErrAPIKeyNotFound, got %v", err)
+	}
+	if key, _ := db.GetAPIKey(ctx, "orphan"); key != nil {
+		t.Errorf("Expected failed rotation to be rolled back, got %+v", key)
+	}
+}
+
+func TestTouchAPIKey(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	usedAt := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	if err := db.TouchAPIKey(ctx, "demo", usedAt); err != nil {
+		t.Fatalf("Failed to touch api key: %v", err)
+	}
+
+	keys, err := db.ListAPIKeys(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list api keys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].LastUsedAt == nil || !keys[0].LastUsedAt.Equal(usedAt) {
+		t.Errorf("Expected demo key last used at %v, got %+v", usedAt, keys)
+	}
+}
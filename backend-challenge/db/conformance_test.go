@@ -0,0 +1,53 @@
+package db_test
+
+import (
+	"backend-challenge/db"
+	"backend-challenge/db/dbtest"
+	"backend-challenge/db/pgtest"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// Both backends queue webhooks, so the suite checks their deliveries too
+var (
+	_ dbtest.WebhookStore = (*db.DB)(nil)
+	_ dbtest.WebhookStore = (*db.Memory)(nil)
+)
+
+// migrated opens dsn and brings it to the latest schema
+func migrated(t *testing.T, dsn string) db.Database {
+	t.Helper()
+	database, err := db.Open(dsn)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+	if _, err := database.Migrate(context.Background(), db.LatestSchemaVersion()); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return database
+}
+
+func TestConformance_SQLite(t *testing.T) {
+	dbtest.RunConformance(t, func(t *testing.T) db.Database {
+		return migrated(t, filepath.Join(t.TempDir(), "test.db"))
+	})
+}
+
+func TestConformance_Postgres(t *testing.T) {
+	if !pgtest.Enabled() {
+		t.Skipf("%s is not set", pgtest.EnvVar)
+	}
+	dbtest.RunConformance(t, func(t *testing.T) db.Database {
+		return migrated(t, pgtest.DSN(t))
+	})
+}
+
+func TestConformance_Memory(t *testing.T) {
+	dbtest.RunConformance(t, func(t *testing.T) db.Database {
+		return db.NewMemory()
+	})
+}
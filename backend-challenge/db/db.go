@@ -1,8 +1,12 @@
 package db
 
 import (
+	"backend-challenge/coupon"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -10,10 +14,62 @@ import (
 
 type DB struct {
 	*sql.DB
+	dialect      *dialect
+	couponPolicy coupon.Policy
 }
 
+// dialect holds what differs between the SQL databases DB runs on. Queries
+// are otherwise written once, in SQL both accept, with ? placeholders.
+type dialect struct {
+	name       string
+	migrations []Migration
+	// lockRows ends a SELECT of rows the transaction goes on to check and
+	// write, so concurrent transactions wait for it rather than read them
+	lockRows string
+	// tableExists and columnExists count the tables, or a table's columns,
+	// with a name
+	tableExists  string
+	columnExists string
+	// textOrder follows a text column in ORDER BY to sort it by bytes, as
+	// SQLite and Go do, rather than by the database's locale
+	textOrder string
+}
+
+// sqlite needs no row locks: transactions begin immediate, taking the write
+// lock for the whole database up front
+var sqlite = &dialect{
+	name:         "sqlite",
+	migrations:   mustLoadMigrations(migrationFiles, "migrations/sqlite"),
+	tableExists:  `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`,
+	columnExists: `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`,
+}
+
+// Open opens the database named by dsn: a postgres:// or postgresql:// URL
+// for Postgres, or a sqlite:// URL or plain file path for SQLite
+func Open(dsn string) (*DB, error) {
+	scheme, rest, found := strings.Cut(dsn, "://")
+	if !found {
+		return New(dsn)
+	}
+	switch scheme {
+	case "sqlite":
+		return New(rest)
+	case "postgres", "postgresql":
+		return NewPostgres(dsn)
+	case "memory":
+		// See NewMemory; only the server can run on a database that goes
+		// away when it exits
+		return nil, errors.New("memory:// databases can only be used by the server")
+	}
+	return nil, fmt.Errorf("unsupported database %q: use a sqlite:// or postgres:// DSN, or a SQLite file path", scheme+"://")
+}
+
+// New opens the SQLite database at dbPath. It refuses databases whose schema
+// is newer than this binary's; older ones are brought up to date with Migrate.
 func New(dbPath string) (*DB, error) {
-	sqlDB, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000")
+	// Immediate transactions take the write lock up front so concurrent order
+	// transactions wait on the busy timeout instead of failing to upgrade
+	sqlDB, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -24,9 +80,25 @@ func New(dbPath string) (*DB, error) {
 	sqlDB.SetConnMaxLifetime(5 * time.Minute)
 	sqlDB.SetConnMaxIdleTime(30 * time.Second) // Close idle connections after 30s
 
+	return open(sqlDB, sqlite)
+}
+
+// open checks the connection and the schema version of a newly opened database
+func open(sqlDB *sql.DB, d *dialect) (*DB, error) {
 	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &DB{sqlDB}, nil
+	db := &DB{DB: sqlDB, dialect: d, couponPolicy: coupon.DefaultPolicy()}
+	if err := db.checkSchemaVersion(context.Background()); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// SetCouponPolicy replaces the policy IsCouponValid enforces
+func (db *DB) SetCouponPolicy(policy coupon.Policy) {
+	db.couponPolicy = policy
 }
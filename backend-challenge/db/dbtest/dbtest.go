@@ -0,0 +1,783 @@
+// Package dbtest checks db.Database implementations against the contract the
+// service layer relies on. Every backend runs the same suite, so a new one is
+// covered by adding a factory for it:
+//
+//	func TestConformance(t *testing.T) {
+//		dbtest.RunConformance(t, func(t *testing.T) db.Database { ... })
+//	}
+//
+// Backends that also implement WebhookStore are checked as the outbox
+// dispatcher and webhook sender use them.
+package dbtest
+
+import (
+	"backend-challenge/db"
+	"backend-challenge/models"
+	"backend-challenge/money"
+	"backend-challenge/outbox"
+	"backend-challenge/webhook"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// WebhookStore is the outbox and webhook delivery queue the server runs on
+// top of a db.Database
+type WebhookStore interface {
+	outbox.Store
+	webhook.DeliveryQueue
+	webhook.Store
+}
+
+// Factory returns a new, empty database at the latest schema version with
+// the default coupon policy. It registers any cleanup with t.
+type Factory func(t *testing.T) db.Database
+
+// RunConformance runs the contract checks as subtests, each on a database
+// of its own from newDB
+func RunConformance(t *testing.T, newDB Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, d db.Database)
+	}{
+		{"Products", testProducts},
+		{"MissingIDs", testMissingIDs},
+		{"Pagination", testPagination},
+		{"ProductFilters", testProductFilters},
+		{"CouponCodeLength", testCouponCodeLength},
+		{"Orders", testOrders},
+		{"IdempotencyKeys", testIdempotencyKeys},
+		{"WebhookDeliveries", testWebhookDeliveries},
+		{"ContextCancellation", testContextCancellation},
+		{"ConcurrentOrders", testConcurrentOrders},
+		{"ConcurrentRedemptions", testConcurrentRedemptions},
+		{"ConcurrentIdempotencyKeys", testConcurrentIdempotencyKeys},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newDB(t))
+		})
+	}
+}
+
+// idempotentRequest returns an in-flight request for key made at createdAt
+func idempotentRequest(key, fingerprint string, createdAt time.Time) *models.IdempotentRequest {
+	return &models.IdempotentRequest{
+		APIKeyID:    "key-1",
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   createdAt,
+		ExpiresAt:   createdAt.Add(24 * time.Hour),
+	}
+}
+
+func aud(cents int64) money.Money {
+	return money.New(cents, money.DefaultCurrency)
+}
+
+// newProduct returns a product with every field set; nil stock is untracked
+func newProduct(id string, stock *int) *models.Product {
+	return &models.Product{
+		ID:          id,
+		Name:        "Product " + id,
+		Category:    "Waffle",
+		Price:       aud(650),
+		Prices:      map[string]money.Money{"NZD": money.New(750, "NZD")},
+		TaxCategory: "standard",
+		Stock:       stock,
+		Image: &models.ProductImage{
+			Thumbnail: "https://example.com/" + id + "-thumbnail.jpg",
+			Mobile:    "https://example.com/" + id + "-mobile.jpg",
+			Tablet:    "https://example.com/" + id + "-tablet.jpg",
+			Desktop:   "https://example.com/" + id + "-desktop.jpg",
+		},
+	}
+}
+
+func createProduct(t *testing.T, d db.Database, id string, stock *int) {
+	t.Helper()
+	if err := d.CreateProduct(context.Background(), newProduct(id, stock)); err != nil {
+		t.Fatalf("CreateProduct(%s) failed: %v", id, err)
+	}
+}
+
+func createCoupon(t *testing.T, d db.Database, c models.Coupon) {
+	t.Helper()
+	if err := d.CreateCoupon(context.Background(), &c); err != nil {
+		t.Fatalf("CreateCoupon(%s) failed: %v", c.Code, err)
+	}
+}
+
+// newOrder returns a placed order for one unit of the product
+func newOrder(id, productID, couponCode, customerID string) *models.Order {
+	at := time.Now().UTC().Truncate(time.Second)
+	return &models.Order{
+		ID:         id,
+		CouponCode: couponCode,
+		CustomerID: customerID,
+		Items:      []models.OrderItem{{ProductID: productID, Quantity: 1}},
+		Lines:      []models.OrderLine{{ProductID: productID, Quantity: 1, UnitPrice: aud(650), Amount: aud(650), Tax: aud(0)}},
+		Subtotal:   aud(650),
+		Total:      aud(650),
+		Status:     models.OrderPlaced,
+		History:    []models.OrderStatusChange{{To: models.OrderPlaced, At: at}},
+		CreatedAt:  at,
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func testProducts(t *testing.T, d db.Database) {
+	ctx := context.Background()
+	want := newProduct("1", intPtr(3))
+	if err := d.CreateProduct(ctx, want); err != nil {
+		t.Fatalf("CreateProduct failed: %v", err)
+	}
+
+	got, err := d.GetProductByID(ctx, "1")
+	if err != nil || got == nil {
+		t.Fatalf("GetProductByID = %+v, %v", got, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetProductByID = %+v\nwant %+v", got, want)
+	}
+
+	if err := d.CreateProduct(ctx, newProduct("1", nil)); !errors.Is(err, db.ErrProductExists) {
+		t.Errorf("CreateProduct with a taken ID: expected ErrProductExists, got %v", err)
+	}
+
+	// Without URLs there is no image
+	want.Name, want.Image, want.Prices = "Renamed", nil, nil
+	if err := d.UpdateProduct(ctx, want); err != nil {
+		t.Fatalf("UpdateProduct failed: %v", err)
+	}
+	got, _ = d.GetProductByID(ctx, "1")
+	if got == nil || got.Name != "Renamed" || got.Image != nil || len(got.Prices) != 0 || *got.Stock != 3 {
+		t.Errorf("after UpdateProduct got %+v", got)
+	}
+
+	if err := d.SetProductStock(ctx, "1", intPtr(0)); err != nil {
+		t.Fatalf("SetProductStock failed: %v", err)
+	}
+	got, _ = d.GetProductByID(ctx, "1")
+	if got == nil || *got.Stock != 0 || !got.SoldOut {
+		t.Errorf("after selling out got %+v", got)
+	}
+
+	// Deleted products keep their ID
+	if err := d.DeleteProduct(ctx, "1"); err != nil {
+		t.Fatalf("DeleteProduct failed: %v", err)
+	}
+	if got, err := d.GetProductByID(ctx, "1"); got != nil || err != nil {
+		t.Errorf("GetProductByID of a deleted product = %+v, %v; want nil, nil", got, err)
+	}
+	if products, err := d.GetAllProducts(ctx, models.ProductFilter{}, 0, 0); err != nil || len(products) != 0 {
+		t.Errorf("GetAllProducts after delete = %+v, %v", products, err)
+	}
+	if err := d.CreateProduct(ctx, newProduct("1", nil)); !errors.Is(err, db.ErrProductExists) {
+		t.Errorf("CreateProduct with a deleted ID: expected ErrProductExists, got %v", err)
+	}
+	if err := d.DeleteProduct(ctx, "1"); !errors.Is(err, db.ErrProductNotFound) {
+		t.Errorf("DeleteProduct twice: expected ErrProductNotFound, got %v", err)
+	}
+}
+
+func testMissingIDs(t *testing.T, d db.Database) {
+	ctx := context.Background()
+
+	if p, err := d.GetProductByID(ctx, "missing"); p != nil || err != nil {
+		t.Errorf("GetProductByID = %+v, %v; want nil, nil", p, err)
+	}
+	if c, err := d.GetCoupon(ctx, "MISSING1"); c != nil || err != nil {
+		t.Errorf("GetCoupon = %+v, %v; want nil, nil", c, err)
+	}
+	if o, err := d.GetOrderByID(ctx, "missing"); o != nil || err != nil {
+		t.Errorf("GetOrderByID = %+v, %v; want nil, nil", o, err)
+	}
+	if k, err := d.GetAPIKeyByHash(ctx, "missing"); k != nil || err != nil {
+		t.Errorf("GetAPIKeyByHash = %+v, %v; want nil, nil", k, err)
+	}
+	if n, err := d.CountCustomerRedemptions(ctx, "MISSING1", "alice"); n != 0 || err != nil {
+		t.Errorf("CountCustomerRedemptions = %d, %v; want 0, nil", n, err)
+	}
+	if ok, err := d.IsCouponValid(ctx, "MISSING1"); ok || err != nil {
+		t.Errorf("IsCouponValid = %v, %v; want false, nil", ok, err)
+	}
+
+	writes := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"UpdateProduct", d.UpdateProduct(ctx, newProduct("missing", nil)), db.ErrProductNotFound},
+		{"SetProductStock", d.SetProductStock(ctx, "missing", intPtr(1)), db.ErrProductNotFound},
+		{"DeleteProduct", d.DeleteProduct(ctx, "missing"), db.ErrProductNotFound},
+		{"DeactivateCoupon", d.DeactivateCoupon(ctx, "MISSING1"), db.ErrCouponNotFound},
+		{"UpdateOrderStatus", d.UpdateOrderStatus(ctx, "missing", models.OrderStatusChange{
+			From: models.OrderPlaced, To: models.OrderCancelled, At: time.Now().UTC()}), db.ErrOrderNotFound},
+		{"DeleteWebhook", d.DeleteWebhook(ctx, "missing"), db.ErrWebhookNotFound},
+	}
+	for _, w := range writes {
+		if !errors.Is(w.err, w.want) {
+			t.Errorf("%s: expected %v, got %v", w.name, w.want, w.err)
+		}
+	}
+	if _, err := d.ListWebhookDeliveries(ctx, "missing", 0, 0); !errors.Is(err, db.ErrWebhookNotFound) {
+		t.Errorf("ListWebhookDeliveries: expected ErrWebhookNotFound, got %v", err)
+	}
+}
+
+// pageCases are the limits and offsets checked against a listing of five
+// items, with the positions each page should hold
+var pageCases = []struct {
+	limit, offset int
+	want          []int
+}{
+	{0, 0, []int{0, 1, 2, 3, 4}},
+	{0, 3, []int{0, 1, 2, 3, 4}}, // offset needs a limit
+	{-1, 0, []int{0, 1, 2, 3, 4}},
+	{2, 0, []int{0, 1}},
+	{2, 2, []int{2, 3}},
+	{2, 4, []int{4}},
+	{2, 5, nil},
+	{2, 50, nil},
+	{10, 1, []int{1, 2, 3, 4}},
+	{2, -1, []int{0, 1}}, // a negative offset counts as zero
+}
+
+func testPagination(t *testing.T, d db.Database) {
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		createProduct(t, d, fmt.Sprint(i), nil)
+		createCoupon(t, d, models.Coupon{Code: fmt.Sprintf("COUPON%02d", i)})
+	}
+
+	products, err := d.GetAllProducts(ctx, models.ProductFilter{}, 0, 0)
+	if err != nil || len(products) != 5 {
+		t.Fatalf("GetAllProducts = %d products, %v; want 5", len(products), err)
+	}
+	coupons, err := d.ListCoupons(ctx, 0, 0)
+	if err != nil || len(coupons) != 5 {
+		t.Fatalf("ListCoupons = %d coupons, %v; want 5", len(coupons), err)
+	}
+	for i, c := range coupons {
+		if want := fmt.Sprintf("COUPON%02d", i+1); c.Code != want {
+			t.Errorf("ListCoupons[%d] = %s, want %s: coupons are ordered by code", i, c.Code, want)
+		}
+	}
+
+	for _, pc := range pageCases {
+		page, err := d.GetAllProducts(ctx, models.ProductFilter{}, pc.limit, pc.offset)
+		if err != nil {
+			t.Errorf("GetAllProducts(%d, %d) failed: %v", pc.limit, pc.offset, err)
+		} else if got := productIDs(page); !reflect.DeepEqual(got, pick(productIDs(products), pc.want)) {
+			t.Errorf("GetAllProducts(%d, %d) = %v, want %v", pc.limit, pc.offset, got, pick(productIDs(products), pc.want))
+		}
+
+		couponPage, err := d.ListCoupons(ctx, pc.limit, pc.offset)
+		if err != nil {
+			t.Errorf("ListCoupons(%d, %d) failed: %v", pc.limit, pc.offset, err)
+		} else if got := couponCodes(couponPage); !reflect.DeepEqual(got, pick(couponCodes(coupons), pc.want)) {
+			t.Errorf("ListCoupons(%d, %d) = %v, want %v", pc.limit, pc.offset, got, pick(couponCodes(coupons), pc.want))
+		}
+	}
+}
+
+func productIDs(products []models.Product) []string {
+	var ids []string
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func couponCodes(coupons []models.Coupon) []string {
+	var codes []string
+	for _, c := range coupons {
+		codes = append(codes, c.Code)
+	}
+	return codes
+}
+
+func pick(items []string, positions []int) []string {
+	var picked []string
+	for _, i := range positions {
+		picked = append(picked, items[i])
+	}
+	return picked
+}
+
+func testProductFilters(t *testing.T, d db.Database) {
+	ctx := context.Background()
+	products := []models.Product{
+		{ID: "a", Name: "Berry Waffle", Category: "Waffle", Price: aud(650)},
+		{ID: "b", Name: "berry tart", Category: "Tart", Price: aud(400)},
+		{ID: "c", Name: "Caramel Slice", Category: "Slice", Price: money.New(900, "NZD"),
+			Prices: map[string]money.Money{money.DefaultCurrency: aud(800)}},
+		// No price in the store currency
+		{ID: "d", Name: "Date Scone", Category: "Scone", Price: money.New(300, "NZD")},
+		{ID: "e", Name: "100% Cocoa_Bar", Category: "Bar", Price: aud(500)},
+	}
+	for _, p := range products {
+		if err := d.CreateProduct(ctx, &p); err != nil {
+			t.Fatalf("CreateProduct(%s) failed: %v", p.ID, err)
+		}
+	}
+
+	price := func(cents int64) *money.Money {
+		p := aud(cents)
+		return &p
+	}
+	sortBy := func(fields ...string) []models.ProductSort {
+		var sort []models.ProductSort
+		for _, f := range fields {
+			sort = append(sort, models.ProductSort{Field: strings.TrimPrefix(f, "-"), Descending: strings.HasPrefix(f, "-")})
+		}
+		return sort
+	}
+	tests := []struct {
+		filter        models.ProductFilter
+		limit, offset int
+		want          []string
+	}{
+		{filter: models.ProductFilter{Category: "Waffle"}, want: []string{"a"}},
+		{filter: models.ProductFilter{Query: "BERRY"}, want: []string{"a", "b"}},
+		{filter: models.ProductFilter{Query: "%"}, want: []string{"e"}},
+		{filter: models.ProductFilter{Query: "a_b"}, want: []string{"e"}},
+		{filter: models.ProductFilter{Query: "y_t"}, want: nil},
+		{filter: models.ProductFilter{Category: "Tart", Query: "waffle"}, want: nil},
+		{filter: models.ProductFilter{MinPrice: price(500)}, want: []string{"a", "c", "e"}},
+		{filter: models.ProductFilter{MinPrice: price(400), MaxPrice: price(650)}, want: []string{"a", "b", "e"}},
+		{filter: models.ProductFilter{Sort: sortBy("price")}, want: []string{"b", "e", "a", "c", "d"}},
+		{filter: models.ProductFilter{Sort: sortBy("-price")}, want: []string{"c", "a", "e", "b", "d"}},
+		{filter: models.ProductFilter{Sort: sortBy("name")}, want: []string{"e", "a", "c", "d", "b"}},
+		{filter: models.ProductFilter{Sort: sortBy("category", "-name")}, want: []string{"e", "d", "c", "b", "a"}},
+		{filter: models.ProductFilter{Sort: sortBy("price")}, limit: 2, offset: 1, want: []string{"e", "a"}},
+	}
+	for _, tt := range tests {
+		got, err := d.GetAllProducts(ctx, tt.filter, tt.limit, tt.offset)
+		if err != nil {
+			t.Errorf("GetAllProducts(%+v) failed: %v", tt.filter, err)
+		} else if ids := productIDs(got); !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("GetAllProducts(%+v, %d, %d) = %v, want %v", tt.filter, tt.limit, tt.offset, ids, tt.want)
+		}
+	}
+
+	// Deleted products are left out of filtered listings too
+	if err := d.DeleteProduct(ctx, "a"); err != nil {
+		t.Fatalf("DeleteProduct failed: %v", err)
+	}
+	got, err := d.GetAllProducts(ctx, models.ProductFilter{Query: "berry", Sort: sortBy("name")}, 0, 0)
+	if ids := productIDs(got); err != nil || !reflect.DeepEqual(ids, []string{"b"}) {
+		t.Errorf("GetAllProducts after delete = %v, %v", ids, err)
+	}
+
+	nzd := money.New(500, "NZD")
+	if _, err := d.GetAllProducts(ctx, models.ProductFilter{MaxPrice: &nzd}, 0, 0); err == nil {
+		t.Error("Expected an error for a price bound outside the store currency")
+	}
+	if _, err := d.GetAllProducts(ctx, models.ProductFilter{Sort: sortBy("stock")}, 0, 0); err == nil {
+		t.Error("Expected an error for an unknown sort field")
+	}
+}
+
+// testCouponCodeLength checks the default policy of 8 to 10 characters
+func testCouponCodeLength(t *testing.T, d db.Database) {
+	ctx := context.Background()
+
+	for _, code := range []string{"SHORT12", "ELEVENCHARS"} {
+		if err := d.CreateCoupon(ctx, &models.Coupon{Code: code}); !errors.Is(err, db.ErrCouponCodeLength) {
+			t.Errorf("CreateCoupon(%s): expected ErrCouponCodeLength, got %v", code, err)
+		}
+		if c, err := d.GetCoupon(ctx, code); c != nil || err != nil {
+			t.Errorf("GetCoupon(%s) after a rejected create = %+v, %v", code, c, err)
+		}
+		if err := d.DeactivateCoupon(ctx, code); !errors.Is(err, db.ErrCouponCodeLength) {
+			t.Errorf("DeactivateCoupon(%s): expected ErrCouponCodeLength, got %v", code, err)
+		}
+		if ok, err := d.IsCouponValid(ctx, code); ok || err != nil {
+			t.Errorf("IsCouponValid(%s) = %v, %v; want false, nil", code, ok, err)
+		}
+	}
+
+	for _, code := range []string{"EIGHT123", "TENCHARS10"} {
+		createCoupon(t, d, models.Coupon{Code: code})
+		if ok, err := d.IsCouponValid(ctx, code); !ok || err != nil {
+			t.Errorf("IsCouponValid(%s) = %v, %v; want true, nil", code, ok, err)
+		}
+	}
+	if err := d.CreateCoupon(ctx, &models.Coupon{Code: "EIGHT123"}); !errors.Is(err, db.ErrCouponExists) {
+		t.Errorf("CreateCoupon with a taken code: expected ErrCouponExists, got %v", err)
+	}
+
+	// No code means no coupon
+	if ok, err := d.IsCouponValid(ctx, ""); !ok || err != nil {
+		t.Errorf(`IsCouponValid("") = %v, %v; want true, nil`, ok, err)
+	}
+}
+
+func testOrders(t *testing.T, d db.Database) {
+	ctx := context.Background()
+	createProduct(t, d, "1", intPtr(5))
+	createCoupon(t, d, models.Coupon{Code: "HAPPYHRS", MaxPerCustomer: 1})
+
+	order := newOrder("order-1", "1", "HAPPYHRS", "alice")
+	if err := d.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("CreateOrder failed: %v", err)
+	}
+	got, err := d.GetOrderByID(ctx, "order-1")
+	if err != nil || got == nil {
+		t.Fatalf("GetOrderByID = %+v, %v", got, err)
+	}
+	if got.CouponCode != "HAPPYHRS" || got.CustomerID != "alice" || got.Total != aud(650) || got.Status != models.OrderPlaced ||
+		!got.CreatedAt.Equal(order.CreatedAt) || len(got.History) != 1 || !reflect.DeepEqual(got.Lines, order.Lines) ||
+		len(got.Products) != 1 || got.Products[0].ID != "1" {
+		t.Errorf("GetOrderByID = %+v", got)
+	}
+	if n, err := d.CountCustomerRedemptions(ctx, "HAPPYHRS", "alice"); n != 1 || err != nil {
+		t.Errorf("CountCustomerRedemptions = %d, %v; want 1, nil", n, err)
+	}
+	if c, _ := d.GetCoupon(ctx, "HAPPYHRS"); c == nil || c.Redemptions != 1 {
+		t.Errorf("GetCoupon after redemption = %+v", c)
+	}
+
+	// A rejected order leaves nothing behind, including the stock it took
+	err = d.CreateOrder(ctx, newOrder("order-2", "1", "HAPPYHRS", "alice"))
+	if !errors.Is(err, db.ErrCustomerRedemptionLimit) {
+		t.Errorf("Expected ErrCustomerRedemptionLimit, got %v", err)
+	}
+	// Nor can the cap be dodged by leaving the customer out
+	if err := d.CreateOrder(ctx, newOrder("order-3", "1", "HAPPYHRS", "")); !errors.Is(err, db.ErrCustomerRequired) {
+		t.Errorf("Expected ErrCustomerRequired, got %v", err)
+	}
+	if o, err := d.GetOrderByID(ctx, "order-2"); o != nil || err != nil {
+		t.Errorf("rejected order was stored: %+v, %v", o, err)
+	}
+	if p, _ := d.GetProductByID(ctx, "1"); p == nil || *p.Stock != 4 {
+		t.Errorf("stock after a rejected order = %+v, want 4", p)
+	}
+
+	cancel := models.OrderStatusChange{From: models.OrderPlaced, To: models.OrderCancelled, At: time.Now().UTC()}
+	if err := d.UpdateOrderStatus(ctx, "order-1", cancel); err != nil {
+		t.Fatalf("UpdateOrderStatus failed: %v", err)
+	}
+	if err := d.UpdateOrderStatus(ctx, "order-1", cancel); !errors.Is(err, db.ErrOrderStatusChanged) {
+		t.Errorf("Expected ErrOrderStatusChanged, got %v", err)
+	}
+	if p, _ := d.GetProductByID(ctx, "1"); p == nil || *p.Stock != 5 {
+		t.Errorf("stock after cancelling = %+v, want 5", p)
+	}
+}
+
+// testContextCancellation checks that every method gives up on a cancelled
+// context, with an error matching context.Canceled, and changes nothing
+func testIdempotencyKeys(t *testing.T, d db.Database) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	staleBefore := now.Add(-time.Minute)
+
+	req := idempotentRequest("k1", "fp", now)
+	if existing, err := d.ReserveIdempotencyKey(ctx, req, staleBefore); existing != nil || err != nil {
+		t.Fatalf("ReserveIdempotencyKey = %+v, %v; want nil, nil", existing, err)
+	}
+	// A retry while the request is in flight gets the reservation back
+	existing, err := d.ReserveIdempotencyKey(ctx, idempotentRequest("k1", "fp", now), staleBefore)
+	if err != nil || existing == nil || existing.Completed() || existing.Fingerprint != "fp" {
+		t.Fatalf("ReserveIdempotencyKey in flight = %+v, %v", existing, err)
+	}
+	// Each API key has keys of its own
+	other := idempotentRequest("k1", "fp", now)
+	other.APIKeyID = "key-2"
+	if existing, err := d.ReserveIdempotencyKey(ctx, other, staleBefore); existing != nil || err != nil {
+		t.Errorf("ReserveIdempotencyKey for another API key = %+v, %v; want nil, nil", existing, err)
+	}
+
+	req.StatusCode, req.ContentType, req.Body = 201, "application/json", []byte(`{"id":"order-1"}`)
+	req.Headers = map[string]string{"Location": "/api/order/order-1"}
+	if err := d.CompleteIdempotencyKey(ctx, req); err != nil {
+		t.Fatalf("CompleteIdempotencyKey failed: %v", err)
+	}
+	if err := d.CompleteIdempotencyKey(ctx, req); !errors.Is(err, db.ErrIdempotencyKeyNotFound) {
+		t.Errorf("CompleteIdempotencyKey twice = %v, want ErrIdempotencyKeyNotFound", err)
+	}
+	// Completed requests are neither released nor taken over when stale
+	if err := d.ReleaseIdempotencyKey(ctx, "key-1", "k1"); err != nil {
+		t.Fatalf("ReleaseIdempotencyKey failed: %v", err)
+	}
+	existing, err = d.ReserveIdempotencyKey(ctx, idempotentRequest("k1", "fp", now.Add(time.Hour)), now.Add(time.Hour))
+	if err != nil || existing == nil || existing.StatusCode != 201 || existing.ContentType != "application/json" ||
+		existing.Headers["Location"] != "/api/order/order-1" || string(existing.Body) != `{"id":"order-1"}` || !existing.CreatedAt.Equal(now) {
+		t.Errorf("ReserveIdempotencyKey after completion = %+v, %v", existing, err)
+	}
+
+	// A released reservation can be made again
+	if _, err := d.ReserveIdempotencyKey(ctx, idempotentRequest("k2", "fp", now), staleBefore); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ReleaseIdempotencyKey(ctx, "key-1", "k2"); err != nil {
+		t.Fatalf("ReleaseIdempotencyKey failed: %v", err)
+	}
+	if existing, err := d.ReserveIdempotencyKey(ctx, idempotentRequest("k2", "fp", now), staleBefore); existing != nil || err != nil {
+		t.Errorf("ReserveIdempotencyKey after release = %+v, %v; want nil, nil", existing, err)
+	}
+
+	// An in-flight reservation made before staleBefore is taken over, and
+	// only the request that took it over can complete it
+	if _, err := d.ReserveIdempotencyKey(ctx, idempotentRequest("k3", "fp", now.Add(-time.Hour)), staleBefore); err != nil {
+		t.Fatal(err)
+	}
+	retry := idempotentRequest("k3", "fp2", now)
+	if existing, err := d.ReserveIdempotencyKey(ctx, retry, staleBefore); existing != nil || err != nil {
+		t.Fatalf("ReserveIdempotencyKey over a stale reservation = %+v, %v; want nil, nil", existing, err)
+	}
+	abandoned := idempotentRequest("k3", "fp", now.Add(-time.Hour))
+	abandoned.StatusCode = 500
+	if err := d.CompleteIdempotencyKey(ctx, abandoned); !errors.Is(err, db.ErrIdempotencyKeyNotFound) {
+		t.Errorf("CompleteIdempotencyKey for the stale request = %v, want ErrIdempotencyKeyNotFound", err)
+	}
+	retry.StatusCode = 201
+	if err := d.CompleteIdempotencyKey(ctx, retry); err != nil {
+		t.Errorf("CompleteIdempotencyKey for the request that took over failed: %v", err)
+	}
+
+	// Expired entries are purged, completed or not
+	later := idempotentRequest("k1", "fp3", now.Add(25*time.Hour))
+	if existing, err := d.ReserveIdempotencyKey(ctx, later, later.CreatedAt); existing != nil || err != nil {
+		t.Errorf("ReserveIdempotencyKey after expiry = %+v, %v; want nil, nil", existing, err)
+	}
+}
+
+func testWebhookDeliveries(t *testing.T, d db.Database) {
+	store, ok := d.(WebhookStore)
+	if !ok {
+		t.Skip("the backend does not implement WebhookStore")
+	}
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for _, w := range []models.Webhook{
+		{ID: "orders", URL: "https://a.example.com", Events: []string{models.EventOrderPlaced}, Secret: "s1", CreatedAt: now},
+		{ID: "coupons", URL: "https://b.example.com", Events: []string{models.EventCouponRedeemed}, Secret: "s2", CreatedAt: now},
+		{ID: "deleted", URL: "https://c.example.com", Events: []string{models.EventOrderPlaced}, Secret: "s3", CreatedAt: now},
+	} {
+		if err := d.CreateWebhook(ctx, &w); err != nil {
+			t.Fatalf("CreateWebhook(%s) failed: %v", w.ID, err)
+		}
+	}
+	if err := d.DeleteWebhook(ctx, "deleted"); err != nil {
+		t.Fatal(err)
+	}
+
+	createProduct(t, d, "1", nil)
+	if err := d.CreateOrder(ctx, newOrder("order-1", "1", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	events, err := store.PendingOutboxEvents(ctx, now, 0)
+	if err != nil || len(events) != 1 || events[0].Type != models.EventOrderPlaced {
+		t.Fatalf("PendingOutboxEvents = %+v, %v; want the order.placed event", events, err)
+	}
+
+	// Enqueueing is idempotent, and only live subscribed webhooks get a delivery
+	for i := 0; i < 2; i++ {
+		if err := store.EnqueueWebhookDeliveries(ctx, events[0], now); err != nil {
+			t.Fatalf("EnqueueWebhookDeliveries failed: %v", err)
+		}
+	}
+	due, err := store.DueWebhookDeliveries(ctx, now, 0)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("DueWebhookDeliveries = %+v, %v; want one delivery", due, err)
+	}
+	if due[0].WebhookID != "orders" || due[0].URL != "https://a.example.com" || due[0].Secret != "s1" ||
+		due[0].Status != models.DeliveryPending || due[0].Event.ID != events[0].ID ||
+		due[0].Event.Type != models.EventOrderPlaced || !strings.Contains(string(due[0].Event.Data), `"order-1"`) {
+		t.Errorf("due delivery = %+v", due[0])
+	}
+
+	delivery := due[0].WebhookDelivery
+	deliveredAt := now.Add(time.Second)
+	delivery.Status, delivery.Attempts, delivery.LastStatusCode, delivery.DeliveredAt = models.DeliveryDelivered, 1, 200, &deliveredAt
+	if err := store.RecordWebhookAttempt(ctx, delivery); err != nil {
+		t.Fatalf("RecordWebhookAttempt failed: %v", err)
+	}
+	if due, err := store.DueWebhookDeliveries(ctx, deliveredAt, 0); err != nil || len(due) != 0 {
+		t.Errorf("DueWebhookDeliveries after delivery = %+v, %v; want none", due, err)
+	}
+	// Publishing the event again does not queue a delivered event
+	if err := store.EnqueueWebhookDeliveries(ctx, events[0], deliveredAt); err != nil {
+		t.Fatal(err)
+	}
+	log, err := d.ListWebhookDeliveries(ctx, "orders", 0, 0)
+	if err != nil || len(log) != 1 || log[0].Status != models.DeliveryDelivered || log[0].LastStatusCode != 200 {
+		t.Errorf("ListWebhookDeliveries = %+v, %v", log, err)
+	}
+	if log, err := d.ListWebhookDeliveries(ctx, "coupons", 0, 0); err != nil || len(log) != 0 {
+		t.Errorf("ListWebhookDeliveries for an unsubscribed webhook = %+v, %v", log, err)
+	}
+}
+
+func testContextCancellation(t *testing.T, d db.Database) {
+	createProduct(t, d, "1", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	errs := map[string]error{}
+	_, errs["GetAllProducts"] = d.GetAllProducts(ctx, models.ProductFilter{}, 0, 0)
+	_, errs["GetProductByID"] = d.GetProductByID(ctx, "1")
+	errs["CreateProduct"] = d.CreateProduct(ctx, newProduct("2", nil))
+	errs["UpdateProduct"] = d.UpdateProduct(ctx, newProduct("1", nil))
+	errs["SetProductStock"] = d.SetProductStock(ctx, "1", intPtr(1))
+	errs["DeleteProduct"] = d.DeleteProduct(ctx, "1")
+	_, errs["IsCouponValid"] = d.IsCouponValid(ctx, "HAPPYHRS")
+	_, errs["GetCoupon"] = d.GetCoupon(ctx, "HAPPYHRS")
+	errs["CreateCoupon"] = d.CreateCoupon(ctx, &models.Coupon{Code: "HAPPYHRS"})
+	errs["DeactivateCoupon"] = d.DeactivateCoupon(ctx, "HAPPYHRS")
+	_, errs["ListCoupons"] = d.ListCoupons(ctx, 0, 0)
+	_, errs["CountCustomerRedemptions"] = d.CountCustomerRedemptions(ctx, "HAPPYHRS", "alice")
+	errs["CreateOrder"] = d.CreateOrder(ctx, newOrder("order-1", "1", "", ""))
+	_, errs["GetOrderByID"] = d.GetOrderByID(ctx, "order-1")
+	errs["UpdateOrderStatus"] = d.UpdateOrderStatus(ctx, "order-1", models.OrderStatusChange{
+		From: models.OrderPlaced, To: models.OrderCancelled, At: time.Now().UTC()})
+	_, errs["GetAPIKeyByHash"] = d.GetAPIKeyByHash(ctx, "hash")
+	errs["TouchAPIKey"] = d.TouchAPIKey(ctx, "key", time.Now().UTC())
+	_, errs["ReserveIdempotencyKey"] = d.ReserveIdempotencyKey(ctx, &models.IdempotentRequest{
+		APIKeyID: "key", Key: "idem", CreatedAt: time.Now().UTC()}, time.Now().UTC().Add(-time.Hour))
+	errs["CompleteIdempotencyKey"] = d.CompleteIdempotencyKey(ctx, &models.IdempotentRequest{APIKeyID: "key", Key: "idem"})
+	errs["ReleaseIdempotencyKey"] = d.ReleaseIdempotencyKey(ctx, "key", "idem")
+	errs["CreateWebhook"] = d.CreateWebhook(ctx, &models.Webhook{
+		ID: "hook", URL: "https://example.com/hook", Events: []string{models.EventOrderPlaced}, CreatedAt: time.Now().UTC()})
+	_, errs["ListWebhooks"] = d.ListWebhooks(ctx)
+	errs["DeleteWebhook"] = d.DeleteWebhook(ctx, "hook")
+	_, errs["ListWebhookDeliveries"] = d.ListWebhookDeliveries(ctx, "hook", 0, 0)
+
+	for name, err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got %v", name, err)
+		}
+	}
+
+	bg := context.Background()
+	if p, _ := d.GetProductByID(bg, "1"); p == nil || p.Name != "Product 1" || p.Stock != nil {
+		t.Errorf("product changed by cancelled calls: %+v", p)
+	}
+	if p, _ := d.GetProductByID(bg, "2"); p != nil {
+		t.Errorf("product created by a cancelled call: %+v", p)
+	}
+	if c, _ := d.GetCoupon(bg, "HAPPYHRS"); c != nil {
+		t.Errorf("coupon created by a cancelled call: %+v", c)
+	}
+	if o, _ := d.GetOrderByID(bg, "order-1"); o != nil {
+		t.Errorf("order created by a cancelled call: %+v", o)
+	}
+	if w, _ := d.ListWebhooks(bg); len(w) != 0 {
+		t.Errorf("webhook created by a cancelled call: %+v", w)
+	}
+}
+
+// concurrently runs n calls of f at once, alongside readers, and returns
+// their errors
+func concurrently(d db.Database, n int, f func(i int) error) []error {
+	ctx := context.Background()
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs[i] = f(i)
+		}()
+		go func() {
+			defer wg.Done()
+			d.GetAllProducts(ctx, models.ProductFilter{}, 0, 0)
+			d.ListCoupons(ctx, 0, 0)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func testConcurrentOrders(t *testing.T, d db.Database) {
+	ctx := context.Background()
+	createProduct(t, d, "1", intPtr(10))
+
+	errs := concurrently(d, 25, func(i int) error {
+		return d.CreateOrder(ctx, newOrder(fmt.Sprintf("order-%d", i), "1", "", ""))
+	})
+	placed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			placed++
+		case !errors.Is(err, db.ErrInsufficientStock):
+			t.Errorf("CreateOrder failed: %v", err)
+		}
+	}
+	if placed != 10 {
+		t.Errorf("%d orders placed for 10 units in stock", placed)
+	}
+	if p, _ := d.GetProductByID(ctx, "1"); p == nil || *p.Stock != 0 || !p.SoldOut {
+		t.Errorf("product after selling out = %+v", p)
+	}
+}
+
+func testConcurrentRedemptions(t *testing.T, d db.Database) {
+	ctx := context.Background()
+	createProduct(t, d, "1", nil)
+	createCoupon(t, d, models.Coupon{Code: "HAPPYHRS", MaxRedemptions: 5})
+
+	errs := concurrently(d, 20, func(i int) error {
+		return d.CreateOrder(ctx, newOrder(fmt.Sprintf("order-%d", i), "1", "HAPPYHRS", fmt.Sprintf("customer-%d", i)))
+	})
+	placed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			placed++
+		case !errors.Is(err, db.ErrRedemptionLimit):
+			t.Errorf("CreateOrder failed: %v", err)
+		}
+	}
+	if placed != 5 {
+		t.Errorf("%d orders redeemed a coupon capped at 5", placed)
+	}
+	if c, _ := d.GetCoupon(ctx, "HAPPYHRS"); c == nil || c.Redemptions != 5 {
+		t.Errorf("coupon after reaching its cap = %+v", c)
+	}
+}
+
+func testConcurrentIdempotencyKeys(t *testing.T, d db.Database) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	staleBefore := now.Add(-time.Minute)
+
+	// A key reserved long ago and never completed is up for grabs too
+	if _, err := d.ReserveIdempotencyKey(ctx, idempotentRequest("stale", "fp", now.Add(-time.Hour)), staleBefore); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"fresh", "stale"} {
+		reserved := make([]bool, 20)
+		errs := concurrently(d, len(reserved), func(i int) error {
+			existing, err := d.ReserveIdempotencyKey(ctx, idempotentRequest(key, fmt.Sprintf("fp-%d", i), now), staleBefore)
+			reserved[i] = err == nil && existing == nil
+			return err
+		})
+		won := 0
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("ReserveIdempotencyKey(%s) failed: %v", key, err)
+			}
+			if reserved[i] {
+				won++
+			}
+		}
+		if won != 1 {
+			t.Errorf("%d concurrent requests reserved idempotency key %s", won, key)
+		}
+	}
+}
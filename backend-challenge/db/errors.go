@@ -0,0 +1,96 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrProductExists is returned by CreateProduct when the product ID is already taken
+	ErrProductExists = errors.New("product already exists")
+
+	// ErrProductNotFound is returned by UpdateProduct, SetProductStock and DeleteProduct when there is no live product with the ID
+	ErrProductNotFound = errors.New("product not found")
+
+	// ErrCouponExists is returned by CreateCoupon when the code is already taken
+	ErrCouponExists = errors.New("coupon already exists")
+
+	// ErrCouponNotFound is returned by DeactivateCoupon when there is no active coupon with the code
+	ErrCouponNotFound = errors.New("coupon not found")
+
+	// ErrCouponCodeLength is returned by coupon writes when the code length is not allowed by the coupon policy
+	ErrCouponCodeLength = errors.New("coupon code length not allowed by policy")
+
+	// ErrCouponDeactivated is returned by CreateOrder when the coupon was deactivated before the order was stored
+	ErrCouponDeactivated = errors.New("coupon has been deactivated")
+
+	// ErrAPIKeyExists is returned by CreateAPIKey when a key with the same hash is already stored
+	ErrAPIKeyExists = errors.New("api key already exists")
+
+	// ErrAPIKeyNotFound is returned by DisableAPIKey and RotateAPIKey when there is no such key
+	ErrAPIKeyNotFound = errors.New("api key not found")
+
+	// ErrIdempotencyKeyNotFound is returned by CompleteIdempotencyKey when the reservation is gone
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+
+	// ErrOrderNotFound is returned by UpdateOrderStatus when there is no such order
+	ErrOrderNotFound = errors.New("order not found")
+
+	// ErrOrderStatusChanged is returned by UpdateOrderStatus when the order is no longer in the expected status
+	ErrOrderStatusChanged = errors.New("order status changed")
+
+	// ErrWebhookNotFound is returned by DeleteWebhook and ListWebhookDeliveries when there is no such webhook
+	ErrWebhookNotFound = errors.New("webhook not found")
+
+	// ErrWebhookDeliveryNotFound is returned by RecordWebhookAttempt when there is no such delivery
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+
+	// ErrOutboxEventNotFound is returned by the outbox updates when there is no such event,
+	// or, for RequeueOutboxEvent, no such dead-lettered event
+	ErrOutboxEventNotFound = errors.New("outbox event not found")
+
+	// ErrRedemptionLimit is returned by CreateOrder when the coupon has reached its redemption cap
+	ErrRedemptionLimit = errors.New("coupon redemption limit reached")
+
+	// ErrCustomerRedemptionLimit is returned by CreateOrder when the customer has reached the coupon's per-customer cap
+	ErrCustomerRedemptionLimit = errors.New("coupon per-customer redemption limit reached")
+
+	// ErrCustomerRequired is returned by CreateOrder when an order without a customer uses a coupon with a per-customer cap
+	ErrCustomerRequired = errors.New("coupon per-customer limit requires a customer")
+
+	// ErrInsufficientStock is matched by the InsufficientStockError CreateOrder returns
+	ErrInsufficientStock = errors.New("insufficient stock")
+
+	// ErrSchemaTooNew is matched by the SchemaTooNewError New and Migrate return
+	ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+)
+
+// InsufficientStockError lists the products an order asked for more of than
+// is in stock. It matches ErrInsufficientStock with errors.Is.
+type InsufficientStockError struct {
+	ProductIDs []string
+}
+
+func (e *InsufficientStockError) Error() string {
+	return ErrInsufficientStock.Error() + ": " + strings.Join(e.ProductIDs, ", ")
+}
+
+func (e *InsufficientStockError) Is(target error) bool {
+	return target == ErrInsufficientStock
+}
+
+// SchemaTooNewError reports a database migrated past the latest schema version
+// the binary knows. It matches ErrSchemaTooNew with errors.Is.
+type SchemaTooNewError struct {
+	Version int
+	Latest  int
+}
+
+func (e *SchemaTooNewError) Error() string {
+	return fmt.Sprintf("%s: database is at version %d, the binary supports up to %d", ErrSchemaTooNew, e.Version, e.Latest)
+}
+
+func (e *SchemaTooNewError) Is(target error) bool {
+	return target == ErrSchemaTooNew
+}
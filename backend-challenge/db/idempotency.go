@@ -0,0 +1,111 @@
+package db
+
+import (
+	"backend-challenge/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ReserveIdempotencyKey records req as in flight, unless its key is already
+// taken, in which case the stored request is returned instead. Expired entries
+// are purged first, and an in-flight entry created before staleBefore is taken
+// over, since the request that made it never finished.
+func (db *DB) ReserveIdempotencyKey(ctx context.Context, req *models.IdempotentRequest, staleBefore time.Time) (*models.IdempotentRequest, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ?`, req.CreatedAt.UTC()); err != nil {
+		return nil, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+
+	// Insert first so that, of concurrent first requests, exactly one gets
+	// the key; the others wait on it and then see its row
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO idempotency_keys (api_key_id, idempotency_key, fingerprint, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (api_key_id, idempotency_key) DO NOTHING`,
+		req.APIKeyID, req.Key, req.Fingerprint, req.CreatedAt.UTC(), req.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	} else if n == 0 {
+		existing := models.IdempotentRequest{APIKeyID: req.APIKeyID, Key: req.Key}
+		var contentType, headers sql.NullString
+		err = tx.QueryRowContext(ctx,
+			`SELECT fingerprint, status_code, content_type, headers, body, created_at, expires_at
+			FROM idempotency_keys WHERE api_key_id = ? AND idempotency_key = ?`+db.dialect.lockRows,
+			req.APIKeyID, req.Key,
+		).Scan(&existing.Fingerprint, &existing.StatusCode, &contentType, &headers, &existing.Body, &existing.CreatedAt, &existing.ExpiresAt)
+		if err != nil {
+			// Includes a key released between the insert and this read
+			return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+		if existing.Completed() || !existing.CreatedAt.Before(staleBefore) {
+			existing.ContentType = contentType.String
+			if headers.Valid {
+				if err := json.Unmarshal([]byte(headers.String), &existing.Headers); err != nil {
+					return nil, fmt.Errorf("failed to read idempotent response headers: %w", err)
+				}
+			}
+			return &existing, nil
+		}
+
+		// The row is locked, so only one retry takes over a stale reservation
+		_, err = tx.ExecContext(ctx,
+			`UPDATE idempotency_keys SET fingerprint = ?, status_code = 0, content_type = NULL, headers = NULL, body = NULL,
+				created_at = ?, expires_at = ?
+			WHERE api_key_id = ? AND idempotency_key = ? AND status_code = 0 AND created_at < ?`,
+			req.Fingerprint, req.CreatedAt.UTC(), req.ExpiresAt.UTC(), req.APIKeyID, req.Key, staleBefore.UTC(),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to take over idempotency key: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil, nil
+}
+
+// CompleteIdempotencyKey stores the response for an in-flight request
+func (db *DB) CompleteIdempotencyKey(ctx context.Context, req *models.IdempotentRequest) error {
+	var headers sql.NullString
+	if len(req.Headers) > 0 {
+		encoded, err := json.Marshal(req.Headers)
+		if err != nil {
+			return fmt.Errorf("failed to encode idempotent response headers: %w", err)
+		}
+		headers = sql.NullString{String: string(encoded), Valid: true}
+	}
+	res, err := db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET status_code = ?, content_type = ?, headers = ?, body = ?
+		WHERE api_key_id = ? AND idempotency_key = ? AND fingerprint = ? AND status_code = 0`,
+		req.StatusCode, nullString(req.ContentType), headers, req.Body, req.APIKeyID, req.Key, req.Fingerprint,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	return requireRow(res, ErrIdempotencyKeyNotFound)
+}
+
+// ReleaseIdempotencyKey drops an in-flight reservation so the request can be retried
+func (db *DB) ReleaseIdempotencyKey(ctx context.Context, apiKeyID, key string) error {
+	_, err := db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE api_key_id = ? AND idempotency_key = ? AND status_code = 0`,
+		apiKeyID, key,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
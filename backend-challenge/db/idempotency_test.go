@@ -0,0 +1,107 @@
+package db
+
+import (
+	"backend-challenge/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	reserve := func(apiKeyID, key, fingerprint string, at time.Time) *models.IdempotentRequest {
+		t.Helper()
+		existing, err := db.ReserveIdempotencyKey(ctx, &models.IdempotentRequest{
+			APIKeyID: apiKeyID, Key: key, Fingerprint: fingerprint, CreatedAt: at, ExpiresAt: at.Add(time.Hour),
+		}, at.Add(-time.Minute))
+		if err != nil {
+			t.Fatalf("Failed to reserve idempotency key: %v", err)
+		}
+		return existing
+	}
+
+	if existing := reserve("demo", "k1", "fp1", now); existing != nil {
+		t.Fatalf("Expected new key to be reserved, got %+v", existing)
+	}
+
+	existing := reserve("demo", "k1", "fp2", now.Add(time.Second))
+	if existing == nil || existing.Completed() || existing.Fingerprint != "fp1" {
+		t.Fatalf("Expected in-flight request, got %+v", existing)
+	}
+
+	// Keys are per API key
+	if existing := reserve("other", "k1", "fp2", now); existing != nil {
+		t.Errorf("Expected another API key to reserve the same key, got %+v", existing)
+	}
+
+	err := db.CompleteIdempotencyKey(ctx, &models.IdempotentRequest{
+		APIKeyID: "demo", Key: "k1", Fingerprint: "fp1", StatusCode: 200, ContentType: "application/json", Body: []byte(`{"id":"1"}`),
+	})
+	if err != nil {
+		t.Fatalf("Failed to complete idempotency key: %v", err)
+	}
+
+	existing = reserve("demo", "k1", "fp1", now.Add(2*time.Minute))
+	if existing == nil || existing.StatusCode != 200 || existing.ContentType != "application/json" || string(existing.Body) != `{"id":"1"}` {
+		t.Fatalf("Expected stored response, got %+v", existing)
+	}
+	if !existing.CreatedAt.Equal(now) {
+		t.Errorf("Expected completed request to keep its key, got created at %v", existing.CreatedAt)
+	}
+
+	// Past its expiry the key is free again
+	if existing := reserve("demo", "k1", "fp3", now.Add(time.Hour)); existing != nil {
+		t.Errorf("Expected expired key to be reserved again, got %+v", existing)
+	}
+
+	if err := db.CompleteIdempotencyKey(ctx, &models.IdempotentRequest{APIKeyID: "demo", Key: "missing", StatusCode: 200}); !errors.Is(err, ErrIdempotencyKeyNotFound) {
+		t.Errorf("Expected ErrIdempotencyKeyNotFound, got %v", err)
+	}
+}
+
+func TestReserveIdempotencyKey_Stale(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	req := &models.IdempotentRequest{APIKeyID: "demo", Key: "k1", Fingerprint: "fp1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	if _, err := db.ReserveIdempotencyKey(ctx, req, now.Add(-time.Minute)); err != nil {
+		t.Fatalf("Failed to reserve idempotency key: %v", err)
+	}
+
+	// A reservation older than staleBefore was abandoned and is taken over
+	retry := &models.IdempotentRequest{APIKeyID: "demo", Key: "k1", Fingerprint: "fp1", CreatedAt: now.Add(2 * time.Minute), ExpiresAt: now.Add(time.Hour)}
+	existing, err := db.ReserveIdempotencyKey(ctx, retry, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to reserve idempotency key: %v", err)
+	}
+	if existing != nil {
+		t.Errorf("Expected stale reservation to be taken over, got %+v", existing)
+	}
+}
+
+func TestReleaseIdempotencyKey(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	req := &models.IdempotentRequest{APIKeyID: "demo", Key: "k1", Fingerprint: "fp1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	if _, err := db.ReserveIdempotencyKey(ctx, req, now.Add(-time.Minute)); err != nil {
+		t.Fatalf("Failed to reserve idempotency key: %v", err)
+	}
+	if err := db.ReleaseIdempotencyKey(ctx, "demo", "k1"); err != nil {
+		t.Fatalf("Failed to release idempotency key: %v", err)
+	}
+
+	existing, err := db.ReserveIdempotencyKey(ctx, req, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to reserve idempotency key: %v", err)
+	}
+	if existing != nil {
+		t.Errorf("Expected released key to be free, got %+v", existing)
+	}
+}
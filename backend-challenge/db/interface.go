@@ -3,14 +3,36 @@ package db
 import (
 	"backend-challenge/models"
 	"context"
+	"time"
 )
 
 //go:generate mockgen -source=interface.go -destination=mocks/mock_db.go -package=mocks
 
 // Database defines the interface for database operations
 type Database interface {
-	GetAllProducts(ctx context.Context, limit, offset int) ([]models.Product, error)
+	GetAllProducts(ctx context.Context, filter models.ProductFilter, limit, offset int) ([]models.Product, error)
 	GetProductByID(ctx context.Context, id string) (*models.Product, error)
+	CreateProduct(ctx context.Context, product *models.Product) error
+	UpdateProduct(ctx context.Context, product *models.Product) error
+	SetProductStock(ctx context.Context, id string, stock *int) error
+	DeleteProduct(ctx context.Context, id string) error
 	IsCouponValid(ctx context.Context, code string) (bool, error)
+	GetCoupon(ctx context.Context, code string) (*models.Coupon, error)
+	CreateCoupon(ctx context.Context, coupon *models.Coupon) error
+	DeactivateCoupon(ctx context.Context, code string) error
+	ListCoupons(ctx context.Context, limit, offset int) ([]models.Coupon, error)
+	CountCustomerRedemptions(ctx context.Context, code, customerID string) (int, error)
+	CreateOrder(ctx context.Context, order *models.Order) error
+	GetOrderByID(ctx context.Context, id string) (*models.Order, error)
+	UpdateOrderStatus(ctx context.Context, id string, change models.OrderStatusChange) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error
+	ReserveIdempotencyKey(ctx context.Context, req *models.IdempotentRequest, staleBefore time.Time) (*models.IdempotentRequest, error)
+	CompleteIdempotencyKey(ctx context.Context, req *models.IdempotentRequest) error
+	ReleaseIdempotencyKey(ctx context.Context, apiKeyID, key string) error
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	ListWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) ([]models.WebhookDelivery, error)
 	Close() error
 }
@@ -0,0 +1,853 @@
+package db
+
+import (
+	"backend-challenge/coupon"
+	"backend-challenge/models"
+	"backend-challenge/money"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a Database that keeps its data in memory, for demos and tests
+// that don't need it to outlive the process. It behaves like DB, down to the
+// errors it returns, and is safe for concurrent use: every method holds one
+// lock, so its writes are as atomic as DB's transactions. Values go in and
+// come out as copies, so callers can't change stored data behind its back.
+type Memory struct {
+	mu           sync.Mutex
+	couponPolicy coupon.Policy
+
+	// products and webhooks are kept in the order they were added, which
+	// is the order DB lists them in
+	products     []*memoryProduct
+	productsByID map[string]*memoryProduct
+	coupons      map[string]*models.Coupon
+	sources      map[string]map[string]bool
+	redemptions  []models.CouponRedemption
+	orders       map[string]*models.Order
+	apiKeys      []*memoryAPIKey
+	idempotency  map[idempotencyKey]*models.IdempotentRequest
+	outbox       []*memoryOutboxEvent
+	webhooks     []*memoryWebhook
+	deliveries   []*models.WebhookDelivery
+}
+
+type memoryProduct struct {
+	product models.Product
+	deleted bool
+}
+
+type memoryAPIKey struct {
+	key  models.APIKey
+	hash string
+}
+
+type memoryOutboxEvent struct {
+	event     models.OutboxEvent
+	published bool
+}
+
+type memoryWebhook struct {
+	webhook models.Webhook
+	deleted bool
+}
+
+// idempotencyKey identifies a stored request; each API key has its own keys
+type idempotencyKey struct {
+	apiKeyID string
+	key      string
+}
+
+// NewMemory returns an empty in-memory database; see Seed to load demo data
+func NewMemory() *Memory {
+	return &Memory{
+		couponPolicy: coupon.DefaultPolicy(),
+		productsByID: make(map[string]*memoryProduct),
+		coupons:      make(map[string]*models.Coupon),
+		sources:      make(map[string]map[string]bool),
+		orders:       make(map[string]*models.Order),
+		idempotency:  make(map[idempotencyKey]*models.IdempotentRequest),
+	}
+}
+
+// SetCouponPolicy replaces the policy IsCouponValid enforces
+func (m *Memory) SetCouponPolicy(policy coupon.Policy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.couponPolicy = policy
+}
+
+// Close does nothing; the data goes when the Memory is no longer referenced
+func (m *Memory) Close() error {
+	return nil
+}
+
+// GetAllProducts returns the products that match filter, in its order, with
+// optional pagination
+func (m *Memory) GetAllProducts(ctx context.Context, filter models.ProductFilter, limit, offset int) ([]models.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, bound := range []*money.Money{filter.MinPrice, filter.MaxPrice} {
+		if bound != nil && bound.Currency != money.DefaultCurrency {
+			return nil, fmt.Errorf("price bounds must be in %s, not %s", money.DefaultCurrency, bound.Currency)
+		}
+	}
+	for _, s := range filter.Sort {
+		if !models.ValidProductSortField(s.Field) {
+			return nil, fmt.Errorf("products can't be sorted by %q", s.Field)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var products []models.Product
+	for _, p := range m.products {
+		if !p.deleted && matchesFilter(p.product, filter) {
+			products = append(products, p.get())
+		}
+	}
+	if len(filter.Sort) > 0 {
+		sort.SliceStable(products, func(i, j int) bool {
+			return productLess(products[i], products[j], filter.Sort)
+		})
+	}
+	return paginate(products, limit, offset), nil
+}
+
+// matchesFilter reports whether a product is in a listing filtered by filter
+func matchesFilter(p models.Product, filter models.ProductFilter) bool {
+	if filter.Category != "" && p.Category != filter.Category {
+		return false
+	}
+	if filter.Query != "" && !strings.Contains(strings.ToLower(p.Name), strings.ToLower(filter.Query)) {
+		return false
+	}
+	if filter.MinPrice == nil && filter.MaxPrice == nil {
+		return true
+	}
+	price, ok := storePriceOf(p)
+	return ok && (filter.MinPrice == nil || price >= filter.MinPrice.Amount) &&
+		(filter.MaxPrice == nil || price <= filter.MaxPrice.Amount)
+}
+
+// productLess orders products by the sort fields in turn, then by ID, as the
+// ORDER BY of DB's listing does
+func productLess(a, b models.Product, fields []models.ProductSort) bool {
+	for _, s := range fields {
+		var c int
+		switch s.Field {
+		case models.SortByName:
+			c = strings.Compare(a.Name, b.Name)
+		case models.SortByCategory:
+			c = strings.Compare(a.Category, b.Category)
+		case models.SortByPrice:
+			aPrice, aOK := storePriceOf(a)
+			bPrice, bOK := storePriceOf(b)
+			if aOK != bOK {
+				// Products without a price in the store currency go last either way
+				return aOK
+			}
+			c = cmp.Compare(aPrice, bPrice)
+		}
+		if s.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return a.ID < b.ID
+}
+
+// storePriceOf returns a product's price in the store currency: its own price
+// if it is in that currency, otherwise the one set for it
+func storePriceOf(p models.Product) (int64, bool) {
+	if p.Price.Currency == money.DefaultCurrency {
+		return p.Price.Amount, true
+	}
+	price, ok := p.Prices[money.DefaultCurrency]
+	return price.Amount, ok
+}
+
+func (m *Memory) GetProductByID(ctx context.Context, id string) (*models.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.productsByID[id]
+	if !ok || p.deleted {
+		return nil, nil
+	}
+	product := p.get()
+	return &product, nil
+}
+
+// CreateProduct stores a new product with its prices in other currencies
+func (m *Memory) CreateProduct(ctx context.Context, product *models.Product) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Deleted products keep their ID so past orders still resolve them
+	if _, ok := m.productsByID[product.ID]; ok {
+		return ErrProductExists
+	}
+	m.addProduct(storedProduct(product, product.Stock))
+	return nil
+}
+
+func (m *Memory) addProduct(product models.Product) {
+	p := &memoryProduct{product: product}
+	m.products = append(m.products, p)
+	m.productsByID[product.ID] = p
+}
+
+// UpdateProduct overwrites a product's details, including its prices in
+// other currencies. Stock is left alone, as DB.UpdateProduct leaves it.
+func (m *Memory) UpdateProduct(ctx context.Context, product *models.Product) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.productsByID[product.ID]
+	if !ok || p.deleted {
+		return ErrProductNotFound
+	}
+	p.product = storedProduct(product, p.product.Stock)
+	return nil
+}
+
+// SetProductStock sets the units of a product left to sell. A nil stock
+// stops tracking it, so it can be ordered in any quantity.
+func (m *Memory) SetProductStock(ctx context.Context, id string, stock *int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.productsByID[id]
+	if !ok || p.deleted {
+		return ErrProductNotFound
+	}
+	p.product.Stock = copyInt(stock)
+	return nil
+}
+
+// DeleteProduct soft-deletes a product. It disappears from the catalogue and
+// can no longer be ordered, but past orders keep resolving it.
+func (m *Memory) DeleteProduct(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.productsByID[id]
+	if !ok || p.deleted {
+		return ErrProductNotFound
+	}
+	p.deleted = true
+	return nil
+}
+
+func (m *Memory) IsCouponValid(ctx context.Context, code string) (bool, error) {
+	// An empty code means no coupon was supplied
+	if code == "" {
+		return true, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.couponPolicy.ValidLength(code) {
+		return false, nil
+	}
+	// As in DB, coupons without recorded sources were added directly and
+	// only need to exist
+	c, ok := m.coupons[code]
+	n := len(m.sources[code])
+	return ok && c.DeactivatedAt == nil && (n == 0 || m.couponPolicy.EnoughSources(n)), nil
+}
+
+// InsertCoupons adds imported codes and the sources they were found in,
+// skipping those already present
+func (m *Memory) InsertCoupons(ctx context.Context, matches []coupon.Match) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, match := range matches {
+		if _, ok := m.coupons[match.Code]; !ok {
+			m.addCoupon(models.Coupon{Code: match.Code})
+		}
+		for _, source := range match.Sources {
+			m.addCouponSource(match.Code, source)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) addCouponSource(code, source string) {
+	if m.sources[code] == nil {
+		m.sources[code] = make(map[string]bool)
+	}
+	m.sources[code][source] = true
+}
+
+func (m *Memory) GetCoupon(ctx context.Context, code string) (*models.Coupon, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.coupons[code]
+	if !ok {
+		return nil, nil
+	}
+	result := m.getCoupon(c)
+	return &result, nil
+}
+
+// ListCoupons returns every coupon, including deactivated ones, ordered by code
+func (m *Memory) ListCoupons(ctx context.Context, limit, offset int) ([]models.Coupon, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var coupons []models.Coupon
+	for _, c := range m.coupons {
+		coupons = append(coupons, m.getCoupon(c))
+	}
+	sort.Slice(coupons, func(i, j int) bool { return coupons[i].Code < coupons[j].Code })
+	return paginate(coupons, limit, offset), nil
+}
+
+// getCoupon copies a stored coupon and counts its redemptions
+func (m *Memory) getCoupon(c *models.Coupon) models.Coupon {
+	result := copyCoupon(*c)
+	for _, r := range m.redemptions {
+		if r.Code == c.Code {
+			result.Redemptions++
+		}
+	}
+	return result
+}
+
+// CreateCoupon adds a coupon with its limits and optional rule. The code must
+// satisfy the same length policy IsCouponValid enforces.
+func (m *Memory) CreateCoupon(ctx context.Context, c *models.Coupon) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.couponPolicy.ValidLength(c.Code) {
+		return ErrCouponCodeLength
+	}
+	// Deactivated coupons keep their code so their redemptions stay attached
+	if _, ok := m.coupons[c.Code]; ok {
+		return ErrCouponExists
+	}
+	m.addCoupon(*c)
+	return nil
+}
+
+func (m *Memory) addCoupon(c models.Coupon) {
+	stored := copyCoupon(c)
+	stored.Redemptions = 0
+	stored.DeactivatedAt = nil
+	if stored.Rule != nil {
+		stored.Rule.Code = stored.Code
+	}
+	m.coupons[stored.Code] = &stored
+}
+
+// DeactivateCoupon withdraws a coupon so it is no longer accepted. Its
+// redemptions are kept and it still shows up in ListCoupons.
+func (m *Memory) DeactivateCoupon(ctx context.Context, code string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.couponPolicy.ValidLength(code) {
+		return ErrCouponCodeLength
+	}
+	c, ok := m.coupons[code]
+	if !ok || c.DeactivatedAt != nil {
+		return ErrCouponNotFound
+	}
+	now := time.Now().UTC()
+	c.DeactivatedAt = &now
+	return nil
+}
+
+func (m *Memory) CountCustomerRedemptions(ctx context.Context, code, customerID string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.countRedemptions(code, customerID), nil
+}
+
+// countRedemptions counts a customer's redemptions of a coupon. Anonymous
+// redemptions belong to no customer, as their customer_id is NULL in DB.
+func (m *Memory) countRedemptions(code, customerID string) int {
+	if customerID == "" {
+		return 0
+	}
+	n := 0
+	for _, r := range m.redemptions {
+		if r.Code == code && r.CustomerID == customerID {
+			n++
+		}
+	}
+	return n
+}
+
+// CreateOrder stores the order with its lines, history, coupon redemption and
+// outbox events, and takes its items out of stock. Every check is made before
+// anything is stored, so a failed order leaves no trace, as with DB.
+func (m *Memory) CreateOrder(ctx context.Context, order *models.Order) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	placed, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", models.EventOrderPlaced, err)
+	}
+	var redeemed []byte
+	redemption := models.CouponRedemption{
+		Code:       order.CouponCode,
+		OrderID:    order.ID,
+		CustomerID: order.CustomerID,
+		RedeemedAt: order.CreatedAt.UTC(),
+	}
+	if order.CouponCode != "" {
+		if redeemed, err = json.Marshal(redemption); err != nil {
+			return fmt.Errorf("failed to encode %s event: %w", models.EventCouponRedeemed, err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.orders[order.ID]; ok {
+		return fmt.Errorf("failed to insert order: order %s already exists", order.ID)
+	}
+
+	quantities, err := m.checkStock(order.Lines)
+	if err != nil {
+		return err
+	}
+
+	if order.CouponCode != "" {
+		if err := m.checkRedemption(order); err != nil {
+			return err
+		}
+	}
+
+	// Everything has been checked, so the order can be stored
+	for id, quantity := range quantities {
+		if stock := m.productsByID[id].product.Stock; stock != nil {
+			*stock -= quantity
+		}
+	}
+	stored := *order
+	stored.Items, stored.Products = nil, nil
+	stored.Lines = append([]models.OrderLine(nil), order.Lines...)
+	stored.History = copyHistory(order.History)
+	stored.CreatedAt = order.CreatedAt.UTC()
+	m.orders[order.ID] = &stored
+
+	if order.CouponCode != "" {
+		m.redemptions = append(m.redemptions, redemption)
+	}
+	m.addOutboxEvent(models.EventOrderPlaced, placed, order.CreatedAt)
+	if order.CouponCode != "" {
+		m.addOutboxEvent(models.EventCouponRedeemed, redeemed, order.CreatedAt)
+	}
+	return nil
+}
+
+// checkStock totals the quantity of each product ordered and checks those
+// that track stock have enough. If any is short, InsufficientStockError
+// lists them all.
+func (m *Memory) checkStock(lines []models.OrderLine) (map[string]int, error) {
+	// A product can appear on several lines
+	var productIDs []string
+	quantities := make(map[string]int)
+	for _, line := range lines {
+		if _, ok := quantities[line.ProductID]; !ok {
+			productIDs = append(productIDs, line.ProductID)
+		}
+		quantities[line.ProductID] += line.Quantity
+	}
+
+	var short []string
+	for _, id := range productIDs {
+		p, ok := m.productsByID[id]
+		if !ok {
+			return nil, fmt.Errorf("failed to reserve stock: product %s does not exist", id)
+		}
+		if p.product.Stock != nil && *p.product.Stock < quantities[id] {
+			short = append(short, id)
+		}
+	}
+	if len(short) > 0 {
+		return nil, &InsufficientStockError{ProductIDs: short}
+	}
+	return quantities, nil
+}
+
+// checkRedemption enforces the caps of the order's coupon
+func (m *Memory) checkRedemption(order *models.Order) error {
+	c, ok := m.coupons[order.CouponCode]
+	if !ok {
+		return fmt.Errorf("failed to redeem coupon: coupon %s does not exist", order.CouponCode)
+	}
+	if c.DeactivatedAt != nil {
+		return ErrCouponDeactivated
+	}
+
+	total := 0
+	for _, r := range m.redemptions {
+		if r.Code == c.Code {
+			total++
+		}
+	}
+	if c.MaxRedemptions > 0 && total >= c.MaxRedemptions {
+		return ErrRedemptionLimit
+	}
+	if c.MaxPerCustomer > 0 && order.CustomerID == "" {
+		return ErrCustomerRequired
+	}
+	if c.MaxPerCustomer > 0 && m.countRedemptions(c.Code, order.CustomerID) >= c.MaxPerCustomer {
+		return ErrCustomerRedemptionLimit
+	}
+	return nil
+}
+
+func (m *Memory) GetOrderByID(ctx context.Context, id string) (*models.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.orders[id]
+	if !ok {
+		return nil, nil
+	}
+
+	order := *stored
+	order.Lines = append([]models.OrderLine(nil), stored.Lines...)
+	order.History = copyHistory(stored.History)
+	for _, line := range order.Lines {
+		order.Items = append(order.Items, models.OrderItem{ProductID: line.ProductID, Quantity: line.Quantity})
+		order.Products = append(order.Products, m.productsByID[line.ProductID].get())
+	}
+	order.SetCurrency(stored.Total.Currency)
+	return &order, nil
+}
+
+// UpdateOrderStatus moves an order from change.From to change.To and records
+// the change with its order.status_changed event. Cancelled orders put their
+// items back into stock. It returns ErrOrderStatusChanged if the order has
+// meanwhile left change.From.
+func (m *Memory) UpdateOrderStatus(ctx context.Context, id string, change models.OrderStatusChange) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[id]
+	if !ok {
+		return ErrOrderNotFound
+	}
+	if order.Status != change.From {
+		return ErrOrderStatusChanged
+	}
+
+	change.At = change.At.UTC()
+	// The event carries the change's position in the history, as streamed order events do
+	event := models.OrderEvent{ID: len(order.History) + 1, OrderID: id, OrderStatusChange: change}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", models.EventOrderStatusChanged, err)
+	}
+
+	order.Status = change.To
+	order.History = append(order.History, change)
+	if change.To == models.OrderCancelled {
+		for _, line := range order.Lines {
+			if stock := m.productsByID[line.ProductID].product.Stock; stock != nil {
+				*stock += line.Quantity
+			}
+		}
+	}
+	m.addOutboxEvent(models.EventOrderStatusChanged, data, change.At)
+	return nil
+}
+
+func (m *Memory) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, k := range m.apiKeys {
+		if k.hash == keyHash {
+			key := copyAPIKey(k.key)
+			return &key, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateAPIKey stores a key under its hash. The key itself is never stored.
+func (m *Memory) CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.addAPIKey(*key, keyHash)
+}
+
+func (m *Memory) addAPIKey(key models.APIKey, keyHash string) error {
+	for _, k := range m.apiKeys {
+		if k.hash == keyHash {
+			return ErrAPIKeyExists
+		}
+		if k.key.ID == key.ID {
+			return fmt.Errorf("failed to create api key: key %s already exists", key.ID)
+		}
+	}
+	stored := copyAPIKey(key)
+	stored.CreatedAt = stored.CreatedAt.UTC()
+	stored.LastUsedAt, stored.ReplacedBy = nil, ""
+	m.apiKeys = append(m.apiKeys, &memoryAPIKey{key: stored, hash: keyHash})
+	return nil
+}
+
+// TouchAPIKey records when a key was last used
+func (m *Memory) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, k := range m.apiKeys {
+		if k.key.ID == id {
+			k.key.LastUsedAt = copyTime(&usedAt)
+		}
+	}
+	return nil
+}
+
+// ReserveIdempotencyKey records req as in flight, unless its key is already
+// taken, in which case the stored request is returned instead. Expired entries
+// are purged first, and an in-flight entry created before staleBefore is taken
+// over, since the request that made it never finished.
+func (m *Memory) ReserveIdempotencyKey(ctx context.Context, req *models.IdempotentRequest, staleBefore time.Time) (*models.IdempotentRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, stored := range m.idempotency {
+		if !stored.ExpiresAt.After(req.CreatedAt) {
+			delete(m.idempotency, k)
+		}
+	}
+
+	k := idempotencyKey{req.APIKeyID, req.Key}
+	if existing, ok := m.idempotency[k]; ok && (existing.Completed() || !existing.CreatedAt.Before(staleBefore)) {
+		result := *existing
+		result.Headers = maps.Clone(existing.Headers)
+		result.Body = append([]byte(nil), existing.Body...)
+		return &result, nil
+	}
+
+	m.idempotency[k] = &models.IdempotentRequest{
+		APIKeyID:    req.APIKeyID,
+		Key:         req.Key,
+		Fingerprint: req.Fingerprint,
+		CreatedAt:   req.CreatedAt.UTC(),
+		ExpiresAt:   req.ExpiresAt.UTC(),
+	}
+	return nil, nil
+}
+
+// CompleteIdempotencyKey stores the response for an in-flight request
+func (m *Memory) CompleteIdempotencyKey(ctx context.Context, req *models.IdempotentRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.idempotency[idempotencyKey{req.APIKeyID, req.Key}]
+	if !ok || stored.Fingerprint != req.Fingerprint || stored.Completed() {
+		return ErrIdempotencyKeyNotFound
+	}
+	stored.StatusCode = req.StatusCode
+	stored.ContentType = req.ContentType
+	if len(req.Headers) > 0 {
+		stored.Headers = maps.Clone(req.Headers)
+	}
+	stored.Body = append([]byte(nil), req.Body...)
+	return nil
+}
+
+// ReleaseIdempotencyKey drops an in-flight reservation so the request can be retried
+func (m *Memory) ReleaseIdempotencyKey(ctx context.Context, apiKeyID, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := idempotencyKey{apiKeyID, key}
+	if stored, ok := m.idempotency[k]; ok && !stored.Completed() {
+		delete(m.idempotency, k)
+	}
+	return nil
+}
+
+// paginate applies limit and offset the way the SQL queries do: without a
+// positive limit everything is returned and offset is ignored
+func paginate[T any](items []T, limit, offset int) []T {
+	if limit <= 0 {
+		return items
+	}
+	offset = max(offset, 0)
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+// get returns a copy of the product as DB reads it back
+func (p *memoryProduct) get() models.Product {
+	product := copyProduct(p.product)
+	product.SoldOut = product.OutOfStock()
+	return product
+}
+
+// storedProduct is a copy of product as DB stores it, with the given stock
+func storedProduct(product *models.Product, stock *int) models.Product {
+	stored := copyProduct(*product)
+	stored.TaxCategory = taxCategory(product)
+	stored.Stock = copyInt(stock)
+	stored.SoldOut = false
+	// Prices in other currencies are stored by currency code alone
+	for currency, price := range stored.Prices {
+		stored.Prices[currency] = money.New(price.Amount, currency)
+	}
+	return stored
+}
+
+// copyProduct deep-copies a product. An image without any URLs is dropped,
+// since DB stores its URLs in nullable columns and reads none back as nil.
+func copyProduct(p models.Product) models.Product {
+	if p.Image != nil {
+		img := *p.Image
+		p.Image = &img
+		if img == (models.ProductImage{}) {
+			p.Image = nil
+		}
+	}
+	if len(p.Prices) > 0 {
+		prices := make(map[string]money.Money, len(p.Prices))
+		for currency, price := range p.Prices {
+			prices[currency] = price
+		}
+		p.Prices = prices
+	} else {
+		p.Prices = nil
+	}
+	p.Stock = copyInt(p.Stock)
+	return p
+}
+
+func copyCoupon(c models.Coupon) models.Coupon {
+	if c.Rule != nil {
+		rule := *c.Rule
+		c.Rule = &rule
+	}
+	c.StartsAt = copyTime(c.StartsAt)
+	c.EndsAt = copyTime(c.EndsAt)
+	c.DeactivatedAt = copyTime(c.DeactivatedAt)
+	return c
+}
+
+func copyAPIKey(k models.APIKey) models.APIKey {
+	k.Scopes = append([]string(nil), k.Scopes...)
+	k.ExpiresAt = copyTime(k.ExpiresAt)
+	k.LastUsedAt = copyTime(k.LastUsedAt)
+	return k
+}
+
+func copyHistory(history []models.OrderStatusChange) []models.OrderStatusChange {
+	var copied []models.OrderStatusChange
+	for _, change := range history {
+		change.At = change.At.UTC()
+		copied = append(copied, change)
+	}
+	return copied
+}
+
+func copyInt(n *int) *int {
+	if n == nil {
+		return nil
+	}
+	v := *n
+	return &v
+}
+
+// copyTime copies a time in UTC, which DB reads stored times back in
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := t.UTC()
+	return &v
+}
@@ -0,0 +1,337 @@
+package db
+
+import (
+	"backend-challenge/models"
+	"backend-challenge/money"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// seedColumns lists the tables Seed loads and the columns it understands
+var seedColumns = map[string][]string{
+	"products": {"id", "name", "category", "price", "currency", "image_thumbnail", "image_mobile",
+		"image_tablet", "image_desktop", "stock", "tax_category"},
+	"product_prices": {"product_id", "currency", "price"},
+	"valid_coupons":  {"code", "starts_at", "ends_at", "max_redemptions", "max_per_customer"},
+	"coupon_sources": {"code", "source"},
+	"coupon_rules":   {"code", "rule_type", "value", "amount", "product_id", "min_subtotal"},
+	"api_keys":       {"id", "key_hash", "owner", "scopes", "disabled", "created_at", "expires_at"},
+}
+
+var insertPattern = regexp.MustCompile(`(?is)^INSERT\s+INTO\s+(\w+)\s*\((.*?)\)\s*VALUES\s*\((.*)\)$`)
+
+// Seed loads the INSERT statements of a seed script such as data/seed.sql,
+// so the in-memory database starts with the data a migrated database loaded
+// with the same script has. Only single-row INSERTs of literal values into
+// the products, product_prices, valid_coupons, coupon_sources, coupon_rules
+// and api_keys tables are understood; anything else is an error.
+func (m *Memory) Seed(script string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stmt := range splitSQL(script, ';') {
+		if stmt == "" {
+			continue
+		}
+		row, err := parseInsert(stmt)
+		if err != nil {
+			return err
+		}
+		if err := m.seedRow(row); err != nil {
+			return fmt.Errorf("failed to seed %s: %w", row.table, err)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) seedRow(row seedRow) error {
+	switch row.table {
+	case "products":
+		price, err := row.int("price")
+		if err != nil {
+			return err
+		}
+		stock, err := row.optionalInt("stock")
+		if err != nil {
+			return err
+		}
+		if _, ok := m.productsByID[row.text("id")]; ok {
+			return ErrProductExists
+		}
+		product := models.Product{
+			ID:          row.text("id"),
+			Name:        row.text("name"),
+			Category:    row.text("category"),
+			Price:       money.New(price, row.textOr("currency", money.DefaultCurrency)),
+			TaxCategory: row.text("tax_category"),
+			Image: &models.ProductImage{
+				Thumbnail: row.text("image_thumbnail"),
+				Mobile:    row.text("image_mobile"),
+				Tablet:    row.text("image_tablet"),
+				Desktop:   row.text("image_desktop"),
+			},
+		}
+		m.addProduct(storedProduct(&product, stock))
+
+	case "product_prices":
+		p, ok := m.productsByID[row.text("product_id")]
+		if !ok {
+			return fmt.Errorf("product %s does not exist", row.text("product_id"))
+		}
+		price, err := row.int("price")
+		if err != nil {
+			return err
+		}
+		if p.product.Prices == nil {
+			p.product.Prices = make(map[string]money.Money)
+		}
+		currency := row.text("currency")
+		p.product.Prices[currency] = money.New(price, currency)
+
+	case "valid_coupons":
+		c := models.Coupon{Code: row.text("code")}
+		var err error
+		if c.StartsAt, err = row.time("starts_at"); err != nil {
+			return err
+		}
+		if c.EndsAt, err = row.time("ends_at"); err != nil {
+			return err
+		}
+		maxRedemptions, err := row.optionalInt("max_redemptions")
+		if err != nil {
+			return err
+		}
+		maxPerCustomer, err := row.optionalInt("max_per_customer")
+		if err != nil {
+			return err
+		}
+		if maxRedemptions != nil {
+			c.MaxRedemptions = *maxRedemptions
+		}
+		if maxPerCustomer != nil {
+			c.MaxPerCustomer = *maxPerCustomer
+		}
+		if _, ok := m.coupons[c.Code]; ok {
+			return ErrCouponExists
+		}
+		m.addCoupon(c)
+
+	case "coupon_sources":
+		if _, ok := m.coupons[row.text("code")]; !ok {
+			return fmt.Errorf("coupon %s does not exist", row.text("code"))
+		}
+		m.addCouponSource(row.text("code"), row.text("source"))
+
+	case "coupon_rules":
+		c, ok := m.coupons[row.text("code")]
+		if !ok {
+			return fmt.Errorf("coupon %s does not exist", row.text("code"))
+		}
+		value, err := row.float("value")
+		if err != nil {
+			return err
+		}
+		amount, err := row.int("amount")
+		if err != nil {
+			return err
+		}
+		minSubtotal, err := row.int("min_subtotal")
+		if err != nil {
+			return err
+		}
+		c.Rule = &models.CouponRule{
+			Code:        c.Code,
+			Type:        row.text("rule_type"),
+			Value:       value,
+			Amount:      amount,
+			ProductID:   row.text("product_id"),
+			MinSubtotal: minSubtotal,
+		}
+
+	case "api_keys":
+		key := models.APIKey{
+			ID:     row.text("id"),
+			Owner:  row.text("owner"),
+			Scopes: strings.Fields(row.text("scopes")),
+		}
+		disabled := strings.ToUpper(row.text("disabled"))
+		key.Disabled = disabled == "TRUE" || disabled == "1"
+		createdAt, err := row.time("created_at")
+		if err != nil {
+			return err
+		}
+		if createdAt == nil {
+			return fmt.Errorf("key %s has no created_at", key.ID)
+		}
+		key.CreatedAt = *createdAt
+		if key.ExpiresAt, err = row.time("expires_at"); err != nil {
+			return err
+		}
+		return m.addAPIKey(key, row.text("key_hash"))
+	}
+	return nil
+}
+
+// seedRow is a row of a seed INSERT. Values are kept as the text of their
+// literals, with NULLs left out.
+type seedRow struct {
+	table  string
+	values map[string]string
+}
+
+func parseInsert(stmt string) (seedRow, error) {
+	match := insertPattern.FindStringSubmatch(stmt)
+	if match == nil {
+		return seedRow{}, fmt.Errorf("unsupported seed statement: %.60s", stmt)
+	}
+	row := seedRow{table: strings.ToLower(match[1]), values: make(map[string]string)}
+	allowed, ok := seedColumns[row.table]
+	if !ok {
+		return seedRow{}, fmt.Errorf("unsupported seed table %s", row.table)
+	}
+
+	columns := splitSQL(match[2], ',')
+	values := splitSQL(match[3], ',')
+	if len(columns) != len(values) {
+		return seedRow{}, fmt.Errorf("%s insert has %d columns and %d values", row.table, len(columns), len(values))
+	}
+	for i, column := range columns {
+		column = strings.ToLower(column)
+		if !containsString(allowed, column) {
+			return seedRow{}, fmt.Errorf("unsupported seed column %s.%s", row.table, column)
+		}
+		value, isNull, err := parseLiteral(values[i])
+		if err != nil {
+			return seedRow{}, fmt.Errorf("%s.%s: %w", row.table, column, err)
+		}
+		if !isNull {
+			row.values[column] = value
+		}
+	}
+	return row, nil
+}
+
+// parseLiteral returns the text of a quoted string, number or boolean literal
+func parseLiteral(literal string) (value string, isNull bool, err error) {
+	switch {
+	case strings.EqualFold(literal, "NULL"):
+		return "", true, nil
+	case len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'':
+		return strings.ReplaceAll(literal[1:len(literal)-1], "''", "'"), false, nil
+	case strings.EqualFold(literal, "TRUE"), strings.EqualFold(literal, "FALSE"):
+		return strings.ToUpper(literal), false, nil
+	}
+	if _, err := strconv.ParseFloat(literal, 64); err != nil {
+		return "", false, fmt.Errorf("unsupported value %s", literal)
+	}
+	return literal, false, nil
+}
+
+// splitSQL splits s at each sep outside quoted strings and -- comments,
+// dropping the comments and trimming the parts
+func splitSQL(s string, sep byte) []string {
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'':
+			// A doubled quote inside a string is an escaped quote, so
+			// scanning on from the closing quote handles it
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				end = len(s) - i - 2
+			}
+			part.WriteString(s[i : i+end+2])
+			i += end + 1
+		case c == '-' && strings.HasPrefix(s[i:], "--"):
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				i = len(s)
+			} else {
+				i += end
+			}
+		case c == sep:
+			parts = append(parts, strings.TrimSpace(part.String()))
+			part.Reset()
+		default:
+			part.WriteByte(c)
+		}
+	}
+	if last := strings.TrimSpace(part.String()); last != "" {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (r seedRow) text(column string) string {
+	return r.values[column]
+}
+
+func (r seedRow) textOr(column, fallback string) string {
+	if v, ok := r.values[column]; ok {
+		return v
+	}
+	return fallback
+}
+
+func (r seedRow) int(column string) (int64, error) {
+	n, err := strconv.ParseInt(r.values[column], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", column, err)
+	}
+	return n, nil
+}
+
+func (r seedRow) optionalInt(column string) (*int, error) {
+	if _, ok := r.values[column]; !ok {
+		return nil, nil
+	}
+	n, err := r.int(column)
+	if err != nil {
+		return nil, err
+	}
+	v := int(n)
+	return &v, nil
+}
+
+func (r seedRow) float(column string) (float64, error) {
+	v, ok := r.values[column]
+	if !ok {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", column, err)
+	}
+	return f, nil
+}
+
+// seedTimeLayouts are the timestamp formats seed scripts write
+var seedTimeLayouts = []string{"2006-01-02 15:04:05-07:00", "2006-01-02 15:04:05", time.RFC3339Nano}
+
+func (r seedRow) time(column string) (*time.Time, error) {
+	v, ok := r.values[column]
+	if !ok {
+		return nil, nil
+	}
+	for _, layout := range seedTimeLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: unsupported timestamp %q", column, v)
+}
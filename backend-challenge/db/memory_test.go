@@ -0,0 +1,255 @@
+package db
+
+import (
+	"backend-challenge/coupon"
+	"backend-challenge/models"
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setupMemoryTestDB returns an in-memory database seeded with data/seed.sql
+func setupMemoryTestDB(t *testing.T) *Memory {
+	t.Helper()
+	seed, err := os.ReadFile("../data/seed.sql")
+	if err != nil {
+		t.Fatalf("Failed to read seed data: %v", err)
+	}
+	m := NewMemory()
+	if err := m.Seed(string(seed)); err != nil {
+		t.Fatalf("Failed to seed memory database: %v", err)
+	}
+	return m
+}
+
+func TestMemory_SeedMatchesCommittedDatabase(t *testing.T) {
+	db := setupTestDB(t)
+	m := setupMemoryTestDB(t)
+	ctx := context.Background()
+
+	want, err := db.GetAllProducts(ctx, models.ProductFilter{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.GetAllProducts(ctx, models.ProductFilter{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("products = %+v\nwant %+v", got, want)
+	}
+
+	wantCoupons, err := db.ListCoupons(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotCoupons, err := m.ListCoupons(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotCoupons, wantCoupons) {
+		t.Errorf("coupons = %+v\nwant %+v", gotCoupons, wantCoupons)
+	}
+
+	// The demo key "apitest"
+	const demoHash = "e81cbf18a5239377aa4972773d34cc2b81ebc672879581bce29a0a4c414bf117"
+	wantKey, err := db.GetAPIKeyByHash(ctx, demoHash)
+	if err != nil || wantKey == nil {
+		t.Fatalf("GetAPIKeyByHash failed: %v", err)
+	}
+	gotKey, err := m.GetAPIKeyByHash(ctx, demoHash)
+	if err != nil || gotKey == nil {
+		t.Fatalf("GetAPIKeyByHash failed: %v", err)
+	}
+	if !gotKey.CreatedAt.Equal(wantKey.CreatedAt) {
+		t.Errorf("key created at %v, want %v", gotKey.CreatedAt, wantKey.CreatedAt)
+	}
+	gotKey.CreatedAt = wantKey.CreatedAt
+	if !reflect.DeepEqual(gotKey, wantKey) {
+		t.Errorf("key = %+v, want %+v", gotKey, wantKey)
+	}
+}
+
+func TestMemory_SeedErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"not an insert", `DELETE FROM products;`},
+		{"unknown table", `INSERT INTO orders (id) VALUES ('1');`},
+		{"unknown column", `INSERT INTO products (id, colour) VALUES ('1', 'red');`},
+		{"value count", `INSERT INTO valid_coupons (code, max_redemptions) VALUES ('ABCDEFGH');`},
+		{"expression", `INSERT INTO products (id, name, category, price) VALUES ('1', 'Tart', 'Tart', 1 + 1);`},
+		{"rule without coupon", `INSERT INTO coupon_rules (code, rule_type) VALUES ('ABCDEFGH', 'percentage');`},
+		{"source without coupon", `INSERT INTO coupon_sources (code, source) VALUES ('ABCDEFGH', 'vendor1.gz');`},
+		{"duplicate product", `INSERT INTO products (id, name, category, price) VALUES ('1', 'a', 'b', 1);
+			INSERT INTO products (id, name, category, price) VALUES ('1', 'a', 'b', 1);`},
+	}
+	for _, tt := range tests {
+		if err := NewMemory().Seed(tt.script); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	// Quotes and semicolons inside strings, comments and NULLs are handled
+	m := NewMemory()
+	err := m.Seed(`-- a comment; with a semicolon
+		INSERT INTO products (id, name, category, price, stock, image_thumbnail)
+		VALUES ('10', 'Baker''s; Dozen', 'Bun', 1200, 3, NULL); -- trailing`)
+	if err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
+	product, _ := m.GetProductByID(context.Background(), "10")
+	if product == nil || product.Name != "Baker's; Dozen" || product.Stock == nil || *product.Stock != 3 ||
+		product.Image != nil || product.TaxCategory != "standard" || product.Price != aud(1200) {
+		t.Errorf("seeded product = %+v", product)
+	}
+}
+
+// The policy is applied as in TestIsCouponValid_Policy, to imported and seeded sources alike
+func TestMemory_CouponPolicy(t *testing.T) {
+	m := setupMemoryTestDB(t)
+	ctx := context.Background()
+
+	err := m.InsertCoupons(ctx, []coupon.Match{
+		{Code: "SIXSIX", Sources: []string{"vendor1.gz", "vendor2.gz", "vendor3.gz"}},
+		{Code: "TWOSRC12", Sources: []string{"vendor1.gz", "vendor2.gz"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert coupons: %v", err)
+	}
+	err = m.Seed(`INSERT INTO valid_coupons (code) VALUES ('SEEDED12');
+		INSERT INTO coupon_sources (code, source) VALUES ('SEEDED12', 'vendor1.gz');`)
+	if err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
+
+	campaign := coupon.Policy{MinLength: 6, MaxLength: 12, MinSources: 3}
+	tests := []struct {
+		name   string
+		policy coupon.Policy
+		code   string
+		valid  bool
+	}{
+		{"default policy rejects short code", coupon.DefaultPolicy(), "SIXSIX", false},
+		{"default policy accepts two sources", coupon.DefaultPolicy(), "TWOSRC12", true},
+		{"default policy rejects one seeded source", coupon.DefaultPolicy(), "SEEDED12", false},
+		{"campaign policy accepts short code", campaign, "SIXSIX", true},
+		{"raised threshold rejects two sources", campaign, "TWOSRC12", false},
+		{"coupon without recorded sources", campaign, "HAPPYHRS", true},
+	}
+	for _, tt := range tests {
+		m.SetCouponPolicy(tt.policy)
+		valid, err := m.IsCouponValid(ctx, tt.code)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if valid != tt.valid {
+			t.Errorf("%s: IsCouponValid(%q) = %v, want %v", tt.name, tt.code, valid, tt.valid)
+		}
+	}
+}
+
+func TestMemory_ReturnsCopies(t *testing.T) {
+	m := setupMemoryTestDB(t)
+	ctx := context.Background()
+
+	product, _ := m.GetProductByID(ctx, "1")
+	product.Name = "Changed"
+	product.Image.Thumbnail = "changed.jpg"
+	product.Prices["NZD"] = aud(1)
+	if again, _ := m.GetProductByID(ctx, "1"); again.Name != "Waffle with Berries" ||
+		again.Image.Thumbnail == "changed.jpg" || again.Prices["NZD"].Amount != 750 {
+		t.Errorf("changing a returned product changed the stored one: %+v", again)
+	}
+
+	// Nor can the caller change what it passed in
+	order := testOrder("order-1", "", "")
+	if err := m.CreateOrder(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	order.Lines[0].Quantity = 99
+	if stored, _ := m.GetOrderByID(ctx, "order-1"); stored.Lines[0].Quantity != 1 {
+		t.Errorf("changing a created order changed the stored one: %+v", stored.Lines)
+	}
+}
+
+func TestMemory_CreateOrderIsAtomic(t *testing.T) {
+	m := setupMemoryTestDB(t)
+	ctx := context.Background()
+
+	stock := 5
+	if err := m.SetProductStock(ctx, "1", &stock); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeactivateCoupon(ctx, "HAPPYHRS"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The coupon check fails after the stock check passed, so neither the
+	// stock nor the outbox may show the order
+	err := m.CreateOrder(ctx, testOrder("order-1", "HAPPYHRS", "alice"))
+	if !errors.Is(err, ErrCouponDeactivated) {
+		t.Fatalf("Expected ErrCouponDeactivated, got %v", err)
+	}
+	if product, _ := m.GetProductByID(ctx, "1"); *product.Stock != 5 {
+		t.Errorf("Stock = %d after failed order, want 5", *product.Stock)
+	}
+	if events, _ := m.PendingOutboxEvents(ctx, time.Now(), 0); len(events) != 0 {
+		t.Errorf("Expected no outbox events, got %d", len(events))
+	}
+
+	if err := m.CreateOrder(ctx, testOrder("order-2", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	events, _ := m.PendingOutboxEvents(ctx, time.Now(), 0)
+	if len(events) != 1 || events[0].ID != 1 || events[0].Type != models.EventOrderPlaced ||
+		!strings.Contains(string(events[0].Data), `"order-2"`) {
+		t.Errorf("outbox events = %+v", events)
+	}
+}
+
+func TestMemory_ConcurrentOrders(t *testing.T) {
+	m := setupMemoryTestDB(t)
+	ctx := context.Background()
+
+	stock := 10
+	if err := m.SetProductStock(ctx, "1", &stock); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			order := testOrder("order-"+strings.Repeat("x", i+1), "", "")
+			errs <- m.CreateOrder(ctx, order)
+			m.GetAllProducts(ctx, models.ProductFilter{}, 0, 0)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	placed := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			placed++
+		case !errors.Is(err, ErrInsufficientStock):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if placed != 10 {
+		t.Errorf("%d orders placed, want 10", placed)
+	}
+	if product, _ := m.GetProductByID(ctx, "1"); *product.Stock != 0 || !product.SoldOut {
+		t.Errorf("product after selling out = %+v", product)
+	}
+}
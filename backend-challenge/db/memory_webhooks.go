@@ -0,0 +1,295 @@
+package db
+
+import (
+	"backend-challenge/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// addOutboxEvent records an event in the outbox. Its caller holds the lock
+// for the change the event is about, so the two are stored together.
+func (m *Memory) addOutboxEvent(eventType string, data []byte, at time.Time) {
+	m.outbox = append(m.outbox, &memoryOutboxEvent{event: models.OutboxEvent{
+		ID:        int64(len(m.outbox) + 1),
+		Type:      eventType,
+		Data:      json.RawMessage(data),
+		CreatedAt: at.UTC(),
+	}})
+}
+
+// PendingOutboxEvents returns up to limit unpublished events that are due at
+// now and have not been dead-lettered, oldest first
+func (m *Memory) PendingOutboxEvents(ctx context.Context, now time.Time, limit int) ([]models.OutboxEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []models.OutboxEvent
+	for _, e := range m.outbox {
+		if e.published || e.event.DeadLetteredAt != nil {
+			continue
+		}
+		if e.event.NextAttemptAt != nil && e.event.NextAttemptAt.After(now) {
+			continue
+		}
+		events = append(events, copyOutboxEvent(e.event))
+		if len(events) == limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+// MarkOutboxEventPublished records that an event has been published
+func (m *Memory) MarkOutboxEventPublished(ctx context.Context, id int64, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.outboxEvent(id)
+	if err != nil {
+		return err
+	}
+	e.published, e.event.NextAttemptAt = true, nil
+	return nil
+}
+
+// RecordOutboxFailure stores a failed attempt to publish an event: its
+// attempts, last error, and either its next attempt or when it was dead-lettered
+func (m *Memory) RecordOutboxFailure(ctx context.Context, failed models.OutboxEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.outboxEvent(failed.ID)
+	if err != nil {
+		return err
+	}
+	event := &e.event
+	event.Attempts = failed.Attempts
+	event.LastError = failed.LastError
+	event.NextAttemptAt = copyTime(failed.NextAttemptAt)
+	event.DeadLetteredAt = copyTime(failed.DeadLetteredAt)
+	return nil
+}
+
+func (m *Memory) outboxEvent(id int64) (*memoryOutboxEvent, error) {
+	if id < 1 || id > int64(len(m.outbox)) {
+		return nil, ErrOutboxEventNotFound
+	}
+	return m.outbox[id-1], nil
+}
+
+func (m *Memory) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.webhook(webhook.ID) != nil {
+		return fmt.Errorf("failed to create webhook: webhook %s already exists", webhook.ID)
+	}
+	stored := *webhook
+	stored.Events = append([]string(nil), webhook.Events...)
+	stored.CreatedAt = webhook.CreatedAt.UTC()
+	m.webhooks = append(m.webhooks, &memoryWebhook{webhook: stored})
+	return nil
+}
+
+// ListWebhooks returns the webhooks that have not been deleted, oldest first,
+// without their secrets
+func (m *Memory) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var webhooks []models.Webhook
+	for _, w := range m.webhooks {
+		if w.deleted {
+			continue
+		}
+		webhook := w.webhook
+		webhook.Events = append([]string(nil), w.webhook.Events...)
+		webhook.Secret = ""
+		webhooks = append(webhooks, webhook)
+	}
+	sort.SliceStable(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks, nil
+}
+
+// DeleteWebhook stops deliveries to a webhook. Its pending deliveries are
+// marked failed; the delivery log is kept.
+func (m *Memory) DeleteWebhook(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w := m.webhook(id)
+	if w == nil || w.deleted {
+		return ErrWebhookNotFound
+	}
+	w.deleted = true
+	for _, d := range m.deliveries {
+		if d.WebhookID == id && d.Status == models.DeliveryPending {
+			d.Status, d.LastError, d.NextAttemptAt = models.DeliveryFailed, "webhook deleted", nil
+		}
+	}
+	return nil
+}
+
+func (m *Memory) webhook(id string) *memoryWebhook {
+	for _, w := range m.webhooks {
+		if w.webhook.ID == id {
+			return w
+		}
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns a webhook's deliveries, newest first. It
+// returns ErrWebhookNotFound if the webhook was never registered.
+func (m *Memory) ListWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) ([]models.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.webhook(webhookID) == nil {
+		return nil, ErrWebhookNotFound
+	}
+	var deliveries []models.WebhookDelivery
+	for i := len(m.deliveries) - 1; i >= 0; i-- {
+		if d := m.deliveries[i]; d.WebhookID == webhookID {
+			deliveries = append(deliveries, copyDelivery(*d))
+		}
+	}
+	return paginate(deliveries, limit, offset), nil
+}
+
+// EnqueueWebhookDeliveries queues a pending delivery of the event for every
+// webhook subscribed to its type. Webhooks that already have the event queued
+// are skipped, so an event published again is not delivered twice.
+func (m *Memory) EnqueueWebhookDeliveries(ctx context.Context, event models.OutboxEvent, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.outboxEvent(event.ID); err != nil {
+		return fmt.Errorf("failed to queue webhook delivery: %w", err)
+	}
+	now = now.UTC()
+	for _, w := range m.webhooks {
+		if w.deleted || !w.webhook.Subscribes(event.Type) || m.queued(w.webhook.ID, event.ID) {
+			continue
+		}
+		m.deliveries = append(m.deliveries, &models.WebhookDelivery{
+			ID:            int64(len(m.deliveries) + 1),
+			WebhookID:     w.webhook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: copyTime(&now),
+			CreatedAt:     now,
+		})
+	}
+	return nil
+}
+
+func (m *Memory) queued(webhookID string, eventID int64) bool {
+	for _, d := range m.deliveries {
+		if d.WebhookID == webhookID && d.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries whose next
+// attempt is due at now, with their webhook and event
+func (m *Memory) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.PendingWebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []models.PendingWebhookDelivery
+	for _, d := range m.deliveries {
+		if d.Status != models.DeliveryPending || (d.NextAttemptAt != nil && d.NextAttemptAt.After(now)) {
+			continue
+		}
+		w := m.webhook(d.WebhookID)
+		event := m.outbox[d.EventID-1].event
+		due = append(due, models.PendingWebhookDelivery{
+			WebhookDelivery: copyDelivery(*d),
+			URL:             w.webhook.URL,
+			Secret:          w.webhook.Secret,
+			Event: models.OutboxEvent{
+				ID:        event.ID,
+				Type:      event.Type,
+				Data:      append(json.RawMessage(nil), event.Data...),
+				CreatedAt: event.CreatedAt,
+			},
+		})
+		if len(due) == limit {
+			break
+		}
+	}
+	return due, nil
+}
+
+// RecordWebhookAttempt stores the outcome of an attempt to send a delivery
+func (m *Memory) RecordWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if delivery.ID < 1 || delivery.ID > int64(len(m.deliveries)) {
+		return ErrWebhookDeliveryNotFound
+	}
+	d := m.deliveries[delivery.ID-1]
+	d.Status = delivery.Status
+	d.Attempts = delivery.Attempts
+	d.LastStatusCode = delivery.LastStatusCode
+	d.LastError = delivery.LastError
+	d.NextAttemptAt = copyTime(delivery.NextAttemptAt)
+	d.DeliveredAt = copyTime(delivery.DeliveredAt)
+	return nil
+}
+
+func copyOutboxEvent(event models.OutboxEvent) models.OutboxEvent {
+	event.Data = append(json.RawMessage(nil), event.Data...)
+	event.NextAttemptAt = copyTime(event.NextAttemptAt)
+	event.DeadLetteredAt = copyTime(event.DeadLetteredAt)
+	return event
+}
+
+func copyDelivery(d models.WebhookDelivery) models.WebhookDelivery {
+	d.NextAttemptAt = copyTime(d.NextAttemptAt)
+	d.DeliveredAt = copyTime(d.DeliveredAt)
+	return d
+}
@@ -0,0 +1,291 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema migrations of each dialect in a directory
+// of its own, named VERSION_NAME.up.sql and VERSION_NAME.down.sql with
+// versions numbered from 1 without gaps. Both dialects have the same versions.
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// Migration is one step of the schema. Up moves the schema from the previous
+// version to Version and Down moves it back.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// mustLoadMigrations parses the embedded migrations. They are part of the
+// binary, so a malformed one is a build mistake rather than a runtime error.
+func mustLoadMigrations(files fs.FS, dir string) []Migration {
+	loaded, err := loadMigrations(files, dir)
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}
+
+func loadMigrations(files fs.FS, dir string) ([]Migration, error) {
+	names, err := fs.Glob(files, dir+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, path := range names {
+		file := strings.TrimPrefix(path, dir+"/")
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		versionStr, name, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionStr)
+		if !ok || !found || err != nil || version < 1 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: name must be VERSION_NAME.up.sql or VERSION_NAME.down.sql", file)
+		}
+
+		data, err := fs.ReadFile(files, path)
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	loaded := make([]Migration, len(byVersion))
+	for version, m := range byVersion {
+		if version > len(loaded) {
+			return nil, fmt.Errorf("migration %d: versions must run from 1 without gaps", version)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d: needs both an up and a down step", version)
+		}
+		loaded[version-1] = *m
+	}
+	return loaded, nil
+}
+
+// Migrations returns the database's schema migrations built into the binary,
+// in version order
+func (db *DB) Migrations() []Migration {
+	return db.dialect.migrations
+}
+
+// LatestSchemaVersion is the schema version the binary's queries are written for
+func LatestSchemaVersion() int {
+	return len(sqlite.migrations)
+}
+
+func init() {
+	if len(postgres.migrations) != len(sqlite.migrations) {
+		panic("db: the sqlite and postgres migrations must have the same versions")
+	}
+}
+
+// SchemaVersion returns the version of the database's schema, 0 for an empty
+// database. Databases made with data/init.sql before migrations were tracked
+// are given the version their schema matches; the original init.sql schema,
+// with only products and valid_coupons, is version 0 too.
+func (db *DB) SchemaVersion(ctx context.Context) (int, error) {
+	tracked, err := db.tableExists(ctx, "schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+	if !tracked {
+		return db.untrackedSchemaVersion(ctx)
+	}
+
+	var version int
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// untrackedSchemaVersion works out the version of a schema built by init.sql
+// from the columns and tables each migration added. The original init.sql
+// had no orders table, so its schema is older than any migration.
+func (db *DB) untrackedSchemaVersion(ctx context.Context) (int, error) {
+	checks := []struct {
+		version int
+		exists  func() (bool, error)
+	}{
+		{4, func() (bool, error) { return db.columnExists(ctx, "products", "tax_category") }},
+		{3, func() (bool, error) { return db.tableExists(ctx, "product_prices") }},
+		{2, func() (bool, error) { return db.columnExists(ctx, "products", "currency") }},
+		{1, func() (bool, error) { return db.tableExists(ctx, "orders") }},
+	}
+	for _, check := range checks {
+		exists, err := check.exists()
+		if err != nil {
+			return 0, err
+		}
+		if exists {
+			return check.version, nil
+		}
+	}
+	return 0, nil
+}
+
+func (db *DB) tableExists(ctx context.Context, table string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, db.dialect.tableExists, table).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to read schema: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (db *DB) columnExists(ctx context.Context, table, column string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, db.dialect.columnExists, table, column).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to read schema: %w", err)
+	}
+	return n > 0, nil
+}
+
+// checkSchemaVersion refuses databases migrated by a newer binary, whose
+// schema the queries here may not match
+func (db *DB) checkSchemaVersion(ctx context.Context) error {
+	version, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version > LatestSchemaVersion() {
+		return &SchemaTooNewError{Version: version, Latest: LatestSchemaVersion()}
+	}
+	return nil
+}
+
+// Migrate moves the schema to version by applying up steps or reverting down
+// steps in order, each in its own transaction with its schema_migrations row.
+// It returns the migrations that ran, in the order they ran; an error stops
+// at the version the last successful step reached.
+func (db *DB) Migrate(ctx context.Context, version int) ([]Migration, error) {
+	if version < 0 || version > LatestSchemaVersion() {
+		return nil, fmt.Errorf("schema version %d does not exist; the latest is %d", version, LatestSchemaVersion())
+	}
+	if err := db.checkSchemaVersion(ctx); err != nil {
+		return nil, err
+	}
+	current, err := db.trackSchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for ; current < version; current++ {
+		m := db.dialect.migrations[current]
+		up := m.Up
+		if current == 0 {
+			if up, err = db.initialStep(ctx); err != nil {
+				return ran, err
+			}
+		}
+		err := db.runMigration(ctx, up, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.Version, m.Name, time.Now().UTC())
+		if err != nil {
+			return ran, fmt.Errorf("migration %d %s up: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	for ; current > version; current-- {
+		m := db.dialect.migrations[current-1]
+		if err := db.runMigration(ctx, m.Down, `DELETE FROM schema_migrations WHERE version = ?`, m.Version); err != nil {
+			return ran, fmt.Errorf("migration %d %s down: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// initialStep returns the up step of the first migration. A database built by
+// the original init.sql already has products and valid_coupons, so for it the
+// step moves them aside, creates the schema and copies their rows back.
+func (db *DB) initialStep(ctx context.Context) (string, error) {
+	initial := db.dialect.migrations[0].Up
+	baseline, err := db.tableExists(ctx, "products")
+	if err != nil || !baseline {
+		return initial, err
+	}
+	return `ALTER TABLE products RENAME TO init_products;
+ALTER TABLE valid_coupons RENAME TO init_valid_coupons;
+` + initial + `
+INSERT INTO products (id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop)
+SELECT id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop FROM init_products;
+INSERT INTO valid_coupons (code) SELECT code FROM init_valid_coupons;
+DROP TABLE init_products;
+DROP TABLE init_valid_coupons;`, nil
+}
+
+// trackSchemaVersion creates the schema_migrations table if the database has
+// none yet, recording the migrations an init.sql schema already matches
+func (db *DB) trackSchemaVersion(ctx context.Context) (int, error) {
+	version, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	now := time.Now().UTC()
+	for _, m := range db.dialect.migrations[:version] {
+		_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)
+			ON CONFLICT (version) DO NOTHING`,
+			m.Version, m.Name, now)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record schema version: %w", err)
+		}
+	}
+	return version, tx.Commit()
+}
+
+// runMigration runs a migration step and its schema_migrations change in one transaction
+func (db *DB) runMigration(ctx context.Context, step, record string, args ...any) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, step); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
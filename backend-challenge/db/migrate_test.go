@@ -0,0 +1,273 @@
+package db
+
+import (
+	"backend-challenge/db/pgtest"
+	"backend-challenge/models"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// openEmptyTestDB opens a new database with no tables
+func openEmptyTestDB(t *testing.T) *DB {
+	t.Helper()
+	if pgtest.Enabled() {
+		return setupPostgresTestDB(t, false)
+	}
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func migrateTo(t *testing.T, db *DB, version int) []Migration {
+	t.Helper()
+	ran, err := db.Migrate(context.Background(), version)
+	if err != nil {
+		t.Fatalf("Migrate(%d) failed: %v", version, err)
+	}
+	return ran
+}
+
+func schemaVersion(t *testing.T, db *DB) int {
+	t.Helper()
+	version, err := db.SchemaVersion(context.Background())
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	return version
+}
+
+func TestCommittedDatabaseIsMigrated(t *testing.T) {
+	db := setupTestDB(t)
+	if got := schemaVersion(t, db); got != LatestSchemaVersion() {
+		t.Errorf("data/store.db is at schema version %d, want %d; rebuild it with make init", got, LatestSchemaVersion())
+	}
+}
+
+func TestMigrate_UpAndDown(t *testing.T) {
+	db := openEmptyTestDB(t)
+	ctx := context.Background()
+
+	if got := schemaVersion(t, db); got != 0 {
+		t.Fatalf("empty database at version %d, want 0", got)
+	}
+
+	ran := migrateTo(t, db, LatestSchemaVersion())
+	if len(ran) != LatestSchemaVersion() || ran[0].Version != 1 {
+		t.Errorf("Migrate up ran %d migrations starting at %d", len(ran), ran[0].Version)
+	}
+	if got := schemaVersion(t, db); got != LatestSchemaVersion() {
+		t.Errorf("version = %d, want %d", got, LatestSchemaVersion())
+	}
+	if _, err := db.GetAllProducts(ctx, models.ProductFilter{}, 0, 0); err != nil {
+		t.Errorf("queries fail on the migrated schema: %v", err)
+	}
+
+	// Down steps run newest first and leave only schema_migrations
+	ran = migrateTo(t, db, 0)
+	if len(ran) != LatestSchemaVersion() || ran[0].Version != LatestSchemaVersion() {
+		t.Errorf("Migrate down ran %d migrations starting at %d", len(ran), ran[0].Version)
+	}
+	for _, table := range []string{"products", "product_prices", "orders", "order_items", "valid_coupons", "api_keys", "outbox_events", "webhooks"} {
+		if exists, err := db.tableExists(ctx, table); err != nil || exists {
+			t.Errorf("table %s left after migrating down (err %v)", table, err)
+		}
+	}
+	if got := schemaVersion(t, db); got != 0 {
+		t.Errorf("version = %d after migrating down, want 0", got)
+	}
+
+	// And the schema can be built again
+	migrateTo(t, db, LatestSchemaVersion())
+	if ran := migrateTo(t, db, LatestSchemaVersion()); len(ran) != 0 {
+		t.Errorf("Migrate to the current version ran %d migrations", len(ran))
+	}
+
+	if _, err := db.Migrate(ctx, LatestSchemaVersion()+1); err == nil {
+		t.Error("expected an error migrating past the latest version")
+	}
+}
+
+func TestMigrate_OldFixture(t *testing.T) {
+	if pgtest.Enabled() {
+		t.Skip("the fixture is the original init.sql, which only ever built SQLite databases")
+	}
+	fixture, err := os.ReadFile("testdata/init.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := openEmptyTestDB(t)
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, string(fixture)); err != nil {
+		t.Fatalf("Failed to load fixture: %v", err)
+	}
+
+	// Only products and valid_coupons, so older than every migration
+	if got := schemaVersion(t, db); got != 0 {
+		t.Fatalf("fixture at version %d, want 0", got)
+	}
+
+	ran := migrateTo(t, db, LatestSchemaVersion())
+	if len(ran) != LatestSchemaVersion() || ran[0].Version != 1 {
+		t.Fatalf("Migrate ran %d migrations starting at %d, want all from 1", len(ran), ran[0].Version)
+	}
+	for _, table := range []string{"init_products", "init_valid_coupons"} {
+		if exists, err := db.tableExists(ctx, table); err != nil || exists {
+			t.Errorf("table %s left after migrating (err %v)", table, err)
+		}
+	}
+
+	products, err := db.GetAllProducts(ctx, models.ProductFilter{}, 0, 0)
+	if err != nil {
+		t.Fatalf("GetAllProducts failed: %v", err)
+	}
+	if len(products) != 9 {
+		t.Fatalf("got %d products after migrating, want 9", len(products))
+	}
+	product := products[0]
+	if product.ID != "1" || product.Price != aud(650) || product.TaxCategory != "standard" ||
+		product.Stock != nil || product.Image == nil || len(product.Prices) != 0 {
+		t.Errorf("migrated product = %+v", product)
+	}
+
+	coupons, err := db.ListCoupons(ctx, 0, 0)
+	if err != nil || len(coupons) != 8 {
+		t.Fatalf("ListCoupons = %d coupons, %v; want 8", len(coupons), err)
+	}
+	if valid, err := db.IsCouponValid(ctx, "HAPPYHRS"); err != nil || !valid {
+		t.Errorf("IsCouponValid(HAPPYHRS) = %v, %v after migrating", valid, err)
+	}
+
+	// Reverting to the first version gives back its dollar amounts
+	migrateTo(t, db, 1)
+	var price float64
+	if err := db.QueryRowContext(ctx, `SELECT price FROM products WHERE id = '1'`).Scan(&price); err != nil {
+		t.Fatal(err)
+	}
+	if price != 6.5 {
+		t.Errorf("price after migrating down = %v, want 6.5", price)
+	}
+}
+
+func TestMigrate_CouponMinorUnits(t *testing.T) {
+	db := openEmptyTestDB(t)
+	ctx := context.Background()
+
+	// Rules as version 6 stored them, with dollar amounts
+	migrateTo(t, db, 6)
+	for _, stmt := range []string{
+		`INSERT INTO valid_coupons (code) VALUES ('OVER9000'), ('SIXTYOFF')`,
+		`INSERT INTO coupon_rules (code, rule_type, value, min_subtotal) VALUES ('OVER9000', 'fixed_amount', 10.5, 90)`,
+		`INSERT INTO coupon_rules (code, rule_type, value, min_subtotal) VALUES ('SIXTYOFF', 'percentage', 60, 50.25)`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrateTo(t, db, 7)
+	want := map[string]models.CouponRule{
+		"OVER9000": {Code: "OVER9000", Type: models.CouponRuleFixedAmount, Amount: 1050, MinSubtotal: 9000},
+		"SIXTYOFF": {Code: "SIXTYOFF", Type: models.CouponRulePercentage, Value: 60, MinSubtotal: 5025},
+	}
+	for code, rule := range want {
+		c, err := db.GetCoupon(ctx, code)
+		if err != nil || c == nil || c.Rule == nil || *c.Rule != rule {
+			t.Errorf("GetCoupon(%s) after migrating = %+v, %v; want rule %+v", code, c, err, rule)
+		}
+	}
+
+	// Reverting gives back the dollar amounts
+	migrateTo(t, db, 6)
+	var value, minSubtotal float64
+	err := db.QueryRowContext(ctx, `SELECT value, min_subtotal FROM coupon_rules WHERE code = 'OVER9000'`).Scan(&value, &minSubtotal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 10.5 || minSubtotal != 90 {
+		t.Errorf("OVER9000 after migrating down = %v off over %v, want 10.5 off over 90", value, minSubtotal)
+	}
+}
+
+func TestNew_SchemaTooNew(t *testing.T) {
+	dsn := pgtest.DSN(t)
+	if dsn == "" {
+		dsn = filepath.Join(t.TempDir(), "test.db")
+	}
+	db, err := Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrateTo(t, db, LatestSchemaVersion())
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'future', CURRENT_TIMESTAMP)`,
+		LatestSchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	_, err = Open(dsn)
+	var tooNew *SchemaTooNewError
+	if !errors.Is(err, ErrSchemaTooNew) || !errors.As(err, &tooNew) || tooNew.Version != LatestSchemaVersion()+1 {
+		t.Errorf("Open() error = %v, want %v", err, ErrSchemaTooNew)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+	loaded, err := loadMigrations(fstest.MapFS{
+		"migrations/0002_second.up.sql":   file("up 2"),
+		"migrations/0002_second.down.sql": file("down 2"),
+		"migrations/0001_first.up.sql":    file("up 1"),
+		"migrations/0001_first.down.sql":  file("down 1"),
+	}, "migrations")
+	if err != nil {
+		t.Fatalf("loadMigrations failed: %v", err)
+	}
+	if len(loaded) != 2 || loaded[0].Name != "first" || loaded[1].Up != "up 2" || loaded[1].Down != "down 2" {
+		t.Errorf("loadMigrations = %+v", loaded)
+	}
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"gap", fstest.MapFS{
+			"migrations/0002_second.up.sql":   file("up"),
+			"migrations/0002_second.down.sql": file("down"),
+		}},
+		{"no down step", fstest.MapFS{"migrations/0001_first.up.sql": file("up")}},
+		{"bad name", fstest.MapFS{"migrations/first.sql": file("up")}},
+		{"bad direction", fstest.MapFS{"migrations/0001_first.sideways.sql": file("up")}},
+		{"names differ", fstest.MapFS{
+			"migrations/0001_first.up.sql":   file("up"),
+			"migrations/0001_other.down.sql": file("down"),
+		}},
+	}
+	for _, tt := range tests {
+		if _, err := loadMigrations(tt.files, "migrations"); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+// TestMigrations_DialectsMatch checks each SQLite migration has a Postgres
+// counterpart, so both backends agree on what a schema version means
+func TestMigrations_DialectsMatch(t *testing.T) {
+	if len(postgres.migrations) != len(sqlite.migrations) {
+		t.Fatalf("%d Postgres migrations, %d SQLite", len(postgres.migrations), len(sqlite.migrations))
+	}
+	for i, m := range sqlite.migrations {
+		if pg := postgres.migrations[i]; pg.Version != m.Version || pg.Name != m.Name {
+			t.Errorf("Postgres migration %d %s, SQLite %d %s", pg.Version, pg.Name, m.Version, m.Name)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+-- Prices and order amounts go back to dollars. The currency columns are
+-- dropped, so amounts in other currencies are read as AUD.
+
+ALTER TABLE order_items ALTER COLUMN amount TYPE DOUBLE PRECISION USING amount / 100.0;
+ALTER TABLE order_items ALTER COLUMN unit_price TYPE DOUBLE PRECISION USING unit_price / 100.0;
+
+ALTER TABLE orders DROP COLUMN currency;
+ALTER TABLE orders ALTER COLUMN total TYPE DOUBLE PRECISION USING total / 100.0;
+ALTER TABLE orders ALTER COLUMN discounts TYPE DOUBLE PRECISION USING discounts / 100.0;
+ALTER TABLE orders ALTER COLUMN subtotal TYPE DOUBLE PRECISION USING subtotal / 100.0;
+
+ALTER TABLE products DROP COLUMN currency;
+ALTER TABLE products ALTER COLUMN price TYPE DOUBLE PRECISION USING price / 100.0;
@@ -0,0 +1,13 @@
+-- Prices and order amounts become integer cents and get a currency, AUD for
+-- every existing row.
+
+ALTER TABLE products ALTER COLUMN price TYPE BIGINT USING ROUND(price * 100);
+ALTER TABLE products ADD COLUMN currency TEXT NOT NULL DEFAULT 'AUD';
+
+ALTER TABLE orders ALTER COLUMN subtotal TYPE BIGINT USING ROUND(subtotal * 100);
+ALTER TABLE orders ALTER COLUMN discounts TYPE BIGINT USING ROUND(discounts * 100);
+ALTER TABLE orders ALTER COLUMN total TYPE BIGINT USING ROUND(total * 100);
+ALTER TABLE orders ADD COLUMN currency TEXT NOT NULL DEFAULT 'AUD';
+
+ALTER TABLE order_items ALTER COLUMN unit_price TYPE BIGINT USING ROUND(unit_price * 100);
+ALTER TABLE order_items ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100);
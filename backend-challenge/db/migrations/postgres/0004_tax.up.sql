@@ -0,0 +1,8 @@
+-- Products get the tax category that picks their rate in each store, and
+-- orders and their lines the tax charged. Existing orders keep a tax of 0.
+
+ALTER TABLE products ADD COLUMN tax_category TEXT NOT NULL DEFAULT 'standard';
+ALTER TABLE orders ADD COLUMN tax BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE order_items ADD COLUMN tax BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN tax_category TEXT;
@@ -0,0 +1,4 @@
+-- The dispatcher polls for unpublished events that are due, so index the
+-- columns it filters on. The index on published_at alone is its prefix.
+DROP INDEX idx_outbox_events_published_at;
+CREATE INDEX idx_outbox_events_due ON outbox_events(published_at, dead_lettered_at, next_attempt_at);
@@ -0,0 +1,3 @@
+-- Response headers the handler set, other than Content-Type, as a JSON
+-- object, so replays carry them too
+ALTER TABLE idempotency_keys ADD COLUMN headers TEXT;
@@ -0,0 +1,6 @@
+-- Fixed amounts and minimum subtotals go back to dollars in value and
+-- min_subtotal
+
+UPDATE coupon_rules SET value = amount / 100.0 WHERE rule_type = 'fixed_amount';
+ALTER TABLE coupon_rules DROP COLUMN amount;
+ALTER TABLE coupon_rules ALTER COLUMN min_subtotal TYPE DOUBLE PRECISION USING min_subtotal / 100.0;
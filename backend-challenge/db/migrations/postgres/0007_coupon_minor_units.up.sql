@@ -0,0 +1,6 @@
+-- Fixed amounts and minimum subtotals become integer cents of the store
+-- currency. value keeps only percentages, and fixed amounts move to amount.
+
+ALTER TABLE coupon_rules ADD COLUMN amount BIGINT NOT NULL DEFAULT 0;
+UPDATE coupon_rules SET amount = ROUND(value * 100), value = 0 WHERE rule_type = 'fixed_amount';
+ALTER TABLE coupon_rules ALTER COLUMN min_subtotal TYPE BIGINT USING ROUND(min_subtotal * 100);
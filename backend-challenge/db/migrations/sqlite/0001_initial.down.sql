@@ -0,0 +1,13 @@
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
+DROP TABLE outbox_events;
+DROP TABLE idempotency_keys;
+DROP TABLE api_keys;
+DROP TABLE coupon_redemptions;
+DROP TABLE order_items;
+DROP TABLE order_status_history;
+DROP TABLE orders;
+DROP TABLE coupon_rules;
+DROP TABLE coupon_sources;
+DROP TABLE valid_coupons;
+DROP TABLE products;
@@ -0,0 +1,175 @@
+-- The schema as it was when data/init.sql built it, before prices were
+-- stored in minor units. Databases made with that init.sql are recorded at
+-- this version, or a later one matching their schema, when first migrated.
+
+CREATE TABLE products (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    category TEXT NOT NULL,
+    price REAL NOT NULL,
+    image_thumbnail TEXT,
+    image_mobile TEXT,
+    image_tablet TEXT,
+    image_desktop TEXT,
+    -- Units left to sell; NULL means stock is not tracked. Orders decrement it
+    -- in their transaction and cancelled orders put it back.
+    stock INTEGER CHECK (stock >= 0),
+    -- Set when the product is removed; deleted products stay so past orders still resolve them
+    deleted_at TIMESTAMP
+);
+
+-- Valid coupons with their redemption window and caps. NULL means unbounded.
+-- deactivated_at is set when the code is withdrawn; the row is kept for its redemptions.
+CREATE TABLE valid_coupons (
+    code TEXT PRIMARY KEY,
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    max_redemptions INTEGER,
+    max_per_customer INTEGER,
+    deactivated_at TIMESTAMP
+);
+
+-- Source files each imported coupon was found in. Coupons without rows here
+-- were added directly rather than imported.
+CREATE TABLE coupon_sources (
+    code TEXT NOT NULL REFERENCES valid_coupons(code),
+    source TEXT NOT NULL,
+    PRIMARY KEY (code, source)
+);
+
+-- Discount granted by each coupon: rule_type is one of percentage, fixed_amount,
+-- cheapest_free or free_item. value holds the percentage or amount, product_id
+-- the product made free, and min_subtotal the minimum basket the rule requires.
+CREATE TABLE coupon_rules (
+    code TEXT PRIMARY KEY REFERENCES valid_coupons(code),
+    rule_type TEXT NOT NULL,
+    value REAL NOT NULL DEFAULT 0,
+    product_id TEXT,
+    min_subtotal REAL NOT NULL DEFAULT 0
+);
+
+-- Placed orders with their priced totals. status is one of placed, accepted,
+-- preparing, ready, completed or cancelled.
+CREATE TABLE orders (
+    id TEXT PRIMARY KEY,
+    coupon_code TEXT,
+    customer_id TEXT,
+    subtotal REAL NOT NULL,
+    discounts REAL NOT NULL,
+    total REAL NOT NULL,
+    status TEXT NOT NULL DEFAULT 'placed',
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Every status an order has been moved to, with who moved it. from_status is
+-- NULL for the entry written when the order was placed.
+CREATE TABLE order_status_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id TEXT NOT NULL REFERENCES orders(id),
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    actor TEXT,
+    reason TEXT,
+    changed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_order_status_history_order ON order_status_history(order_id);
+
+-- Priced lines of each order, in the order they were requested
+CREATE TABLE order_items (
+    order_id TEXT NOT NULL REFERENCES orders(id),
+    line_no INTEGER NOT NULL,
+    product_id TEXT NOT NULL REFERENCES products(id),
+    quantity INTEGER NOT NULL,
+    unit_price REAL NOT NULL,
+    amount REAL NOT NULL,
+    PRIMARY KEY (order_id, line_no)
+);
+
+-- One row per order that redeemed a coupon, written in the order transaction
+CREATE TABLE coupon_redemptions (
+    code TEXT NOT NULL REFERENCES valid_coupons(code),
+    order_id TEXT NOT NULL REFERENCES orders(id),
+    customer_id TEXT,
+    redeemed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (code, order_id)
+);
+
+CREATE INDEX idx_coupon_redemptions_customer ON coupon_redemptions(code, customer_id);
+
+-- API keys, stored as the hex SHA-256 of the key. scopes is a space-separated
+-- list of create_order, read_orders and admin. A rotated key records the key
+-- that replaced it in replaced_by and keeps working until its expires_at.
+CREATE TABLE api_keys (
+    id TEXT PRIMARY KEY,
+    key_hash TEXT NOT NULL UNIQUE,
+    owner TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    disabled INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    replaced_by TEXT REFERENCES api_keys(id)
+);
+
+-- Requests made with an Idempotency-Key header, per API key, with the response
+-- to replay for retries. status_code is 0 while the request is in flight.
+CREATE TABLE idempotency_keys (
+    api_key_id TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    content_type TEXT,
+    body BLOB,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (api_key_id, idempotency_key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+-- Events written in the same transaction as the change they describe. The
+-- outbox dispatcher publishes them and sets published_at; failed attempts are
+-- retried from next_attempt_at until the event is dead-lettered.
+CREATE TABLE outbox_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_type TEXT NOT NULL,
+    data TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP,
+    published_at TIMESTAMP,
+    dead_lettered_at TIMESTAMP
+);
+
+CREATE INDEX idx_outbox_events_published_at ON outbox_events(published_at);
+
+-- Registered webhook endpoints. events is a space-separated list of event
+-- types; secret signs the deliveries. Deleted webhooks keep their deliveries.
+CREATE TABLE webhooks (
+    id TEXT PRIMARY KEY,
+    url TEXT NOT NULL,
+    events TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    deleted_at TIMESTAMP
+);
+
+-- One row per event and webhook, with the outcome of the latest attempt.
+-- status is one of pending, delivered or failed.
+CREATE TABLE webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id TEXT NOT NULL REFERENCES webhooks(id),
+    event_id INTEGER NOT NULL REFERENCES outbox_events(id),
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_status_code INTEGER,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP,
+    delivered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX idx_webhook_deliveries_status ON webhook_deliveries(status);
@@ -0,0 +1,54 @@
+-- Prices and order amounts go back to REAL dollars. The currency columns are
+-- dropped, so amounts in other currencies are read as AUD.
+
+CREATE TABLE products_old (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    category TEXT NOT NULL,
+    price REAL NOT NULL,
+    image_thumbnail TEXT,
+    image_mobile TEXT,
+    image_tablet TEXT,
+    image_desktop TEXT,
+    -- Units left to sell; NULL means stock is not tracked. Orders decrement it
+    -- in their transaction and cancelled orders put it back.
+    stock INTEGER CHECK (stock >= 0),
+    -- Set when the product is removed; deleted products stay so past orders still resolve them
+    deleted_at TIMESTAMP
+);
+INSERT INTO products_old (id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop, stock, deleted_at)
+    SELECT id, name, category, price / 100.0, image_thumbnail, image_mobile, image_tablet, image_desktop, stock, deleted_at
+    FROM products;
+DROP TABLE products;
+ALTER TABLE products_old RENAME TO products;
+
+CREATE TABLE orders_old (
+    id TEXT PRIMARY KEY,
+    coupon_code TEXT,
+    customer_id TEXT,
+    subtotal REAL NOT NULL,
+    discounts REAL NOT NULL,
+    total REAL NOT NULL,
+    status TEXT NOT NULL DEFAULT 'placed',
+    created_at TIMESTAMP NOT NULL
+);
+INSERT INTO orders_old (id, coupon_code, customer_id, subtotal, discounts, total, status, created_at)
+    SELECT id, coupon_code, customer_id, subtotal / 100.0, discounts / 100.0, total / 100.0, status, created_at
+    FROM orders;
+DROP TABLE orders;
+ALTER TABLE orders_old RENAME TO orders;
+
+CREATE TABLE order_items_old (
+    order_id TEXT NOT NULL REFERENCES orders(id),
+    line_no INTEGER NOT NULL,
+    product_id TEXT NOT NULL REFERENCES products(id),
+    quantity INTEGER NOT NULL,
+    unit_price REAL NOT NULL,
+    amount REAL NOT NULL,
+    PRIMARY KEY (order_id, line_no)
+);
+INSERT INTO order_items_old (order_id, line_no, product_id, quantity, unit_price, amount)
+    SELECT order_id, line_no, product_id, quantity, unit_price / 100.0, amount / 100.0
+    FROM order_items;
+DROP TABLE order_items;
+ALTER TABLE order_items_old RENAME TO order_items;
@@ -0,0 +1,60 @@
+-- Prices and order amounts become integer cents and get a currency, AUD for
+-- every existing row.
+
+-- SQLite can't change a column's type, so each table is rebuilt
+
+CREATE TABLE products_new (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    category TEXT NOT NULL,
+    -- Prices are integer minor units (cents) of the currency
+    price INTEGER NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'AUD',
+    image_thumbnail TEXT,
+    image_mobile TEXT,
+    image_tablet TEXT,
+    image_desktop TEXT,
+    -- Units left to sell; NULL means stock is not tracked. Orders decrement it
+    -- in their transaction and cancelled orders put it back.
+    stock INTEGER CHECK (stock >= 0),
+    -- Set when the product is removed; deleted products stay so past orders still resolve them
+    deleted_at TIMESTAMP
+);
+INSERT INTO products_new (id, name, category, price, currency, image_thumbnail, image_mobile, image_tablet, image_desktop, stock, deleted_at)
+    SELECT id, name, category, CAST(ROUND(price * 100) AS INTEGER), 'AUD', image_thumbnail, image_mobile, image_tablet, image_desktop, stock, deleted_at
+    FROM products;
+DROP TABLE products;
+ALTER TABLE products_new RENAME TO products;
+
+CREATE TABLE orders_new (
+    id TEXT PRIMARY KEY,
+    coupon_code TEXT,
+    customer_id TEXT,
+    subtotal INTEGER NOT NULL,
+    discounts INTEGER NOT NULL,
+    total INTEGER NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'AUD',
+    status TEXT NOT NULL DEFAULT 'placed',
+    created_at TIMESTAMP NOT NULL
+);
+INSERT INTO orders_new (id, coupon_code, customer_id, subtotal, discounts, total, currency, status, created_at)
+    SELECT id, coupon_code, customer_id, CAST(ROUND(subtotal * 100) AS INTEGER), CAST(ROUND(discounts * 100) AS INTEGER),
+        CAST(ROUND(total * 100) AS INTEGER), 'AUD', status, created_at
+    FROM orders;
+DROP TABLE orders;
+ALTER TABLE orders_new RENAME TO orders;
+
+CREATE TABLE order_items_new (
+    order_id TEXT NOT NULL REFERENCES orders(id),
+    line_no INTEGER NOT NULL,
+    product_id TEXT NOT NULL REFERENCES products(id),
+    quantity INTEGER NOT NULL,
+    unit_price INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+    PRIMARY KEY (order_id, line_no)
+);
+INSERT INTO order_items_new (order_id, line_no, product_id, quantity, unit_price, amount)
+    SELECT order_id, line_no, product_id, quantity, CAST(ROUND(unit_price * 100) AS INTEGER), CAST(ROUND(amount * 100) AS INTEGER)
+    FROM order_items;
+DROP TABLE order_items;
+ALTER TABLE order_items_new RENAME TO order_items;
@@ -0,0 +1,9 @@
+-- Prices of products in currencies other than their own, in integer minor
+-- units. Currencies without a row are converted from the product's price
+-- using the exchange rate table.
+CREATE TABLE product_prices (
+    product_id TEXT NOT NULL REFERENCES products(id),
+    currency TEXT NOT NULL,
+    price INTEGER NOT NULL,
+    PRIMARY KEY (product_id, currency)
+);
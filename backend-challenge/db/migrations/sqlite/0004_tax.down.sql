@@ -0,0 +1,5 @@
+ALTER TABLE order_items DROP COLUMN tax_category;
+ALTER TABLE order_items DROP COLUMN tax;
+ALTER TABLE orders DROP COLUMN tax_inclusive;
+ALTER TABLE orders DROP COLUMN tax;
+ALTER TABLE products DROP COLUMN tax_category;
@@ -0,0 +1,2 @@
+DROP INDEX idx_outbox_events_due;
+CREATE INDEX idx_outbox_events_published_at ON outbox_events(published_at);
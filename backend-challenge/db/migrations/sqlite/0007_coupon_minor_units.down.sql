@@ -0,0 +1,17 @@
+-- Fixed amounts and minimum subtotals go back to REAL dollars in value and
+-- min_subtotal
+
+CREATE TABLE coupon_rules_old (
+    code TEXT PRIMARY KEY REFERENCES valid_coupons(code),
+    rule_type TEXT NOT NULL,
+    value REAL NOT NULL DEFAULT 0,
+    product_id TEXT,
+    min_subtotal REAL NOT NULL DEFAULT 0
+);
+INSERT INTO coupon_rules_old (code, rule_type, value, product_id, min_subtotal)
+    SELECT code, rule_type,
+        CASE WHEN rule_type = 'fixed_amount' THEN amount / 100.0 ELSE value END,
+        product_id, min_subtotal / 100.0
+    FROM coupon_rules;
+DROP TABLE coupon_rules;
+ALTER TABLE coupon_rules_old RENAME TO coupon_rules;
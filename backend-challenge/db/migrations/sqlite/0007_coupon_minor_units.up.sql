@@ -0,0 +1,23 @@
+-- Fixed amounts and minimum subtotals become integer cents of the store
+-- currency. value keeps only percentages, and fixed amounts move to amount.
+
+-- SQLite can't change a column's type, so the table is rebuilt
+
+CREATE TABLE coupon_rules_new (
+    code TEXT PRIMARY KEY REFERENCES valid_coupons(code),
+    rule_type TEXT NOT NULL,
+    -- The percentage off, for percentage rules
+    value REAL NOT NULL DEFAULT 0,
+    -- The amount off, for fixed_amount rules, in integer minor units (cents)
+    amount INTEGER NOT NULL DEFAULT 0,
+    product_id TEXT,
+    min_subtotal INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO coupon_rules_new (code, rule_type, value, amount, product_id, min_subtotal)
+    SELECT code, rule_type,
+        CASE WHEN rule_type = 'fixed_amount' THEN 0 ELSE value END,
+        CASE WHEN rule_type = 'fixed_amount' THEN CAST(ROUND(value * 100) AS INTEGER) ELSE 0 END,
+        product_id, CAST(ROUND(min_subtotal * 100) AS INTEGER)
+    FROM coupon_rules;
+DROP TABLE coupon_rules;
+ALTER TABLE coupon_rules_new RENAME TO coupon_rules;
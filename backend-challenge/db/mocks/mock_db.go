@@ -13,6 +13,7 @@ import (
 	models "backend-challenge/models"
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "go.uber.org/mock/gomock"
 )
@@ -55,19 +56,191 @@ func (mr *MockDatabaseMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockDatabase)(nil).Close))
 }
 
+// CompleteIdempotencyKey mocks base method.
+func (m *MockDatabase) CompleteIdempotencyKey(ctx context.Context, req *models.IdempotentRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteIdempotencyKey", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompleteIdempotencyKey indicates an expected call of CompleteIdempotencyKey.
+func (mr *MockDatabaseMockRecorder) CompleteIdempotencyKey(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteIdempotencyKey", reflect.TypeOf((*MockDatabase)(nil).CompleteIdempotencyKey), ctx, req)
+}
+
+// CountCustomerRedemptions mocks base method.
+func (m *MockDatabase) CountCustomerRedemptions(ctx context.Context, code, customerID string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountCustomerRedemptions", ctx, code, customerID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountCustomerRedemptions indicates an expected call of CountCustomerRedemptions.
+func (mr *MockDatabaseMockRecorder) CountCustomerRedemptions(ctx, code, customerID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountCustomerRedemptions", reflect.TypeOf((*MockDatabase)(nil).CountCustomerRedemptions), ctx, code, customerID)
+}
+
+// CreateCoupon mocks base method.
+func (m *MockDatabase) CreateCoupon(ctx context.Context, coupon *models.Coupon) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateCoupon", ctx, coupon)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateCoupon indicates an expected call of CreateCoupon.
+func (mr *MockDatabaseMockRecorder) CreateCoupon(ctx, coupon any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCoupon", reflect.TypeOf((*MockDatabase)(nil).CreateCoupon), ctx, coupon)
+}
+
+// CreateOrder mocks base method.
+func (m *MockDatabase) CreateOrder(ctx context.Context, order *models.Order) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrder", ctx, order)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateOrder indicates an expected call of CreateOrder.
+func (mr *MockDatabaseMockRecorder) CreateOrder(ctx, order any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrder", reflect.TypeOf((*MockDatabase)(nil).CreateOrder), ctx, order)
+}
+
+// CreateProduct mocks base method.
+func (m *MockDatabase) CreateProduct(ctx context.Context, product *models.Product) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateProduct", ctx, product)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateProduct indicates an expected call of CreateProduct.
+func (mr *MockDatabaseMockRecorder) CreateProduct(ctx, product any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateProduct", reflect.TypeOf((*MockDatabase)(nil).CreateProduct), ctx, product)
+}
+
+// CreateWebhook mocks base method.
+func (m *MockDatabase) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhook", ctx, webhook)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateWebhook indicates an expected call of CreateWebhook.
+func (mr *MockDatabaseMockRecorder) CreateWebhook(ctx, webhook any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhook", reflect.TypeOf((*MockDatabase)(nil).CreateWebhook), ctx, webhook)
+}
+
+// DeactivateCoupon mocks base method.
+func (m *MockDatabase) DeactivateCoupon(ctx context.Context, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeactivateCoupon", ctx, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeactivateCoupon indicates an expected call of DeactivateCoupon.
+func (mr *MockDatabaseMockRecorder) DeactivateCoupon(ctx, code any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeactivateCoupon", reflect.TypeOf((*MockDatabase)(nil).DeactivateCoupon), ctx, code)
+}
+
+// DeleteProduct mocks base method.
+func (m *MockDatabase) DeleteProduct(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteProduct", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteProduct indicates an expected call of DeleteProduct.
+func (mr *MockDatabaseMockRecorder) DeleteProduct(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProduct", reflect.TypeOf((*MockDatabase)(nil).DeleteProduct), ctx, id)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockDatabase) DeleteWebhook(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockDatabaseMockRecorder) DeleteWebhook(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockDatabase)(nil).DeleteWebhook), ctx, id)
+}
+
+// GetAPIKeyByHash mocks base method.
+func (m *MockDatabase) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeyByHash", ctx, keyHash)
+	ret0, _ := ret[0].(*models.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKeyByHash indicates an expected call of GetAPIKeyByHash.
+func (mr *MockDatabaseMockRecorder) GetAPIKeyByHash(ctx, keyHash any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeyByHash", reflect.TypeOf((*MockDatabase)(nil).GetAPIKeyByHash), ctx, keyHash)
+}
+
 // GetAllProducts mocks base method.
-func (m *MockDatabase) GetAllProducts(ctx context.Context, limit, offset int) ([]models.Product, error) {
+func (m *MockDatabase) GetAllProducts(ctx context.Context, filter models.ProductFilter, limit, offset int) ([]models.Product, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllProducts", ctx, limit, offset)
+	ret := m.ctrl.Call(m, "GetAllProducts", ctx, filter, limit, offset)
 	ret0, _ := ret[0].([]models.Product)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAllProducts indicates an expected call of GetAllProducts.
-func (mr *MockDatabaseMockRecorder) GetAllProducts(ctx, limit, offset any) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) GetAllProducts(ctx, filter, limit, offset any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllProducts", reflect.TypeOf((*MockDatabase)(nil).GetAllProducts), ctx, filter, limit, offset)
+}
+
+// GetCoupon mocks base method.
+func (m *MockDatabase) GetCoupon(ctx context.Context, code string) (*models.Coupon, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCoupon", ctx, code)
+	ret0, _ := ret[0].(*models.Coupon)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCoupon indicates an expected call of GetCoupon.
+func (mr *MockDatabaseMockRecorder) GetCoupon(ctx, code any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllProducts", reflect.TypeOf((*MockDatabase)(nil).GetAllProducts), ctx, limit, offset)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCoupon", reflect.TypeOf((*MockDatabase)(nil).GetCoupon), ctx, code)
+}
+
+// GetOrderByID mocks base method.
+func (m *MockDatabase) GetOrderByID(ctx context.Context, id string) (*models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderByID", ctx, id)
+	ret0, _ := ret[0].(*models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderByID indicates an expected call of GetOrderByID.
+func (mr *MockDatabaseMockRecorder) GetOrderByID(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderByID", reflect.TypeOf((*MockDatabase)(nil).GetOrderByID), ctx, id)
 }
 
 // GetProductByID mocks base method.
@@ -99,3 +272,133 @@ func (mr *MockDatabaseMockRecorder) IsCouponValid(ctx, code any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsCouponValid", reflect.TypeOf((*MockDatabase)(nil).IsCouponValid), ctx, code)
 }
+
+// ListCoupons mocks base method.
+func (m *MockDatabase) ListCoupons(ctx context.Context, limit, offset int) ([]models.Coupon, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCoupons", ctx, limit, offset)
+	ret0, _ := ret[0].([]models.Coupon)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListCoupons indicates an expected call of ListCoupons.
+func (mr *MockDatabaseMockRecorder) ListCoupons(ctx, limit, offset any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCoupons", reflect.TypeOf((*MockDatabase)(nil).ListCoupons), ctx, limit, offset)
+}
+
+// ListWebhookDeliveries mocks base method.
+func (m *MockDatabase) ListWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) ([]models.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWebhookDeliveries", ctx, webhookID, limit, offset)
+	ret0, _ := ret[0].([]models.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWebhookDeliveries indicates an expected call of ListWebhookDeliveries.
+func (mr *MockDatabaseMockRecorder) ListWebhookDeliveries(ctx, webhookID, limit, offset any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWebhookDeliveries", reflect.TypeOf((*MockDatabase)(nil).ListWebhookDeliveries), ctx, webhookID, limit, offset)
+}
+
+// ListWebhooks mocks base method.
+func (m *MockDatabase) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWebhooks", ctx)
+	ret0, _ := ret[0].([]models.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWebhooks indicates an expected call of ListWebhooks.
+func (mr *MockDatabaseMockRecorder) ListWebhooks(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWebhooks", reflect.TypeOf((*MockDatabase)(nil).ListWebhooks), ctx)
+}
+
+// ReleaseIdempotencyKey mocks base method.
+func (m *MockDatabase) ReleaseIdempotencyKey(ctx context.Context, apiKeyID, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseIdempotencyKey", ctx, apiKeyID, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseIdempotencyKey indicates an expected call of ReleaseIdempotencyKey.
+func (mr *MockDatabaseMockRecorder) ReleaseIdempotencyKey(ctx, apiKeyID, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseIdempotencyKey", reflect.TypeOf((*MockDatabase)(nil).ReleaseIdempotencyKey), ctx, apiKeyID, key)
+}
+
+// ReserveIdempotencyKey mocks base method.
+func (m *MockDatabase) ReserveIdempotencyKey(ctx context.Context, req *models.IdempotentRequest, staleBefore time.Time) (*models.IdempotentRequest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveIdempotencyKey", ctx, req, staleBefore)
+	ret0, _ := ret[0].(*models.IdempotentRequest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReserveIdempotencyKey indicates an expected call of ReserveIdempotencyKey.
+func (mr *MockDatabaseMockRecorder) ReserveIdempotencyKey(ctx, req, staleBefore any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveIdempotencyKey", reflect.TypeOf((*MockDatabase)(nil).ReserveIdempotencyKey), ctx, req, staleBefore)
+}
+
+// SetProductStock mocks base method.
+func (m *MockDatabase) SetProductStock(ctx context.Context, id string, stock *int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetProductStock", ctx, id, stock)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetProductStock indicates an expected call of SetProductStock.
+func (mr *MockDatabaseMockRecorder) SetProductStock(ctx, id, stock any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProductStock", reflect.TypeOf((*MockDatabase)(nil).SetProductStock), ctx, id, stock)
+}
+
+// TouchAPIKey mocks base method.
+func (m *MockDatabase) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchAPIKey", ctx, id, usedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchAPIKey indicates an expected call of TouchAPIKey.
+func (mr *MockDatabaseMockRecorder) TouchAPIKey(ctx, id, usedAt any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchAPIKey", reflect.TypeOf((*MockDatabase)(nil).TouchAPIKey), ctx, id, usedAt)
+}
+
+// UpdateOrderStatus mocks base method.
+func (m *MockDatabase) UpdateOrderStatus(ctx context.Context, id string, change models.OrderStatusChange) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOrderStatus", ctx, id, change)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOrderStatus indicates an expected call of UpdateOrderStatus.
+func (mr *MockDatabaseMockRecorder) UpdateOrderStatus(ctx, id, change any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrderStatus", reflect.TypeOf((*MockDatabase)(nil).UpdateOrderStatus), ctx, id, change)
+}
+
+// UpdateProduct mocks base method.
+func (m *MockDatabase) UpdateProduct(ctx context.Context, product *models.Product) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProduct", ctx, product)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProduct indicates an expected call of UpdateProduct.
+func (mr *MockDatabaseMockRecorder) UpdateProduct(ctx, product any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProduct", reflect.TypeOf((*MockDatabase)(nil).UpdateProduct), ctx, product)
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"backend-challenge/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// insertOutboxEvent records an event about data in the transaction that makes
+// the change, so the change and its event are committed or rolled back together
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, eventType string, data interface{}, at time.Time) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO outbox_events (event_type, data, created_at) VALUES (?, ?, ?)`,
+		eventType, string(payload), at.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// outboxColumns selects an outbox event in the order scanOutboxEvent expects
+const outboxColumns = `id, event_type, data, created_at, attempts, last_error, next_attempt_at, dead_lettered_at FROM outbox_events`
+
+// PendingOutboxEvents returns up to limit unpublished events that are due at
+// now and have not been dead-lettered, oldest first
+func (db *DB) PendingOutboxEvents(ctx context.Context, now time.Time, limit int) ([]models.OutboxEvent, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+outboxColumns+` WHERE published_at IS NULL AND dead_lettered_at IS NULL
+		AND (next_attempt_at IS NULL OR next_attempt_at <= ?) ORDER BY id`+pageClause(limit, 0), now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		event, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get outbox events: %w", err)
+		}
+		events = append(events, *event)
+	}
+	return events, rows.Err()
+}
+
+// MarkOutboxEventPublished records that an event has been published
+func (db *DB) MarkOutboxEventPublished(ctx context.Context, id int64, at time.Time) error {
+	res, err := db.ExecContext(ctx,
+		`UPDATE outbox_events SET published_at = ?, next_attempt_at = NULL WHERE id = ?`, at.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event published: %w", err)
+	}
+	return requireRow(res, ErrOutboxEventNotFound)
+}
+
+// RecordOutboxFailure stores a failed attempt to publish an event: its
+// attempts, last error, and either its next attempt or when it was dead-lettered
+func (db *DB) RecordOutboxFailure(ctx context.Context, event models.OutboxEvent) error {
+	res, err := db.ExecContext(ctx,
+		`UPDATE outbox_events SET attempts = ?, last_error = ?, next_attempt_at = ?, dead_lettered_at = ? WHERE id = ?`,
+		event.Attempts, nullString(event.LastError), nullTime(event.NextAttemptAt), nullTime(event.DeadLetteredAt), event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record outbox failure: %w", err)
+	}
+	return requireRow(res, ErrOutboxEventNotFound)
+}
+
+// ListDeadLetteredEvents returns the events that failed too often to be
+// retried, oldest first
+func (db *DB) ListDeadLetteredEvents(ctx context.Context) ([]models.OutboxEvent, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+outboxColumns+` WHERE dead_lettered_at IS NOT NULL ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead-lettered events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		event, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list dead-lettered events: %w", err)
+		}
+		events = append(events, *event)
+	}
+	return events, rows.Err()
+}
+
+// RequeueOutboxEvent gives a dead-lettered event a fresh set of attempts. It
+// returns ErrOutboxEventNotFound unless the event is dead-lettered.
+func (db *DB) RequeueOutboxEvent(ctx context.Context, id int64) error {
+	res, err := db.ExecContext(ctx,
+		`UPDATE outbox_events SET attempts = 0, next_attempt_at = NULL, dead_lettered_at = NULL
+		WHERE id = ? AND dead_lettered_at IS NOT NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to requeue outbox event: %w", err)
+	}
+	return requireRow(res, ErrOutboxEventNotFound)
+}
+
+// scanOutboxEvent scans outboxColumns into an OutboxEvent
+func scanOutboxEvent(scanner rowScanner) (*models.OutboxEvent, error) {
+	var event models.OutboxEvent
+	var data string
+	var lastError sql.NullString
+	var nextAttemptAt, deadLetteredAt sql.NullTime
+	err := scanner.Scan(&event.ID, &event.Type, &data, &event.CreatedAt, &event.Attempts,
+		&lastError, &nextAttemptAt, &deadLetteredAt)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Data = json.RawMessage(data)
+	event.LastError = lastError.String
+	if nextAttemptAt.Valid {
+		event.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if deadLetteredAt.Valid {
+		event.DeadLetteredAt = &deadLetteredAt.Time
+	}
+	return &event, nil
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"backend-challenge/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCreateOrder_WritesOutboxEvents(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	placeTestOrder(t, db, "order-1", "HAPPYHRS", "alice")
+	change := models.OrderStatusChange{From: models.OrderPlaced, To: models.OrderAccepted, Actor: "kitchen", At: time.Now().UTC()}
+	if err := db.UpdateOrderStatus(ctx, "order-1", change); err != nil {
+		t.Fatalf("Failed to update order status: %v", err)
+	}
+
+	events, err := db.PendingOutboxEvents(ctx, time.Now(), 10)
+	if err != nil {
+		t.Fatalf("Failed to get outbox events: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %+v", events)
+	}
+	want := []string{models.EventOrderPlaced, models.EventCouponRedeemed, models.EventOrderStatusChanged}
+	for i, event := range events {
+		if event.Type != want[i] {
+			t.Errorf("Event %d: expected %s, got %s", i, want[i], event.Type)
+		}
+	}
+
+	var redemption models.CouponRedemption
+	if err := json.Unmarshal(events[1].Data, &redemption); err != nil {
+		t.Fatalf("Failed to decode redemption: %v", err)
+	}
+	if redemption.Code != "HAPPYHRS" || redemption.OrderID != "order-1" || redemption.CustomerID != "alice" {
+		t.Errorf("Unexpected redemption: %+v", redemption)
+	}
+
+	// Status change events are numbered like streamed order events
+	var statusEvent models.OrderEvent
+	if err := json.Unmarshal(events[2].Data, &statusEvent); err != nil {
+		t.Fatalf("Failed to decode status change: %v", err)
+	}
+	if statusEvent.ID != 1 || statusEvent.OrderID != "order-1" || statusEvent.To != models.OrderAccepted {
+		t.Errorf("Unexpected status change: %+v", statusEvent)
+	}
+}
+
+func TestCreateOrder_RollsBackOutboxEvents(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	if _, err := db.Exec(`UPDATE valid_coupons SET max_redemptions = 0 WHERE code = 'HAPPYHRS'`); err != nil {
+		t.Fatalf("Failed to cap coupon: %v", err)
+	}
+	if err := db.CreateOrder(ctx, testOrder("order-1", "HAPPYHRS", "")); !errors.Is(err, ErrRedemptionLimit) {
+		t.Fatalf("Expected ErrRedemptionLimit, got %v", err)
+	}
+
+	events, err := db.PendingOutboxEvents(ctx, time.Now(), 10)
+	if err != nil {
+		t.Fatalf("Failed to get outbox events: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events for a failed order, got %+v", events)
+	}
+}
+
+func TestOutboxRetryAndDeadLetter(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	placeTestOrder(t, db, "order-1", "", "")
+	placeTestOrder(t, db, "order-2", "", "")
+	events, err := db.PendingOutboxEvents(ctx, now, 10)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("Expected two outbox events, got %+v, %v", events, err)
+	}
+	if first, err := db.PendingOutboxEvents(ctx, now, 1); err != nil || len(first) != 1 || first[0].ID != events[0].ID {
+		t.Errorf("Expected the oldest event with a limit of 1, got %+v, %v", first, err)
+	}
+
+	if err := db.MarkOutboxEventPublished(ctx, events[1].ID, now); err != nil {
+		t.Fatalf("Failed to mark event published: %v", err)
+	}
+
+	// Retries are compared as times whatever zone they are given in
+	retryAt := now.Add(time.Minute).In(time.FixedZone("AEST", 10*60*60))
+	failed := events[0]
+	failed.Attempts, failed.LastError, failed.NextAttemptAt = 1, "broker unavailable", &retryAt
+	if err := db.RecordOutboxFailure(ctx, failed); err != nil {
+		t.Fatalf("Failed to record failure: %v", err)
+	}
+
+	if pending, _ := db.PendingOutboxEvents(ctx, now, 10); len(pending) != 0 {
+		t.Errorf("Expected no events before the retry, got %+v", pending)
+	}
+	pending, err := db.PendingOutboxEvents(ctx, retryAt, 10)
+	if err != nil || len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError != "broker unavailable" {
+		t.Fatalf("Expected the failed event due at its retry, got %+v, %v", pending, err)
+	}
+
+	failed.Attempts, failed.NextAttemptAt, failed.DeadLetteredAt = 2, nil, &retryAt
+	if err := db.RecordOutboxFailure(ctx, failed); err != nil {
+		t.Fatalf("Failed to record failure: %v", err)
+	}
+	if pending, _ := db.PendingOutboxEvents(ctx, retryAt.Add(time.Hour), 10); len(pending) != 0 {
+		t.Errorf("Expected dead-lettered event skipped, got %+v", pending)
+	}
+	dead, err := db.ListDeadLetteredEvents(ctx)
+	if err != nil || len(dead) != 1 || dead[0].ID != failed.ID || dead[0].DeadLetteredAt == nil {
+		t.Fatalf("Expected the dead-lettered event, got %+v, %v", dead, err)
+	}
+
+	// Requeued events start over; only dead-lettered ones can be requeued
+	if err := db.RequeueOutboxEvent(ctx, failed.ID); err != nil {
+		t.Fatalf("Failed to requeue event: %v", err)
+	}
+	pending, err = db.PendingOutboxEvents(ctx, now, 10)
+	if err != nil || len(pending) != 1 || pending[0].Attempts != 0 {
+		t.Errorf("Expected the requeued event pending, got %+v, %v", pending, err)
+	}
+	if err := db.RequeueOutboxEvent(ctx, failed.ID); !errors.Is(err, ErrOutboxEventNotFound) {
+		t.Errorf("Expected ErrOutboxEventNotFound, got %v", err)
+	}
+	if err := db.RequeueOutboxEvent(ctx, events[1].ID); !errors.Is(err, ErrOutboxEventNotFound) {
+		t.Errorf("Expected ErrOutboxEventNotFound for a published event, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Package pgtest gives tests a database of their own on the Postgres server
+// named by the TEST_POSTGRES_DSN environment variable, so the suites written
+// against SQLite can run against Postgres too:
+//
+//	TEST_POSTGRES_DSN=postgres://localhost/postgres?sslmode=disable go test ./...
+package pgtest
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// EnvVar names the server tests run against; they use SQLite when it is unset
+const EnvVar = "TEST_POSTGRES_DSN"
+
+// Enabled reports whether tests should run against Postgres
+func Enabled() bool {
+	return os.Getenv(EnvVar) != ""
+}
+
+// DSN creates an empty schema on the test server and returns a DSN whose
+// search_path selects it. The schema is dropped when the test ends. DSN
+// returns "" when no server is configured.
+func DSN(t testing.TB) string {
+	t.Helper()
+	server := os.Getenv(EnvVar)
+	if server == "" {
+		return ""
+	}
+
+	schema := newSchemaName()
+	dsn, err := withSearchPath(server, schema)
+	if err != nil {
+		t.Fatalf("Invalid %s: %v", EnvVar, err)
+	}
+
+	admin, err := sql.Open("postgres", server)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", EnvVar, err)
+	}
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		admin.Close()
+		t.Fatalf("Failed to create test schema: %v", err)
+	}
+	t.Cleanup(func() {
+		defer admin.Close()
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("Failed to drop test schema %s: %v", schema, err)
+		}
+	})
+	return dsn
+}
+
+// newSchemaName returns a random schema name, so packages testing in parallel
+// against one server don't collide
+func newSchemaName() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "test_" + hex.EncodeToString(b)
+}
+
+// withSearchPath sets search_path in a postgres:// URL, which lib/pq sends
+// to the server as a runtime parameter. Key=value DSNs are refused since the
+// -db flag only recognises Postgres by its URL scheme.
+func withSearchPath(dsn, schema string) (string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return "", fmt.Errorf("%q is not a postgres:// URL", dsn)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
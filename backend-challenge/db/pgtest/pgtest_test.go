@@ -0,0 +1,13 @@
+package pgtest
+
+import "testing"
+
+func TestWithSearchPath(t *testing.T) {
+	got, err := withSearchPath("postgres://user@localhost:5432/store?sslmode=disable", "test_1")
+	if err != nil || got != "postgres://user@localhost:5432/store?search_path=test_1&sslmode=disable" {
+		t.Errorf("withSearchPath() = %q, %v", got, err)
+	}
+	if _, err := withSearchPath("host=localhost dbname=store", "test_1"); err == nil {
+		t.Error("expected an error for a key=value DSN")
+	}
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgres locks the rows a transaction checks before writing, since its
+// transactions run concurrently
+var postgres = &dialect{
+	name:       "postgres",
+	migrations: mustLoadMigrations(migrationFiles, "migrations/postgres"),
+	lockRows:   " FOR UPDATE",
+	textOrder:  ` COLLATE "C"`,
+	tableExists: `SELECT COUNT(*) FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name = ?`,
+	columnExists: `SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`,
+}
+
+// NewPostgres opens the Postgres database named by dsn, a postgres:// URL or
+// key=value connection string. Tables are looked up on the connection's
+// search_path, which can be set in the DSN. Like New, it refuses databases
+// whose schema is newer than this binary's.
+func NewPostgres(dsn string) (*DB, error) {
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	sqlDB := sql.OpenDB(rebindConnector{connector})
+
+	sqlDB.SetMaxOpenConns(10)
+	sqlDB.SetMaxIdleConns(5)
+	sqlDB.SetConnMaxLifetime(5 * time.Minute)
+	sqlDB.SetConnMaxIdleTime(30 * time.Second)
+
+	return open(sqlDB, postgres)
+}
+
+// pqConn is the set of driver interfaces lib/pq connections implement
+type pqConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.QueryerContext
+	driver.ExecerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+// rebindConnector hands out lib/pq connections that accept the ? placeholders
+// the queries are written with
+type rebindConnector struct {
+	driver.Connector
+}
+
+func (c rebindConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pc, ok := conn.(pqConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("postgres driver connection %T lacks context support", conn)
+	}
+	return rebindConn{pc}, nil
+}
+
+// rebindConn rewrites each query's placeholders before lib/pq sees it
+type rebindConn struct {
+	pqConn
+}
+
+func (c rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.pqConn.Prepare(rebind(query))
+}
+
+func (c rebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.pqConn.PrepareContext(ctx, rebind(query))
+}
+
+func (c rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.pqConn.QueryContext(ctx, rebind(query), args)
+}
+
+func (c rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.pqConn.ExecContext(ctx, rebind(query), args)
+}
+
+// rebind numbers the ? placeholders in query as $1, $2 and so on. Question
+// marks in quoted strings and identifiers and in comments are left alone.
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+1])
+			i += end
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
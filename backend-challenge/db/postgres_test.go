@@ -0,0 +1,46 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`SELECT 1`, `SELECT 1`},
+		{`SELECT * FROM orders WHERE id = ? AND customer_id = ?`, `SELECT * FROM orders WHERE id = $1 AND customer_id = $2`},
+		{`SELECT '?' FROM t WHERE a = ? AND "b?" = ?`, `SELECT '?' FROM t WHERE a = $1 AND "b?" = $2`},
+		{"SELECT a -- why?\nFROM t WHERE a = ?", "SELECT a -- why?\nFROM t WHERE a = $1"},
+		{`SELECT 'it''s ?' WHERE a = ?`, `SELECT 'it''s ?' WHERE a = $1`},
+		{`SELECT 'unterminated ?`, `SELECT 'unterminated ?`},
+	}
+	for _, tt := range tests {
+		if got := rebind(tt.query); got != tt.want {
+			t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for _, dsn := range []string{
+		filepath.Join(t.TempDir(), "plain.db"),
+		"sqlite://" + filepath.Join(t.TempDir(), "url.db"),
+	} {
+		db, err := Open(dsn)
+		if err != nil {
+			t.Errorf("Open(%q) failed: %v", dsn, err)
+			continue
+		}
+		if db.dialect != sqlite {
+			t.Errorf("Open(%q) dialect = %s, want sqlite", dsn, db.dialect.name)
+		}
+		db.Close()
+	}
+
+	if _, err := Open("mysql://localhost/store"); err == nil {
+		t.Error("expected an error for an unsupported scheme")
+	}
+}
@@ -1,21 +1,30 @@
 package db
 
 import (
+	"backend-challenge/coupon"
 	"backend-challenge/models"
+	"backend-challenge/money"
+	"backend-challenge/tax"
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 )
 
-func (db *DB) GetAllProducts(ctx context.Context, limit, offset int) ([]models.Product, error) {
-	query := `SELECT id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop FROM products`
+// GetAllProducts returns the products that match filter, in its order, with
+// optional pagination
+func (db *DB) GetAllProducts(ctx context.Context, filter models.ProductFilter, limit, offset int) ([]models.Product, error) {
+	query := `SELECT id, name, category, price, currency, image_thumbnail, image_mobile, image_tablet, image_desktop, stock, tax_category
+		FROM products p WHERE deleted_at IS NULL`
 
-	// Add pagination if limit is specified
-	if limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	clauses, args, err := db.productFilterClauses(filter)
+	if err != nil {
+		return nil, err
 	}
+	query += clauses + pageClause(limit, offset)
 
-	rows, err := db.QueryContext(ctx, query)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -29,12 +38,82 @@ func (db *DB) GetAllProducts(ctx context.Context, limit, offset int) ([]models.P
 		}
 		products = append(products, *p)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := db.loadPrices(ctx, products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// storePrice is a product's price in the store currency: its own price if it
+// is in that currency, otherwise the one set for it, or NULL
+const storePrice = `COALESCE(CASE WHEN p.currency = ? THEN p.price END,
+	(SELECT pp.price FROM product_prices pp WHERE pp.product_id = p.id AND pp.currency = ?))`
+
+// productFilterClauses returns the conditions and ORDER BY of a product
+// listing, to follow its WHERE clause, with their arguments
+func (db *DB) productFilterClauses(filter models.ProductFilter) (string, []any, error) {
+	var clauses strings.Builder
+	var args []any
+
+	if filter.Category != "" {
+		clauses.WriteString(` AND p.category = ?`)
+		args = append(args, filter.Category)
+	}
+	if filter.Query != "" {
+		clauses.WriteString(` AND LOWER(p.name) LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(strings.ToLower(filter.Query))+"%")
+	}
+	for _, bound := range []struct {
+		price *money.Money
+		op    string
+	}{{filter.MinPrice, ">="}, {filter.MaxPrice, "<="}} {
+		if bound.price == nil {
+			continue
+		}
+		if bound.price.Currency != money.DefaultCurrency {
+			return "", nil, fmt.Errorf("price bounds must be in %s, not %s", money.DefaultCurrency, bound.price.Currency)
+		}
+		clauses.WriteString(` AND ` + storePrice + ` ` + bound.op + ` ?`)
+		args = append(args, money.DefaultCurrency, money.DefaultCurrency, bound.price.Amount)
+	}
+
+	if len(filter.Sort) == 0 {
+		return clauses.String(), args, nil
+	}
+	clauses.WriteString(` ORDER BY `)
+	for _, s := range filter.Sort {
+		direction := ""
+		if s.Descending {
+			direction = " DESC"
+		}
+		switch s.Field {
+		case models.SortByName:
+			clauses.WriteString(`p.name` + db.dialect.textOrder + direction + `, `)
+		case models.SortByCategory:
+			clauses.WriteString(`p.category` + db.dialect.textOrder + direction + `, `)
+		case models.SortByPrice:
+			// Products without a price in the store currency go last either way
+			clauses.WriteString(`(` + storePrice + `) IS NULL, ` + storePrice + direction + `, `)
+			args = append(args, money.DefaultCurrency, money.DefaultCurrency, money.DefaultCurrency, money.DefaultCurrency)
+		default:
+			return "", nil, fmt.Errorf("products can't be sorted by %q", s.Field)
+		}
+	}
+	clauses.WriteString(`p.id` + db.dialect.textOrder)
+	return clauses.String(), args, nil
+}
 
-	return products, rows.Err()
+// escapeLike escapes the LIKE wildcards in s, with \ as the escape character
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
 }
 
 func (db *DB) GetProductByID(ctx context.Context, id string) (*models.Product, error) {
-	query := `SELECT id, name, category, price, image_thumbnail, image_mobile, image_tablet, image_desktop FROM products WHERE id = ?`
+	query := `SELECT id, name, category, price, currency, image_thumbnail, image_mobile, image_tablet, image_desktop, stock, tax_category FROM products WHERE id = ? AND deleted_at IS NULL`
 
 	row := db.QueryRowContext(ctx, query, id)
 	p, err := scanProduct(row)
@@ -45,38 +124,774 @@ func (db *DB) GetProductByID(ctx context.Context, id string) (*models.Product, e
 		return nil, err
 	}
 
-	return p, nil
+	products := []models.Product{*p}
+	if err := db.loadPrices(ctx, products); err != nil {
+		return nil, err
+	}
+	return &products[0], nil
+}
+
+// CreateProduct stores a new product with its prices in other currencies
+func (db *DB) CreateProduct(ctx context.Context, product *models.Product) error {
+	query := `INSERT INTO products (id, name, category, price, currency, image_thumbnail, image_mobile, image_tablet, image_desktop, stock, tax_category)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	thumbnail, mobile, tablet, desktop := imageColumns(product.Image)
+	res, err := tx.ExecContext(ctx, query, product.ID, product.Name, product.Category, product.Price.Amount, product.Price.Currency,
+		thumbnail, mobile, tablet, desktop, nullIntPtr(product.Stock), taxCategory(product))
+	if err != nil {
+		return fmt.Errorf("failed to create product: %w", err)
+	}
+	// Deleted products keep their ID so past orders still resolve them
+	if err := requireRow(res, ErrProductExists); err != nil {
+		return err
+	}
+
+	if err := replacePrices(ctx, tx, product); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit product: %w", err)
+	}
+	return nil
+}
+
+// UpdateProduct overwrites a product's details, including its prices in other
+// currencies. Stock is left alone, so an edit can't undo sales made since the
+// product was read; see SetProductStock.
+func (db *DB) UpdateProduct(ctx context.Context, product *models.Product) error {
+	query := `UPDATE products SET name = ?, category = ?, price = ?, currency = ?,
+		image_thumbnail = ?, image_mobile = ?, image_tablet = ?, image_desktop = ?, tax_category = ?
+		WHERE id = ? AND deleted_at IS NULL`
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	thumbnail, mobile, tablet, desktop := imageColumns(product.Image)
+	res, err := tx.ExecContext(ctx, query, product.Name, product.Category, product.Price.Amount, product.Price.Currency,
+		thumbnail, mobile, tablet, desktop, taxCategory(product), product.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update product: %w", err)
+	}
+	if err := requireRow(res, ErrProductNotFound); err != nil {
+		return err
+	}
+
+	if err := replacePrices(ctx, tx, product); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit product: %w", err)
+	}
+	return nil
+}
+
+// replacePrices stores the product's prices in other currencies in place of
+// the ones it had
+func replacePrices(ctx context.Context, tx *sql.Tx, product *models.Product) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM product_prices WHERE product_id = ?`, product.ID); err != nil {
+		return fmt.Errorf("failed to clear product prices: %w", err)
+	}
+	for currency, price := range product.Prices {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO product_prices (product_id, currency, price) VALUES (?, ?, ?)`,
+			product.ID, currency, price.Amount)
+		if err != nil {
+			return fmt.Errorf("failed to insert product price: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadPrices fills in the prices in other currencies of the given products.
+// A product may appear more than once, as in an order's products.
+func (db *DB) loadPrices(ctx context.Context, products []models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	positions := make(map[string][]int)
+	var ids []interface{}
+	for i, p := range products {
+		if _, ok := positions[p.ID]; !ok {
+			ids = append(ids, p.ID)
+		}
+		positions[p.ID] = append(positions[p.ID], i)
+	}
+
+	query := `SELECT product_id, currency, price FROM product_prices WHERE product_id IN (?` +
+		strings.Repeat(", ?", len(ids)-1) + `)`
+	rows, err := db.QueryContext(ctx, query, ids...)
+	if err != nil {
+		return fmt.Errorf("failed to get product prices: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID string
+		var price money.Money
+		if err := rows.Scan(&productID, &price.Currency, &price.Amount); err != nil {
+			return fmt.Errorf("failed to scan product price: %w", err)
+		}
+		for _, i := range positions[productID] {
+			if products[i].Prices == nil {
+				products[i].Prices = make(map[string]money.Money)
+			}
+			products[i].Prices[price.Currency] = price
+		}
+	}
+	return rows.Err()
+}
+
+// SetProductStock sets the units of a product left to sell. A nil stock
+// stops tracking it, so it can be ordered in any quantity.
+func (db *DB) SetProductStock(ctx context.Context, id string, stock *int) error {
+	res, err := db.ExecContext(ctx, `UPDATE products SET stock = ? WHERE id = ? AND deleted_at IS NULL`, nullIntPtr(stock), id)
+	if err != nil {
+		return fmt.Errorf("failed to set product stock: %w", err)
+	}
+	return requireRow(res, ErrProductNotFound)
+}
+
+// DeleteProduct soft-deletes a product. It disappears from the catalogue and
+// can no longer be ordered, but past orders keep resolving it.
+func (db *DB) DeleteProduct(ctx context.Context, id string) error {
+	query := `UPDATE products SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`
+
+	res, err := db.ExecContext(ctx, query, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete product: %w", err)
+	}
+	return requireRow(res, ErrProductNotFound)
 }
 
 func (db *DB) IsCouponValid(ctx context.Context, code string) (bool, error) {
+	// An empty code means no coupon was supplied
+	if code == "" {
+		return true, nil
+	}
+
 	// Coupons are preprocessed but best to defensively check length
-	if len(code) < 8 || len(code) > 10 {
+	if !db.couponPolicy.ValidLength(code) {
 		return false, nil
 	}
 
-	query := `SELECT COUNT(*) FROM valid_coupons WHERE code = ?`
-	var count int
-	err := db.QueryRowContext(ctx, query, code).Scan(&count)
+	// Imported coupons record the sources they were found in, so a raised
+	// source threshold applies without re-importing. Coupons without recorded
+	// sources were added directly and only need to exist.
+	query := `SELECT
+		(SELECT COUNT(*) FROM valid_coupons WHERE code = ? AND deactivated_at IS NULL),
+		(SELECT COUNT(*) FROM coupon_sources WHERE code = ?)`
+	var count, sources int
+	err := db.QueryRowContext(ctx, query, code, code).Scan(&count, &sources)
 	if err != nil {
 		return false, fmt.Errorf("failed to validate coupon: %w", err)
 	}
 
-	return count > 0, nil
+	return count > 0 && (sources == 0 || db.couponPolicy.EnoughSources(sources)), nil
+}
+
+// InsertCoupons adds imported codes and the sources they were found in to
+// valid_coupons in a single transaction, skipping rows already present
+func (db *DB) InsertCoupons(ctx context.Context, matches []coupon.Match) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin coupon transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	codeStmt, err := tx.PrepareContext(ctx, `INSERT INTO valid_coupons (code) VALUES (?) ON CONFLICT (code) DO NOTHING`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare coupon insert: %w", err)
+	}
+	defer codeStmt.Close()
+
+	sourceStmt, err := tx.PrepareContext(ctx, `INSERT INTO coupon_sources (code, source) VALUES (?, ?) ON CONFLICT (code, source) DO NOTHING`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare coupon source insert: %w", err)
+	}
+	defer sourceStmt.Close()
+
+	for _, match := range matches {
+		if _, err := codeStmt.ExecContext(ctx, match.Code); err != nil {
+			return fmt.Errorf("failed to insert coupon: %w", err)
+		}
+		for _, source := range match.Sources {
+			if _, err := sourceStmt.ExecContext(ctx, match.Code, source); err != nil {
+				return fmt.Errorf("failed to insert coupon source: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit coupons: %w", err)
+	}
+	return nil
+}
+
+// couponColumns selects a coupon with its redemption count and rule, in the order scanCoupon expects
+const couponColumns = `c.code, c.starts_at, c.ends_at, c.max_redemptions, c.max_per_customer, c.deactivated_at,
+	(SELECT COUNT(*) FROM coupon_redemptions WHERE code = c.code),
+	r.rule_type, r.value, r.amount, r.product_id, r.min_subtotal
+	FROM valid_coupons c LEFT JOIN coupon_rules r ON r.code = c.code`
+
+func (db *DB) GetCoupon(ctx context.Context, code string) (*models.Coupon, error) {
+	query := `SELECT ` + couponColumns + ` WHERE c.code = ?`
+
+	c, err := scanCoupon(db.QueryRowContext(ctx, query, code))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+	return c, nil
+}
+
+// ListCoupons returns every coupon, including deactivated ones, ordered by code
+func (db *DB) ListCoupons(ctx context.Context, limit, offset int) ([]models.Coupon, error) {
+	query := `SELECT ` + couponColumns + ` ORDER BY c.code`
+
+	query += pageClause(limit, offset)
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list coupons: %w", err)
+	}
+	defer rows.Close()
+
+	var coupons []models.Coupon
+	for rows.Next() {
+		c, err := scanCoupon(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list coupons: %w", err)
+		}
+		coupons = append(coupons, *c)
+	}
+
+	return coupons, rows.Err()
+}
+
+// CreateCoupon adds a coupon with its limits and optional rule. The code must
+// satisfy the same length policy IsCouponValid enforces.
+func (db *DB) CreateCoupon(ctx context.Context, c *models.Coupon) error {
+	if !db.couponPolicy.ValidLength(c.Code) {
+		return ErrCouponCodeLength
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin coupon transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO valid_coupons (code, starts_at, ends_at, max_redemptions, max_per_customer)
+		VALUES (?, ?, ?, ?, ?) ON CONFLICT (code) DO NOTHING`,
+		c.Code, nullTime(c.StartsAt), nullTime(c.EndsAt), nullInt(c.MaxRedemptions), nullInt(c.MaxPerCustomer))
+	if err != nil {
+		return fmt.Errorf("failed to create coupon: %w", err)
+	}
+	// Deactivated coupons keep their code so their redemptions stay attached
+	if err := requireRow(res, ErrCouponExists); err != nil {
+		return err
+	}
+
+	if c.Rule != nil {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO coupon_rules (code, rule_type, value, amount, product_id, min_subtotal) VALUES (?, ?, ?, ?, ?, ?)`,
+			c.Code, c.Rule.Type, c.Rule.Value, c.Rule.Amount, nullString(c.Rule.ProductID), c.Rule.MinSubtotal)
+		if err != nil {
+			return fmt.Errorf("failed to create coupon rule: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit coupon: %w", err)
+	}
+	return nil
 }
 
-// scanProduct scans a row into a Product, handling nullable image fields
-func scanProduct(scanner interface {
+// DeactivateCoupon withdraws a coupon so it is no longer accepted. Its
+// redemptions are kept and it still shows up in ListCoupons.
+func (db *DB) DeactivateCoupon(ctx context.Context, code string) error {
+	if !db.couponPolicy.ValidLength(code) {
+		return ErrCouponCodeLength
+	}
+
+	res, err := db.ExecContext(ctx,
+		`UPDATE valid_coupons SET deactivated_at = ? WHERE code = ? AND deactivated_at IS NULL`,
+		time.Now().UTC(), code)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate coupon: %w", err)
+	}
+	return requireRow(res, ErrCouponNotFound)
+}
+
+func (db *DB) CountCustomerRedemptions(ctx context.Context, code, customerID string) (int, error) {
+	query := `SELECT COUNT(*) FROM coupon_redemptions WHERE code = ? AND customer_id = ?`
+
+	var count int
+	if err := db.QueryRowContext(ctx, query, code, customerID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count coupon redemptions: %w", err)
+	}
+	return count, nil
+}
+
+// CreateOrder stores the order with its lines, history, coupon redemption and
+// outbox events, and takes its items out of stock, in one transaction
+func (db *DB) CreateOrder(ctx context.Context, order *models.Order) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin order transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO orders (id, coupon_code, customer_id, subtotal, discounts, tax, tax_inclusive, total, currency, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		order.ID, nullString(order.CouponCode), nullString(order.CustomerID),
+		order.Subtotal.Amount, order.Discounts.Amount, order.Tax.Amount, order.TaxInclusive, order.Total.Amount, order.Total.Currency,
+		order.Status, order.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert order: %w", err)
+	}
+
+	for _, change := range order.History {
+		if err := insertStatusChange(ctx, tx, order.ID, change); err != nil {
+			return err
+		}
+	}
+
+	for i, line := range order.Lines {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO order_items (order_id, line_no, product_id, quantity, unit_price, amount, tax, tax_category) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			order.ID, i, line.ProductID, line.Quantity, line.UnitPrice.Amount, line.Amount.Amount, line.Tax.Amount, nullString(line.TaxCategory))
+		if err != nil {
+			return fmt.Errorf("failed to insert order item: %w", err)
+		}
+	}
+
+	if err := reserveStock(ctx, tx, order.Lines); err != nil {
+		return err
+	}
+
+	if order.CouponCode != "" {
+		if err := db.redeemCoupon(ctx, tx, order); err != nil {
+			return err
+		}
+	}
+
+	if err := insertOutboxEvent(ctx, tx, models.EventOrderPlaced, order, order.CreatedAt); err != nil {
+		return err
+	}
+	if order.CouponCode != "" {
+		redemption := models.CouponRedemption{
+			Code:       order.CouponCode,
+			OrderID:    order.ID,
+			CustomerID: order.CustomerID,
+			RedeemedAt: order.CreatedAt,
+		}
+		if err := insertOutboxEvent(ctx, tx, models.EventCouponRedeemed, redemption, order.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit order: %w", err)
+	}
+	return nil
+}
+
+// reserveStock takes the ordered quantities out of the stock of the products
+// that track it. The check and decrement are a single statement in the order
+// transaction, so concurrent orders can't sell the same units. If any product
+// is short, nothing is taken and InsufficientStockError lists them all.
+func reserveStock(ctx context.Context, tx *sql.Tx, lines []models.OrderLine) error {
+	// A product can appear on several lines
+	var productIDs []string
+	quantities := make(map[string]int)
+	for _, line := range lines {
+		if _, ok := quantities[line.ProductID]; !ok {
+			productIDs = append(productIDs, line.ProductID)
+		}
+		quantities[line.ProductID] += line.Quantity
+	}
+
+	var short []string
+	for _, id := range productIDs {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE products SET stock = stock - ? WHERE id = ? AND stock IS NOT NULL AND stock >= ?`,
+			quantities[id], id, quantities[id])
+		if err != nil {
+			return fmt.Errorf("failed to reserve stock: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to reserve stock: %w", err)
+		} else if n > 0 {
+			continue
+		}
+
+		// Nothing was taken: either stock isn't tracked or there isn't enough
+		var tracked bool
+		if err := tx.QueryRowContext(ctx, `SELECT stock IS NOT NULL FROM products WHERE id = ?`, id).Scan(&tracked); err != nil {
+			return fmt.Errorf("failed to reserve stock: %w", err)
+		}
+		if tracked {
+			short = append(short, id)
+		}
+	}
+
+	if len(short) > 0 {
+		// The caller rolls back the transaction, returning what was taken
+		return &InsufficientStockError{ProductIDs: short}
+	}
+	return nil
+}
+
+// releaseStock puts a cancelled order's items back into stock
+func releaseStock(ctx context.Context, tx *sql.Tx, orderID string) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE products SET stock = stock + (SELECT SUM(quantity) FROM order_items WHERE order_id = ? AND product_id = products.id)
+		WHERE stock IS NOT NULL AND id IN (SELECT product_id FROM order_items WHERE order_id = ?)`,
+		orderID, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to release stock: %w", err)
+	}
+	return nil
+}
+
+// redeemCoupon records the order's coupon redemption, enforcing the coupon's
+// caps inside the order transaction. The coupon's row is read with a lock,
+// so concurrent orders for the same coupon check the caps one at a time.
+func (db *DB) redeemCoupon(ctx context.Context, tx *sql.Tx, order *models.Order) error {
+	var maxRedemptions, maxPerCustomer sql.NullInt64
+	var deactivatedAt sql.NullTime
+	err := tx.QueryRowContext(ctx,
+		`SELECT max_redemptions, max_per_customer, deactivated_at FROM valid_coupons WHERE code = ?`+db.dialect.lockRows,
+		order.CouponCode).Scan(&maxRedemptions, &maxPerCustomer, &deactivatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("failed to redeem coupon: coupon %s does not exist", order.CouponCode)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to redeem coupon: %w", err)
+	}
+	if deactivatedAt.Valid {
+		return ErrCouponDeactivated
+	}
+
+	var total, perCustomer int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT COUNT(*), COUNT(CASE WHEN customer_id = ? THEN 1 END) FROM coupon_redemptions WHERE code = ?`,
+		order.CustomerID, order.CouponCode).Scan(&total, &perCustomer)
+	if err != nil {
+		return fmt.Errorf("failed to redeem coupon: %w", err)
+	}
+	if maxRedemptions.Valid && total >= maxRedemptions.Int64 {
+		return ErrRedemptionLimit
+	}
+	if maxPerCustomer.Valid && order.CustomerID == "" {
+		return ErrCustomerRequired
+	}
+	if maxPerCustomer.Valid && perCustomer >= maxPerCustomer.Int64 {
+		return ErrCustomerRedemptionLimit
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO coupon_redemptions (code, order_id, customer_id, redeemed_at) VALUES (?, ?, ?, ?)`,
+		order.CouponCode, order.ID, nullString(order.CustomerID), order.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to redeem coupon: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) GetOrderByID(ctx context.Context, id string) (*models.Order, error) {
+	query := `SELECT id, coupon_code, customer_id, subtotal, discounts, tax, tax_inclusive, total, currency, status, created_at FROM orders WHERE id = ?`
+
+	var order models.Order
+	var couponCode, customerID sql.NullString
+	var currency string
+	err := db.QueryRowContext(ctx, query, id).Scan(&order.ID, &couponCode, &customerID,
+		&order.Subtotal.Amount, &order.Discounts.Amount, &order.Tax.Amount, &order.TaxInclusive, &order.Total.Amount, &currency,
+		&order.Status, &order.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	order.CouponCode = couponCode.String
+	order.CustomerID = customerID.String
+
+	query = `SELECT oi.product_id, oi.quantity, oi.unit_price, oi.amount, oi.tax, COALESCE(oi.tax_category, ''),
+		p.id, p.name, p.category, p.price, p.currency, p.image_thumbnail, p.image_mobile, p.image_tablet, p.image_desktop, p.stock, p.tax_category
+		FROM order_items oi JOIN products p ON p.id = oi.product_id
+		WHERE oi.order_id = ? ORDER BY oi.line_no`
+
+	rows, err := db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line models.OrderLine
+		p, err := scanProduct(prefixedScanner{rows, []interface{}{
+			&line.ProductID, &line.Quantity, &line.UnitPrice.Amount, &line.Amount.Amount, &line.Tax.Amount, &line.TaxCategory,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		order.Lines = append(order.Lines, line)
+		order.Items = append(order.Items, models.OrderItem{ProductID: line.ProductID, Quantity: line.Quantity})
+		order.Products = append(order.Products, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get order items: %w", err)
+	}
+	order.SetCurrency(currency)
+	if err := db.loadPrices(ctx, order.Products); err != nil {
+		return nil, err
+	}
+
+	order.History, err = db.orderHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// UpdateOrderStatus moves an order from change.From to change.To and records
+// the change with its order.status_changed event. Cancelled orders put their
+// items back into stock. It returns ErrOrderStatusChanged if the order has meanwhile
+// left change.From, so concurrent updates can't skip a transition check.
+func (db *DB) UpdateOrderStatus(ctx context.Context, id string, change models.OrderStatusChange) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE orders SET status = ? WHERE id = ? AND status = ?`, change.To, id, change.From)
+	if err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+	if err := requireRow(res, ErrOrderStatusChanged); err != nil {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE id = ?)`, id).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to update order status: %w", err)
+		}
+		if !exists {
+			return ErrOrderNotFound
+		}
+		return err
+	}
+
+	if err := insertStatusChange(ctx, tx, id, change); err != nil {
+		return err
+	}
+
+	if change.To == models.OrderCancelled {
+		if err := releaseStock(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+
+	// The event carries the change's position in the history, as streamed order events do
+	event := models.OrderEvent{OrderID: id, OrderStatusChange: change}
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM order_status_history WHERE order_id = ?`, id).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+	if err := insertOutboxEvent(ctx, tx, models.EventOrderStatusChanged, event, change.At); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func insertStatusChange(ctx context.Context, tx *sql.Tx, orderID string, change models.OrderStatusChange) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO order_status_history (order_id, from_status, to_status, actor, reason, changed_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		orderID, nullString(change.From), change.To, nullString(change.Actor), nullString(change.Reason), change.At)
+	if err != nil {
+		return fmt.Errorf("failed to record order status: %w", err)
+	}
+	return nil
+}
+
+// orderHistory returns an order's status changes, oldest first
+func (db *DB) orderHistory(ctx context.Context, orderID string) ([]models.OrderStatusChange, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT from_status, to_status, actor, reason, changed_at FROM order_status_history WHERE order_id = ? ORDER BY id`,
+		orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []models.OrderStatusChange
+	for rows.Next() {
+		var change models.OrderStatusChange
+		var from, actor, reason sql.NullString
+		if err := rows.Scan(&from, &change.To, &actor, &reason, &change.At); err != nil {
+			return nil, fmt.Errorf("failed to get order history: %w", err)
+		}
+		change.From, change.Actor, change.Reason = from.String, actor.String, reason.String
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// pageClause limits a query to a page of its rows. Without a positive limit
+// every row is returned, and a negative offset counts as zero, as SQLite
+// treats it and Postgres rejects it.
+func pageClause(limit, offset int) string {
+	if limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, max(offset, 0))
+}
+
+// requireRow returns notFound when a statement changed no rows
+func requireRow(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// taxCategory is the tax category stored for a product, standard if it has none
+func taxCategory(product *models.Product) string {
+	if product.TaxCategory == "" {
+		return tax.Standard
+	}
+	return product.TaxCategory
+}
+
+// imageColumns splits an optional product image into its nullable columns
+func imageColumns(img *models.ProductImage) (thumbnail, mobile, tablet, desktop sql.NullString) {
+	if img == nil {
+		return
+	}
+	return nullString(img.Thumbnail), nullString(img.Mobile), nullString(img.Tablet), nullString(img.Desktop)
+}
+
+// nullTime stores nil times as NULL and others in UTC, so that SQLite, which
+// keeps timestamps as text, compares them in time order
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// nullInt stores zero, meaning unlimited, as NULL
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+// nullIntPtr stores nil as NULL, unlike nullInt, for which zero is a value
+func nullIntPtr(n *int) sql.NullInt64 {
+	if n == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*n), Valid: true}
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+type rowScanner interface {
 	Scan(dest ...interface{}) error
-}) (*models.Product, error) {
+}
+
+// prefixedScanner scans leading columns into prefix before the remaining destinations
+type prefixedScanner struct {
+	rowScanner
+	prefix []interface{}
+}
+
+func (s prefixedScanner) Scan(dest ...interface{}) error {
+	return s.rowScanner.Scan(append(s.prefix, dest...)...)
+}
+
+// scanCoupon scans couponColumns into a Coupon, handling the nullable limits and rule
+func scanCoupon(scanner rowScanner) (*models.Coupon, error) {
+	var c models.Coupon
+	var startsAt, endsAt, deactivatedAt sql.NullTime
+	var maxRedemptions, maxPerCustomer, amount, minSubtotal sql.NullInt64
+	var ruleType, productID sql.NullString
+	var value sql.NullFloat64
+	err := scanner.Scan(&c.Code, &startsAt, &endsAt, &maxRedemptions, &maxPerCustomer, &deactivatedAt,
+		&c.Redemptions, &ruleType, &value, &amount, &productID, &minSubtotal)
+	if err != nil {
+		return nil, err
+	}
+
+	if startsAt.Valid {
+		c.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		c.EndsAt = &endsAt.Time
+	}
+	if deactivatedAt.Valid {
+		c.DeactivatedAt = &deactivatedAt.Time
+	}
+	c.MaxRedemptions = int(maxRedemptions.Int64)
+	c.MaxPerCustomer = int(maxPerCustomer.Int64)
+
+	if ruleType.Valid {
+		c.Rule = &models.CouponRule{
+			Code:        c.Code,
+			Type:        ruleType.String,
+			Value:       value.Float64,
+			Amount:      amount.Int64,
+			ProductID:   productID.String,
+			MinSubtotal: minSubtotal.Int64,
+		}
+	}
+
+	return &c, nil
+}
+
+// scanProduct scans a row into a Product, handling nullable image fields and stock
+func scanProduct(scanner rowScanner) (*models.Product, error) {
 	var p models.Product
 	var thumbnail, mobile, tablet, desktop sql.NullString
+	var stock sql.NullInt64
 
-	err := scanner.Scan(&p.ID, &p.Name, &p.Category, &p.Price,
-		&thumbnail, &mobile, &tablet, &desktop)
+	err := scanner.Scan(&p.ID, &p.Name, &p.Category, &p.Price.Amount, &p.Price.Currency,
+		&thumbnail, &mobile, &tablet, &desktop, &stock, &p.TaxCategory)
 	if err != nil {
 		return nil, err
 	}
 
+	if stock.Valid {
+		n := int(stock.Int64)
+		p.Stock = &n
+	}
+	p.SoldOut = p.OutOfStock()
+
 	// Only create Image object if at least one field has content
 	if thumbnail.String != "" || mobile.String != "" ||
 		tablet.String != "" || desktop.String != "" {
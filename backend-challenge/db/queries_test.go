@@ -1,11 +1,24 @@
 package db
 
 import (
+	"backend-challenge/coupon"
+	"backend-challenge/db/pgtest"
+	"backend-challenge/models"
+	"backend-challenge/money"
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func setupTestDB(t *testing.T) *DB {
+	if pgtest.Enabled() {
+		return setupPostgresTestDB(t, true)
+	}
+
 	// Use the committed database
 	dbPath := "../data/store.db"
 
@@ -22,11 +35,74 @@ func setupTestDB(t *testing.T) *DB {
 	return db
 }
 
+// setupPostgresTestDB opens a schema of its own on the TEST_POSTGRES_DSN
+// server, migrated and, if seed is set, loaded with the data the committed
+// database holds
+func setupPostgresTestDB(t *testing.T, seed bool) *DB {
+	t.Helper()
+	db, err := NewPostgres(pgtest.DSN(t))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	if !seed {
+		return db
+	}
+
+	ctx := context.Background()
+	if _, err := db.Migrate(ctx, LatestSchemaVersion()); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	data, err := os.ReadFile("../data/seed.sql")
+	if err != nil {
+		t.Fatalf("Failed to read seed data: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, string(data)); err != nil {
+		t.Fatalf("Failed to seed test database: %v", err)
+	}
+	return db
+}
+
+// setupWritableTestDB opens a copy of the committed database for tests that write
+func setupWritableTestDB(t *testing.T) *DB {
+	if pgtest.Enabled() {
+		return setupPostgresTestDB(t, true)
+	}
+
+	data, err := os.ReadFile("../data/store.db")
+	if err != nil {
+		t.Fatalf("Failed to read test database: %v", err)
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	if err := os.WriteFile(dbPath, data, 0o644); err != nil {
+		t.Fatalf("Failed to copy test database: %v", err)
+	}
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return db
+}
+
+// aud returns an amount in cents of the store currency
+func aud(cents int64) money.Money {
+	return money.New(cents, money.DefaultCurrency)
+}
+
 func TestGetProductByID(t *testing.T) {
 	db := setupTestDB(t)
 	ctx := context.Background()
 
-	// Test existing product from init.sql (Waffle with Berries, ID=1)
+	// Test existing product from seed.sql (Waffle with Berries, ID=1)
 	product, err := db.GetProductByID(ctx, "1")
 	if err != nil {
 		t.Fatalf("Failed to get product: %v", err)
@@ -36,8 +112,8 @@ func TestGetProductByID(t *testing.T) {
 		t.Fatal("Expected product, got nil")
 	}
 
-	if product.Name != "Waffle with Berries" || product.Price != 6.5 {
-		t.Errorf("Product mismatch: got %+v, want Name='Waffle with Berries' Price=6.5", product)
+	if product.Name != "Waffle with Berries" || product.Price != aud(650) {
+		t.Errorf("Product mismatch: got %+v, want Name='Waffle with Berries' Price=6.50 AUD", product)
 	}
 }
 
@@ -59,17 +135,277 @@ func TestGetAllProducts(t *testing.T) {
 	db := setupTestDB(t)
 	ctx := context.Background()
 
-	all, err := db.GetAllProducts(ctx, 0, 0)
+	all, err := db.GetAllProducts(ctx, models.ProductFilter{}, 0, 0)
 	if err != nil {
 		t.Fatalf("Failed to get all products: %v", err)
 	}
 
-	// init.sql has 9 products
+	// seed.sql has 9 products
 	if len(all) != 9 {
 		t.Errorf("Expected 9 products, got %d", len(all))
 	}
 }
 
+func TestGetAllProducts_Filter(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	price := func(cents int64) *money.Money {
+		p := aud(cents)
+		return &p
+	}
+	tests := []struct {
+		name          string
+		filter        models.ProductFilter
+		limit, offset int
+		want          []string
+	}{
+		{name: "category", filter: models.ProductFilter{Category: "Waffle"}, want: []string{"1"}},
+		{name: "category is exact", filter: models.ProductFilter{Category: "waffle"}, want: nil},
+		{name: "query ignores case", filter: models.ProductFilter{Query: "VANILLA"}, want: []string{"2", "9"}},
+		{name: "query matches inside names", filter: models.ProductFilter{Query: "caramel"}, want: []string{"8"}},
+		{name: "query wildcards are literal", filter: models.ProductFilter{Query: "%"}, want: nil},
+		{name: "query underscore is literal", filter: models.ProductFilter{Query: "_"}, want: nil},
+		{
+			name:   "price range is inclusive",
+			filter: models.ProductFilter{MinPrice: price(450), MaxPrice: price(650)},
+			want:   []string{"1", "4", "6", "7", "8", "9"},
+		},
+		{name: "min price", filter: models.ProductFilter{MinPrice: price(701)}, want: []string{"3"}},
+		{
+			name:   "sort by price, ties by ID",
+			filter: models.ProductFilter{Sort: []models.ProductSort{{Field: models.SortByPrice}}},
+			want:   []string{"5", "7", "8", "6", "4", "1", "9", "2", "3"},
+		},
+		{
+			name: "sort by price descending then name",
+			filter: models.ProductFilter{Sort: []models.ProductSort{
+				{Field: models.SortByPrice, Descending: true}, {Field: models.SortByName},
+			}},
+			want: []string{"3", "2", "9", "1", "4", "6", "7", "8", "5"},
+		},
+		{
+			name:   "sort by name",
+			filter: models.ProductFilter{Sort: []models.ProductSort{{Field: models.SortByName}}},
+			want:   []string{"4", "6", "3", "5", "7", "8", "2", "9", "1"},
+		},
+		{
+			name:   "filters combine and paginate",
+			filter: models.ProductFilter{MaxPrice: price(500), Sort: []models.ProductSort{{Field: models.SortByPrice}}},
+			limit:  2, offset: 1,
+			want: []string{"7", "8"},
+		},
+	}
+	for _, tt := range tests {
+		products, err := db.GetAllProducts(ctx, tt.filter, tt.limit, tt.offset)
+		if err != nil {
+			t.Errorf("%s: GetAllProducts failed: %v", tt.name, err)
+			continue
+		}
+		var ids []string
+		for _, p := range products {
+			ids = append(ids, p.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+
+	nzd := money.New(500, "NZD")
+	if _, err := db.GetAllProducts(ctx, models.ProductFilter{MinPrice: &nzd}, 0, 0); err == nil {
+		t.Error("Expected an error for a price bound outside the store currency")
+	}
+	if _, err := db.GetAllProducts(ctx, models.ProductFilter{Sort: []models.ProductSort{{Field: "stock"}}}, 0, 0); err == nil {
+		t.Error("Expected an error for an unknown sort field")
+	}
+}
+
+func TestCreateProduct(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	product := &models.Product{
+		ID:       "10",
+		Name:     "Lemon Tart",
+		Category: "Tart",
+		Price:    aud(525),
+		Image:    &models.ProductImage{Thumbnail: "https://example.com/tart.jpg"},
+	}
+	if err := db.CreateProduct(ctx, product); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	saved, err := db.GetProductByID(ctx, "10")
+	if err != nil {
+		t.Fatalf("Failed to get product: %v", err)
+	}
+	if saved == nil || saved.Name != "Lemon Tart" || saved.Price != aud(525) || saved.Image == nil || saved.Image.Thumbnail != product.Image.Thumbnail {
+		t.Errorf("Product mismatch: got %+v", saved)
+	}
+
+	if err := db.CreateProduct(ctx, product); !errors.Is(err, ErrProductExists) {
+		t.Errorf("Expected ErrProductExists, got %v", err)
+	}
+}
+
+func TestProductPrices(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	// seed.sql sets the New Zealand prices
+	seeded, err := db.GetProductByID(ctx, "1")
+	if err != nil || seeded.Prices["NZD"] != money.New(750, "NZD") {
+		t.Fatalf("Expected seeded NZD price, got %+v, %v", seeded, err)
+	}
+
+	product := &models.Product{
+		ID:       "10",
+		Name:     "Lemon Tart",
+		Category: "Tart",
+		Price:    aud(525),
+		Prices:   map[string]money.Money{"NZD": money.New(575, "NZD"), "GBP": money.New(275, "GBP")},
+	}
+	if err := db.CreateProduct(ctx, product); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	saved, err := db.GetProductByID(ctx, "10")
+	if err != nil || !reflect.DeepEqual(saved.Prices, product.Prices) {
+		t.Fatalf("Prices mismatch: got %+v, %v", saved, err)
+	}
+
+	// Updating replaces the prices
+	product.Prices = map[string]money.Money{"GBP": money.New(300, "GBP")}
+	if err := db.UpdateProduct(ctx, product); err != nil {
+		t.Fatalf("Failed to update product: %v", err)
+	}
+	all, err := db.GetAllProducts(ctx, models.ProductFilter{}, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to get all products: %v", err)
+	}
+	for _, p := range all {
+		if p.ID == "10" && !reflect.DeepEqual(p.Prices, product.Prices) {
+			t.Errorf("Prices after update = %+v, want %+v", p.Prices, product.Prices)
+		}
+	}
+}
+
+func TestUpdateProduct(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	product := &models.Product{ID: "1", Name: "Waffle", Category: "Waffle", Price: aud(700)}
+	if err := db.UpdateProduct(ctx, product); err != nil {
+		t.Fatalf("Failed to update product: %v", err)
+	}
+
+	saved, err := db.GetProductByID(ctx, "1")
+	if err != nil {
+		t.Fatalf("Failed to get product: %v", err)
+	}
+	if saved == nil || saved.Name != "Waffle" || saved.Price != aud(700) || saved.Image != nil {
+		t.Errorf("Product mismatch: got %+v", saved)
+	}
+
+	missing := &models.Product{ID: "missing", Name: "Missing", Category: "None", Price: aud(100)}
+	if err := db.UpdateProduct(ctx, missing); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+}
+
+func TestSetProductStock(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	stock := 3
+	if err := db.SetProductStock(ctx, "1", &stock); err != nil {
+		t.Fatalf("Failed to set stock: %v", err)
+	}
+	saved, err := db.GetProductByID(ctx, "1")
+	if err != nil {
+		t.Fatalf("Failed to get product: %v", err)
+	}
+	if saved.Stock == nil || *saved.Stock != 3 || saved.SoldOut {
+		t.Errorf("Stock mismatch: got %+v", saved)
+	}
+
+	// Updating the product's details leaves its stock alone
+	saved.Name = "Waffle"
+	saved.Stock = nil
+	if err := db.UpdateProduct(ctx, saved); err != nil {
+		t.Fatalf("Failed to update product: %v", err)
+	}
+
+	stock = 0
+	if err := db.SetProductStock(ctx, "1", &stock); err != nil {
+		t.Fatalf("Failed to set stock: %v", err)
+	}
+	saved, err = db.GetProductByID(ctx, "1")
+	if err != nil {
+		t.Fatalf("Failed to get product: %v", err)
+	}
+	if saved.Name != "Waffle" || saved.Stock == nil || *saved.Stock != 0 || !saved.SoldOut {
+		t.Errorf("Stock mismatch: got %+v", saved)
+	}
+
+	if err := db.SetProductStock(ctx, "1", nil); err != nil {
+		t.Fatalf("Failed to stop tracking stock: %v", err)
+	}
+	saved, err = db.GetProductByID(ctx, "1")
+	if err != nil {
+		t.Fatalf("Failed to get product: %v", err)
+	}
+	if saved.Stock != nil || saved.SoldOut {
+		t.Errorf("Expected untracked stock, got %+v", saved)
+	}
+
+	if err := db.SetProductStock(ctx, "missing", &stock); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+}
+
+func TestDeleteProduct(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	placeTestOrder(t, db, "order-1", "", "")
+
+	if err := db.DeleteProduct(ctx, "1"); err != nil {
+		t.Fatalf("Failed to delete product: %v", err)
+	}
+
+	product, err := db.GetProductByID(ctx, "1")
+	if err != nil || product != nil {
+		t.Errorf("Expected deleted product to be hidden, got %+v, %v", product, err)
+	}
+	products, err := db.GetAllProducts(ctx, models.ProductFilter{}, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to get products: %v", err)
+	}
+	if len(products) != 8 {
+		t.Errorf("Expected 8 products after delete, got %d", len(products))
+	}
+
+	// Past orders still resolve the deleted product
+	order, err := db.GetOrderByID(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if order == nil || len(order.Products) != 1 || order.Products[0].Name != "Waffle with Berries" {
+		t.Errorf("Expected order to keep its product, got %+v", order)
+	}
+
+	if err := db.DeleteProduct(ctx, "1"); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("Expected ErrProductNotFound deleting twice, got %v", err)
+	}
+	updated := &models.Product{ID: "1", Name: "Waffle", Category: "Waffle", Price: aud(700)}
+	if err := db.UpdateProduct(ctx, updated); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("Expected ErrProductNotFound updating a deleted product, got %v", err)
+	}
+	if err := db.CreateProduct(ctx, updated); !errors.Is(err, ErrProductExists) {
+		t.Errorf("Expected ErrProductExists reusing a deleted product ID, got %v", err)
+	}
+}
+
 func TestIsCouponValid(t *testing.T) {
 	db := setupTestDB(t)
 	ctx := context.Background()
@@ -79,7 +415,7 @@ func TestIsCouponValid(t *testing.T) {
 		code  string
 		valid bool
 	}{
-		{"valid coupon from init.sql", "HAPPYHRS", true},
+		{"valid coupon from seed.sql", "HAPPYHRS", true},
 		{"another valid coupon", "FIFTYOFF", true},
 		{"invalid coupon", "INVALID", false},
 		{"empty coupon", "", true},
@@ -101,11 +437,480 @@ func TestIsCouponValid(t *testing.T) {
 	}
 }
 
+func TestIsCouponValid_Policy(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	err := db.InsertCoupons(ctx, []coupon.Match{
+		{Code: "SIXSIX", Sources: []string{"vendor1.gz", "vendor2.gz", "vendor3.gz"}},
+		{Code: "TWOSRC12", Sources: []string{"vendor1.gz", "vendor2.gz"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert coupons: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		policy coupon.Policy
+		code   string
+		valid  bool
+	}{
+		{"default policy rejects short code", coupon.DefaultPolicy(), "SIXSIX", false},
+		{"default policy accepts two sources", coupon.DefaultPolicy(), "TWOSRC12", true},
+		{"campaign policy accepts short code", coupon.Policy{MinLength: 6, MaxLength: 12, MinSources: 3}, "SIXSIX", true},
+		{"raised threshold rejects two sources", coupon.Policy{MinLength: 6, MaxLength: 12, MinSources: 3}, "TWOSRC12", false},
+		{"coupon without recorded sources", coupon.Policy{MinLength: 6, MaxLength: 12, MinSources: 3}, "HAPPYHRS", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db.SetCouponPolicy(tt.policy)
+
+			valid, err := db.IsCouponValid(ctx, tt.code)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if valid != tt.valid {
+				t.Errorf("IsCouponValid(%q) = %v, want %v", tt.code, valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestGetCoupon(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	c, err := db.GetCoupon(ctx, "HAPPYHRS")
+	if err != nil {
+		t.Fatalf("Failed to get coupon: %v", err)
+	}
+	if c == nil || c.Rule == nil || c.Rule.Type != models.CouponRulePercentage || c.Rule.Value != 18 {
+		t.Errorf("Coupon mismatch: got %+v, want percentage 18 rule", c)
+	}
+	if c != nil && (c.StartsAt != nil || c.EndsAt != nil || c.MaxRedemptions != 0 || c.MaxPerCustomer != 0) {
+		t.Errorf("Expected unbounded coupon, got %+v", c)
+	}
+
+	c, err = db.GetCoupon(ctx, "BIRTHDAY")
+	if err != nil {
+		t.Fatalf("Failed to get coupon: %v", err)
+	}
+	if c == nil || c.Rule == nil || c.Rule.Type != models.CouponRuleFreeItem || c.Rule.ProductID != "7" {
+		t.Errorf("Coupon mismatch: got %+v, want free item 7 rule", c)
+	}
+
+	c, err = db.GetCoupon(ctx, "OVER9000")
+	if err != nil {
+		t.Fatalf("Failed to get coupon: %v", err)
+	}
+	if c == nil || c.Rule == nil || c.Rule.Type != models.CouponRuleFixedAmount || c.Rule.Amount != 1000 || c.Rule.MinSubtotal != 9000 {
+		t.Errorf("Coupon mismatch: got %+v, want 1000 off over 9000 rule", c)
+	}
+
+	c, err = db.GetCoupon(ctx, "NOTINDB88")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if c != nil {
+		t.Errorf("Expected nil for unknown coupon, got %+v", c)
+	}
+}
+
+func TestGetCoupon_Lifecycle(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	startsAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endsAt := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	_, err := db.ExecContext(ctx,
+		`UPDATE valid_coupons SET starts_at = ?, ends_at = ?, max_redemptions = 10, max_per_customer = 2 WHERE code = 'HAPPYHRS'`,
+		startsAt, endsAt)
+	if err != nil {
+		t.Fatalf("Failed to update coupon: %v", err)
+	}
+	placeTestOrder(t, db, "order-1", "HAPPYHRS", "alice")
+	placeTestOrder(t, db, "order-2", "HAPPYHRS", "bob")
+
+	c, err := db.GetCoupon(ctx, "HAPPYHRS")
+	if err != nil {
+		t.Fatalf("Failed to get coupon: %v", err)
+	}
+	if c.StartsAt == nil || !c.StartsAt.Equal(startsAt) || c.EndsAt == nil || !c.EndsAt.Equal(endsAt) {
+		t.Errorf("Window mismatch: got %v - %v", c.StartsAt, c.EndsAt)
+	}
+	if c.MaxRedemptions != 10 || c.MaxPerCustomer != 2 || c.Redemptions != 2 {
+		t.Errorf("Limits mismatch: got %+v", c)
+	}
+
+	used, err := db.CountCustomerRedemptions(ctx, "HAPPYHRS", "alice")
+	if err != nil {
+		t.Fatalf("Failed to count redemptions: %v", err)
+	}
+	if used != 1 {
+		t.Errorf("Expected 1 redemption for alice, got %d", used)
+	}
+}
+
+func TestCreateCoupon(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	endsAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &models.Coupon{
+		Code:           "SPRING25",
+		Rule:           &models.CouponRule{Type: models.CouponRulePercentage, Value: 25},
+		EndsAt:         &endsAt,
+		MaxPerCustomer: 1,
+	}
+	if err := db.CreateCoupon(ctx, c); err != nil {
+		t.Fatalf("Failed to create coupon: %v", err)
+	}
+
+	saved, err := db.GetCoupon(ctx, "SPRING25")
+	if err != nil {
+		t.Fatalf("Failed to get coupon: %v", err)
+	}
+	if saved == nil || saved.Rule == nil || saved.Rule.Value != 25 || saved.MaxPerCustomer != 1 || saved.MaxRedemptions != 0 {
+		t.Fatalf("Coupon mismatch: got %+v", saved)
+	}
+	if saved.StartsAt != nil || saved.EndsAt == nil || !saved.EndsAt.Equal(endsAt) {
+		t.Errorf("Window mismatch: got %v - %v", saved.StartsAt, saved.EndsAt)
+	}
+
+	valid, err := db.IsCouponValid(ctx, "SPRING25")
+	if err != nil || !valid {
+		t.Errorf("Expected created coupon to be valid, got %v, %v", valid, err)
+	}
+
+	if err := db.CreateCoupon(ctx, c); !errors.Is(err, ErrCouponExists) {
+		t.Errorf("Expected ErrCouponExists, got %v", err)
+	}
+	if err := db.CreateCoupon(ctx, &models.Coupon{Code: "SHORT"}); !errors.Is(err, ErrCouponCodeLength) {
+		t.Errorf("Expected ErrCouponCodeLength, got %v", err)
+	}
+}
+
+func TestDeactivateCoupon(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	placeTestOrder(t, db, "order-1", "HAPPYHRS", "")
+
+	if err := db.DeactivateCoupon(ctx, "HAPPYHRS"); err != nil {
+		t.Fatalf("Failed to deactivate coupon: %v", err)
+	}
+
+	valid, err := db.IsCouponValid(ctx, "HAPPYHRS")
+	if err != nil || valid {
+		t.Errorf("Expected deactivated coupon to be invalid, got %v, %v", valid, err)
+	}
+	if err := db.CreateOrder(ctx, testOrder("order-2", "HAPPYHRS", "")); !errors.Is(err, ErrCouponDeactivated) {
+		t.Errorf("Expected ErrCouponDeactivated, got %v", err)
+	}
+
+	c, err := db.GetCoupon(ctx, "HAPPYHRS")
+	if err != nil {
+		t.Fatalf("Failed to get coupon: %v", err)
+	}
+	if c == nil || c.DeactivatedAt == nil || c.Redemptions != 1 {
+		t.Errorf("Expected deactivated coupon to keep its redemptions, got %+v", c)
+	}
+
+	if err := db.DeactivateCoupon(ctx, "HAPPYHRS"); !errors.Is(err, ErrCouponNotFound) {
+		t.Errorf("Expected ErrCouponNotFound deactivating twice, got %v", err)
+	}
+	if err := db.DeactivateCoupon(ctx, "NOTINDB88"); !errors.Is(err, ErrCouponNotFound) {
+		t.Errorf("Expected ErrCouponNotFound, got %v", err)
+	}
+	if err := db.DeactivateCoupon(ctx, "SHORT"); !errors.Is(err, ErrCouponCodeLength) {
+		t.Errorf("Expected ErrCouponCodeLength, got %v", err)
+	}
+}
+
+func TestListCoupons(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	placeTestOrder(t, db, "order-1", "HAPPYHRS", "")
+	placeTestOrder(t, db, "order-2", "HAPPYHRS", "bob")
+
+	coupons, err := db.ListCoupons(ctx, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to list coupons: %v", err)
+	}
+	if len(coupons) != 8 || coupons[0].Code != "BIRTHDAY" {
+		t.Fatalf("Expected 8 coupons starting with BIRTHDAY, got %+v", coupons)
+	}
+	for _, c := range coupons {
+		want := 0
+		if c.Code == "HAPPYHRS" {
+			want = 2
+		}
+		if c.Redemptions != want {
+			t.Errorf("%s: expected %d redemptions, got %d", c.Code, want, c.Redemptions)
+		}
+	}
+
+	page, err := db.ListCoupons(ctx, 2, 1)
+	if err != nil {
+		t.Fatalf("Failed to list coupons: %v", err)
+	}
+	if len(page) != 2 || page[0].Code != "BUYGETON" {
+		t.Errorf("Expected page starting with BUYGETON, got %+v", page)
+	}
+}
+
+func TestCreateOrder_RedemptionLimits(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	_, err := db.ExecContext(ctx, `UPDATE valid_coupons SET max_redemptions = 2, max_per_customer = 1 WHERE code = 'HAPPYHRS'`)
+	if err != nil {
+		t.Fatalf("Failed to update coupon: %v", err)
+	}
+
+	placeTestOrder(t, db, "order-1", "HAPPYHRS", "alice")
+
+	err = db.CreateOrder(ctx, testOrder("order-2", "HAPPYHRS", "alice"))
+	if !errors.Is(err, ErrCustomerRedemptionLimit) {
+		t.Errorf("Expected ErrCustomerRedemptionLimit, got %v", err)
+	}
+
+	placeTestOrder(t, db, "order-3", "HAPPYHRS", "bob")
+
+	err = db.CreateOrder(ctx, testOrder("order-4", "HAPPYHRS", "carol"))
+	if !errors.Is(err, ErrRedemptionLimit) {
+		t.Errorf("Expected ErrRedemptionLimit, got %v", err)
+	}
+
+	// Rejected orders are rolled back along with their redemption
+	for _, id := range []string{"order-2", "order-4"} {
+		order, err := db.GetOrderByID(ctx, id)
+		if err != nil || order != nil {
+			t.Errorf("Expected %s not to be stored, got %+v, %v", id, order, err)
+		}
+	}
+}
+
+// testOrder builds a single-line order for the waffle (ID=1)
+func testOrder(id, couponCode, customerID string) *models.Order {
+	return &models.Order{
+		ID:         id,
+		CouponCode: couponCode,
+		CustomerID: customerID,
+		Items:      []models.OrderItem{{ProductID: "1", Quantity: 1}},
+		Lines:      []models.OrderLine{{ProductID: "1", Quantity: 1, UnitPrice: aud(650), Amount: aud(650)}},
+		Subtotal:   aud(650),
+		Total:      aud(650),
+		Status:     models.OrderPlaced,
+		CreatedAt:  time.Now().UTC(),
+	}
+}
+
+func placeTestOrder(t *testing.T, db *DB, id, couponCode, customerID string) {
+	t.Helper()
+	if err := db.CreateOrder(context.Background(), testOrder(id, couponCode, customerID)); err != nil {
+		t.Fatalf("Failed to create order %s: %v", id, err)
+	}
+}
+
+func TestCreateOrder(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	order := &models.Order{
+		ID:         "order-1",
+		CouponCode: "HAPPYHRS",
+		Items:      []models.OrderItem{{ProductID: "1", Quantity: 2}, {ProductID: "5", Quantity: 1}},
+		Lines: []models.OrderLine{
+			{ProductID: "1", Quantity: 2, UnitPrice: aud(650), Amount: aud(1300), TaxCategory: "standard", Tax: aud(97)},
+			{ProductID: "5", Quantity: 1, UnitPrice: aud(400), Amount: aud(400), TaxCategory: "food", Tax: aud(0)},
+		},
+		Subtotal:     aud(1700),
+		Discounts:    aud(306),
+		Tax:          aud(97),
+		TaxInclusive: true,
+		Total:        aud(1394),
+		Status:       models.OrderPlaced,
+		History:      []models.OrderStatusChange{{To: models.OrderPlaced, Actor: "customer-1", At: createdAt}},
+		CreatedAt:    createdAt,
+	}
+
+	if err := db.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	saved, err := db.GetOrderByID(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if saved == nil {
+		t.Fatal("Expected order, got nil")
+	}
+
+	if saved.CouponCode != "HAPPYHRS" || saved.Subtotal != aud(1700) || saved.Discounts != aud(306) || saved.Total != aud(1394) ||
+		saved.Tax != aud(97) || !saved.TaxInclusive {
+		t.Errorf("Order mismatch: got %+v", saved)
+	}
+	if !saved.CreatedAt.Equal(createdAt) {
+		t.Errorf("CreatedAt = %v, want %v", saved.CreatedAt, createdAt)
+	}
+	if len(saved.Lines) != 2 || saved.Lines[0] != order.Lines[0] || saved.Lines[1] != order.Lines[1] {
+		t.Errorf("Lines mismatch: got %+v", saved.Lines)
+	}
+	if len(saved.Items) != 2 || len(saved.Products) != 2 || saved.Products[1].Name != "Pistachio Baklava" {
+		t.Errorf("Items or products mismatch: got %+v / %+v", saved.Items, saved.Products)
+	}
+	if saved.Status != models.OrderPlaced || len(saved.History) != 1 || saved.History[0].To != models.OrderPlaced ||
+		saved.History[0].Actor != "customer-1" || !saved.History[0].At.Equal(createdAt) {
+		t.Errorf("Status mismatch: got %s / %+v", saved.Status, saved.History)
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+	placeTestOrder(t, db, "order-1", "", "")
+
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	change := models.OrderStatusChange{From: models.OrderPlaced, To: models.OrderCancelled, Actor: "kitchen", Reason: "out of waffles", At: at}
+	if err := db.UpdateOrderStatus(ctx, "order-1", change); err != nil {
+		t.Fatalf("Failed to update order status: %v", err)
+	}
+
+	saved, err := db.GetOrderByID(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if saved.Status != models.OrderCancelled {
+		t.Errorf("Status = %s, want %s", saved.Status, models.OrderCancelled)
+	}
+	if len(saved.History) != 1 || saved.History[0] != change {
+		t.Errorf("History mismatch: got %+v", saved.History)
+	}
+
+	// The order is no longer placed, so a second change from placed loses the race
+	change.To = models.OrderAccepted
+	if err := db.UpdateOrderStatus(ctx, "order-1", change); !errors.Is(err, ErrOrderStatusChanged) {
+		t.Errorf("Expected ErrOrderStatusChanged, got %v", err)
+	}
+	if err := db.UpdateOrderStatus(ctx, "missing", change); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+}
+
+func TestCreateOrder_Stock(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	setStock := func(id string, n int) {
+		t.Helper()
+		if err := db.SetProductStock(ctx, id, &n); err != nil {
+			t.Fatalf("Failed to set stock of %s: %v", id, err)
+		}
+	}
+	stockOf := func(id string) *int {
+		t.Helper()
+		product, err := db.GetProductByID(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to get product %s: %v", id, err)
+		}
+		return product.Stock
+	}
+	setStock("1", 3)
+	setStock("5", 1)
+
+	// Quantities of a product on several lines add up; product 2 isn't tracked
+	order := testOrder("order-1", "", "")
+	order.Lines = []models.OrderLine{
+		{ProductID: "1", Quantity: 1, UnitPrice: aud(650), Amount: aud(650)},
+		{ProductID: "2", Quantity: 50, UnitPrice: aud(700), Amount: aud(35000)},
+		{ProductID: "1", Quantity: 1, UnitPrice: aud(650), Amount: aud(650)},
+	}
+	if err := db.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	if got := stockOf("1"); got == nil || *got != 1 {
+		t.Errorf("Stock of 1 = %v, want 1", got)
+	}
+	if got := stockOf("2"); got != nil {
+		t.Errorf("Stock of 2 = %v, want untracked", *got)
+	}
+
+	// Every short product is reported and nothing is taken
+	order = testOrder("order-2", "", "")
+	order.Lines = []models.OrderLine{
+		{ProductID: "1", Quantity: 2, UnitPrice: aud(650), Amount: aud(1300)},
+		{ProductID: "5", Quantity: 2, UnitPrice: aud(400), Amount: aud(800)},
+	}
+	err := db.CreateOrder(ctx, order)
+	var stockErr *InsufficientStockError
+	if !errors.As(err, &stockErr) || !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Expected InsufficientStockError, got %v", err)
+	}
+	if len(stockErr.ProductIDs) != 2 || stockErr.ProductIDs[0] != "1" || stockErr.ProductIDs[1] != "5" {
+		t.Errorf("ProductIDs = %v, want [1 5]", stockErr.ProductIDs)
+	}
+	if got := stockOf("1"); *got != 1 {
+		t.Errorf("Stock of 1 = %d after failed order, want 1", *got)
+	}
+	if saved, _ := db.GetOrderByID(ctx, "order-2"); saved != nil {
+		t.Error("Expected failed order not to be stored")
+	}
+
+	// Cancelling puts the items back
+	change := models.OrderStatusChange{From: models.OrderPlaced, To: models.OrderCancelled, Actor: "kitchen", At: time.Now().UTC()}
+	if err := db.UpdateOrderStatus(ctx, "order-1", change); err != nil {
+		t.Fatalf("Failed to cancel order: %v", err)
+	}
+	if got := stockOf("1"); *got != 3 {
+		t.Errorf("Stock of 1 = %d after cancellation, want 3", *got)
+	}
+	if got := stockOf("2"); got != nil {
+		t.Errorf("Stock of 2 = %v after cancellation, want untracked", *got)
+	}
+}
+
+func TestCreateOrder_DuplicateID(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+
+	order := &models.Order{
+		ID:        "order-1",
+		Lines:     []models.OrderLine{{ProductID: "1", Quantity: 1, UnitPrice: aud(650), Amount: aud(650)}},
+		Subtotal:  aud(650),
+		Total:     aud(650),
+		CreatedAt: time.Now(),
+	}
+	if err := db.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	if err := db.CreateOrder(ctx, order); err == nil {
+		t.Error("Expected error for duplicate order ID")
+	}
+}
+
+func TestGetOrderByID_NotFound(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	order, err := db.GetOrderByID(ctx, "missing")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if order != nil {
+		t.Errorf("Expected nil for non-existent order, got %+v", order)
+	}
+}
+
 func TestProductImage_NilHandling(t *testing.T) {
 	db := setupTestDB(t)
 	ctx := context.Background()
 
-	// Vanilla Panna Cotta (ID=9) has images in init.sql
+	// Vanilla Panna Cotta (ID=9) has images in seed.sql
 	retrieved, err := db.GetProductByID(ctx, "9")
 	if err != nil {
 		t.Fatalf("Failed to get product: %v", err)
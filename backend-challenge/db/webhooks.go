@@ -0,0 +1,229 @@
+package db
+
+import (
+	"backend-challenge/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (db *DB) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO webhooks (id, url, events, secret, created_at) VALUES (?, ?, ?, ?, ?)`,
+		webhook.ID, webhook.URL, strings.Join(webhook.Events, " "), webhook.Secret, webhook.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+// ListWebhooks returns the webhooks that have not been deleted, oldest first,
+// without their secrets
+func (db *DB) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, url, events, created_at FROM webhooks WHERE deleted_at IS NULL ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		var webhook models.Webhook
+		var events string
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &events, &webhook.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to list webhooks: %w", err)
+		}
+		webhook.Events = strings.Fields(events)
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook stops deliveries to a webhook. Its pending deliveries are
+// marked failed; the delivery log is kept.
+func (db *DB) DeleteWebhook(ctx context.Context, id string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE webhooks SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if err := requireRow(res, ErrWebhookNotFound); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = ?, last_error = ?, next_attempt_at = NULL
+		WHERE webhook_id = ? AND status = ?`,
+		models.DeliveryFailed, "webhook deleted", id, models.DeliveryPending)
+	if err != nil {
+		return fmt.Errorf("failed to cancel webhook deliveries: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// deliveryColumns selects a delivery in the order scanDelivery expects
+const deliveryColumns = `d.id, d.webhook_id, d.event_id, e.event_type, d.status, d.attempts,
+	d.last_status_code, d.last_error, d.next_attempt_at, d.delivered_at, d.created_at`
+
+// ListWebhookDeliveries returns a webhook's deliveries, newest first. It
+// returns ErrWebhookNotFound if the webhook was never registered.
+func (db *DB) ListWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) ([]models.WebhookDelivery, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = ?)`, webhookID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	if !exists {
+		return nil, ErrWebhookNotFound
+	}
+
+	query := `SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries d JOIN outbox_events e ON e.id = d.event_id
+		WHERE d.webhook_id = ? ORDER BY d.id DESC`
+	query += pageClause(limit, offset)
+
+	rows, err := db.QueryContext(ctx, query, webhookID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// EnqueueWebhookDeliveries queues a pending delivery of the event for every
+// webhook subscribed to its type. Webhooks that already have the event queued
+// are skipped, so an event published again is not delivered twice.
+func (db *DB) EnqueueWebhookDeliveries(ctx context.Context, event models.OutboxEvent, now time.Time) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, events FROM webhooks WHERE deleted_at IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	var subscribed []string
+	for rows.Next() {
+		var webhook models.Webhook
+		var events string
+		if err := rows.Scan(&webhook.ID, &events); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to get webhooks: %w", err)
+		}
+		webhook.Events = strings.Fields(events)
+		if webhook.Subscribes(event.Type) {
+			subscribed = append(subscribed, webhook.ID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get webhooks: %w", err)
+	}
+
+	now = now.UTC()
+	for _, webhookID := range subscribed {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO webhook_deliveries (webhook_id, event_id, status, next_attempt_at, created_at)
+			VALUES (?, ?, ?, ?, ?) ON CONFLICT (webhook_id, event_id) DO NOTHING`,
+			webhookID, event.ID, models.DeliveryPending, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to queue webhook delivery: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries whose next
+// attempt is due at now, with their webhook and event
+func (db *DB) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.PendingWebhookDelivery, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+deliveryColumns+`, w.url, w.secret, e.data, e.created_at
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		JOIN outbox_events e ON e.id = d.event_id
+		WHERE d.status = ? AND (d.next_attempt_at IS NULL OR d.next_attempt_at <= ?)
+		ORDER BY d.id`+pageClause(limit, 0), models.DeliveryPending, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var due []models.PendingWebhookDelivery
+	for rows.Next() {
+		var pending models.PendingWebhookDelivery
+		var data string
+		delivery, err := scanDelivery(rows, &pending.URL, &pending.Secret, &data, &pending.Event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get due webhook deliveries: %w", err)
+		}
+		pending.WebhookDelivery = *delivery
+		pending.Event.ID, pending.Event.Type, pending.Event.Data = delivery.EventID, delivery.EventType, json.RawMessage(data)
+		due = append(due, pending)
+	}
+	return due, rows.Err()
+}
+
+// RecordWebhookAttempt stores the outcome of an attempt to send a delivery
+func (db *DB) RecordWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery) error {
+	res, err := db.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = ?, attempts = ?, last_status_code = ?, last_error = ?,
+		next_attempt_at = ?, delivered_at = ? WHERE id = ?`,
+		delivery.Status, delivery.Attempts, nullInt(delivery.LastStatusCode), nullString(delivery.LastError),
+		nullTime(delivery.NextAttemptAt), nullTime(delivery.DeliveredAt), delivery.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook attempt: %w", err)
+	}
+	return requireRow(res, ErrWebhookDeliveryNotFound)
+}
+
+// scanDelivery scans deliveryColumns into a WebhookDelivery, followed by any
+// extra destinations
+func scanDelivery(scanner rowScanner, extra ...interface{}) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var statusCode sql.NullInt64
+	var lastError sql.NullString
+	var nextAttemptAt, deliveredAt sql.NullTime
+	dest := []interface{}{&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts,
+		&statusCode, &lastError, &nextAttemptAt, &deliveredAt, &d.CreatedAt}
+	if err := scanner.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	d.LastStatusCode = int(statusCode.Int64)
+	d.LastError = lastError.String
+	if nextAttemptAt.Valid {
+		d.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"backend-challenge/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWebhookDeliveries(t *testing.T) {
+	db := setupWritableTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, webhook := range []models.Webhook{
+		{ID: "orders", URL: "https://a.example.com", Events: []string{models.EventOrderPlaced}, Secret: "s1", CreatedAt: now},
+		{ID: "coupons", URL: "https://b.example.com", Events: []string{models.EventCouponRedeemed}, Secret: "s2", CreatedAt: now},
+	} {
+		if err := db.CreateWebhook(ctx, &webhook); err != nil {
+			t.Fatalf("Failed to create webhook: %v", err)
+		}
+	}
+
+	placeTestOrder(t, db, "order-1", "", "")
+	events, err := db.PendingOutboxEvents(ctx, now, 10)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("Expected one outbox event, got %+v, %v", events, err)
+	}
+	// Publishing the event again doesn't queue it twice
+	for i := 0; i < 2; i++ {
+		if err := db.EnqueueWebhookDeliveries(ctx, events[0], now); err != nil {
+			t.Fatalf("Failed to enqueue deliveries: %v", err)
+		}
+	}
+
+	// Only the webhook subscribed to order.placed gets a delivery
+	due, err := db.DueWebhookDeliveries(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("Failed to get due deliveries: %v", err)
+	}
+	if len(due) != 1 || due[0].WebhookID != "orders" || due[0].Secret != "s1" || due[0].Event.Type != models.EventOrderPlaced {
+		t.Fatalf("Unexpected due deliveries: %+v", due)
+	}
+
+	retryAt := now.Add(time.Minute).In(time.FixedZone("AEST", 10*60*60))
+	delivery := due[0].WebhookDelivery
+	delivery.Attempts, delivery.LastStatusCode, delivery.LastError, delivery.NextAttemptAt = 1, 503, "unavailable", &retryAt
+	if err := db.RecordWebhookAttempt(ctx, delivery); err != nil {
+		t.Fatalf("Failed to record attempt: %v", err)
+	}
+
+	if due, _ := db.DueWebhookDeliveries(ctx, now.Add(30*time.Second), 10); len(due) != 0 {
+		t.Errorf("Expected no delivery before its retry, got %+v", due)
+	}
+	if due, _ := db.DueWebhookDeliveries(ctx, retryAt, 10); len(due) != 1 {
+		t.Errorf("Expected the delivery due at its retry, got %+v", due)
+	}
+
+	// The limit is applied to due deliveries only, oldest first
+	placeTestOrder(t, db, "order-2", "", "")
+	if events, err = db.PendingOutboxEvents(ctx, now, 10); err != nil || len(events) != 2 {
+		t.Fatalf("Expected two outbox events, got %+v, %v", events, err)
+	}
+	if err := db.EnqueueWebhookDeliveries(ctx, events[1], now); err != nil {
+		t.Fatalf("Failed to enqueue deliveries: %v", err)
+	}
+	if due, _ := db.DueWebhookDeliveries(ctx, now, 1); len(due) != 1 || due[0].EventID != events[1].ID {
+		t.Errorf("Expected only the new delivery due now, got %+v", due)
+	}
+	if due, _ := db.DueWebhookDeliveries(ctx, retryAt, 1); len(due) != 1 || due[0].ID != delivery.ID {
+		t.Errorf("Expected the oldest due delivery with a limit of 1, got %+v", due)
+	}
+
+	log, err := db.ListWebhookDeliveries(ctx, "orders", 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to list deliveries: %v", err)
+	}
+	if len(log) != 2 || log[1].Attempts != 1 || log[1].LastStatusCode != 503 || log[1].LastError != "unavailable" {
+		t.Errorf("Unexpected delivery log: %+v", log)
+	}
+
+	// Deleting the webhook gives up on its pending deliveries but keeps the log
+	if err := db.DeleteWebhook(ctx, "orders"); err != nil {
+		t.Fatalf("Failed to delete webhook: %v", err)
+	}
+	if err := db.DeleteWebhook(ctx, "orders"); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+	log, err = db.ListWebhookDeliveries(ctx, "orders", 0, 0)
+	if err != nil || len(log) != 2 || log[0].Status != models.DeliveryFailed {
+		t.Errorf("Expected failed delivery in the log, got %+v, %v", log, err)
+	}
+	webhooks, err := db.ListWebhooks(ctx)
+	if err != nil || len(webhooks) != 1 || webhooks[0].ID != "coupons" || webhooks[0].Secret != "" {
+		t.Errorf("Expected only the coupons webhook without its secret, got %+v, %v", webhooks, err)
+	}
+
+	if _, err := db.ListWebhookDeliveries(ctx, "missing", 0, 0); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+// Package events fans order status changes out to subscribers in this
+// process. Events are not persisted: subscribers that fall behind or connect
+// late catch up from the order history instead.
+package events
+
+import (
+	"backend-challenge/models"
+	"sync"
+)
+
+// subscriberBuffer is how many events a subscriber can fall behind before it
+// is dropped
+const subscriberBuffer = 16
+
+// Bus delivers published events to the subscribers of their order
+type Bus struct {
+	mu     sync.Mutex
+	subs   map[string]map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscription receives the events of one order until it is closed
+type Subscription struct {
+	// C is closed when the subscription ends, whether by Close, by the bus
+	// closing, or because the subscriber fell too far behind
+	C <-chan models.OrderEvent
+
+	bus     *Bus
+	orderID string
+	ch      chan models.OrderEvent
+}
+
+// NewBus returns a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subs: make(map[string]map[*Subscription]struct{})}
+}
+
+// Subscribe starts receiving the events published for orderID
+func (b *Bus) Subscribe(orderID string) *Subscription {
+	ch := make(chan models.OrderEvent, subscriberBuffer)
+	sub := &Subscription{C: ch, bus: b, orderID: orderID, ch: ch}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return sub
+	}
+	if b.subs[orderID] == nil {
+		b.subs[orderID] = make(map[*Subscription]struct{})
+	}
+	b.subs[orderID][sub] = struct{}{}
+	return sub
+}
+
+// Publish sends e to the subscribers of its order without blocking.
+// Subscribers whose buffer is full are dropped.
+func (b *Bus) Publish(e models.OrderEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs[e.OrderID] {
+		select {
+		case sub.ch <- e:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Close ends every subscription and stops accepting new ones
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, subs := range b.subs {
+		for sub := range subs {
+			b.remove(sub)
+		}
+	}
+}
+
+// Close stops the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// remove unregisters sub and closes its channel; b.mu must be held
+func (b *Bus) remove(sub *Subscription) {
+	subs, ok := b.subs[sub.orderID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subs, sub.orderID)
+	}
+	close(sub.ch)
+}
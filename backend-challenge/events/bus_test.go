@@ -0,0 +1,73 @@
+package events
+
+import (
+	"backend-challenge/models"
+	"testing"
+)
+
+func event(orderID string, id int) models.OrderEvent {
+	return models.OrderEvent{ID: id, OrderID: orderID}
+}
+
+func TestBus_Publish(t *testing.T) {
+	bus := NewBus()
+	a := bus.Subscribe("a")
+	a2 := bus.Subscribe("a")
+	b := bus.Subscribe("b")
+
+	bus.Publish(event("a", 1))
+
+	for _, sub := range []*Subscription{a, a2} {
+		if e := <-sub.C; e.ID != 1 {
+			t.Errorf("Expected event 1, got %+v", e)
+		}
+	}
+	select {
+	case e := <-b.C:
+		t.Errorf("Expected no event for another order, got %+v", e)
+	default:
+	}
+
+	a.Close()
+	a.Close()
+	if _, ok := <-a.C; ok {
+		t.Error("Expected closed subscription")
+	}
+	bus.Publish(event("a", 2))
+	if e := <-a2.C; e.ID != 2 {
+		t.Errorf("Expected remaining subscriber to get event 2, got %+v", e)
+	}
+}
+
+func TestBus_SlowSubscriber(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe("a")
+
+	for i := 1; i <= subscriberBuffer+1; i++ {
+		bus.Publish(event("a", i))
+	}
+
+	// The buffered events are still delivered, then the channel closes
+	n := 0
+	for range sub.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("Expected %d buffered events, got %d", subscriberBuffer, n)
+	}
+	sub.Close()
+}
+
+func TestBus_Close(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe("a")
+
+	bus.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("Expected Close to end subscriptions")
+	}
+	if _, ok := <-bus.Subscribe("a").C; ok {
+		t.Error("Expected subscriptions after Close to be closed")
+	}
+	bus.Publish(event("a", 1))
+}
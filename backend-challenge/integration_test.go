@@ -1,27 +1,83 @@
 package main
 
 import (
+	"backend-challenge/db"
+	"backend-challenge/db/pgtest"
 	"backend-challenge/models"
+	"backend-challenge/money"
+	"backend-challenge/service"
+	"backend-challenge/webhook"
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// copyTestDB copies the committed database so tests that write don't modify
+// it, and returns its path. With TEST_POSTGRES_DSN set it instead returns the
+// DSN of a Postgres schema holding the same data.
+func copyTestDB(t *testing.T) string {
+	if dsn := pgtest.DSN(t); dsn != "" {
+		seedPostgres(t, dsn)
+		return dsn
+	}
+
+	data, err := os.ReadFile("data/store.db")
+	require.NoError(t, err)
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	require.NoError(t, os.WriteFile(dbPath, data, 0o644))
+	return dbPath
+}
+
+// testStoreDSN names the database the server tests run against: a copy of
+// the committed database, or with TEST_MEMORY_DB set, an in-memory database
+// seeded with the same data
+func testStoreDSN(t *testing.T) string {
+	if os.Getenv("TEST_MEMORY_DB") != "" {
+		return memoryScheme
+	}
+	return copyTestDB(t)
+}
+
+// seedPostgres builds the schema at dsn and loads the demo data into it
+func seedPostgres(t *testing.T, dsn string) {
+	database, err := db.Open(dsn)
+	require.NoError(t, err)
+	defer database.Close()
+
+	ctx := context.Background()
+	_, err = database.Migrate(ctx, db.LatestSchemaVersion())
+	require.NoError(t, err)
+	seed, err := os.ReadFile("data/seed.sql")
+	require.NoError(t, err)
+	_, err = database.ExecContext(ctx, string(seed))
+	require.NoError(t, err)
+}
+
 func setupIntegrationTest(t *testing.T) (*httptest.Server, func()) {
-	database, router, err := setup("data/store.db")
+	app, err := setup(testStoreDSN(t))
 	require.NoError(t, err)
 
-	server := httptest.NewServer(router)
+	server := httptest.NewServer(app.router)
 
 	cleanup := func() {
 		server.Close()
-		database.Close()
+		app.db.Close()
 	}
 
 	return server, cleanup
@@ -45,53 +101,53 @@ func TestIntegration_GetProducts(t *testing.T) {
 	expectedProducts := map[string]struct {
 		name      string
 		category  string
-		price     float64
+		price     money.Money
 		thumbnail string
 		mobile    string
 		tablet    string
 		desktop   string
 	}{
-		"1": {"Waffle with Berries", "Waffle", 6.5,
+		"1": {"Waffle with Berries", "Waffle", aud(650),
 			"https://orderfoodonline.deno.dev/public/images/image-waffle-thumbnail.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-waffle-mobile.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-waffle-tablet.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-waffle-desktop.jpg"},
-		"2": {"Vanilla Bean Crème Brûlée", "Crème Brûlée", 7,
+		"2": {"Vanilla Bean Crème Brûlée", "Crème Brûlée", aud(700),
 			"https://orderfoodonline.deno.dev/public/images/image-creme-brulee-thumbnail.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-creme-brulee-mobile.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-creme-brulee-tablet.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-creme-brulee-desktop.jpg"},
-		"3": {"Macaron Mix of Five", "Macaron", 8,
+		"3": {"Macaron Mix of Five", "Macaron", aud(800),
 			"https://orderfoodonline.deno.dev/public/images/image-macaron-thumbnail.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-macaron-mobile.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-macaron-tablet.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-macaron-desktop.jpg"},
-		"4": {"Classic Tiramisu", "Tiramisu", 5.5,
+		"4": {"Classic Tiramisu", "Tiramisu", aud(550),
 			"https://orderfoodonline.deno.dev/public/images/image-tiramisu-thumbnail.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-tiramisu-mobile.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-tiramisu-tablet.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-tiramisu-desktop.jpg"},
-		"5": {"Pistachio Baklava", "Baklava", 4,
+		"5": {"Pistachio Baklava", "Baklava", aud(400),
 			"https://orderfoodonline.deno.dev/public/images/image-baklava-thumbnail.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-baklava-mobile.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-baklava-tablet.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-baklava-desktop.jpg"},
-		"6": {"Lemon Meringue Pie", "Pie", 5,
+		"6": {"Lemon Meringue Pie", "Pie", aud(500),
 			"https://orderfoodonline.deno.dev/public/images/image-meringue-thumbnail.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-meringue-mobile.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-meringue-tablet.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-meringue-desktop.jpg"},
-		"7": {"Red Velvet Cake", "Cake", 4.5,
+		"7": {"Red Velvet Cake", "Cake", aud(450),
 			"https://orderfoodonline.deno.dev/public/images/image-cake-thumbnail.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-cake-mobile.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-cake-tablet.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-cake-desktop.jpg"},
-		"8": {"Salted Caramel Brownie", "Brownie", 4.5,
+		"8": {"Salted Caramel Brownie", "Brownie", aud(450),
 			"https://orderfoodonline.deno.dev/public/images/image-brownie-thumbnail.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-brownie-mobile.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-brownie-tablet.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-brownie-desktop.jpg"},
-		"9": {"Vanilla Panna Cotta", "Panna Cotta", 6.5,
+		"9": {"Vanilla Panna Cotta", "Panna Cotta", aud(650),
 			"https://orderfoodonline.deno.dev/public/images/image-panna-cotta-thumbnail.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-panna-cotta-mobile.jpg",
 			"https://orderfoodonline.deno.dev/public/images/image-panna-cotta-tablet.jpg",
@@ -117,6 +173,41 @@ func TestIntegration_GetProducts(t *testing.T) {
 	}
 }
 
+func TestIntegration_ProductFilters(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	listIDs := func(query string) (int, []string) {
+		resp, err := http.Get(server.URL + "/api/product?" + query)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var products []models.Product
+		json.NewDecoder(resp.Body).Decode(&products)
+		var ids []string
+		for _, p := range products {
+			ids = append(ids, p.ID)
+		}
+		return resp.StatusCode, ids
+	}
+
+	status, ids := listIDs("category=Waffle")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"1"}, ids)
+
+	_, ids = listIDs("q=vanilla&sort=-name")
+	assert.Equal(t, []string{"9", "2"}, ids)
+
+	_, ids = listIDs("minPrice=4.50&maxPrice=5.50&sort=price,-name")
+	assert.Equal(t, []string{"8", "7", "6", "4"}, ids)
+
+	// Price filters use AUD prices whatever currency the listing is in
+	_, ids = listIDs("maxPrice=4.50&currency=NZD&sort=price&limit=2")
+	assert.Equal(t, []string{"5", "7"}, ids)
+
+	status, _ = listIDs("sort=stock")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
 func TestIntegration_GetProductByID(t *testing.T) {
 	server, cleanup := setupIntegrationTest(t)
 	defer cleanup()
@@ -127,7 +218,7 @@ func TestIntegration_GetProductByID(t *testing.T) {
 		expectedStatus         int
 		expectedName           string
 		expectedCat            string
-		expectedPrice          float64
+		expectedPrice          money.Money
 		expectedThumbnailImage string
 		expectedMobileImage    string
 		expectedTabletImage    string
@@ -139,7 +230,7 @@ func TestIntegration_GetProductByID(t *testing.T) {
 			expectedStatus:         http.StatusOK,
 			expectedName:           "Waffle with Berries",
 			expectedCat:            "Waffle",
-			expectedPrice:          6.5,
+			expectedPrice:          aud(650),
 			expectedThumbnailImage: "https://orderfoodonline.deno.dev/public/images/image-waffle-thumbnail.jpg",
 			expectedMobileImage:    "https://orderfoodonline.deno.dev/public/images/image-waffle-mobile.jpg",
 			expectedTabletImage:    "https://orderfoodonline.deno.dev/public/images/image-waffle-tablet.jpg",
@@ -151,7 +242,7 @@ func TestIntegration_GetProductByID(t *testing.T) {
 			expectedStatus:         http.StatusOK,
 			expectedName:           "Vanilla Bean Crème Brûlée",
 			expectedCat:            "Crème Brûlée",
-			expectedPrice:          7,
+			expectedPrice:          aud(700),
 			expectedThumbnailImage: "https://orderfoodonline.deno.dev/public/images/image-creme-brulee-thumbnail.jpg",
 			expectedMobileImage:    "https://orderfoodonline.deno.dev/public/images/image-creme-brulee-mobile.jpg",
 			expectedTabletImage:    "https://orderfoodonline.deno.dev/public/images/image-creme-brulee-tablet.jpg",
@@ -163,7 +254,7 @@ func TestIntegration_GetProductByID(t *testing.T) {
 			expectedStatus:         http.StatusOK,
 			expectedName:           "Macaron Mix of Five",
 			expectedCat:            "Macaron",
-			expectedPrice:          8,
+			expectedPrice:          aud(800),
 			expectedThumbnailImage: "https://orderfoodonline.deno.dev/public/images/image-macaron-thumbnail.jpg",
 			expectedMobileImage:    "https://orderfoodonline.deno.dev/public/images/image-macaron-mobile.jpg",
 			expectedTabletImage:    "https://orderfoodonline.deno.dev/public/images/image-macaron-tablet.jpg",
@@ -175,7 +266,7 @@ func TestIntegration_GetProductByID(t *testing.T) {
 			expectedStatus:         http.StatusOK,
 			expectedName:           "Classic Tiramisu",
 			expectedCat:            "Tiramisu",
-			expectedPrice:          5.5,
+			expectedPrice:          aud(550),
 			expectedThumbnailImage: "https://orderfoodonline.deno.dev/public/images/image-tiramisu-thumbnail.jpg",
 			expectedMobileImage:    "https://orderfoodonline.deno.dev/public/images/image-tiramisu-mobile.jpg",
 			expectedTabletImage:    "https://orderfoodonline.deno.dev/public/images/image-tiramisu-tablet.jpg",
@@ -187,7 +278,7 @@ func TestIntegration_GetProductByID(t *testing.T) {
 			expectedStatus:         http.StatusOK,
 			expectedName:           "Pistachio Baklava",
 			expectedCat:            "Baklava",
-			expectedPrice:          4,
+			expectedPrice:          aud(400),
 			expectedThumbnailImage: "https://orderfoodonline.deno.dev/public/images/image-baklava-thumbnail.jpg",
 			expectedMobileImage:    "https://orderfoodonline.deno.dev/public/images/image-baklava-mobile.jpg",
 			expectedTabletImage:    "https://orderfoodonline.deno.dev/public/images/image-baklava-tablet.jpg",
@@ -199,7 +290,7 @@ func TestIntegration_GetProductByID(t *testing.T) {
 			expectedStatus:         http.StatusOK,
 			expectedName:           "Lemon Meringue Pie",
 			expectedCat:            "Pie",
-			expectedPrice:          5,
+			expectedPrice:          aud(500),
 			expectedThumbnailImage: "https://orderfoodonline.deno.dev/public/images/image-meringue-thumbnail.jpg",
 			expectedMobileImage:    "https://orderfoodonline.deno.dev/public/images/image-meringue-mobile.jpg",
 			expectedTabletImage:    "https://orderfoodonline.deno.dev/public/images/image-meringue-tablet.jpg",
@@ -211,7 +302,7 @@ func TestIntegration_GetProductByID(t *testing.T) {
 			expectedStatus:         http.StatusOK,
 			expectedName:           "Red Velvet Cake",
 			expectedCat:            "Cake",
-			expectedPrice:          4.5,
+			expectedPrice:          aud(450),
 			expectedThumbnailImage: "https://orderfoodonline.deno.dev/public/images/image-cake-thumbnail.jpg",
 			expectedMobileImage:    "https://orderfoodonline.deno.dev/public/images/image-cake-mobile.jpg",
 			expectedTabletImage:    "https://orderfoodonline.deno.dev/public/images/image-cake-tablet.jpg",
@@ -223,7 +314,7 @@ func TestIntegration_GetProductByID(t *testing.T) {
 			expectedStatus:         http.StatusOK,
 			expectedName:           "Salted Caramel Brownie",
 			expectedCat:            "Brownie",
-			expectedPrice:          4.5,
+			expectedPrice:          aud(450),
 			expectedThumbnailImage: "https://orderfoodonline.deno.dev/public/images/image-brownie-thumbnail.jpg",
 			expectedMobileImage:    "https://orderfoodonline.deno.dev/public/images/image-brownie-mobile.jpg",
 			expectedTabletImage:    "https://orderfoodonline.deno.dev/public/images/image-brownie-tablet.jpg",
@@ -235,7 +326,7 @@ func TestIntegration_GetProductByID(t *testing.T) {
 			expectedStatus:         http.StatusOK,
 			expectedName:           "Vanilla Panna Cotta",
 			expectedCat:            "Panna Cotta",
-			expectedPrice:          6.5,
+			expectedPrice:          aud(650),
 			expectedThumbnailImage: "https://orderfoodonline.deno.dev/public/images/image-panna-cotta-thumbnail.jpg",
 			expectedMobileImage:    "https://orderfoodonline.deno.dev/public/images/image-panna-cotta-mobile.jpg",
 			expectedTabletImage:    "https://orderfoodonline.deno.dev/public/images/image-panna-cotta-tablet.jpg",
@@ -275,6 +366,153 @@ func TestIntegration_GetProductByID(t *testing.T) {
 	}
 }
 
+// TestIntegration_MoneyJSON checks that amounts stored in minor units are
+// still written as plain numbers in major units, next to their currency
+func TestIntegration_MoneyJSON(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	resp, err := http.Get(server.URL + "/api/product/4")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var product map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&product))
+	assert.Equal(t, 5.5, product["price"])
+	assert.Equal(t, "AUD", product["currency"])
+
+	resp = doJSON(t, server, "POST", "/api/order", "apitest", models.OrderReq{
+		Items:      []models.OrderItem{{ProductID: "4", Quantity: 3}},
+		CouponCode: "HAPPYHRS",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var order map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+	assert.Equal(t, 16.5, order["subtotal"])
+	assert.Equal(t, 2.97, order["discounts"])
+	assert.Equal(t, 13.53, order["total"])
+	assert.Equal(t, "AUD", order["currency"])
+}
+
+func TestIntegration_Currencies(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	getProduct := func(path, acceptCurrency string) (*http.Response, map[string]interface{}) {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		require.NoError(t, err)
+		if acceptCurrency != "" {
+			req.Header.Set("Accept-Currency", acceptCurrency)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var product map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&product)
+		return resp, product
+	}
+
+	// seed.sql sets NZD prices; GBP is converted with data/rates.csv
+	resp, product := getProduct("/api/product/1?currency=NZD", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 7.5, product["price"])
+	assert.Equal(t, "NZD", product["currency"])
+	assert.Contains(t, resp.Header.Values("Vary"), "Accept-Currency")
+
+	_, product = getProduct("/api/product/1", "GBP, AUD;q=0.5")
+	assert.Equal(t, 3.38, product["price"])
+	assert.Equal(t, "GBP", product["currency"])
+
+	resp, _ = getProduct("/api/product?currency=USD", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Orders are priced and stored in the currency asked for
+	resp = doJSON(t, server, "POST", "/api/order?currency=NZD", "apitest", models.OrderReq{
+		Items: []models.OrderItem{{ProductID: "1", Quantity: 2}, {ProductID: "5", Quantity: 1}},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var placed models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&placed))
+	assert.Equal(t, money.New(1950, "NZD"), placed.Total)
+
+	resp = doJSON(t, server, "GET", "/api/order/"+placed.ID, "apitest", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var order models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+	assert.Equal(t, money.New(1950, "NZD"), order.Total)
+	assert.Equal(t, money.New(750, "NZD"), order.Lines[0].UnitPrice)
+	assert.Equal(t, money.New(750, "NZD"), order.Products[0].Price)
+}
+
+func TestIntegration_CurrenciesWithoutRates(t *testing.T) {
+	t.Setenv("EXCHANGE_RATES_FILE", "")
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	resp, err := http.Get(server.URL + "/api/product/1?currency=NZD")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/api/product/1?currency=GBP")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+func TestIntegration_Tax(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "admintest")
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	// data/tax.json has GST of 10% included in AUD prices, worked out after
+	// the 18% discount: 10.66 paid includes 0.97 tax
+	resp := doJSON(t, server, "POST", "/api/order", "apitest", models.OrderReq{
+		Items: []models.OrderItem{{ProductID: "1", Quantity: 2}}, CouponCode: "HAPPYHRS",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var placed models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&placed))
+	assert.Equal(t, aud(1066), placed.Total)
+	assert.Equal(t, aud(97), placed.Tax)
+	assert.True(t, placed.TaxInclusive)
+	assert.Equal(t, aud(97), placed.Lines[0].Tax)
+	assert.Equal(t, "standard", placed.Lines[0].TaxCategory)
+
+	resp = doJSON(t, server, "GET", "/api/order/"+placed.ID, "apitest", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var order models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+	assert.Equal(t, aud(97), order.Tax)
+	assert.True(t, order.TaxInclusive)
+	assert.Equal(t, aud(97), order.Lines[0].Tax)
+
+	// Categories must be ones the stores have rates for
+	resp = doJSON(t, server, "POST", "/api/admin/product", "admintest", models.Product{
+		ID: "20", Name: "Lemon Tart", Category: "Tart", Price: aud(525), TaxCategory: "luxury",
+	})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestIntegration_TaxExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tax.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"AUD": {"inclusive": false, "rates": {"standard": 10}}}`), 0o644))
+	t.Setenv("TAX_CONFIG_FILE", path)
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	// Tax is added on top of the discounted 10.66
+	resp := doJSON(t, server, "POST", "/api/order", "apitest", models.OrderReq{
+		Items: []models.OrderItem{{ProductID: "1", Quantity: 2}}, CouponCode: "HAPPYHRS",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var placed models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&placed))
+	assert.Equal(t, aud(107), placed.Tax)
+	assert.False(t, placed.TaxInclusive)
+	assert.Equal(t, aud(1173), placed.Total)
+}
+
 func TestIntegration_PlaceOrder(t *testing.T) {
 	server, cleanup := setupIntegrationTest(t)
 	defer cleanup()
@@ -286,6 +524,9 @@ func TestIntegration_PlaceOrder(t *testing.T) {
 		expectedStatus     int
 		expectedCouponCode string
 		expectedItems      []models.OrderItem
+		expectedSubtotal   money.Money
+		expectedDiscounts  money.Money
+		expectedTotal      money.Money
 	}{
 		{
 			name:               "successful order with coupon",
@@ -294,6 +535,9 @@ func TestIntegration_PlaceOrder(t *testing.T) {
 			expectedStatus:     http.StatusOK,
 			expectedCouponCode: "HAPPYHRS",
 			expectedItems:      []models.OrderItem{{ProductID: "1", Quantity: 2}},
+			expectedSubtotal:   aud(1300),
+			expectedDiscounts:  aud(234),
+			expectedTotal:      aud(1066),
 		},
 		{
 			name:               "multiple items order",
@@ -302,6 +546,26 @@ func TestIntegration_PlaceOrder(t *testing.T) {
 			expectedStatus:     http.StatusOK,
 			expectedCouponCode: "FIFTYOFF",
 			expectedItems:      []models.OrderItem{{ProductID: "1", Quantity: 2}, {ProductID: "3", Quantity: 1}},
+			expectedSubtotal:   aud(2100),
+			expectedDiscounts:  aud(1050),
+			expectedTotal:      aud(1050),
+		},
+		{
+			name:               "cheapest item free",
+			body:               models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}, {ProductID: "5", Quantity: 1}}, CouponCode: "BUYGETON"},
+			apiKey:             "apitest",
+			expectedStatus:     http.StatusOK,
+			expectedCouponCode: "BUYGETON",
+			expectedItems:      []models.OrderItem{{ProductID: "1", Quantity: 1}, {ProductID: "5", Quantity: 1}},
+			expectedSubtotal:   aud(1050),
+			expectedDiscounts:  aud(400),
+			expectedTotal:      aud(650),
+		},
+		{
+			name:           "coupon minimum basket not met",
+			body:           models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "OVER9000"},
+			apiKey:         "apitest",
+			expectedStatus: http.StatusUnprocessableEntity,
 		},
 		{
 			name:           "invalid coupon",
@@ -375,15 +639,685 @@ func TestIntegration_PlaceOrder(t *testing.T) {
 				assert.Equal(t, tt.expectedCouponCode, order.CouponCode)
 				assert.Len(t, order.Items, len(tt.expectedItems))
 				assert.Len(t, order.Products, len(tt.expectedItems))
+				assert.Len(t, order.Lines, len(tt.expectedItems))
 				for i, expectedItem := range tt.expectedItems {
 					assert.Equal(t, expectedItem.ProductID, order.Items[i].ProductID)
 					assert.Equal(t, expectedItem.Quantity, order.Items[i].Quantity)
 				}
+				assert.Equal(t, tt.expectedSubtotal, order.Subtotal)
+				assert.Equal(t, tt.expectedDiscounts, order.Discounts)
+				assert.Equal(t, tt.expectedTotal, order.Total)
+			}
+		})
+	}
+}
+
+func TestIntegration_GetOrder(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	jsonBody, err := json.Marshal(models.OrderReq{
+		Items:      []models.OrderItem{{ProductID: "1", Quantity: 2}, {ProductID: "3", Quantity: 1}},
+		CouponCode: "HAPPYHRS",
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("POST", server.URL+"/api/order", bytes.NewReader(jsonBody))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api_key", "apitest")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var placed models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&placed))
+
+	tests := []struct {
+		name           string
+		orderID        string
+		apiKey         string
+		expectedStatus int
+	}{
+		{"saved order", placed.ID, "apitest", http.StatusOK},
+		{"missing API key", placed.ID, "", http.StatusUnauthorized},
+		{"non-existent order", "does-not-exist", "apitest", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", server.URL+"/api/order/"+tt.orderID, nil)
+			require.NoError(t, err)
+			if tt.apiKey != "" {
+				req.Header.Set("api_key", tt.apiKey)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+
+			if resp.StatusCode == http.StatusOK {
+				var order models.Order
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+				assert.Equal(t, placed.ID, order.ID)
+				assert.Equal(t, "HAPPYHRS", order.CouponCode)
+				assert.Equal(t, placed.Items, order.Items)
+				assert.Equal(t, placed.Lines, order.Lines)
+				assert.Equal(t, placed.Products, order.Products)
+				assert.Equal(t, placed.Subtotal, order.Subtotal)
+				assert.Equal(t, placed.Discounts, order.Discounts)
+				assert.Equal(t, placed.Total, order.Total)
+				assert.True(t, placed.CreatedAt.Equal(order.CreatedAt))
+			}
+		})
+	}
+}
+
+// doJSON sends body as JSON with the given API key. The response body is closed when the test ends.
+func doJSON(t *testing.T, server *httptest.Server, method, path, apiKey string, body interface{}) *http.Response {
+	t.Helper()
+	var reqBody []byte
+	if body != nil {
+		var err error
+		reqBody, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+	req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(reqBody))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api_key", apiKey)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestIntegration_AdminProducts(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "admintest")
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	do := func(method, path, apiKey string, body interface{}) *http.Response {
+		return doJSON(t, server, method, path, apiKey, body)
+	}
+
+	tart := models.Product{ID: "10", Name: "Lemon Tart", Category: "Tart", Price: aud(525)}
+	resp := do("POST", "/api/admin/product", "admintest", tart)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = do("POST", "/api/admin/product", "admintest", tart)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = do("PATCH", "/api/admin/product/10", "admintest", map[string]interface{}{"price": 6})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = do("GET", "/api/product/10", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var product models.Product
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&product))
+	assert.Equal(t, aud(600), product.Price)
+
+	resp = do("POST", "/api/order", "apitest", models.OrderReq{
+		Items: []models.OrderItem{{ProductID: "10", Quantity: 2}},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var placed models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&placed))
+	assert.Equal(t, aud(1200), placed.Total)
+
+	resp = do("DELETE", "/api/admin/product/10", "admintest", nil)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = do("GET", "/api/product/10", "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = do("POST", "/api/order", "apitest", models.OrderReq{
+		Items: []models.OrderItem{{ProductID: "10", Quantity: 1}},
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	// The order placed before the delete still resolves the product
+	resp = do("GET", "/api/order/"+placed.ID, "apitest", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var order models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+	require.Len(t, order.Products, 1)
+	assert.Equal(t, "Lemon Tart", order.Products[0].Name)
+	assert.Equal(t, aud(600), order.Lines[0].UnitPrice)
+}
+
+func TestIntegration_Stock(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "admintest")
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	do := func(method, path, apiKey string, body interface{}) *http.Response {
+		return doJSON(t, server, method, path, apiKey, body)
+	}
+
+	resp := do("PUT", "/api/admin/product/1/stock", "admintest", models.StockReq{Stock: intPtr(2)})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = do("PUT", "/api/admin/product/2/stock", "admintest", models.StockReq{Stock: intPtr(0)})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = do("GET", "/api/product", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var products []models.Product
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&products))
+	soldOut := map[string]bool{}
+	for _, p := range products {
+		soldOut[p.ID] = p.SoldOut
+	}
+	assert.False(t, soldOut["1"])
+	assert.True(t, soldOut["2"])
+	assert.False(t, soldOut["3"], "untracked products are never sold out")
+
+	resp = do("POST", "/api/order", "apitest", models.OrderReq{
+		Items: []models.OrderItem{{ProductID: "1", Quantity: 3}, {ProductID: "2", Quantity: 1}, {ProductID: "3", Quantity: 5}},
+	})
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	var stockErr models.StockErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stockErr))
+	assert.Equal(t, []string{"1", "2"}, stockErr.ProductIDs)
+
+	resp = do("POST", "/api/order", "apitest", models.OrderReq{
+		Items: []models.OrderItem{{ProductID: "1", Quantity: 2}},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = do("GET", "/api/product/1", "", nil)
+	var product models.Product
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&product))
+	assert.Equal(t, 0, *product.Stock)
+	assert.True(t, product.SoldOut)
+}
+
+func TestIntegration_StockConcurrentOrders(t *testing.T) {
+	app, err := setup(testStoreDSN(t))
+	require.NoError(t, err)
+	defer app.db.Close()
+
+	ctx := context.Background()
+	const stock, buyers = 10, 50
+	require.NoError(t, app.db.SetProductStock(ctx, "1", intPtr(stock)))
+
+	var wg sync.WaitGroup
+	var placed, short atomic.Int32
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := app.svc.PlaceOrder(ctx, models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}})
+			switch {
+			case err == nil:
+				placed.Add(1)
+			case errors.Is(err, service.ErrInsufficientStock):
+				short.Add(1)
+			default:
+				t.Errorf("PlaceOrder() error = %v", err)
 			}
+		}()
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, stock, placed.Load())
+	assert.EqualValues(t, buyers-stock, short.Load())
+	product, err := app.db.GetProductByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, *product.Stock)
+}
+
+// aud returns an amount in cents of the store currency
+func aud(cents int64) money.Money {
+	return money.New(cents, money.DefaultCurrency)
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestIntegration_AdminCoupons(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "admintest")
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	do := func(method, path, apiKey string, body interface{}) *http.Response {
+		return doJSON(t, server, method, path, apiKey, body)
+	}
+	order := models.OrderReq{
+		Items:      []models.OrderItem{{ProductID: "1", Quantity: 2}},
+		CouponCode: "SPRING25",
+		CustomerID: "alice",
+	}
+
+	resp := do("POST", "/api/admin/coupon", "admintest", models.Coupon{
+		Code:           "SPRING25",
+		Rule:           &models.CouponRule{Type: models.CouponRulePercentage, Value: 25},
+		MaxPerCustomer: 1,
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = do("POST", "/api/admin/coupon", "admintest", models.Coupon{Code: "SPRING"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "code length must follow the coupon policy")
+
+	resp = do("POST", "/api/order", "apitest", order)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var placed models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&placed))
+	assert.Equal(t, aud(325), placed.Discounts)
+
+	resp = do("POST", "/api/order", "apitest", order)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, "per-customer limit")
+
+	anonymous := order
+	anonymous.CustomerID = ""
+	resp = do("POST", "/api/order", "apitest", anonymous)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, "per-customer limit without a customer")
+
+	resp = do("GET", "/api/admin/coupon", "admintest", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var coupons []models.Coupon
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&coupons))
+	redemptions := map[string]int{}
+	for _, c := range coupons {
+		redemptions[c.Code] = c.Redemptions
+	}
+	assert.Len(t, coupons, 9)
+	assert.Equal(t, 1, redemptions["SPRING25"])
+
+	resp = do("DELETE", "/api/admin/coupon/SPRING25", "admintest", nil)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	order.CustomerID = "bob"
+	resp = do("POST", "/api/order", "apitest", order)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, "deactivated coupon")
+
+	resp = do("DELETE", "/api/admin/coupon/SPRING25", "admintest", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestIntegration_APIKeyScopes(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "admintest")
+	app, err := setup(testStoreDSN(t))
+	require.NoError(t, err)
+	defer app.db.Close()
+	server := httptest.NewServer(app.router)
+	defer server.Close()
+
+	require.NoError(t, app.db.CreateAPIKey(context.Background(), &models.APIKey{
+		ID: "reader", Owner: "support", Scopes: []string{models.ScopeReadOrders}, CreatedAt: time.Now(),
+	}, service.HashAPIKey("readonly")))
+	require.NoError(t, app.db.CreateAPIKey(context.Background(), &models.APIKey{
+		ID: "retired", Owner: "old client", Scopes: []string{models.ScopeCreateOrder}, Disabled: true, CreatedAt: time.Now(),
+	}, service.HashAPIKey("retired")))
+
+	order := models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}}
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		apiKey         string
+		body           interface{}
+		expectedStatus int
+	}{
+		{"customer key places order", "POST", "/api/order", "apitest", order, http.StatusOK},
+		{"read-only key can't place order", "POST", "/api/order", "readonly", order, http.StatusForbidden},
+		{"read-only key reads orders", "GET", "/api/order/missing", "readonly", nil, http.StatusNotFound},
+		{"disabled key", "POST", "/api/order", "retired", order, http.StatusUnauthorized},
+		{"unknown key", "POST", "/api/order", "nope", order, http.StatusUnauthorized},
+		{"customer key can't administer", "GET", "/api/admin/coupon", "apitest", nil, http.StatusForbidden},
+		{"admin key from environment", "GET", "/api/admin/coupon", "admintest", nil, http.StatusOK},
+		{"admin key can't place order", "POST", "/api/order", "admintest", order, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doJSON(t, server, tt.method, tt.path, tt.apiKey, tt.body)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
 		})
 	}
 }
 
+func TestIntegration_OrderStatus(t *testing.T) {
+	app, err := setup(testStoreDSN(t))
+	require.NoError(t, err)
+	defer app.db.Close()
+	server := httptest.NewServer(app.router)
+	defer server.Close()
+
+	require.NoError(t, app.db.CreateAPIKey(context.Background(), &models.APIKey{
+		ID: "kitchen", Owner: "kitchen tablet", Scopes: []string{models.ScopeManageOrders}, CreatedAt: time.Now(),
+	}, service.HashAPIKey("stafftest")))
+
+	resp := doJSON(t, server, "POST", "/api/order", "apitest", models.OrderReq{
+		Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CustomerID: "customer-1",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var order models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+	assert.Equal(t, models.OrderPlaced, order.Status)
+
+	statusPath := "/api/order/" + order.ID + "/status"
+	for _, status := range []string{models.OrderAccepted, models.OrderPreparing, models.OrderReady} {
+		resp := doJSON(t, server, "PATCH", statusPath, "stafftest", models.OrderStatusReq{Status: status})
+		require.Equal(t, http.StatusOK, resp.StatusCode, status)
+	}
+
+	// Ready orders can only be completed
+	resp = doJSON(t, server, "PATCH", statusPath, "stafftest", models.OrderStatusReq{Status: models.OrderCancelled})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	// Customers can't move their own orders
+	resp = doJSON(t, server, "PATCH", statusPath, "apitest", models.OrderStatusReq{Status: models.OrderCompleted})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = doJSON(t, server, "PATCH", statusPath, "stafftest", models.OrderStatusReq{Status: models.OrderCompleted})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doJSON(t, server, "GET", "/api/order/"+order.ID, "apitest", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+	assert.Equal(t, models.OrderCompleted, order.Status)
+
+	var steps []string
+	for _, change := range order.History {
+		steps = append(steps, change.From+">"+change.To+" by "+change.Actor)
+	}
+	assert.Equal(t, []string{
+		">placed by customer-1",
+		"placed>accepted by kitchen",
+		"accepted>preparing by kitchen",
+		"preparing>ready by kitchen",
+		"ready>completed by kitchen",
+	}, steps)
+}
+
+// readSSEEvent reads the next event from an event stream, skipping comments
+func readSSEEvent(t *testing.T, r *bufio.Reader) (id string, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && id != "":
+			return id, data
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestIntegration_OrderEvents(t *testing.T) {
+	app, err := setup(testStoreDSN(t))
+	require.NoError(t, err)
+	defer app.db.Close()
+
+	// A stream has to outlive the server's WriteTimeout
+	server := httptest.NewUnstartedServer(app.router)
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	require.NoError(t, app.db.CreateAPIKey(context.Background(), &models.APIKey{
+		ID: "kitchen", Owner: "kitchen tablet", Scopes: []string{models.ScopeManageOrders}, CreatedAt: time.Now(),
+	}, service.HashAPIKey("stafftest")))
+
+	resp := doJSON(t, server, "POST", "/api/order", "apitest", models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var order models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+
+	openStream := func(lastEventID string) *http.Response {
+		req, err := http.NewRequest("GET", server.URL+"/api/order/"+order.ID+"/events", nil)
+		require.NoError(t, err)
+		req.Header.Set("api_key", "apitest")
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	setStatus := func(status string) {
+		resp := doJSON(t, server, "PATCH", "/api/order/"+order.ID+"/status", "stafftest", models.OrderStatusReq{Status: status})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	stream := openStream("")
+	require.Equal(t, http.StatusOK, stream.StatusCode)
+	assert.Equal(t, "text/event-stream", stream.Header.Get("Content-Type"))
+	events := bufio.NewReader(stream.Body)
+
+	id, data := readSSEEvent(t, events)
+	assert.Equal(t, "1", id)
+	assert.Contains(t, data, `"to":"placed"`)
+
+	time.Sleep(2 * server.Config.WriteTimeout)
+	setStatus(models.OrderAccepted)
+	id, data = readSSEEvent(t, events)
+	assert.Equal(t, "2", id)
+	assert.Contains(t, data, `"from":"placed","to":"accepted","actor":"kitchen"`)
+
+	// A client that missed event 2 gets it on reconnect
+	resumed := bufio.NewReader(openStream("1").Body)
+	id, _ = readSSEEvent(t, resumed)
+	assert.Equal(t, "2", id)
+
+	setStatus(models.OrderCancelled)
+	id, _ = readSSEEvent(t, events)
+	assert.Equal(t, "3", id)
+	// The stream ends with the order's final status
+	_, err = events.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+
+	id, _ = readSSEEvent(t, resumed)
+	assert.Equal(t, "3", id)
+
+	// Once everything has been seen there is nothing to stream
+	assert.Equal(t, http.StatusNoContent, openStream("3").StatusCode)
+}
+
+func TestIntegration_OrderEventsShutdown(t *testing.T) {
+	app, err := setup(testStoreDSN(t))
+	require.NoError(t, err)
+	defer app.db.Close()
+	server := httptest.NewServer(app.router)
+	defer server.Close()
+
+	resp := doJSON(t, server, "POST", "/api/order", "apitest", models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var order models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+
+	stream := doJSON(t, server, "GET", "/api/order/"+order.ID+"/events", "apitest", nil)
+	require.Equal(t, http.StatusOK, stream.StatusCode)
+	events := bufio.NewReader(stream.Body)
+	readSSEEvent(t, events)
+
+	// The server closes the service when it shuts down, which ends open streams
+	app.svc.Close()
+	_, err = io.ReadAll(events)
+	assert.NoError(t, err)
+}
+
+func TestIntegration_Webhooks(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "admintest")
+	app, err := setup(testStoreDSN(t))
+	require.NoError(t, err)
+	defer app.db.Close()
+	server := httptest.NewServer(app.router)
+	defer server.Close()
+
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan delivery, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{r.Header, body}
+	}))
+	defer receiver.Close()
+
+	resp := doJSON(t, server, "POST", "/api/admin/webhook", "admintest", models.Webhook{
+		URL: receiver.URL, Events: []string{models.EventOrderPlaced, models.EventCouponRedeemed},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var hook models.Webhook
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&hook))
+	require.NotEmpty(t, hook.Secret)
+
+	resp = doJSON(t, server, "POST", "/api/order", "apitest", models.OrderReq{
+		Items: []models.OrderItem{{ProductID: "1", Quantity: 2}}, CouponCode: "HAPPYHRS",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var order models.Order
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+
+	require.NoError(t, app.outbox.Dispatch(context.Background()))
+	require.NoError(t, app.webhooks.Send(context.Background()))
+	require.Len(t, received, 2)
+
+	var types []string
+	for i := 0; i < 2; i++ {
+		d := <-received
+		unix, err := strconv.ParseInt(d.header.Get(webhook.HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		assert.True(t, webhook.Verify(hook.Secret, time.Unix(unix, 0), d.body, d.header.Get(webhook.HeaderSignature)))
+
+		var event struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(d.body, &event))
+		types = append(types, event.Type)
+		assert.Contains(t, string(event.Data), order.ID)
+	}
+	assert.Equal(t, []string{models.EventOrderPlaced, models.EventCouponRedeemed}, types)
+
+	resp = doJSON(t, server, "GET", "/api/admin/webhook/"+hook.ID+"/deliveries", "admintest", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var deliveries []models.WebhookDelivery
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&deliveries))
+	require.Len(t, deliveries, 2)
+	for _, d := range deliveries {
+		assert.Equal(t, models.DeliveryDelivered, d.Status)
+		assert.Equal(t, 1, d.Attempts)
+	}
+}
+
+func TestIntegration_IdempotentOrders(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	placeOrder := func(key string, order models.OrderReq) *http.Response {
+		body, err := json.Marshal(order)
+		require.NoError(t, err)
+		req, err := http.NewRequest("POST", server.URL+"/api/order", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("api_key", "apitest")
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	decode := func(resp *http.Response) models.Order {
+		var order models.Order
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+		return order
+	}
+
+	order := models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 2}}}
+	first := placeOrder("retry-1", order)
+	require.Equal(t, http.StatusOK, first.StatusCode)
+	placed := decode(first)
+
+	retry := placeOrder("retry-1", order)
+	require.Equal(t, http.StatusOK, retry.StatusCode)
+	assert.Equal(t, "true", retry.Header.Get("Idempotent-Replayed"))
+	assert.Equal(t, placed.ID, decode(retry).ID)
+
+	changed := models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 3}}}
+	assert.Equal(t, http.StatusUnprocessableEntity, placeOrder("retry-1", changed).StatusCode)
+
+	// Another key places another order
+	other := placeOrder("retry-2", order)
+	require.Equal(t, http.StatusOK, other.StatusCode)
+	assert.NotEqual(t, placed.ID, decode(other).ID)
+}
+
+func TestIntegration_RateLimits(t *testing.T) {
+	t.Setenv("RATE_LIMIT_ORDERS", "2/1h")
+	t.Setenv("RATE_LIMIT_COUPON_FAILURES", "1/1h")
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	order := models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}}
+	resp := doJSON(t, server, "POST", "/api/order", "apitest", order)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", resp.Header.Get("RateLimit-Remaining"))
+
+	guess := models.OrderReq{Items: order.Items, CouponCode: "NOTACODE1"}
+	resp = doJSON(t, server, "POST", "/api/order", "apitest", guess)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp = doJSON(t, server, "POST", "/api/order", "apitest", order)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "1800", resp.Header.Get("Retry-After"))
+
+	// Product reads have their own, default, limit
+	resp = doJSON(t, server, "GET", "/api/product", "", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "300", resp.Header.Get("RateLimit-Limit"))
+}
+
+func TestIntegration_RateLimitedIdempotentOrder(t *testing.T) {
+	t.Setenv("RATE_LIMIT_COUPON_FAILURES", "1/1h")
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	placeOrder := func(key string, order models.OrderReq) *http.Response {
+		body, err := json.Marshal(order)
+		require.NoError(t, err)
+		req, err := http.NewRequest("POST", server.URL+"/api/order", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("api_key", "apitest")
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	items := []models.OrderItem{{ProductID: "1", Quantity: 1}}
+	guess := placeOrder("guess-1", models.OrderReq{Items: items, CouponCode: "NOTACODE1"})
+	require.Equal(t, http.StatusUnprocessableEntity, guess.StatusCode)
+
+	order := models.OrderReq{Items: items, CouponCode: "HAPPYHRS"}
+	limited := placeOrder("limited-1", order)
+	require.Equal(t, http.StatusTooManyRequests, limited.StatusCode)
+	assert.Equal(t, "3600", limited.Header.Get("Retry-After"))
+
+	// The 429 wasn't stored, so the retry is rate limited afresh rather than replayed
+	retry := placeOrder("limited-1", order)
+	require.Equal(t, http.StatusTooManyRequests, retry.StatusCode)
+	assert.Empty(t, retry.Header.Get("Idempotent-Replayed"))
+	assert.Equal(t, "3600", retry.Header.Get("Retry-After"))
+
+	// and the key is free for a request without the coupon
+	plain := placeOrder("limited-1", models.OrderReq{Items: items})
+	assert.Equal(t, http.StatusOK, plain.StatusCode)
+}
+
 func TestIntegration_OpenAPISpec(t *testing.T) {
 	server, cleanup := setupIntegrationTest(t)
 	defer cleanup()
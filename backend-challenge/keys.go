@@ -0,0 +1,228 @@
+package main
+
+import (
+	"backend-challenge/db"
+	"backend-challenge/models"
+	"backend-challenge/service"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const keysUsage = `usage: backend-challenge keys COMMAND [flags]
+
+Commands:
+  create -owner NAME -scopes SCOPE,... [-expires DURATION]
+  list
+  revoke ID
+  rotate [-overlap DURATION] [-expires DURATION] ID
+
+Every command accepts -db PATH.`
+
+// runKeys handles the keys subcommand, which manages the API keys in the
+// api_keys table. New keys are printed once and only their hash is stored.
+func runKeys(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", keysUsage)
+	}
+
+	fs := flag.NewFlagSet("keys "+args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db", "data/store.db", "SQLite database path, or a sqlite:// or postgres:// DSN")
+
+	var cmd keysCommand
+	switch args[0] {
+	case "create":
+		cmd = keysCreate(fs)
+	case "list":
+		cmd = keysList(fs)
+	case "revoke":
+		cmd = keysRevoke(fs)
+	case "rotate":
+		cmd = keysRotate(fs)
+	default:
+		return fmt.Errorf("%s", keysUsage)
+	}
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+
+	database, err := openMigrated(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	return cmd(ctx, database, out)
+}
+
+// keysCommand runs a keys command once its flags, registered on the FlagSet
+// it was built with, have been parsed
+type keysCommand func(ctx context.Context, database *db.DB, out io.Writer) error
+
+func keysCreate(fs *flag.FlagSet) keysCommand {
+	owner := fs.String("owner", "", "Who the key is issued to")
+	scopes := fs.String("scopes", "", "Comma-separated scopes: create_order, read_orders, manage_orders, admin")
+	expires := fs.Duration("expires", 0, "Lifetime of the key, e.g. 2160h (default never expires)")
+
+	return func(ctx context.Context, database *db.DB, out io.Writer) error {
+		if *owner == "" {
+			return fmt.Errorf("-owner is required")
+		}
+		scopeList, err := parseScopes(*scopes)
+		if err != nil {
+			return err
+		}
+
+		key, apiKey, err := newAPIKey(*owner, scopeList, *expires)
+		if err != nil {
+			return err
+		}
+		if err := database.CreateAPIKey(ctx, apiKey, service.HashAPIKey(key)); err != nil {
+			return err
+		}
+
+		printNewKey(out, key, apiKey)
+		return nil
+	}
+}
+
+func keysList(fs *flag.FlagSet) keysCommand {
+	return func(ctx context.Context, database *db.DB, out io.Writer) error {
+		keys, err := database.ListAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tOWNER\tSCOPES\tSTATUS\tEXPIRES\tLAST USED")
+		for _, key := range keys {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Owner, strings.Join(key.Scopes, ","),
+				keyStatus(key, now), formatTime(key.ExpiresAt), formatTime(key.LastUsedAt))
+		}
+		return tw.Flush()
+	}
+}
+
+func keysRevoke(fs *flag.FlagSet) keysCommand {
+	return func(ctx context.Context, database *db.DB, out io.Writer) error {
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: backend-challenge keys revoke ID")
+		}
+		if err := database.DisableAPIKey(ctx, fs.Arg(0)); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "Revoked key %s\n", fs.Arg(0))
+		return nil
+	}
+}
+
+func keysRotate(fs *flag.FlagSet) keysCommand {
+	overlap := fs.Duration("overlap", 24*time.Hour, "How long the old key keeps working")
+	expires := fs.Duration("expires", 0, "Lifetime of the new key (default never expires)")
+
+	return func(ctx context.Context, database *db.DB, out io.Writer) error {
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: backend-challenge keys rotate [-overlap DURATION] [-expires DURATION] ID")
+		}
+		if *overlap < 0 {
+			return fmt.Errorf("-overlap must not be negative")
+		}
+
+		old, err := database.GetAPIKey(ctx, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			return db.ErrAPIKeyNotFound
+		}
+
+		key, apiKey, err := newAPIKey(old.Owner, old.Scopes, *expires)
+		if err != nil {
+			return err
+		}
+		oldExpiresAt := apiKey.CreatedAt.Add(*overlap)
+		if err := database.RotateAPIKey(ctx, old.ID, apiKey, service.HashAPIKey(key), oldExpiresAt); err != nil {
+			return err
+		}
+
+		printNewKey(out, key, apiKey)
+		fmt.Fprintf(out, "Key %s keeps working until %s\n", old.ID, oldExpiresAt.Format(time.RFC3339))
+		return nil
+	}
+}
+
+// newAPIKey generates a key and the record stored for it
+func newAPIKey(owner string, scopes []string, lifetime time.Duration) (string, *models.APIKey, error) {
+	if lifetime < 0 {
+		return "", nil, fmt.Errorf("-expires must not be negative")
+	}
+
+	key, err := service.GenerateAPIKey()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	apiKey := &models.APIKey{
+		ID:        uuid.New().String(),
+		Owner:     owner,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if lifetime > 0 {
+		expiresAt := apiKey.CreatedAt.Add(lifetime)
+		apiKey.ExpiresAt = &expiresAt
+	}
+	return key, apiKey, nil
+}
+
+func parseScopes(s string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if !models.ValidScope(scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("-scopes is required")
+	}
+	return scopes, nil
+}
+
+func printNewKey(out io.Writer, key string, apiKey *models.APIKey) {
+	fmt.Fprintf(out, "Created key %s for %s with scopes %s\n", apiKey.ID, apiKey.Owner, strings.Join(apiKey.Scopes, ","))
+	fmt.Fprintf(out, "API key: %s\n", key)
+	fmt.Fprintln(out, "Store it now, it can't be shown again.")
+}
+
+func keyStatus(key models.APIKey, now time.Time) string {
+	switch {
+	case key.Disabled:
+		return "revoked"
+	case !key.Active(now):
+		return "expired"
+	case key.ReplacedBy != "":
+		return "rotating"
+	}
+	return "active"
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"backend-challenge/db"
+	"backend-challenge/models"
+	"backend-challenge/service"
+	"bytes"
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var printedKey = regexp.MustCompile(`Created key (\S+) .*\nAPI key: (\S+)`)
+
+// runKeysOK runs a keys command against dbPath and returns its output
+func runKeysOK(t *testing.T, dbPath string, args ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	args = append([]string{args[0], "-db", dbPath}, args[1:]...)
+	require.NoError(t, runKeys(context.Background(), args, &out))
+	return out.String()
+}
+
+// authenticate checks a key against the database the way the server does
+func authenticate(t *testing.T, dbPath, key string) (*models.APIKey, error) {
+	t.Helper()
+	database, err := db.Open(dbPath)
+	require.NoError(t, err)
+	defer database.Close()
+	return service.New(database).Authenticate(context.Background(), key)
+}
+
+func TestRunKeys_Lifecycle(t *testing.T) {
+	dbPath := copyTestDB(t)
+
+	out := runKeysOK(t, dbPath, "create", "-owner", "mobile app", "-scopes", "create_order,read_orders", "-expires", "720h")
+	m := printedKey.FindStringSubmatch(out)
+	require.NotNil(t, m, out)
+	oldID, oldKey := m[1], m[2]
+
+	apiKey, err := authenticate(t, dbPath, oldKey)
+	require.NoError(t, err)
+	assert.Equal(t, "mobile app", apiKey.Owner)
+	assert.Equal(t, []string{models.ScopeCreateOrder, models.ScopeReadOrders}, apiKey.Scopes)
+
+	out = runKeysOK(t, dbPath, "rotate", "-overlap", "1h", oldID)
+	m = printedKey.FindStringSubmatch(out)
+	require.NotNil(t, m, out)
+	newID, newKey := m[1], m[2]
+
+	// Both keys work during the overlap
+	_, err = authenticate(t, dbPath, oldKey)
+	assert.NoError(t, err)
+	apiKey, err = authenticate(t, dbPath, newKey)
+	require.NoError(t, err)
+	assert.Equal(t, "mobile app", apiKey.Owner)
+	assert.Nil(t, apiKey.ExpiresAt)
+
+	out = runKeysOK(t, dbPath, "list")
+	assert.Regexp(t, regexp.MustCompile(oldID+`\s+mobile app\s+create_order,read_orders\s+rotating\s+\S+\s+\d{4}-`), out)
+	assert.Regexp(t, regexp.MustCompile(newID+`\s+mobile app\s+create_order,read_orders\s+active\s+-\s+\d{4}-`), out)
+	assert.Regexp(t, regexp.MustCompile(`demo\s+demo\s+create_order,read_orders\s+active\s+-\s+-`), out)
+
+	database, err := db.Open(dbPath)
+	require.NoError(t, err)
+	old, err := database.GetAPIKey(context.Background(), oldID)
+	require.NoError(t, err)
+	database.Close()
+	assert.Equal(t, newID, old.ReplacedBy)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *old.ExpiresAt, time.Minute)
+
+	runKeysOK(t, dbPath, "revoke", oldID)
+	_, err = authenticate(t, dbPath, oldKey)
+	assert.ErrorIs(t, err, service.ErrInvalidAPIKey)
+	_, err = authenticate(t, dbPath, newKey)
+	assert.NoError(t, err)
+}
+
+func TestRunKeys_RotateWithoutOverlap(t *testing.T) {
+	dbPath := copyTestDB(t)
+
+	out := runKeysOK(t, dbPath, "rotate", "-overlap", "0s", "demo")
+	m := printedKey.FindStringSubmatch(out)
+	require.NotNil(t, m, out)
+
+	_, err := authenticate(t, dbPath, "apitest")
+	assert.ErrorIs(t, err, service.ErrInvalidAPIKey)
+	_, err = authenticate(t, dbPath, m[2])
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(runKeysOK(t, dbPath, "list"), "expired"))
+}
+
+func TestRunKeys_NewDatabase(t *testing.T) {
+	// A database with no tables yet is migrated before use
+	dbPath := filepath.Join(t.TempDir(), "new.db")
+	ctx := context.Background()
+
+	out := runKeysOK(t, dbPath, "create", "-owner", "ops", "-scopes", "admin")
+	m := printedKey.FindStringSubmatch(out)
+	require.NotNil(t, m, out)
+
+	// Flags may also follow the ID
+	var revoked bytes.Buffer
+	require.NoError(t, runKeys(ctx, []string{"revoke", m[1], "-db", dbPath}, &revoked))
+	assert.Contains(t, revoked.String(), "Revoked key "+m[1])
+	_, err := authenticate(t, dbPath, m[2])
+	assert.ErrorIs(t, err, service.ErrInvalidAPIKey)
+}
+
+func TestRunKeys_Errors(t *testing.T) {
+	dbPath := copyTestDB(t)
+	ctx := context.Background()
+	var out bytes.Buffer
+
+	tests := [][]string{
+		nil,
+		{"delete"},
+		{"create", "-db", dbPath, "-scopes", "admin"},
+		{"create", "-db", dbPath, "-owner", "ops"},
+		{"create", "-db", dbPath, "-owner", "ops", "-scopes", "superuser"},
+		{"create", "-db", dbPath, "-owner", "ops", "-scopes", "admin", "-expires", "-1h"},
+		{"revoke", "-db", dbPath},
+		{"revoke", "-db", dbPath, "missing"},
+		{"rotate", "-db", dbPath, "missing"},
+		{"rotate", "-db", dbPath, "-overlap", "-1h", "demo"},
+	}
+	for _, args := range tests {
+		assert.Error(t, runKeys(ctx, args, &out), "%v", args)
+	}
+
+	runKeysOK(t, dbPath, "revoke", "demo")
+	assert.ErrorIs(t, runKeys(ctx, []string{"rotate", "-db", dbPath, "demo"}, &out), db.ErrAPIKeyNotFound)
+}
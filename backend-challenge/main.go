@@ -2,48 +2,85 @@ package main
 
 import (
 	"backend-challenge/api"
+	"backend-challenge/coupon"
 	"backend-challenge/db"
+	"backend-challenge/models"
+	"backend-challenge/money"
+	"backend-challenge/outbox"
+	"backend-challenge/ratelimit"
 	"backend-challenge/service"
+	"backend-challenge/tax"
+	"backend-challenge/webhook"
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
 func main() {
-	port := flag.String("port", "8080", "Port to listen on")
-	dbPath := flag.String("db", "data/store.db", "Path to SQLite database")
-	flag.Parse()
-
 	// Setup signal-based context
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	// Subcommands are dispatched before the server flags are parsed
+	if len(os.Args) > 1 {
+		var run func(context.Context, []string, io.Writer) error
+		switch os.Args[1] {
+		case "coupons":
+			run = runCoupons
+		case "keys":
+			run = runKeys
+		case "migrate":
+			run = runMigrate
+		case "outbox":
+			run = runOutbox
+		}
+		if run != nil {
+			if err := run(ctx, os.Args[2:], os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	port := flag.String("port", "8080", "Port to listen on")
+	dbPath := flag.String("db", "data/store.db", "SQLite database path, a sqlite:// or postgres:// DSN, or memory://")
+	flag.Parse()
+
 	if err := run(ctx, *port, *dbPath); err != nil {
 		log.Fatal(err)
 	}
 }
 
 func run(ctx context.Context, port, dbPath string) error {
-	database, router, err := setup(dbPath)
+	app, err := setup(dbPath)
 	if err != nil {
 		return fmt.Errorf("failed to setup application: %w", err)
 	}
-	defer database.Close()
+	defer app.db.Close()
+
+	// The background workers are stopped before the database is closed
+	stopWorkers := startWorkers(app.outbox.Run, app.webhooks.Run)
+	defer stopWorkers()
 
 	addr := ":" + port
 	server := &http.Server{
 		Addr:         addr,
-		Handler:      router,
+		Handler:      app.router,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	// Event streams never go idle, so Shutdown would wait for them until it times out
+	server.RegisterOnShutdown(app.svc.Close)
 
 	// Start server in a goroutine
 	serverErr := make(chan error, 1)
@@ -77,16 +114,223 @@ func run(ctx context.Context, port, dbPath string) error {
 	return nil
 }
 
-// setupApplication initializes database, service, and router
-func setup(dbPath string) (*db.DB, http.Handler, error) {
-	database, err := db.New(dbPath)
+// startWorkers runs each worker in its own goroutine. The returned function
+// cancels them and waits for them to return.
+func startWorkers(workers ...func(context.Context)) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker(ctx)
+		}()
+	}
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// store is what the server needs of its database: the service's queries, the
+// queues the background workers drain, and the key creation tests use. Both
+// *db.DB and *db.Memory provide it.
+type store interface {
+	db.Database
+	outbox.Store
+	webhook.DeliveryQueue
+	webhook.Store
+	CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error
+	SetCouponPolicy(policy coupon.Policy)
+}
+
+// app holds the parts of the application that setup wires together
+type app struct {
+	db       store
+	svc      *service.Service
+	router   http.Handler
+	outbox   *outbox.Dispatcher
+	webhooks *webhook.Sender
+}
+
+// setup initializes database, service, router and background workers
+func setup(dbPath string) (*app, error) {
+	policy, err := coupon.PolicyFromEnv()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to initialize database: %w", err)
+		return nil, fmt.Errorf("failed to load coupon policy: %w", err)
 	}
 
+	limits, err := ratelimit.PoliciesFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rate limits: %w", err)
+	}
+
+	idempotencyTTL := service.DefaultIdempotencyTTL
+	if ttl := os.Getenv("IDEMPOTENCY_TTL"); ttl != "" {
+		idempotencyTTL, err = time.ParseDuration(ttl)
+		if err != nil || idempotencyTTL <= 0 {
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_TTL %q: must be a positive duration", ttl)
+		}
+	}
+
+	rates, err := ratesFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	taxes, err := taxesFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	database, err := openStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	database.SetCouponPolicy(policy)
+
 	svc := service.New(database)
+	addEnvAPIKeys(svc)
+	svc.SetIdempotencyTTL(idempotencyTTL)
+	svc.SetExchangeRates(rates)
+	svc.SetTaxConfig(taxes)
 	handler := api.NewHandler(svc)
+	handler.SetRateLimiter(ratelimit.NewMemory(), limits)
 	router := handler.SetupRoutes()
 
-	return database, router, nil
+	return &app{
+		db:       database,
+		svc:      svc,
+		router:   router,
+		outbox:   outbox.NewDispatcher(database, webhook.NewPublisher(database)),
+		webhooks: webhook.NewSender(database),
+	}, nil
+}
+
+// memoryScheme selects the in-memory database. It is seeded from the file
+// named after the scheme, or data/seed.sql.
+const memoryScheme = "memory://"
+
+// defaultSeedFile seeds memory:// databases that don't name a seed file
+const defaultSeedFile = "data/seed.sql"
+
+// parseFlags parses a subcommand's args, accepting flags after its positional
+// arguments too, so "migrate up 3 -db PATH" sets -db. Flags end at "--".
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 || (len(rest) < len(args) && args[len(args)-len(rest)-1] == "--") {
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	return fs.Parse(append([]string{"--"}, positional...))
+}
+
+// openStore opens the database named by dsn, bringing a SQL one up to date
+func openStore(dsn string) (store, error) {
+	if seedPath, ok := strings.CutPrefix(dsn, memoryScheme); ok {
+		if seedPath == "" {
+			seedPath = defaultSeedFile
+		}
+		seed, err := os.ReadFile(seedPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read seed data: %w", err)
+		}
+		memory := db.NewMemory()
+		if err := memory.Seed(string(seed)); err != nil {
+			return nil, fmt.Errorf("failed to seed database: %w", err)
+		}
+		return memory, nil
+	}
+
+	database, err := openMigrated(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+// openMigrated opens the SQL database named by dsn and applies any pending
+// migrations, for the server and the subcommands that use the data
+func openMigrated(dsn string) (*db.DB, error) {
+	database, err := db.Open(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	// Pending migrations are applied on open so a new binary never runs
+	// against the schema of an older one, and a new database gets its tables
+	applied, err := database.Migrate(context.Background(), db.LatestSchemaVersion())
+	for _, m := range applied {
+		log.Printf("Applied migration %d %s", m.Version, m.Name)
+	}
+	if err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return database, nil
+}
+
+// defaultRatesFile is the exchange rate table loaded when EXCHANGE_RATES_FILE is unset
+const defaultRatesFile = "data/rates.csv"
+
+// ratesFromEnv loads the exchange rate table named by EXCHANGE_RATES_FILE.
+// Setting it empty turns conversion off, so products can only be priced in
+// the currencies they have prices set in.
+func ratesFromEnv() (*money.Rates, error) {
+	path, ok := os.LookupEnv("EXCHANGE_RATES_FILE")
+	if !ok {
+		path = defaultRatesFile
+	}
+	if path == "" {
+		return nil, nil
+	}
+	rates, err := money.LoadRates(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exchange rates: %w", err)
+	}
+	return rates, nil
+}
+
+// defaultTaxFile is the tax config loaded when TAX_CONFIG_FILE is unset
+const defaultTaxFile = "data/tax.json"
+
+// taxesFromEnv loads the stores' tax config named by TAX_CONFIG_FILE. Setting
+// it empty turns tax off, so orders carry none.
+func taxesFromEnv() (*tax.Config, error) {
+	path, ok := os.LookupEnv("TAX_CONFIG_FILE")
+	if !ok {
+		path = defaultTaxFile
+	}
+	if path == "" {
+		return nil, nil
+	}
+	taxes, err := tax.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tax config: %w", err)
+	}
+	return taxes, nil
+}
+
+// addEnvAPIKeys accepts the keys set in API_KEY and ADMIN_API_KEY in addition to
+// the stored ones. They are not persisted, so unsetting a variable revokes its key.
+func addEnvAPIKeys(svc *service.Service) {
+	envKeys := []struct {
+		name   string
+		scopes []string
+	}{
+		{"API_KEY", []string{models.ScopeCreateOrder, models.ScopeReadOrders}},
+		{"ADMIN_API_KEY", []string{models.ScopeAdmin}},
+	}
+	for _, envKey := range envKeys {
+		if key := os.Getenv(envKey.name); key != "" {
+			svc.AddStaticAPIKey(key, models.APIKey{ID: envKey.name, Owner: envKey.name, Scopes: envKey.scopes})
+		}
+	}
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"backend-challenge/db"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const migrateUsage = `usage: backend-challenge migrate COMMAND [flags]
+
+Commands:
+  status
+  up [VERSION]    apply migrations up to VERSION, the latest by default
+  down [VERSION]  revert migrations down to VERSION, the previous one by default
+
+Every command accepts -db PATH.`
+
+// runMigrate handles the migrate subcommand, which moves the database schema
+// between the versions of the migrations built into the binary
+func runMigrate(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+
+	fs := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db", "data/store.db", "SQLite database path, or a sqlite:// or postgres:// DSN")
+
+	switch args[0] {
+	case "status", "up", "down":
+	default:
+		return fmt.Errorf("%s", migrateUsage)
+	}
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 || (args[0] == "status" && fs.NArg() > 0) {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+
+	database, err := db.Open(*dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer database.Close()
+
+	current, err := database.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "status" {
+		for _, m := range database.Migrations() {
+			state := "pending"
+			if m.Version <= current {
+				state = "applied"
+			}
+			fmt.Fprintf(out, "%4d  %-8s %s\n", m.Version, state, m.Name)
+		}
+		fmt.Fprintf(out, "Schema is at version %d of %d\n", current, db.LatestSchemaVersion())
+		return nil
+	}
+
+	target := db.LatestSchemaVersion()
+	if args[0] == "down" {
+		target = max(current-1, 0)
+	}
+	if fs.NArg() == 1 {
+		if target, err = strconv.Atoi(fs.Arg(0)); err != nil {
+			return fmt.Errorf("invalid schema version %q", fs.Arg(0))
+		}
+		if (args[0] == "up" && target < current) || (args[0] == "down" && target > current) {
+			return fmt.Errorf("schema is at version %d; migrate %s can't move it to %d", current, args[0], target)
+		}
+	}
+
+	ran, err := database.Migrate(ctx, target)
+	for _, m := range ran {
+		verb := "Applied"
+		if args[0] == "down" {
+			verb = "Reverted"
+		}
+		fmt.Fprintf(out, "%s %d %s\n", verb, m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Schema is at version %d\n", target)
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"backend-challenge/db"
+	"backend-challenge/db/pgtest"
+	"bytes"
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMigrate(t *testing.T) {
+	dbPath := copyTestDB(t)
+	ctx := context.Background()
+	latest := db.LatestSchemaVersion()
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		args = append([]string{args[0], "-db", dbPath}, args[1:]...)
+		err := runMigrate(ctx, args, &out)
+		return out.String(), err
+	}
+
+	out, err := run("status")
+	require.NoError(t, err)
+	assert.Contains(t, out, "applied  coupon_minor_units")
+	assert.Contains(t, out, "Schema is at version "+strconv.Itoa(latest)+" of "+strconv.Itoa(latest))
+
+	// down reverts one step by default
+	out, err = run("down")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Reverted 7 coupon_minor_units")
+	out, err = run("status")
+	require.NoError(t, err)
+	assert.Contains(t, out, "pending  coupon_minor_units")
+
+	// Flags may follow the version
+	var down bytes.Buffer
+	err = runMigrate(ctx, []string{"down", "2", "-db", dbPath}, &down)
+	out = down.String()
+	require.NoError(t, err)
+	assert.Contains(t, out, "Reverted 3 product_prices")
+	assert.Contains(t, out, "Schema is at version 2")
+
+	out, err = run("up")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Applied 3 product_prices\nApplied 4 tax\n")
+
+	// Each command only moves the schema its own way
+	_, err = run("up", "1")
+	assert.Error(t, err)
+	_, err = run("down", strconv.Itoa(latest+1))
+	assert.Error(t, err)
+	_, err = run("up", "abc")
+	assert.Error(t, err)
+	err = runMigrate(ctx, []string{"sideways"}, &bytes.Buffer{})
+	assert.Error(t, err)
+
+	// The server refuses to run on a schema a newer binary migrated
+	database, err := db.Open(dbPath)
+	require.NoError(t, err)
+	_, err = database.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'future', CURRENT_TIMESTAMP)`, latest+1)
+	require.NoError(t, err)
+	database.Close()
+	_, err = setup(dbPath)
+	assert.ErrorIs(t, err, db.ErrSchemaTooNew)
+}
+
+func TestSetup_MigratesEmptyDatabase(t *testing.T) {
+	dbPath := pgtest.DSN(t)
+	if dbPath == "" {
+		dbPath = filepath.Join(t.TempDir(), "empty.db")
+	}
+	app, err := setup(dbPath)
+	require.NoError(t, err)
+	defer app.db.Close()
+
+	version, err := app.db.(*db.DB).SchemaVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, db.LatestSchemaVersion(), version)
+}
@@ -1,11 +1,193 @@
 package models
 
+import (
+	"backend-challenge/money"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
 type Product struct {
 	ID       string        `json:"id"`
 	Image    *ProductImage `json:"image,omitempty"`
 	Name     string        `json:"name"`
 	Category string        `json:"category"`
-	Price    float64       `json:"price"`
+	// Price is written to JSON as a number, with its currency in a sibling
+	// currency field; see MarshalJSON
+	Price money.Money `json:"price"`
+	// Prices holds the product's prices in other currencies, by currency
+	// code. Currencies without one are converted from Price.
+	Prices map[string]money.Money `json:"prices,omitempty"`
+	// TaxCategory picks the product's tax rate in each store; empty means standard
+	TaxCategory string `json:"taxCategory,omitempty"`
+	// Stock is the number of units left to sell; nil means stock is not tracked
+	Stock *int `json:"stock,omitempty"`
+	// SoldOut is set when stock is tracked and none is left
+	SoldOut bool `json:"soldOut"`
+}
+
+// productJSON is Product without its methods, so they don't recurse
+type productJSON Product
+
+// MarshalJSON adds the price's currency to the product
+func (p Product) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		productJSON
+		Currency string `json:"currency"`
+	}{productJSON(p), p.Price.Currency})
+}
+
+// UnmarshalJSON reads a product, pricing it in the store currency unless
+// another is given
+func (p *Product) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		*productJSON
+		Currency string `json:"currency"`
+	}{productJSON: (*productJSON)(p)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	p.Price.Currency = aux.Currency
+	if p.Price.Currency == "" {
+		p.Price.Currency = money.DefaultCurrency
+	}
+	setPriceCurrencies(p.Prices)
+	return nil
+}
+
+// PriceIn returns the product's price in currency if it has one set
+func (p Product) PriceIn(currency string) (money.Money, bool) {
+	if p.Price.Currency == currency {
+		return p.Price, true
+	}
+	price, ok := p.Prices[currency]
+	return price, ok
+}
+
+// OutOfStock reports whether the product's stock is tracked and used up
+func (p Product) OutOfStock() bool {
+	return p.Stock != nil && *p.Stock <= 0
+}
+
+// Validate checks that the product has everything needed to list and order it
+func (p Product) Validate() error {
+	switch {
+	case strings.TrimSpace(p.ID) == "":
+		return errors.New("id is required")
+	case strings.Contains(p.ID, "/"):
+		return errors.New("id must not contain '/'")
+	case strings.TrimSpace(p.Name) == "":
+		return errors.New("name is required")
+	case strings.TrimSpace(p.Category) == "":
+		return errors.New("category is required")
+	case p.Price.Amount <= 0:
+		return errors.New("price must be positive")
+	case !money.ValidCurrency(p.Price.Currency):
+		return fmt.Errorf("currency %q is not supported", p.Price.Currency)
+	case p.Stock != nil && *p.Stock < 0:
+		return errors.New("stock must not be negative")
+	}
+	for currency, price := range p.Prices {
+		switch {
+		case !money.ValidCurrency(currency):
+			return fmt.Errorf("currency %q is not supported", currency)
+		case currency == p.Price.Currency:
+			return fmt.Errorf("prices must not repeat the %s price", currency)
+		case price.Amount <= 0:
+			return fmt.Errorf("%s price must be positive", currency)
+		}
+	}
+	return nil
+}
+
+// setPriceCurrencies puts each price in the currency it is keyed by, as JSON
+// only carries the amounts
+func setPriceCurrencies(prices map[string]money.Money) {
+	for currency, price := range prices {
+		price.Currency = currency
+		prices[currency] = price
+	}
+}
+
+// ProductPatch holds the product fields to change; nil fields are left as they are
+type ProductPatch struct {
+	Image    *ProductImage `json:"image,omitempty"`
+	Name     *string       `json:"name,omitempty"`
+	Category *string       `json:"category,omitempty"`
+	Price    *money.Money  `json:"price,omitempty"`
+	// Prices replaces all the prices in other currencies; an empty object removes them
+	Prices      map[string]money.Money `json:"prices,omitempty"`
+	TaxCategory *string                `json:"taxCategory,omitempty"`
+}
+
+// Apply copies the set fields onto p
+func (pp ProductPatch) Apply(p *Product) {
+	if pp.Image != nil {
+		p.Image = pp.Image
+	}
+	if pp.Name != nil {
+		p.Name = *pp.Name
+	}
+	if pp.Category != nil {
+		p.Category = *pp.Category
+	}
+	if pp.Price != nil {
+		// The price stays in the product's currency
+		p.Price.Amount = pp.Price.Amount
+	}
+	if pp.Prices != nil {
+		p.Prices = pp.Prices
+		setPriceCurrencies(p.Prices)
+	}
+	if pp.TaxCategory != nil {
+		p.TaxCategory = *pp.TaxCategory
+	}
+}
+
+// ProductFilter narrows and orders a product listing. The zero filter lists
+// every product in the order they were added.
+type ProductFilter struct {
+	// Category matches the product category exactly
+	Category string
+	// Query matches names containing it, ignoring case
+	Query string
+	// MinPrice and MaxPrice bound the product's price in the store currency,
+	// inclusive; nil means unbounded. Products without a price set in the
+	// store currency don't match either bound.
+	MinPrice *money.Money
+	MaxPrice *money.Money
+	// Sort orders by each field in turn, then by ID
+	Sort []ProductSort
+}
+
+// Product sort fields. Prices are compared in the store currency, with
+// products that have no price set in it last.
+const (
+	SortByName     = "name"
+	SortByCategory = "category"
+	SortByPrice    = "price"
+)
+
+// ProductSort orders products by one field
+type ProductSort struct {
+	Field      string
+	Descending bool
+}
+
+// ValidProductSortField reports whether products can be sorted by field
+func ValidProductSortField(field string) bool {
+	switch field {
+	case SortByName, SortByCategory, SortByPrice:
+		return true
+	}
+	return false
+}
+
+// StockReq sets a product's stock; a nil stock stops tracking it
+type StockReq struct {
+	Stock *int `json:"stock"`
 }
 
 type ProductImage struct {
@@ -23,13 +205,316 @@ type OrderItem struct {
 type OrderReq struct {
 	Items      []OrderItem `json:"items"`
 	CouponCode string      `json:"couponCode,omitempty"`
+	CustomerID string      `json:"customerId,omitempty"`
+	// Currency is the currency to price the order in, taken from the request's
+	// currency parameter or Accept-Currency header; empty means the store currency
+	Currency string `json:"-"`
+}
+
+// OrderLine is a priced order item
+type OrderLine struct {
+	ProductID string      `json:"productId"`
+	Quantity  int         `json:"quantity"`
+	UnitPrice money.Money `json:"unitPrice"`
+	Amount    money.Money `json:"amount"`
+	// TaxCategory is the product's tax category when the order was placed
+	TaxCategory string `json:"taxCategory,omitempty"`
+	// Tax is the tax on the line after its share of the discounts
+	Tax money.Money `json:"tax"`
 }
 
 type Order struct {
 	Items      []OrderItem `json:"items"`
 	CouponCode string      `json:"couponCode,omitempty"`
+	CustomerID string      `json:"customerId,omitempty"`
 	ID         string      `json:"id"`
 	Products   []Product   `json:"products"`
+	Lines      []OrderLine `json:"lines"`
+	// The amounts are in the order's currency, written to JSON as a sibling
+	// currency field; see MarshalJSON
+	Subtotal  money.Money `json:"subtotal"`
+	Discounts money.Money `json:"discounts"`
+	// Tax is the sum of the lines' tax. It is part of the total when
+	// TaxInclusive is set and added to it otherwise.
+	Tax          money.Money `json:"tax"`
+	TaxInclusive bool        `json:"taxInclusive"`
+	Total        money.Money `json:"total"`
+	Status       string      `json:"status"`
+	// History lists the order's status changes, oldest first
+	History   []OrderStatusChange `json:"history,omitempty"`
+	CreatedAt time.Time           `json:"createdAt"`
+}
+
+// orderJSON is Order without its methods, so they don't recurse
+type orderJSON Order
+
+// MarshalJSON adds the order's currency to the order
+func (o Order) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		orderJSON
+		Currency string `json:"currency"`
+	}{orderJSON(o), o.Total.Currency})
+}
+
+// UnmarshalJSON reads an order, putting its amounts in its currency
+func (o *Order) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		*orderJSON
+		Currency string `json:"currency"`
+	}{orderJSON: (*orderJSON)(o)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	o.SetCurrency(aux.Currency)
+	return nil
+}
+
+// SetCurrency puts the order's amounts in currency
+func (o *Order) SetCurrency(currency string) {
+	o.Subtotal.Currency = currency
+	o.Discounts.Currency = currency
+	o.Tax.Currency = currency
+	o.Total.Currency = currency
+	for i := range o.Lines {
+		o.Lines[i].UnitPrice.Currency = currency
+		o.Lines[i].Amount.Currency = currency
+		o.Lines[i].Tax.Currency = currency
+	}
+}
+
+// Order statuses
+const (
+	OrderPlaced    = "placed"
+	OrderAccepted  = "accepted"
+	OrderPreparing = "preparing"
+	OrderReady     = "ready"
+	OrderCompleted = "completed"
+	OrderCancelled = "cancelled"
+)
+
+// OrderStatusChange records an order moving to a new status
+type OrderStatusChange struct {
+	// From is empty for the change that placed the order
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	// Actor is the API key that made the change, or the customer for the placed entry
+	Actor  string    `json:"actor,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// OrderEvent is an order status change as streamed to clients. ID is the
+// change's position in the order's history, starting at 1.
+type OrderEvent struct {
+	ID      int    `json:"id"`
+	OrderID string `json:"orderId"`
+	OrderStatusChange
+}
+
+// CouponRedemption records an order redeeming a coupon
+type CouponRedemption struct {
+	Code       string    `json:"code"`
+	OrderID    string    `json:"orderId"`
+	CustomerID string    `json:"customerId,omitempty"`
+	RedeemedAt time.Time `json:"redeemedAt"`
+}
+
+// OrderStatusReq asks for an order to move to a new status
+type OrderStatusReq struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Coupon rule types
+const (
+	CouponRulePercentage   = "percentage"
+	CouponRuleFixedAmount  = "fixed_amount"
+	CouponRuleCheapestFree = "cheapest_free"
+	CouponRuleFreeItem     = "free_item"
+)
+
+// CouponRule describes the discount granted by a coupon code. Amounts are
+// integer minor units (cents) of the store currency.
+type CouponRule struct {
+	Code string `json:"code"`
+	Type string `json:"type"`
+	// Value is the percentage off, for percentage rules
+	Value float64 `json:"value,omitempty"`
+	// Amount is the amount off, for fixed_amount rules
+	Amount      int64  `json:"amount,omitempty"`
+	ProductID   string `json:"productId,omitempty"`
+	MinSubtotal int64  `json:"minSubtotal,omitempty"`
+}
+
+// Coupon is a valid coupon code with its discount rule and redemption limits
+type Coupon struct {
+	Code string      `json:"code"`
+	Rule *CouponRule `json:"rule,omitempty"`
+	// StartsAt and EndsAt bound when the coupon can be redeemed; nil means unbounded
+	StartsAt *time.Time `json:"startsAt,omitempty"`
+	EndsAt   *time.Time `json:"endsAt,omitempty"`
+	// MaxRedemptions and MaxPerCustomer cap redemptions overall and per customer; 0 means unlimited
+	MaxRedemptions int `json:"maxRedemptions,omitempty"`
+	MaxPerCustomer int `json:"maxPerCustomer,omitempty"`
+	// Redemptions is the number of times the coupon has been redeemed
+	Redemptions int `json:"redemptions"`
+	// DeactivatedAt is set once the coupon has been withdrawn
+	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty"`
+}
+
+// API key scopes
+const (
+	ScopeCreateOrder  = "create_order"
+	ScopeReadOrders   = "read_orders"
+	ScopeManageOrders = "manage_orders"
+	ScopeAdmin        = "admin"
+)
+
+// ValidScope reports whether scope is one of the API key scopes
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeCreateOrder, ScopeReadOrders, ScopeManageOrders, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// APIKey is a stored API key. The key itself is only kept as a hash.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Scopes    []string  `json:"scopes"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is when the key stops working; nil means never
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// LastUsedAt is when the key last authenticated a request, to the nearest minute
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	// ReplacedBy is the ID of the key this one was rotated to
+	ReplacedBy string `json:"replacedBy,omitempty"`
+}
+
+// Active reports whether the key can authenticate requests at now
+func (k APIKey) Active(now time.Time) bool {
+	return !k.Disabled && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// HasScope reports whether the key grants scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IdempotentRequest is a request made with an Idempotency-Key header and,
+// once it has been handled, the response replayed to retries
+type IdempotentRequest struct {
+	// APIKeyID is the key the request was made with; each key has its own idempotency keys
+	APIKeyID string
+	Key      string
+	// Fingerprint is a hash of the request, to catch a key reused for a different one
+	Fingerprint string
+	// StatusCode is zero while the request is still being handled
+	StatusCode  int
+	ContentType string
+	// Headers holds the other response headers the handler set, to replay with the body
+	Headers   map[string]string
+	Body      []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Completed reports whether the response has been stored
+func (r IdempotentRequest) Completed() bool {
+	return r.StatusCode != 0
+}
+
+// Event types written to the outbox and delivered to webhooks
+const (
+	EventOrderPlaced        = "order.placed"
+	EventOrderStatusChanged = "order.status_changed"
+	EventCouponRedeemed     = "coupon.redeemed"
+)
+
+// ValidEventType reports whether eventType is one of the event types
+func ValidEventType(eventType string) bool {
+	switch eventType {
+	case EventOrderPlaced, EventOrderStatusChanged, EventCouponRedeemed:
+		return true
+	}
+	return false
+}
+
+// OutboxEvent is an event written in the same transaction as the change it
+// describes. Data holds the JSON of the event's subject.
+type OutboxEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"createdAt"`
+	// Attempts counts the failed attempts to publish the event
+	Attempts  int    `json:"attempts,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+	// NextAttemptAt is when an event that failed to publish is retried
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	// DeadLetteredAt is set once the event has failed too often to be retried
+	DeadLetteredAt *time.Time `json:"deadLetteredAt,omitempty"`
+}
+
+// Webhook is an endpoint that receives the events it subscribes to as signed POST requests
+type Webhook struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret signs the deliveries. It is only returned when the webhook is created.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Subscribes reports whether the webhook receives events of eventType
+func (w Webhook) Subscribes(eventType string) bool {
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is the delivery of one event to one webhook, with the
+// outcome of its latest attempt
+type WebhookDelivery struct {
+	ID        int64  `json:"id"`
+	WebhookID string `json:"webhookId"`
+	EventID   int64  `json:"eventId"`
+	EventType string `json:"eventType"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	// LastStatusCode is the response status of the latest attempt, zero if there was no response
+	LastStatusCode int    `json:"lastStatusCode,omitempty"`
+	LastError      string `json:"lastError,omitempty"`
+	// NextAttemptAt is when a pending delivery is attempted next
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	DeliveredAt   *time.Time `json:"deliveredAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+// PendingWebhookDelivery is a delivery that is due, with what is needed to send it
+type PendingWebhookDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+	Event  OutboxEvent
 }
 
 type ErrorResponse struct {
@@ -37,3 +522,10 @@ type ErrorResponse struct {
 	Type    string `json:"type"`
 	Message string `json:"message"`
 }
+
+// StockErrorResponse is the error for an order that asks for more than is in stock
+type StockErrorResponse struct {
+	ErrorResponse
+	// ProductIDs lists the products that are short
+	ProductIDs []string `json:"productIds"`
+}
@@ -0,0 +1,210 @@
+// Package money represents amounts of money exactly, as an integer number of
+// minor units (cents) of a currency, so prices and totals don't pick up the
+// rounding errors of binary floating point.
+//
+// Rounding only happens where a result isn't a whole number of minor units:
+// Percent and FromMajor round to the nearest minor unit, halves away from
+// zero. Sums, differences and multiples by a quantity are exact.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of the store
+const DefaultCurrency = "AUD"
+
+// minorDigits is the number of decimal places of every supported currency
+const minorDigits = 2
+
+// scale is the number of minor units in a major unit
+const scale = 100
+
+// currencies are the ISO 4217 codes amounts can be in: the currencies of the
+// stores in Australia, New Zealand and the UK
+var currencies = map[string]bool{
+	DefaultCurrency: true,
+	"NZD":           true,
+	"GBP":           true,
+}
+
+// ValidCurrency reports whether code is a supported ISO 4217 currency code
+func ValidCurrency(code string) bool {
+	return currencies[code]
+}
+
+// Money is an amount in the minor units of a currency. The zero Money has no
+// currency; like any Money without one, it combines with amounts in any
+// currency and takes theirs.
+type Money struct {
+	// Amount is in minor units, e.g. cents
+	Amount   int64
+	Currency string
+}
+
+// New returns amount minor units of currency
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// FromMajor converts an amount in major units, such as a coupon's fixed
+// discount, rounding to the nearest minor unit
+func FromMajor(amount float64, currency string) Money {
+	return Money{Amount: int64(math.Round(amount * scale)), Currency: currency}
+}
+
+// Parse reads a decimal amount in major units, such as "6.5" or "13.65",
+// exactly. More decimal places than the currency has are an error.
+func Parse(s, currency string) (Money, error) {
+	neg := strings.HasPrefix(s, "-")
+	whole, frac, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if whole == "" || strings.ContainsAny(whole, "+-") || strings.ContainsAny(frac, "+-") {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > minorDigits {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimal places", s, minorDigits)
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > math.MaxInt64/scale-1 {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	var cents int64
+	if frac != "" {
+		cents, err = strconv.ParseInt(frac+strings.Repeat("0", minorDigits-len(frac)), 10, 64)
+		if err != nil {
+			return Money{}, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+
+	amount := units*scale + cents
+	if neg {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Add returns m + o
+func (m Money) Add(o Money) Money {
+	return Money{Amount: m.Amount + o.Amount, Currency: m.currencyWith(o)}
+}
+
+// Sub returns m - o
+func (m Money) Sub(o Money) Money {
+	return Money{Amount: m.Amount - o.Amount, Currency: m.currencyWith(o)}
+}
+
+// Mul returns m times a quantity
+func (m Money) Mul(n int) Money {
+	return Money{Amount: m.Amount * int64(n), Currency: m.Currency}
+}
+
+// Percent returns the given share of m, in basis points (hundredths of a
+// percent, so 1800 is 18%), rounded to the nearest minor unit with halves
+// rounded away from zero
+func (m Money) Percent(basisPoints int64) Money {
+	return m.MulDiv(basisPoints, 100*100)
+}
+
+// MulDiv returns m * num / den, rounded to the nearest minor unit with halves
+// rounded away from zero. den must be positive.
+func (m Money) MulDiv(num, den int64) Money {
+	n := m.Amount * num
+	q, r := n/den, n%den
+	if 2*r >= den {
+		q++
+	} else if 2*r <= -den {
+		q--
+	}
+	return Money{Amount: q, Currency: m.Currency}
+}
+
+// Less reports whether m is less than o
+func (m Money) Less(o Money) bool {
+	m.currencyWith(o)
+	return m.Amount < o.Amount
+}
+
+// Min returns the smaller of m and o
+func (m Money) Min(o Money) Money {
+	if o.Less(m) {
+		return Money{Amount: o.Amount, Currency: m.currencyWith(o)}
+	}
+	return Money{Amount: m.Amount, Currency: m.currencyWith(o)}
+}
+
+// IsZero reports whether the amount is zero, in any currency
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Decimal formats the amount in major units with no trailing zeros, such as
+// "6.5", "13.65" or "7"
+func (m Money) Decimal() string {
+	s := m.fixed()
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// String formats the amount with all its decimal places and its currency,
+// such as "6.50 AUD"
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.fixed()
+	}
+	return m.fixed() + " " + m.Currency
+}
+
+// MarshalJSON writes the amount as a plain number in major units, the way
+// prices were written before they were stored in minor units. The currency is
+// carried by the enclosing object.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Decimal()), nil
+}
+
+// UnmarshalJSON reads a number in major units exactly. The currency is left
+// as it was, for the enclosing object to set.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if strings.ContainsAny(s, "eE") {
+		// Exponents would need rounding to be exact
+		return errors.New("money: amounts must be plain decimal numbers")
+	}
+	parsed, err := Parse(s, m.Currency)
+	if err != nil {
+		return fmt.Errorf("money: %w", err)
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) fixed() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, minorDigits, amount%scale)
+}
+
+// currencyWith returns the currency of a result combining m and o. Mixing
+// currencies is a programming error, as no conversion is implied.
+func (m Money) currencyWith(o Money) string {
+	switch {
+	case m.Currency == "":
+		return o.Currency
+	case o.Currency == "" || o.Currency == m.Currency:
+		return m.Currency
+	}
+	panic(fmt.Sprintf("money: mixing %s and %s", m.Currency, o.Currency))
+}
@@ -0,0 +1,175 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"6.5", 650, false},
+		{"13.65", 1365, false},
+		{"7", 700, false},
+		{"0.01", 1, false},
+		{"-2.5", -250, false},
+		{"0.1", 10, false},
+		{"4.555", 0, true},
+		{"", 0, true},
+		{".5", 0, true},
+		{"1.-5", 0, true},
+		{"abc", 0, true},
+		{"99999999999999999999", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in, "AUD")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != New(tt.want, "AUD") {
+			t.Errorf("Parse(%q) = %v, %v, want %d cents", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		amount      int64
+		basisPoints int64
+		want        int64
+	}{
+		{1700, 1800, 306},
+		{1365, 1800, 246}, // 2.457
+		{1375, 1800, 248}, // 2.475, halves round up
+		{1374, 1800, 247}, // 2.4732
+		{99, 1250, 12},    // 0.12375
+		{-1375, 1800, -248},
+		{1000, 10000, 1000},
+		{0, 1800, 0},
+	}
+
+	for _, tt := range tests {
+		if got := New(tt.amount, "AUD").Percent(tt.basisPoints); got != New(tt.want, "AUD") {
+			t.Errorf("%d cents at %d bp = %v, want %d cents", tt.amount, tt.basisPoints, got, tt.want)
+		}
+	}
+}
+
+func TestMulDiv(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		num, den int64
+		want     int64
+	}{
+		{1300, 1000, 11000, 118}, // 118.18, the GST in 13.00
+		{1100, 1000, 11000, 100},
+		{1650, 1, 3, 550},
+		{5, 1, 2, 3}, // 2.5, halves round up
+		{-5, 1, 2, -3},
+		{7, 1, 3, 2},
+	}
+
+	for _, tt := range tests {
+		if got := New(tt.amount, "AUD").MulDiv(tt.num, tt.den); got != New(tt.want, "AUD") {
+			t.Errorf("%d cents * %d / %d = %v, want %d cents", tt.amount, tt.num, tt.den, got, tt.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	a, b := New(650, "AUD"), New(400, "AUD")
+
+	if got := a.Add(b); got != New(1050, "AUD") {
+		t.Errorf("Add = %v", got)
+	}
+	if got := a.Sub(b); got != New(250, "AUD") {
+		t.Errorf("Sub = %v", got)
+	}
+	if got := a.Mul(3); got != New(1950, "AUD") {
+		t.Errorf("Mul = %v", got)
+	}
+	if got := a.Min(b); got != b {
+		t.Errorf("Min = %v", got)
+	}
+	if !b.Less(a) || a.Less(b) {
+		t.Error("Less ordered the amounts wrongly")
+	}
+
+	// The zero Money takes the other operand's currency
+	if got := (Money{}).Add(a); got != a {
+		t.Errorf("zero Add = %v", got)
+	}
+	if got := a.Sub(Money{}); got != a {
+		t.Errorf("Sub zero = %v", got)
+	}
+	// 4.55 is 454.99999... cents as a float
+	if got := FromMajor(4.55, "AUD"); got != New(455, "AUD") {
+		t.Errorf("FromMajor = %v", got)
+	}
+	if got := FromMajor(90, "AUD"); got != New(9000, "AUD") {
+		t.Errorf("FromMajor = %v", got)
+	}
+}
+
+func TestMixedCurrencies(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected adding AUD to NZD to panic")
+		}
+	}()
+	New(100, "AUD").Add(New(100, "NZD"))
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		m           Money
+		wantDecimal string
+		wantString  string
+	}{
+		{New(650, "AUD"), "6.5", "6.50 AUD"},
+		{New(1365, "AUD"), "13.65", "13.65 AUD"},
+		{New(700, "AUD"), "7", "7.00 AUD"},
+		{New(5, "AUD"), "0.05", "0.05 AUD"},
+		{New(-250, "AUD"), "-2.5", "-2.50 AUD"},
+		{New(0, ""), "0", "0.00"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.Decimal(); got != tt.wantDecimal {
+			t.Errorf("Decimal() = %q, want %q", got, tt.wantDecimal)
+		}
+		if got := tt.m.String(); got != tt.wantString {
+			t.Errorf("String() = %q, want %q", got, tt.wantString)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Price Money `json:"price"`
+	}{New(525, "AUD")})
+	if err != nil || string(data) != `{"price":5.25}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+
+	var v struct {
+		Price Money `json:"price"`
+	}
+	v.Price.Currency = "AUD"
+	if err := json.Unmarshal([]byte(`{"price":13.65}`), &v); err != nil || v.Price != New(1365, "AUD") {
+		t.Errorf("Unmarshal = %v, %v", v.Price, err)
+	}
+
+	for _, in := range []string{`{"price":4.555}`, `{"price":1e3}`, `{"price":"6.5"}`} {
+		if err := json.Unmarshal([]byte(in), &v); err == nil {
+			t.Errorf("Unmarshal(%s) = %v, want error", in, v.Price)
+		}
+	}
+}
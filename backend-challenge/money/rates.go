@@ -0,0 +1,111 @@
+package money
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// ErrNoRate is returned when converting to or from a currency the rate table
+// has no rate for
+var ErrNoRate = errors.New("money: no exchange rate")
+
+// Rates is a table of exchange rates against the store currency, used to
+// convert prices that aren't set in the currency asked for. Rates are kept as
+// exact fractions, so the only rounding is of the converted amount.
+type Rates struct {
+	// perDefault is the units of each currency one unit of DefaultCurrency buys
+	perDefault map[string]*big.Rat
+}
+
+// ParseRates reads a rate table in CSV, one "currency,rate" line per
+// currency, where rate is the units of the currency one unit of the store
+// currency buys, such as "NZD,1.09". Lines starting with # are comments. The
+// store currency always has a rate of 1 and may be left out.
+func ParseRates(r io.Reader) (*Rates, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+
+	rates := &Rates{perDefault: map[string]*big.Rat{DefaultCurrency: big.NewRat(1, 1)}}
+	seen := make(map[string]bool)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("money: reading rates: %w", err)
+		}
+
+		code := strings.TrimSpace(record[0])
+		if !ValidCurrency(code) {
+			return nil, fmt.Errorf("money: rate for unsupported currency %q", code)
+		}
+		if seen[code] {
+			return nil, fmt.Errorf("money: duplicate rate for %s", code)
+		}
+		seen[code] = true
+
+		rate, ok := new(big.Rat).SetString(strings.TrimSpace(record[1]))
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("money: invalid rate %q for %s", record[1], code)
+		}
+		if code == DefaultCurrency && rate.Cmp(big.NewRat(1, 1)) != 0 {
+			return nil, fmt.Errorf("money: rate for %s must be 1", DefaultCurrency)
+		}
+		rates.perDefault[code] = rate
+	}
+	return rates, nil
+}
+
+// LoadRates reads a rate table from a file; see ParseRates
+func LoadRates(path string) (*Rates, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseRates(f)
+}
+
+// Convert returns m in currency to, rounded to the nearest minor unit with
+// halves rounded away from zero. It returns an error wrapping ErrNoRate if
+// either currency is missing from the table.
+func (r *Rates) Convert(m Money, to string) (Money, error) {
+	if m.Currency == to {
+		return m, nil
+	}
+	from, ok := r.perDefault[m.Currency]
+	if !ok {
+		return Money{}, fmt.Errorf("%w from %s", ErrNoRate, m.Currency)
+	}
+	toRate, ok := r.perDefault[to]
+	if !ok {
+		return Money{}, fmt.Errorf("%w to %s", ErrNoRate, to)
+	}
+
+	// amount * toRate / from, rounded
+	x := new(big.Rat).SetInt64(m.Amount)
+	x.Mul(x, toRate)
+	x.Quo(x, from)
+	return Money{Amount: roundRat(x), Currency: to}, nil
+}
+
+// roundRat rounds x to the nearest integer, halves away from zero
+func roundRat(x *big.Rat) int64 {
+	num := new(big.Int).Abs(x.Num())
+	q, rem := new(big.Int).QuoRem(num, x.Denom(), new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(x.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if x.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
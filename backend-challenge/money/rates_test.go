@@ -0,0 +1,74 @@
+package money
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testRates = `# units per AUD
+NZD,1.09
+GBP, 0.52
+`
+
+func TestParseRates(t *testing.T) {
+	if _, err := ParseRates(strings.NewReader(testRates)); err != nil {
+		t.Fatalf("ParseRates: %v", err)
+	}
+
+	for _, in := range []string{
+		"USD,0.66",
+		"NZD,1.09\nNZD,1.1",
+		"NZD,0",
+		"NZD,-1",
+		"NZD,abc",
+		"NZD",
+		"AUD,2",
+	} {
+		if _, err := ParseRates(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseRates(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rates, err := ParseRates(strings.NewReader(testRates))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		from Money
+		to   string
+		want Money
+	}{
+		{New(650, "AUD"), "NZD", New(709, "NZD")}, // 708.5, halves round up
+		{New(650, "AUD"), "GBP", New(338, "GBP")},
+		{New(650, "AUD"), "AUD", New(650, "AUD")},
+		{New(709, "NZD"), "AUD", New(650, "AUD")}, // 650.4587...
+		{New(338, "GBP"), "NZD", New(709, "NZD")}, // 708.5, via AUD
+		{New(-650, "AUD"), "NZD", New(-709, "NZD")},
+		{New(0, "AUD"), "GBP", New(0, "GBP")},
+	}
+
+	for _, tt := range tests {
+		got, err := rates.Convert(tt.from, tt.to)
+		if err != nil || got != tt.want {
+			t.Errorf("Convert(%v, %s) = %v, %v, want %v", tt.from, tt.to, got, err, tt.want)
+		}
+	}
+}
+
+func TestConvert_NoRate(t *testing.T) {
+	rates, err := ParseRates(strings.NewReader("NZD,1.09"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rates.Convert(New(100, "AUD"), "GBP"); !errors.Is(err, ErrNoRate) {
+		t.Errorf("Convert to GBP = %v, want ErrNoRate", err)
+	}
+	if _, err := rates.Convert(New(100, "GBP"), "NZD"); !errors.Is(err, ErrNoRate) {
+		t.Errorf("Convert from GBP = %v, want ErrNoRate", err)
+	}
+}
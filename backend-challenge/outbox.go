@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+const outboxUsage = `usage: backend-challenge outbox COMMAND [flags]
+
+Commands:
+  dead-letters
+  retry ID
+
+Every command accepts -db PATH.`
+
+// runOutbox handles the outbox subcommand, which inspects the events the
+// outbox dispatcher gave up on and queues them to be published again
+func runOutbox(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", outboxUsage)
+	}
+
+	fs := flag.NewFlagSet("outbox "+args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db", "data/store.db", "SQLite database path, or a sqlite:// or postgres:// DSN")
+
+	switch args[0] {
+	case "dead-letters", "retry":
+	default:
+		return fmt.Errorf("%s", outboxUsage)
+	}
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+
+	var id int64
+	if args[0] == "retry" {
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: backend-challenge outbox retry ID")
+		}
+		var err error
+		if id, err = strconv.ParseInt(fs.Arg(0), 10, 64); err != nil {
+			return fmt.Errorf("invalid event ID %q", fs.Arg(0))
+		}
+	}
+
+	database, err := openMigrated(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if args[0] == "retry" {
+		if err := database.RequeueOutboxEvent(ctx, id); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Event %d will be published again\n", id)
+		return nil
+	}
+
+	events, err := database.ListDeadLetteredEvents(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tCREATED\tATTEMPTS\tDEAD-LETTERED\tLAST ERROR")
+	for _, event := range events {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n", event.ID, event.Type, formatTime(&event.CreatedAt),
+			event.Attempts, formatTime(event.DeadLetteredAt), event.LastError)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,109 @@
+// Package outbox publishes the events written to the outbox_events table in
+// the same transaction as the changes they describe. Events are published at
+// least once, through a Publisher, so transports can be swapped without
+// touching the code that records them.
+package outbox
+
+import (
+	"backend-challenge/models"
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	// pollInterval is how often the dispatcher checks for due events
+	pollInterval = time.Second
+	// batchSize caps the events published per poll
+	batchSize = 100
+)
+
+// Publisher sends events to a transport. An event may be published more than
+// once, so publishers should be idempotent on the event ID.
+type Publisher interface {
+	Publish(ctx context.Context, event models.OutboxEvent) error
+}
+
+// PublisherFunc adapts a function to a Publisher
+type PublisherFunc func(ctx context.Context, event models.OutboxEvent) error
+
+func (f PublisherFunc) Publish(ctx context.Context, event models.OutboxEvent) error {
+	return f(ctx, event)
+}
+
+// Store holds the outbox
+type Store interface {
+	PendingOutboxEvents(ctx context.Context, now time.Time, limit int) ([]models.OutboxEvent, error)
+	MarkOutboxEventPublished(ctx context.Context, id int64, at time.Time) error
+	RecordOutboxFailure(ctx context.Context, event models.OutboxEvent) error
+}
+
+// Dispatcher publishes pending outbox events, retrying failed ones and
+// dead-lettering those that fail too often
+type Dispatcher struct {
+	store     Store
+	publisher Publisher
+	retry     RetryPolicy
+	now       func() time.Time
+}
+
+// NewDispatcher returns a dispatcher publishing to publisher with DefaultRetryPolicy
+func NewDispatcher(store Store, publisher Publisher) *Dispatcher {
+	return &Dispatcher{store: store, publisher: publisher, retry: DefaultRetryPolicy, now: time.Now}
+}
+
+// Run dispatches until ctx is cancelled. An event whose publishing is
+// interrupted by the cancellation is not counted as failed.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Dispatch(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error dispatching outbox events: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch publishes the events that are due. A failed event is scheduled
+// for a retry, or dead-lettered, without holding up the others.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	events, err := d.store.PendingOutboxEvents(ctx, d.now(), batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		err := d.publisher.Publish(ctx, event)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			if err := d.store.MarkOutboxEventPublished(ctx, event.ID, d.now()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		event.Attempts++
+		event.LastError = ErrorText(err)
+		now := d.now().UTC()
+		if d.retry.Exhausted(event.Attempts) {
+			event.NextAttemptAt = nil
+			event.DeadLetteredAt = &now
+			log.Printf("Dead-lettered %s event %d after %d attempts: %v", event.Type, event.ID, event.Attempts, err)
+		} else {
+			next := now.Add(d.retry.Delay(event.Attempts))
+			event.NextAttemptAt = &next
+		}
+		if err := d.store.RecordOutboxFailure(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
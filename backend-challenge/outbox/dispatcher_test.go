@@ -0,0 +1,144 @@
+package outbox
+
+import (
+	"backend-challenge/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// memoryStore is a Store holding the outbox in memory
+type memoryStore struct {
+	events    []models.OutboxEvent
+	published map[int64]time.Time
+}
+
+func newMemoryStore(events ...models.OutboxEvent) *memoryStore {
+	return &memoryStore{events: events, published: make(map[int64]time.Time)}
+}
+
+func (s *memoryStore) PendingOutboxEvents(ctx context.Context, now time.Time, limit int) ([]models.OutboxEvent, error) {
+	var pending []models.OutboxEvent
+	for _, e := range s.events {
+		_, published := s.published[e.ID]
+		if !published && e.DeadLetteredAt == nil && (e.NextAttemptAt == nil || !e.NextAttemptAt.After(now)) {
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
+
+func (s *memoryStore) MarkOutboxEventPublished(ctx context.Context, id int64, at time.Time) error {
+	s.published[id] = at
+	return nil
+}
+
+func (s *memoryStore) RecordOutboxFailure(ctx context.Context, event models.OutboxEvent) error {
+	for i := range s.events {
+		if s.events[i].ID == event.ID {
+			s.events[i] = event
+			return nil
+		}
+	}
+	return errors.New("no such event")
+}
+
+func TestDispatch(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	store := newMemoryStore(
+		models.OutboxEvent{ID: 1, Type: models.EventOrderPlaced},
+		models.OutboxEvent{ID: 2, Type: models.EventCouponRedeemed},
+	)
+
+	// The broker rejects coupon events until it is fixed
+	broken := true
+	var published []int64
+	d := NewDispatcher(store, PublisherFunc(func(ctx context.Context, event models.OutboxEvent) error {
+		if broken && event.Type == models.EventCouponRedeemed {
+			return errors.New("broker unavailable")
+		}
+		published = append(published, event.ID)
+		return nil
+	}))
+	d.retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	d.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := d.Dispatch(ctx); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	// A failing event doesn't hold up the others
+	if len(published) != 1 || published[0] != 1 {
+		t.Fatalf("Expected event 1 published, got %v", published)
+	}
+	failed := store.events[1]
+	if failed.Attempts != 1 || failed.LastError != "broker unavailable" || !failed.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("Expected retry in a minute, got %+v", failed)
+	}
+
+	// Published events aren't published again, and failed ones wait for their retry
+	if err := d.Dispatch(ctx); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	if len(published) != 1 || store.events[1].Attempts != 1 {
+		t.Fatalf("Expected nothing published before the retry, got %v, %+v", published, store.events[1])
+	}
+
+	now = now.Add(time.Minute)
+	d.Dispatch(ctx)
+	if store.events[1].Attempts != 2 || !store.events[1].NextAttemptAt.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("Expected second retry in two minutes, got %+v", store.events[1])
+	}
+
+	// The last allowed attempt dead-letters the event
+	now = now.Add(2 * time.Minute)
+	d.Dispatch(ctx)
+	dead := store.events[1]
+	if dead.Attempts != 3 || dead.DeadLetteredAt == nil || dead.NextAttemptAt != nil {
+		t.Fatalf("Expected dead-lettered event, got %+v", dead)
+	}
+
+	broken = false
+	now = now.Add(time.Hour)
+	d.Dispatch(ctx)
+	if len(published) != 1 {
+		t.Errorf("Expected dead-lettered event left alone, got %v", published)
+	}
+}
+
+func TestDispatch_Cancelled(t *testing.T) {
+	store := newMemoryStore(models.OutboxEvent{ID: 1, Type: models.EventOrderPlaced})
+	ctx, cancel := context.WithCancel(context.Background())
+	d := NewDispatcher(store, PublisherFunc(func(ctx context.Context, event models.OutboxEvent) error {
+		cancel()
+		return ctx.Err()
+	}))
+
+	if err := d.Dispatch(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if store.events[0].Attempts != 0 {
+		t.Errorf("Expected an interrupted attempt not to count, got %+v", store.events[0])
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: 30 * time.Second, MaxDelay: 10 * time.Minute}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{6, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := p.Delay(tt.attempts); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package outbox
+
+import "time"
+
+// MaxErrorLength caps the error kept with a failed attempt
+const MaxErrorLength = 512
+
+// DefaultRetryPolicy retries after 30 seconds, doubling the wait each time up
+// to an hour, and gives up after 10 attempts, about 4.5 hours after the first
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 10, BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+
+// RetryPolicy decides when failed attempts are retried
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Delay returns the wait before the attempt after the given number of failed ones
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Exhausted reports whether no attempt follows the given number of failed ones
+func (p RetryPolicy) Exhausted(attempts int) bool {
+	return attempts >= p.MaxAttempts
+}
+
+// ErrorText returns the message of err, shortened to MaxErrorLength bytes, to
+// be kept with a failed attempt
+func ErrorText(err error) string {
+	msg := err.Error()
+	if len(msg) > MaxErrorLength {
+		return msg[:MaxErrorLength]
+	}
+	return msg
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"backend-challenge/db"
+	"backend-challenge/models"
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunOutbox(t *testing.T) {
+	dbPath := copyTestDB(t)
+	ctx := context.Background()
+
+	database, err := db.Open(dbPath)
+	require.NoError(t, err)
+	defer database.Close()
+
+	now := time.Now().UTC()
+	require.NoError(t, database.CreateOrder(ctx, &models.Order{
+		ID: "order-1", Status: models.OrderPlaced, CreatedAt: now,
+	}))
+	events, err := database.PendingOutboxEvents(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	event := events[0]
+	event.Attempts, event.LastError, event.DeadLetteredAt = 10, "broker unavailable", &now
+	require.NoError(t, database.RecordOutboxFailure(ctx, event))
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		args = append([]string{args[0], "-db", dbPath}, args[1:]...)
+		err := runOutbox(ctx, args, &out)
+		return out.String(), err
+	}
+
+	out, err := run("dead-letters")
+	require.NoError(t, err)
+	assert.Contains(t, out, models.EventOrderPlaced)
+	assert.Contains(t, out, "broker unavailable")
+
+	id := strconv.FormatInt(event.ID, 10)
+	out, err = run("retry", id)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Event "+id+" will be published again")
+
+	pending, err := database.PendingOutboxEvents(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Len(t, pending, 1)
+
+	// Only dead-lettered events can be retried
+	_, err = run("retry", id)
+	assert.ErrorIs(t, err, db.ErrOutboxEventNotFound)
+	_, err = run("retry", "abc")
+	assert.Error(t, err)
+	_, err = run("bogus")
+	assert.Error(t, err)
+}
@@ -0,0 +1,116 @@
+// Package ratelimit implements token bucket rate limiting. The Limiter
+// interface lets the API run against the in-memory buckets of a single
+// process or against a shared store when several instances serve traffic.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Result describes a bucket after a Take or Peek
+type Result struct {
+	Allowed bool
+	Limit   int
+	// Remaining is the number of whole tokens left in the bucket
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next token, zero while tokens remain
+	RetryAfter time.Duration
+}
+
+// Limiter tracks one token bucket per key
+type Limiter interface {
+	// Take removes a token from the key's bucket, reporting whether there was one
+	Take(key string, p Policy) Result
+	// Peek reports whether the key's bucket has a token without removing it
+	Peek(key string, p Policy) Result
+}
+
+// sweepInterval is how often Memory drops buckets that have refilled
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket will be back at its limit and can be dropped
+	full time.Time
+}
+
+// Memory is a Limiter that keeps the buckets in process memory
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemory returns an empty in-memory limiter
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (m *Memory) Take(key string, p Policy) Result {
+	return m.use(key, p, true)
+}
+
+func (m *Memory) Peek(key string, p Policy) Result {
+	return m.use(key, p, false)
+}
+
+func (m *Memory) use(key string, p Policy, take bool) Result {
+	if !p.Enabled() {
+		return Result{Allowed: true}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(p.Limit), last: now}
+	}
+
+	// Refill for the time since the bucket was last used
+	perToken := max(p.Period/time.Duration(p.Limit), time.Nanosecond)
+	b.tokens = math.Min(float64(p.Limit), b.tokens+float64(now.Sub(b.last))/float64(perToken))
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed && take {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((float64(p.Limit) - b.tokens) * float64(perToken)))
+	if take || ok {
+		m.buckets[key] = b
+	}
+
+	res := Result{
+		Allowed:   allowed,
+		Limit:     p.Limit,
+		Remaining: int(b.tokens),
+		Reset:     b.full.Sub(now),
+	}
+	if b.tokens < 1 {
+		res.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	return res
+}
+
+// sweep drops buckets that are full again, since a new bucket behaves the same
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
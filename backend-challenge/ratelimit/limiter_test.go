@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestMemory(now *time.Time) *Memory {
+	m := NewMemory()
+	m.now = func() time.Time { return *now }
+	return m
+}
+
+func TestMemory_Take(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	m := newTestMemory(&now)
+	p := Policy{Limit: 3, Period: 3 * time.Second}
+
+	for i := 2; i >= 0; i-- {
+		res := m.Take("client", p)
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("Expected allowed with %d remaining, got %+v", i, res)
+		}
+	}
+
+	res := m.Take("client", p)
+	if res.Allowed {
+		t.Fatal("Expected empty bucket to refuse")
+	}
+	if res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Errorf("Expected retry after 1s and reset in 3s, got %+v", res)
+	}
+
+	// Other keys have their own bucket
+	if res := m.Take("other", p); !res.Allowed {
+		t.Error("Expected a separate bucket per key")
+	}
+
+	// One token comes back per Period/Limit
+	now = now.Add(time.Second)
+	if res := m.Take("client", p); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("Expected one refilled token, got %+v", res)
+	}
+
+	// Refill never exceeds the limit
+	now = now.Add(time.Hour)
+	if res := m.Take("client", p); res.Remaining != 2 {
+		t.Errorf("Expected bucket capped at the limit, got %+v", res)
+	}
+}
+
+func TestMemory_Peek(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	m := newTestMemory(&now)
+	p := Policy{Limit: 1, Period: time.Minute}
+
+	if res := m.Peek("client", p); !res.Allowed || res.Remaining != 1 {
+		t.Errorf("Expected full bucket, got %+v", res)
+	}
+	if len(m.buckets) != 0 {
+		t.Error("Expected Peek not to create a bucket")
+	}
+
+	m.Take("client", p)
+	if res := m.Peek("client", p); res.Allowed {
+		t.Errorf("Expected empty bucket, got %+v", res)
+	}
+	if res := m.Peek("client", p); res.RetryAfter != time.Minute {
+		t.Errorf("Expected Peek not to take a token, got %+v", res)
+	}
+}
+
+func TestMemory_DisabledPolicy(t *testing.T) {
+	m := NewMemory()
+	for i := 0; i < 10; i++ {
+		if res := m.Take("client", Policy{}); !res.Allowed {
+			t.Fatal("Expected disabled policy to allow every request")
+		}
+	}
+}
+
+func TestMemory_Sweep(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	m := newTestMemory(&now)
+	p := Policy{Limit: 2, Period: time.Minute}
+
+	m.Take("idle", p)
+	now = now.Add(30 * time.Second)
+	m.Take("busy", p)
+	m.Take("busy", p)
+
+	// The next sweep is due a minute after the first use
+	now = now.Add(30 * time.Second)
+	m.Peek("other", p)
+	if _, ok := m.buckets["idle"]; ok {
+		t.Error("Expected refilled bucket to be dropped")
+	}
+	if _, ok := m.buckets["busy"]; !ok {
+		t.Error("Expected bucket that is still refilling to be kept")
+	}
+}
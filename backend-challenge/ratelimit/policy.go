@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is a token bucket that holds Limit tokens and refills Limit tokens
+// every Period. A zero Limit turns the policy off.
+type Policy struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Enabled reports whether the policy limits anything
+func (p Policy) Enabled() bool {
+	return p.Limit > 0
+}
+
+// String formats the policy the way ParsePolicy reads it
+func (p Policy) String() string {
+	if !p.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", p.Limit, p.Period)
+}
+
+// ParsePolicy reads a policy written as "<limit>/<period>", e.g. "60/1m".
+// "off" and "0" disable the limit.
+func ParsePolicy(s string) (Policy, error) {
+	if s == "off" || s == "0" {
+		return Policy{}, nil
+	}
+	limitStr, periodStr, ok := strings.Cut(s, "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("invalid rate limit %q: want <limit>/<period>", s)
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q: limit must be a non-negative number", s)
+	}
+	period, err := time.ParseDuration(periodStr)
+	if err != nil || period <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q: period must be a positive duration", s)
+	}
+	return Policy{Limit: limit, Period: period}, nil
+}
+
+// Policies groups the limits applied by the API
+type Policies struct {
+	// Products limits anonymous product reads per client IP
+	Products Policy
+	// Orders limits order placement per API key
+	Orders Policy
+	// CouponFailures limits unknown coupon codes submitted per client IP
+	CouponFailures Policy
+}
+
+// DefaultPolicies returns limits generous enough for normal shopping but
+// tight enough to make guessing coupon codes impractical
+func DefaultPolicies() Policies {
+	return Policies{
+		Products:       Policy{Limit: 300, Period: time.Minute},
+		Orders:         Policy{Limit: 60, Period: time.Minute},
+		CouponFailures: Policy{Limit: 10, Period: 15 * time.Minute},
+	}
+}
+
+// PoliciesFromEnv returns the default policies overridden by the
+// RATE_LIMIT_PRODUCTS, RATE_LIMIT_ORDERS and RATE_LIMIT_COUPON_FAILURES
+// environment variables
+func PoliciesFromEnv() (Policies, error) {
+	p := DefaultPolicies()
+	for name, field := range map[string]*Policy{
+		"RATE_LIMIT_PRODUCTS":        &p.Products,
+		"RATE_LIMIT_ORDERS":          &p.Orders,
+		"RATE_LIMIT_COUPON_FAILURES": &p.CouponFailures,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		policy, err := ParsePolicy(value)
+		if err != nil {
+			return Policies{}, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		*field = policy
+	}
+	return p, nil
+}
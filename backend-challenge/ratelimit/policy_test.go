@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Policy
+		wantErr bool
+	}{
+		{"60/1m", Policy{Limit: 60, Period: time.Minute}, false},
+		{"5/30s", Policy{Limit: 5, Period: 30 * time.Second}, false},
+		{"off", Policy{}, false},
+		{"0", Policy{}, false},
+		{"60", Policy{}, true},
+		{"sixty/1m", Policy{}, true},
+		{"-1/1m", Policy{}, true},
+		{"60/minute", Policy{}, true},
+		{"60/0s", Policy{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePolicy(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoliciesFromEnv(t *testing.T) {
+	names := []string{"RATE_LIMIT_PRODUCTS", "RATE_LIMIT_ORDERS", "RATE_LIMIT_COUPON_FAILURES"}
+
+	t.Run("defaults", func(t *testing.T) {
+		for _, name := range names {
+			t.Setenv(name, "")
+		}
+		got, err := PoliciesFromEnv()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != DefaultPolicies() {
+			t.Errorf("got %+v, want defaults", got)
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_PRODUCTS", "off")
+		t.Setenv("RATE_LIMIT_ORDERS", "10/1m")
+		t.Setenv("RATE_LIMIT_COUPON_FAILURES", "")
+		got, err := PoliciesFromEnv()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := DefaultPolicies()
+		want.Products = Policy{}
+		want.Orders = Policy{Limit: 10, Period: time.Minute}
+		if got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_ORDERS", "lots")
+		if _, err := PoliciesFromEnv(); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"backend-challenge/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+)
+
+// lastUsedResolution is how stale an API key's last use may get before it is
+// recorded again, so busy keys don't write on every request
+const lastUsedResolution = time.Minute
+
+// GenerateAPIKey returns a new random key
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashAPIKey returns the hex SHA-256 of a key, the form keys are stored in
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddStaticAPIKey accepts key alongside the stored keys without persisting it,
+// for keys supplied through configuration. It must be called before serving.
+func (s *Service) AddStaticAPIKey(key string, apiKey models.APIKey) {
+	if s.staticKeys == nil {
+		s.staticKeys = make(map[string]*models.APIKey)
+	}
+	s.staticKeys[HashAPIKey(key)] = &apiKey
+}
+
+// Authenticate looks up an API key and records its use. Unknown, disabled and
+// expired keys return ErrInvalidAPIKey.
+func (s *Service) Authenticate(ctx context.Context, key string) (*models.APIKey, error) {
+	if key == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	hash := HashAPIKey(key)
+	if apiKey, ok := s.staticKeys[hash]; ok {
+		return apiKey, nil
+	}
+
+	apiKey, err := s.db.GetAPIKeyByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if apiKey == nil || !apiKey.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= lastUsedResolution {
+		// Failing to record the use must not fail the request
+		if err := s.db.TouchAPIKey(ctx, apiKey.ID, now.UTC()); err != nil {
+			log.Printf("Error recording use of api key %s: %v", apiKey.ID, err)
+		}
+	}
+	return apiKey, nil
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"backend-challenge/models"
+	"backend-challenge/money"
+)
+
+// SetExchangeRates sets the rate table used to price products in currencies
+// they have no price set in. Without one, such products can't be priced in
+// those currencies.
+func (s *Service) SetExchangeRates(rates *money.Rates) {
+	s.rates = rates
+}
+
+// checkCurrency accepts an empty currency, meaning the products' own, or a
+// supported one
+func checkCurrency(currency string) error {
+	if currency != "" && !money.ValidCurrency(currency) {
+		return ErrUnsupportedCurrency
+	}
+	return nil
+}
+
+// priceIn sets the product's price to its price in currency: the price set
+// for that currency if there is one, otherwise its own price converted at the
+// exchange rates. An empty currency leaves the product's own price.
+func (s *Service) priceIn(product *models.Product, currency string) error {
+	if currency == "" {
+		return nil
+	}
+	if price, ok := product.PriceIn(currency); ok {
+		product.Price = price
+		return nil
+	}
+	if s.rates != nil {
+		if price, err := s.rates.Convert(product.Price, currency); err == nil {
+			product.Price = price
+			return nil
+		}
+	}
+	return &PriceUnavailableError{ProductID: product.ID, Currency: currency}
+}
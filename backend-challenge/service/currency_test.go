@@ -0,0 +1,122 @@
+package service
+
+import (
+	"backend-challenge/db/mocks"
+	"backend-challenge/models"
+	"backend-challenge/money"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+)
+
+// testRates converts 1 AUD to 1.09 NZD or 0.52 GBP
+func testRates(t *testing.T) *money.Rates {
+	t.Helper()
+	rates, err := money.ParseRates(strings.NewReader("NZD,1.09\nGBP,0.52"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rates
+}
+
+// waffle is priced in AUD with a price set for NZD
+func waffle() *models.Product {
+	return &models.Product{
+		ID:     "1",
+		Price:  aud(650),
+		Prices: map[string]money.Money{"NZD": money.New(750, "NZD")},
+	}
+}
+
+func TestGetProductByID_Currency(t *testing.T) {
+	tests := []struct {
+		name      string
+		currency  string
+		withRates bool
+		want      money.Money
+		wantErr   error
+	}{
+		{name: "own price", currency: "", want: aud(650)},
+		{name: "own currency", currency: "AUD", want: aud(650)},
+		{name: "price set for currency", currency: "NZD", want: money.New(750, "NZD")},
+		{name: "price set wins over rates", currency: "NZD", withRates: true, want: money.New(750, "NZD")},
+		{name: "converted", currency: "GBP", withRates: true, want: money.New(338, "GBP")},
+		{name: "no price or rate", currency: "GBP", wantErr: ErrPriceUnavailable},
+		{name: "unsupported currency", currency: "USD", wantErr: ErrUnsupportedCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			mockDB.EXPECT().GetProductByID(gomock.Any(), "1").Return(waffle(), nil).AnyTimes()
+
+			svc := New(mockDB)
+			if tt.withRates {
+				svc.SetExchangeRates(testRates(t))
+			}
+			product, err := svc.GetProductByID(context.Background(), "1", tt.currency)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetProductByID() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && product.Price != tt.want {
+				t.Errorf("price = %v, want %v", product.Price, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaceOrder_Currency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockDB.EXPECT().GetProductByID(gomock.Any(), "1").Return(waffle(), nil)
+	mockDB.EXPECT().GetProductByID(gomock.Any(), "2").Return(&models.Product{ID: "2", Price: aud(400)}, nil)
+	mockDB.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
+
+	svc := New(mockDB)
+	svc.SetExchangeRates(testRates(t))
+	svc.now = func() time.Time { return testNow }
+	order, err := svc.PlaceOrder(context.Background(), models.OrderReq{
+		Items:    []models.OrderItem{{ProductID: "1", Quantity: 2}, {ProductID: "2", Quantity: 1}},
+		Currency: "NZD",
+	})
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+
+	// 2 x 7.50 set for NZD, plus 4.00 AUD converted to 4.36 NZD
+	if order.Lines[0].UnitPrice != money.New(750, "NZD") || order.Lines[1].UnitPrice != money.New(436, "NZD") {
+		t.Errorf("unit prices = %v, %v", order.Lines[0].UnitPrice, order.Lines[1].UnitPrice)
+	}
+	if order.Total != money.New(1936, "NZD") || order.Products[1].Price.Currency != "NZD" {
+		t.Errorf("total = %v, products = %+v", order.Total, order.Products)
+	}
+}
+
+func TestPlaceOrder_PriceUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockDB.EXPECT().GetProductByID(gomock.Any(), "1").Return(waffle(), nil)
+
+	svc := New(mockDB)
+	_, err := svc.PlaceOrder(context.Background(), models.OrderReq{
+		Items:    []models.OrderItem{{ProductID: "1", Quantity: 1}},
+		Currency: "GBP",
+	})
+
+	var unavailable *PriceUnavailableError
+	if !errors.As(err, &unavailable) || unavailable.ProductID != "1" || unavailable.Currency != "GBP" {
+		t.Errorf("PlaceOrder() error = %v, want product 1 unavailable in GBP", err)
+	}
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"backend-challenge/models"
+	"backend-challenge/money"
+	"fmt"
+	"math"
+)
+
+// DiscountRule computes the discount a coupon grants on a priced order
+type DiscountRule interface {
+	// Discount returns the amount to take off the order subtotal, in the
+	// order's currency, or a *CouponNotApplicableError explaining why the
+	// order does not qualify
+	Discount(order *models.Order) (money.Money, error)
+}
+
+// lineRule is implemented by discount rules that take their discount off a
+// single line, so tax can be worked out on what was paid for each line
+type lineRule interface {
+	// discountedLine returns the index of the line the discount comes off
+	discountedLine(order *models.Order) (int, bool)
+}
+
+// NewDiscountRule builds the DiscountRule described by a stored coupon rule,
+// for orders in currency. Percentages are rounded to the nearest basis point.
+// Amounts are minor units of the store currency and are converted into
+// currency at rates; without a rate the coupon doesn't apply.
+func NewDiscountRule(rule models.CouponRule, currency string, rates *money.Rates) (DiscountRule, error) {
+	amountIn := func(minor int64) (int64, error) {
+		amount, err := convertAmount(money.New(minor, money.DefaultCurrency), currency, rates)
+		return amount.Amount, err
+	}
+
+	var dr DiscountRule
+	switch rule.Type {
+	case models.CouponRulePercentage:
+		if rule.Value <= 0 || rule.Value > 100 {
+			return nil, fmt.Errorf("coupon %s: percentage must be between 0 and 100, got %v", rule.Code, rule.Value)
+		}
+		dr = percentageRule{basisPoints: int64(math.Round(rule.Value * 100))}
+	case models.CouponRuleFixedAmount:
+		if rule.Amount <= 0 {
+			return nil, fmt.Errorf("coupon %s: fixed amount must be positive, got %d", rule.Code, rule.Amount)
+		}
+		amount, err := amountIn(rule.Amount)
+		if err != nil {
+			return nil, err
+		}
+		dr = fixedAmountRule{amount: amount}
+	case models.CouponRuleCheapestFree:
+		dr = cheapestFreeRule{}
+	case models.CouponRuleFreeItem:
+		if rule.ProductID == "" {
+			return nil, fmt.Errorf("coupon %s: free item rule requires a product", rule.Code)
+		}
+		dr = freeItemRule{productID: rule.ProductID}
+	default:
+		return nil, fmt.Errorf("coupon %s: unknown rule type %q", rule.Code, rule.Type)
+	}
+
+	if rule.MinSubtotal > 0 {
+		min, err := amountIn(rule.MinSubtotal)
+		if err != nil {
+			return nil, err
+		}
+		dr = minSubtotalRule{min: min, next: dr}
+	}
+	return dr, nil
+}
+
+// convertAmount converts a coupon amount into currency at rates
+func convertAmount(amount money.Money, currency string, rates *money.Rates) (money.Money, error) {
+	if amount.Currency == currency {
+		return amount, nil
+	}
+	if rates != nil {
+		if converted, err := rates.Convert(amount, currency); err == nil {
+			return converted, nil
+		}
+	}
+	return money.Money{}, &CouponNotApplicableError{Reason: fmt.Sprintf("no exchange rate to %s", currency)}
+}
+
+// percentageRule takes a percentage off the subtotal, rounded to the nearest
+// minor unit with halves rounded up
+type percentageRule struct {
+	basisPoints int64
+}
+
+func (r percentageRule) Discount(order *models.Order) (money.Money, error) {
+	return order.Subtotal.Percent(r.basisPoints), nil
+}
+
+// fixedAmountRule takes a fixed amount, in minor units of the order's
+// currency, off the subtotal, never more than the subtotal itself
+type fixedAmountRule struct {
+	amount int64
+}
+
+func (r fixedAmountRule) Discount(order *models.Order) (money.Money, error) {
+	return money.New(r.amount, order.Subtotal.Currency).Min(order.Subtotal), nil
+}
+
+// cheapestFreeRule makes one unit of the cheapest product free when at least two units are ordered
+type cheapestFreeRule struct{}
+
+func (r cheapestFreeRule) Discount(order *models.Order) (money.Money, error) {
+	units := 0
+	for _, line := range order.Lines {
+		units += line.Quantity
+	}
+
+	if units < 2 {
+		return money.Money{}, &CouponNotApplicableError{Reason: "at least two items must be ordered"}
+	}
+	i, _ := r.discountedLine(order)
+	return order.Lines[i].UnitPrice, nil
+}
+
+// discountedLine returns the first line with the lowest unit price
+func (r cheapestFreeRule) discountedLine(order *models.Order) (int, bool) {
+	cheapest := -1
+	for i, line := range order.Lines {
+		if cheapest < 0 || line.UnitPrice.Less(order.Lines[cheapest].UnitPrice) {
+			cheapest = i
+		}
+	}
+	return cheapest, cheapest >= 0
+}
+
+// freeItemRule makes one unit of a given product free when it is in the order
+type freeItemRule struct {
+	productID string
+}
+
+func (r freeItemRule) Discount(order *models.Order) (money.Money, error) {
+	if i, ok := r.discountedLine(order); ok {
+		return order.Lines[i].UnitPrice, nil
+	}
+	return money.Money{}, &CouponNotApplicableError{Reason: fmt.Sprintf("product %s must be in the order", r.productID)}
+}
+
+// discountedLine returns the first line of the free product
+func (r freeItemRule) discountedLine(order *models.Order) (int, bool) {
+	for i, line := range order.Lines {
+		if line.ProductID == r.productID {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// minSubtotalRule only applies the wrapped rule once the subtotal reaches a
+// minimum basket, in minor units of the order's currency
+type minSubtotalRule struct {
+	min  int64
+	next DiscountRule
+}
+
+func (r minSubtotalRule) Discount(order *models.Order) (money.Money, error) {
+	min := money.New(r.min, order.Subtotal.Currency)
+	if order.Subtotal.Less(min) {
+		return money.Money{}, &CouponNotApplicableError{Reason: fmt.Sprintf("minimum basket of %s not met", min)}
+	}
+	return r.next.Discount(order)
+}
+
+func (r minSubtotalRule) discountedLine(order *models.Order) (int, bool) {
+	if next, ok := r.next.(lineRule); ok {
+		return next.discountedLine(order)
+	}
+	return 0, false
+}
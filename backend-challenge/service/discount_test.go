@@ -0,0 +1,131 @@
+package service
+
+import (
+	"backend-challenge/models"
+	"backend-challenge/money"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDiscountRules(t *testing.T) {
+	// Two waffles at 6.50 and one baklava at 4.00; wanted discounts are in cents
+	order := &models.Order{
+		Lines: []models.OrderLine{
+			{ProductID: "1", Quantity: 2, UnitPrice: aud(650), Amount: aud(1300)},
+			{ProductID: "5", Quantity: 1, UnitPrice: aud(400), Amount: aud(400)},
+		},
+		Subtotal: aud(1700),
+	}
+
+	tests := []struct {
+		name           string
+		rule           models.CouponRule
+		wantDiscount   int64
+		wantBuildErr   bool
+		wantNotApplied bool
+	}{
+		{"percentage", models.CouponRule{Type: models.CouponRulePercentage, Value: 18}, 306, false, false},
+		{"percentage over 100", models.CouponRule{Type: models.CouponRulePercentage, Value: 120}, 0, true, false},
+		{"fixed amount", models.CouponRule{Type: models.CouponRuleFixedAmount, Amount: 500}, 500, false, false},
+		{"fixed amount capped at subtotal", models.CouponRule{Type: models.CouponRuleFixedAmount, Amount: 5000}, 1700, false, false},
+		{"fixed amount not positive", models.CouponRule{Type: models.CouponRuleFixedAmount}, 0, true, false},
+		{"cheapest free", models.CouponRule{Type: models.CouponRuleCheapestFree}, 400, false, false},
+		{"free item in order", models.CouponRule{Type: models.CouponRuleFreeItem, ProductID: "1"}, 650, false, false},
+		{"free item not in order", models.CouponRule{Type: models.CouponRuleFreeItem, ProductID: "7"}, 0, false, true},
+		{"free item without product", models.CouponRule{Type: models.CouponRuleFreeItem}, 0, true, false},
+		{"minimum basket met", models.CouponRule{Type: models.CouponRulePercentage, Value: 10, MinSubtotal: 1500}, 170, false, false},
+		{"minimum basket not met", models.CouponRule{Type: models.CouponRulePercentage, Value: 10, MinSubtotal: 2000}, 0, false, true},
+		{"unknown type", models.CouponRule{Type: "bogus"}, 0, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := NewDiscountRule(tt.rule, money.DefaultCurrency, nil)
+			if tt.wantBuildErr {
+				if err == nil {
+					t.Error("expected error building rule")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error building rule: %v", err)
+			}
+
+			discount, err := rule.Discount(order)
+			if tt.wantNotApplied {
+				if !errors.Is(err, ErrCouponNotApplicable) {
+					t.Errorf("expected ErrCouponNotApplicable, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if discount != aud(tt.wantDiscount) {
+				t.Errorf("discount = %v, want %v", discount, aud(tt.wantDiscount))
+			}
+		})
+	}
+}
+
+func TestDiscountRules_OtherCurrency(t *testing.T) {
+	rates, err := money.ParseRates(strings.NewReader("GBP,0.52\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Like OVER9000: A$10 off orders over A$90, which is £5.20 off over £46.80
+	over9000 := models.CouponRule{Type: models.CouponRuleFixedAmount, Amount: 1000, MinSubtotal: 9000}
+	rule, err := NewDiscountRule(over9000, "GBP", rates)
+	if err != nil {
+		t.Fatalf("unexpected error building rule: %v", err)
+	}
+
+	discount, err := rule.Discount(&models.Order{Subtotal: money.New(5000, "GBP")})
+	if err != nil || discount != money.New(520, "GBP") {
+		t.Errorf("discount = %v, %v, want %v", discount, err, money.New(520, "GBP"))
+	}
+	if _, err := rule.Discount(&models.Order{Subtotal: money.New(4600, "GBP")}); !errors.Is(err, ErrCouponNotApplicable) {
+		t.Errorf("expected ErrCouponNotApplicable under £46.80, got %v", err)
+	}
+
+	if _, err := NewDiscountRule(over9000, "NZD", rates); !errors.Is(err, ErrCouponNotApplicable) {
+		t.Errorf("expected ErrCouponNotApplicable without a rate, got %v", err)
+	}
+}
+
+func TestCheapestFreeRule_SingleItem(t *testing.T) {
+	order := &models.Order{
+		Lines:    []models.OrderLine{{ProductID: "1", Quantity: 1, UnitPrice: aud(650), Amount: aud(650)}},
+		Subtotal: aud(650),
+	}
+
+	_, err := cheapestFreeRule{}.Discount(order)
+
+	var notApplicable *CouponNotApplicableError
+	if !errors.As(err, &notApplicable) || notApplicable.Reason == "" {
+		t.Errorf("expected a reason why the coupon did not apply, got %v", err)
+	}
+}
+
+func TestPercentageRule_Rounding(t *testing.T) {
+	// Halves of a cent round up: 18% of 13.75 is 2.475
+	rule, err := NewDiscountRule(models.CouponRule{Type: models.CouponRulePercentage, Value: 18}, money.DefaultCurrency, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building rule: %v", err)
+	}
+	discount, err := rule.Discount(&models.Order{Subtotal: aud(1375)})
+	if err != nil || discount != aud(248) {
+		t.Errorf("discount = %v, %v, want %v", discount, err, aud(248))
+	}
+
+	// Fractional percentages are exact to the basis point: 12.5% of 0.99 is 0.12375
+	rule, err = NewDiscountRule(models.CouponRule{Type: models.CouponRulePercentage, Value: 12.5}, money.DefaultCurrency, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building rule: %v", err)
+	}
+	discount, err = rule.Discount(&models.Order{Subtotal: aud(99)})
+	if err != nil || discount != aud(12) {
+		t.Errorf("discount = %v, %v, want %v", discount, err, aud(12))
+	}
+}
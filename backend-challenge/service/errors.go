@@ -1,11 +1,184 @@
 package service
 
-import "errors"
+import (
+	"errors"
+	"strings"
+)
 
 var (
+	// ErrInvalidAPIKey is returned when an API key is missing, unknown or disabled
+	ErrInvalidAPIKey = errors.New("invalid api key")
+
 	// ErrInvalidCoupon is returned when a coupon code is invalid
 	ErrInvalidCoupon = errors.New("invalid coupon code")
 
+	// ErrCouponNotApplicable is returned when a valid coupon does not apply to the order
+	ErrCouponNotApplicable = errors.New("coupon does not apply")
+
+	// ErrCouponExpired is returned when a coupon's redemption window has ended
+	ErrCouponExpired = errors.New("coupon has expired")
+
+	// ErrCouponNotYetActive is returned when a coupon's redemption window has not started
+	ErrCouponNotYetActive = errors.New("coupon is not active yet")
+
+	// ErrCouponExhausted is returned when a coupon has reached its redemption cap
+	ErrCouponExhausted = errors.New("coupon has been fully redeemed")
+
+	// ErrCouponAlreadyUsed is returned when the customer has reached the coupon's per-customer cap
+	ErrCouponAlreadyUsed = errors.New("coupon already used by this customer")
+
+	// ErrCustomerRequired is returned when a coupon with a per-customer cap is used without a customer ID
+	ErrCustomerRequired = errors.New("coupon requires a customer ID")
+
+	// ErrCouponExists is returned when creating a coupon whose code is already taken
+	ErrCouponExists = errors.New("coupon already exists")
+
+	// ErrCouponNotFound is returned when deactivating a coupon that does not exist or is already inactive
+	ErrCouponNotFound = errors.New("coupon not found")
+
+	// ErrMalformedCoupon is returned when a new coupon's rule or limits fail validation
+	ErrMalformedCoupon = errors.New("malformed coupon")
+
 	// ErrProductNotFound is returned when a product does not exist
 	ErrProductNotFound = errors.New("product not found")
+
+	// ErrProductExists is returned when creating a product whose ID is already taken
+	ErrProductExists = errors.New("product already exists")
+
+	// ErrInvalidProduct is returned when a product fails validation
+	ErrInvalidProduct = errors.New("invalid product")
+
+	// ErrInsufficientStock is returned when an order asks for more of a product than is in stock
+	ErrInsufficientStock = errors.New("insufficient stock")
+
+	// ErrUnsupportedCurrency is returned when prices are asked for in a currency no store uses
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+	// ErrPriceUnavailable is returned when a product has no price in the currency asked for
+	// and there is no exchange rate to convert its price with
+	ErrPriceUnavailable = errors.New("price unavailable")
+
+	// ErrOrderNotFound is returned when changing the status of an order that does not exist
+	ErrOrderNotFound = errors.New("order not found")
+
+	// ErrInvalidOrderStatus is returned when a status update names an unknown status
+	ErrInvalidOrderStatus = errors.New("invalid order status")
+
+	// ErrInvalidStatusTransition is returned when an order can't move from its status to the requested one
+	ErrInvalidStatusTransition = errors.New("invalid order status transition")
+
+	// ErrOrderStatusConflict is returned when the order's status changed while it was being updated
+	ErrOrderStatusConflict = errors.New("order status changed concurrently")
+
+	// ErrWebhookNotFound is returned when a webhook does not exist or has been deleted
+	ErrWebhookNotFound = errors.New("webhook not found")
+
+	// ErrInvalidWebhook is returned when a webhook's URL or events fail validation
+	ErrInvalidWebhook = errors.New("invalid webhook")
+
+	// ErrIdempotencyKeyReused is returned when an idempotency key comes back with a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused for a different request")
+
+	// ErrIdempotencyKeyInFlight is returned when a request with the same idempotency key is still being handled
+	ErrIdempotencyKeyInFlight = errors.New("idempotency key in use by a request in flight")
 )
+
+// CouponNotApplicableError explains why a valid coupon did not apply to an order.
+// It matches ErrCouponNotApplicable with errors.Is.
+type CouponNotApplicableError struct {
+	Reason string
+}
+
+func (e *CouponNotApplicableError) Error() string {
+	return ErrCouponNotApplicable.Error() + ": " + e.Reason
+}
+
+func (e *CouponNotApplicableError) Is(target error) bool {
+	return target == ErrCouponNotApplicable
+}
+
+// MalformedCouponError explains why a new coupon failed validation.
+// It matches ErrMalformedCoupon with errors.Is.
+type MalformedCouponError struct {
+	Reason string
+}
+
+func (e *MalformedCouponError) Error() string {
+	return ErrMalformedCoupon.Error() + ": " + e.Reason
+}
+
+func (e *MalformedCouponError) Is(target error) bool {
+	return target == ErrMalformedCoupon
+}
+
+// InvalidProductError explains why a product failed validation.
+// It matches ErrInvalidProduct with errors.Is.
+type InvalidProductError struct {
+	Reason string
+}
+
+func (e *InvalidProductError) Error() string {
+	return ErrInvalidProduct.Error() + ": " + e.Reason
+}
+
+func (e *InvalidProductError) Is(target error) bool {
+	return target == ErrInvalidProduct
+}
+
+// StatusTransitionError names the disallowed order status transition.
+// It matches ErrInvalidStatusTransition with errors.Is.
+type StatusTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *StatusTransitionError) Error() string {
+	return ErrInvalidStatusTransition.Error() + ": " + e.From + " to " + e.To
+}
+
+func (e *StatusTransitionError) Is(target error) bool {
+	return target == ErrInvalidStatusTransition
+}
+
+// InvalidWebhookError explains why a webhook failed validation.
+// It matches ErrInvalidWebhook with errors.Is.
+type InvalidWebhookError struct {
+	Reason string
+}
+
+func (e *InvalidWebhookError) Error() string {
+	return ErrInvalidWebhook.Error() + ": " + e.Reason
+}
+
+func (e *InvalidWebhookError) Is(target error) bool {
+	return target == ErrInvalidWebhook
+}
+
+// InsufficientStockError lists the products an order asked for more of than
+// is in stock. It matches ErrInsufficientStock with errors.Is.
+type InsufficientStockError struct {
+	ProductIDs []string
+}
+
+func (e *InsufficientStockError) Error() string {
+	return ErrInsufficientStock.Error() + ": " + strings.Join(e.ProductIDs, ", ")
+}
+
+func (e *InsufficientStockError) Is(target error) bool {
+	return target == ErrInsufficientStock
+}
+
+// PriceUnavailableError names the product that can't be priced in a currency.
+// It matches ErrPriceUnavailable with errors.Is.
+type PriceUnavailableError struct {
+	ProductID string
+	Currency  string
+}
+
+func (e *PriceUnavailableError) Error() string {
+	return ErrPriceUnavailable.Error() + ": product " + e.ProductID + " in " + e.Currency
+}
+
+func (e *PriceUnavailableError) Is(target error) bool {
+	return target == ErrPriceUnavailable
+}
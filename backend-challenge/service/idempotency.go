@@ -0,0 +1,57 @@
+package service
+
+import (
+	"backend-challenge/models"
+	"context"
+	"time"
+)
+
+const (
+	// DefaultIdempotencyTTL is how long responses are kept for retries
+	DefaultIdempotencyTTL = 24 * time.Hour
+
+	// idempotencyLockTimeout is how long an in-flight request holds its key.
+	// Past it the request is assumed lost, e.g. to a crash, and the key is freed.
+	idempotencyLockTimeout = time.Minute
+)
+
+// SetIdempotencyTTL sets how long idempotency keys and their responses are kept
+func (s *Service) SetIdempotencyTTL(ttl time.Duration) {
+	s.idempotencyTTL = ttl
+}
+
+// BeginIdempotentRequest claims key for a request. It returns nil when the
+// request should be handled, and the stored request when it already was and
+// its response should be replayed. A key that is still in flight, or that was
+// used for a request with another fingerprint, is refused.
+func (s *Service) BeginIdempotentRequest(ctx context.Context, apiKeyID, key, fingerprint string) (*models.IdempotentRequest, error) {
+	now := s.now()
+	existing, err := s.db.ReserveIdempotencyKey(ctx, &models.IdempotentRequest{
+		APIKeyID:    apiKeyID,
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.idempotencyTTL),
+	}, now.Add(-idempotencyLockTimeout))
+	if err != nil || existing == nil {
+		return nil, err
+	}
+
+	if existing.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !existing.Completed() {
+		return nil, ErrIdempotencyKeyInFlight
+	}
+	return existing, nil
+}
+
+// CompleteIdempotentRequest stores the response to replay for retries of the request
+func (s *Service) CompleteIdempotentRequest(ctx context.Context, req *models.IdempotentRequest) error {
+	return s.db.CompleteIdempotencyKey(ctx, req)
+}
+
+// AbortIdempotentRequest frees key after a request failed in a way worth retrying
+func (s *Service) AbortIdempotentRequest(ctx context.Context, apiKeyID, key string) error {
+	return s.db.ReleaseIdempotencyKey(ctx, apiKeyID, key)
+}
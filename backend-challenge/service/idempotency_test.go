@@ -0,0 +1,69 @@
+package service
+
+import (
+	"backend-challenge/db/mocks"
+	"backend-challenge/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+)
+
+func TestBeginIdempotentRequest(t *testing.T) {
+	completed := &models.IdempotentRequest{Fingerprint: "fp", StatusCode: 200, Body: []byte("{}")}
+
+	tests := []struct {
+		name      string
+		existing  *models.IdempotentRequest
+		dbErr     error
+		want      *models.IdempotentRequest
+		expectErr error
+	}{
+		{"new key", nil, nil, nil, nil},
+		{"replay", completed, nil, completed, nil},
+		{"different request", &models.IdempotentRequest{Fingerprint: "other", StatusCode: 200}, nil, nil, ErrIdempotencyKeyReused},
+		{"in flight", &models.IdempotentRequest{Fingerprint: "fp"}, nil, nil, ErrIdempotencyKeyInFlight},
+		{"database error", nil, errors.New("db error"), nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			mockDB.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), testNow.Add(-idempotencyLockTimeout)).DoAndReturn(
+				func(_ context.Context, req *models.IdempotentRequest, _ time.Time) (*models.IdempotentRequest, error) {
+					want := models.IdempotentRequest{APIKeyID: "demo", Key: "k1", Fingerprint: "fp", CreatedAt: testNow, ExpiresAt: testNow.Add(time.Hour)}
+					if req.APIKeyID != want.APIKeyID || req.Key != want.Key || req.Fingerprint != want.Fingerprint ||
+						!req.CreatedAt.Equal(want.CreatedAt) || !req.ExpiresAt.Equal(want.ExpiresAt) {
+						t.Errorf("Unexpected reservation %+v", req)
+					}
+					return tt.existing, tt.dbErr
+				})
+
+			svc := New(mockDB)
+			svc.now = func() time.Time { return testNow }
+			svc.SetIdempotencyTTL(time.Hour)
+
+			got, err := svc.BeginIdempotentRequest(context.Background(), "demo", "k1", "fp")
+			switch {
+			case tt.dbErr != nil:
+				if !errors.Is(err, tt.dbErr) {
+					t.Errorf("Expected %v, got %v", tt.dbErr, err)
+				}
+			case tt.expectErr != nil:
+				if !errors.Is(err, tt.expectErr) {
+					t.Errorf("Expected %v, got %v", tt.expectErr, err)
+				}
+			case err != nil:
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"backend-challenge/events"
+	"backend-challenge/models"
+	"context"
+)
+
+// OrderEventStream holds an order's status changes after the one a client
+// last saw, followed by the changes made while it is open
+type OrderEventStream struct {
+	// Backlog holds the recorded changes the client has not seen yet
+	Backlog []models.OrderEvent
+	// Final is set when the order was already in a final status, so no live events will follow
+	Final bool
+	// Events delivers live changes, and is closed when the stream ends
+	Events <-chan models.OrderEvent
+
+	sub *events.Subscription
+}
+
+// Close stops the live events
+func (s *OrderEventStream) Close() {
+	s.sub.Close()
+}
+
+// Close ends all order event streams, e.g. when the server shuts down
+func (s *Service) Close() {
+	s.events.Close()
+}
+
+// FinalOrderStatus reports whether an order in status can no longer change
+func FinalOrderStatus(status string) bool {
+	return validOrderStatus(status) && len(orderTransitions[status]) == 0
+}
+
+// StreamOrderEvents returns the changes to an order after event afterID,
+// followed by live ones. Live events may repeat backlog events and should be
+// skipped when their ID has already been seen.
+func (s *Service) StreamOrderEvents(ctx context.Context, id string, afterID int) (*OrderEventStream, error) {
+	// Subscribe before reading the history so no change falls between the two
+	sub := s.events.Subscribe(id)
+
+	order, err := s.db.GetOrderByID(ctx, id)
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+	if order == nil {
+		sub.Close()
+		return nil, ErrOrderNotFound
+	}
+
+	stream := &OrderEventStream{Final: FinalOrderStatus(order.Status), Events: sub.C, sub: sub}
+	for i, change := range order.History {
+		if i+1 > afterID {
+			stream.Backlog = append(stream.Backlog, models.OrderEvent{ID: i + 1, OrderID: id, OrderStatusChange: change})
+		}
+	}
+	return stream, nil
+}
+
+// publishChange announces a change recorded in the order's history. Statuses
+// are never revisited, so the From and To pair identifies the entry, and with
+// it the event ID, even if another change has been recorded since.
+func (s *Service) publishChange(order *models.Order, from, to string) {
+	for i, change := range order.History {
+		if change.From == from && change.To == to {
+			s.events.Publish(models.OrderEvent{ID: i + 1, OrderID: order.ID, OrderStatusChange: change})
+			return
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"backend-challenge/db/mocks"
+	"backend-challenge/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+)
+
+func TestStreamOrderEvents(t *testing.T) {
+	history := []models.OrderStatusChange{
+		{To: models.OrderPlaced},
+		{From: models.OrderPlaced, To: models.OrderAccepted, Actor: "kitchen"},
+	}
+
+	tests := []struct {
+		name        string
+		order       *models.Order
+		afterID     int
+		wantBacklog []int
+		wantFinal   bool
+		expectErr   error
+	}{
+		{"whole history", &models.Order{ID: "o1", Status: models.OrderAccepted, History: history}, 0, []int{1, 2}, false, nil},
+		{"resume", &models.Order{ID: "o1", Status: models.OrderAccepted, History: history}, 1, []int{2}, false, nil},
+		{"up to date", &models.Order{ID: "o1", Status: models.OrderAccepted, History: history}, 2, nil, false, nil},
+		{"final", &models.Order{ID: "o1", Status: models.OrderCancelled, History: history}, 2, nil, true, nil},
+		{"not found", nil, 0, nil, false, ErrOrderNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			mockDB.EXPECT().GetOrderByID(gomock.Any(), "o1").Return(tt.order, nil)
+			svc := New(mockDB)
+
+			stream, err := svc.StreamOrderEvents(context.Background(), "o1", tt.afterID)
+			if tt.expectErr != nil {
+				if !errors.Is(err, tt.expectErr) {
+					t.Errorf("Expected %v, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer stream.Close()
+
+			var ids []int
+			for _, e := range stream.Backlog {
+				if e.OrderID != "o1" || e.To != history[e.ID-1].To {
+					t.Errorf("Unexpected event %+v", e)
+				}
+				ids = append(ids, e.ID)
+			}
+			if len(ids) != len(tt.wantBacklog) || (len(ids) > 0 && ids[0] != tt.wantBacklog[0]) {
+				t.Errorf("Backlog IDs = %v, want %v", ids, tt.wantBacklog)
+			}
+			if stream.Final != tt.wantFinal {
+				t.Errorf("Final = %v, want %v", stream.Final, tt.wantFinal)
+			}
+		})
+	}
+}
+
+func TestUpdateOrderStatus_PublishesEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	placed := &models.Order{ID: "o1", Status: models.OrderPlaced, History: []models.OrderStatusChange{{To: models.OrderPlaced}}}
+	accepted := &models.Order{ID: "o1", Status: models.OrderAccepted, History: []models.OrderStatusChange{
+		{To: models.OrderPlaced},
+		{From: models.OrderPlaced, To: models.OrderAccepted, Actor: "kitchen", At: testNow},
+	}}
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	gomock.InOrder(
+		mockDB.EXPECT().GetOrderByID(gomock.Any(), "o1").Return(placed, nil),
+		mockDB.EXPECT().GetOrderByID(gomock.Any(), "o1").Return(placed, nil),
+		mockDB.EXPECT().UpdateOrderStatus(gomock.Any(), "o1", gomock.Any()).Return(nil),
+		mockDB.EXPECT().GetOrderByID(gomock.Any(), "o1").Return(accepted, nil),
+	)
+	svc := New(mockDB)
+	svc.now = func() time.Time { return testNow }
+
+	stream, err := svc.StreamOrderEvents(context.Background(), "o1", 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+
+	if _, err := svc.UpdateOrderStatus(context.Background(), "o1", models.OrderStatusReq{Status: models.OrderAccepted}, "kitchen"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case e := <-stream.Events:
+		if e.ID != 2 || e.OrderID != "o1" || e.From != models.OrderPlaced || e.To != models.OrderAccepted || e.Actor != "kitchen" {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	default:
+		t.Fatal("Expected the status change to be published")
+	}
+}
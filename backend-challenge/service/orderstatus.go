@@ -0,0 +1,81 @@
+package service
+
+import (
+	"backend-challenge/db"
+	"backend-challenge/models"
+	"context"
+	"errors"
+	"strings"
+)
+
+// orderTransitions lists the statuses each status can move to. Orders can be
+// cancelled until they are ready; completed and cancelled orders are final.
+var orderTransitions = map[string][]string{
+	models.OrderPlaced:    {models.OrderAccepted, models.OrderCancelled},
+	models.OrderAccepted:  {models.OrderPreparing, models.OrderCancelled},
+	models.OrderPreparing: {models.OrderReady, models.OrderCancelled},
+	models.OrderReady:     {models.OrderCompleted},
+	models.OrderCompleted: nil,
+	models.OrderCancelled: nil,
+}
+
+// validOrderStatus reports whether status is one of the order statuses
+func validOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// canTransition reports whether an order may move from one status to another
+func canTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateOrderStatus moves an order to a new status on behalf of actor and
+// returns the updated order
+func (s *Service) UpdateOrderStatus(ctx context.Context, id string, req models.OrderStatusReq, actor string) (*models.Order, error) {
+	if !validOrderStatus(req.Status) {
+		return nil, ErrInvalidOrderStatus
+	}
+
+	order, err := s.db.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if !canTransition(order.Status, req.Status) {
+		return nil, &StatusTransitionError{From: order.Status, To: req.Status}
+	}
+
+	change := models.OrderStatusChange{
+		From:   order.Status,
+		To:     req.Status,
+		Actor:  actor,
+		Reason: strings.TrimSpace(req.Reason),
+		At:     s.now().UTC(),
+	}
+	err = s.db.UpdateOrderStatus(ctx, id, change)
+	switch {
+	case errors.Is(err, db.ErrOrderNotFound):
+		return nil, ErrOrderNotFound
+	case errors.Is(err, db.ErrOrderStatusChanged):
+		return nil, ErrOrderStatusConflict
+	case err != nil:
+		return nil, err
+	}
+
+	updated, err := s.db.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if updated != nil {
+		s.publishChange(updated, change.From, change.To)
+	}
+	return updated, nil
+}
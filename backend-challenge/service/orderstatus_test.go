@@ -0,0 +1,130 @@
+package service
+
+import (
+	"backend-challenge/db"
+	"backend-challenge/db/mocks"
+	"backend-challenge/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+)
+
+func TestCanTransition(t *testing.T) {
+	// Walk the kitchen flow from placed to completed
+	flow := []string{models.OrderPlaced, models.OrderAccepted, models.OrderPreparing, models.OrderReady, models.OrderCompleted}
+	for i := 1; i < len(flow); i++ {
+		if !canTransition(flow[i-1], flow[i]) {
+			t.Errorf("Expected %s -> %s to be allowed", flow[i-1], flow[i])
+		}
+	}
+
+	disallowed := [][2]string{
+		{models.OrderPlaced, models.OrderReady},
+		{models.OrderAccepted, models.OrderPlaced},
+		{models.OrderReady, models.OrderCancelled},
+		{models.OrderCompleted, models.OrderCancelled},
+		{models.OrderCancelled, models.OrderPlaced},
+		{models.OrderPlaced, models.OrderPlaced},
+	}
+	for _, tr := range disallowed {
+		if canTransition(tr[0], tr[1]) {
+			t.Errorf("Expected %s -> %s to be refused", tr[0], tr[1])
+		}
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	placed := &models.Order{ID: "o1", Status: models.OrderPlaced}
+	accepted := &models.Order{ID: "o1", Status: models.OrderAccepted}
+
+	tests := []struct {
+		name      string
+		req       models.OrderStatusReq
+		mockSetup func(*mocks.MockDatabase)
+		expectErr error
+	}{
+		{
+			name: "accept placed order",
+			req:  models.OrderStatusReq{Status: models.OrderAccepted},
+			mockSetup: func(m *mocks.MockDatabase) {
+				gomock.InOrder(
+					m.EXPECT().GetOrderByID(gomock.Any(), "o1").Return(placed, nil),
+					m.EXPECT().UpdateOrderStatus(gomock.Any(), "o1", models.OrderStatusChange{
+						From: models.OrderPlaced, To: models.OrderAccepted, Actor: "kitchen", At: testNow,
+					}).Return(nil),
+					m.EXPECT().GetOrderByID(gomock.Any(), "o1").Return(accepted, nil),
+				)
+			},
+		},
+		{
+			name: "cancel with reason",
+			req:  models.OrderStatusReq{Status: models.OrderCancelled, Reason: " out of stock "},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "o1").Return(placed, nil).Times(2)
+				m.EXPECT().UpdateOrderStatus(gomock.Any(), "o1", models.OrderStatusChange{
+					From: models.OrderPlaced, To: models.OrderCancelled, Actor: "kitchen", Reason: "out of stock", At: testNow,
+				}).Return(nil)
+			},
+		},
+		{
+			name:      "unknown status",
+			req:       models.OrderStatusReq{Status: "eaten"},
+			mockSetup: func(m *mocks.MockDatabase) {},
+			expectErr: ErrInvalidOrderStatus,
+		},
+		{
+			name: "order not found",
+			req:  models.OrderStatusReq{Status: models.OrderAccepted},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "o1").Return(nil, nil)
+			},
+			expectErr: ErrOrderNotFound,
+		},
+		{
+			name: "skipping a step",
+			req:  models.OrderStatusReq{Status: models.OrderReady},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "o1").Return(placed, nil)
+			},
+			expectErr: ErrInvalidStatusTransition,
+		},
+		{
+			name: "status changed concurrently",
+			req:  models.OrderStatusReq{Status: models.OrderAccepted},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetOrderByID(gomock.Any(), "o1").Return(placed, nil)
+				m.EXPECT().UpdateOrderStatus(gomock.Any(), "o1", gomock.Any()).Return(db.ErrOrderStatusChanged)
+			},
+			expectErr: ErrOrderStatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			tt.mockSetup(mockDB)
+			svc := New(mockDB)
+			svc.now = func() time.Time { return testNow }
+
+			order, err := svc.UpdateOrderStatus(context.Background(), "o1", tt.req, "kitchen")
+			if tt.expectErr != nil {
+				if !errors.Is(err, tt.expectErr) {
+					t.Errorf("Expected %v, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if order == nil {
+				t.Error("Expected updated order")
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"backend-challenge/models"
+	"backend-challenge/money"
+	"backend-challenge/tax"
+)
+
+// priceOrder fills in the per-line amounts and subtotal of an order, then
+// applies the coupon discount rule, if any, to compute discounts, and the
+// taxes of the store selling in currency to compute tax and total. The
+// order's products must already be priced in currency. Amounts are exact
+// minor units; the only rounding is in percentage discounts and tax, to the
+// nearest minor unit.
+func priceOrder(order *models.Order, currency string, rule DiscountRule, taxes *tax.Config) error {
+	order.Lines = make([]models.OrderLine, 0, len(order.Items))
+	subtotal := money.New(0, currency)
+	for i, item := range order.Items {
+		unitPrice := order.Products[i].Price
+		amount := unitPrice.Mul(item.Quantity)
+		order.Lines = append(order.Lines, models.OrderLine{
+			ProductID:   item.ProductID,
+			Quantity:    item.Quantity,
+			UnitPrice:   unitPrice,
+			Amount:      amount,
+			TaxCategory: order.Products[i].TaxCategory,
+			Tax:         money.New(0, currency),
+		})
+		subtotal = subtotal.Add(amount)
+	}
+	order.Subtotal = subtotal
+	order.Discounts = money.New(0, subtotal.Currency)
+
+	if rule != nil {
+		discount, err := rule.Discount(order)
+		if err != nil {
+			return err
+		}
+		order.Discounts = order.Discounts.Add(discount)
+	}
+	order.Total = order.Subtotal.Sub(order.Discounts)
+
+	// Tax is on what is paid, so it comes after the discounts
+	if err := applyTax(order, rule, taxes); err != nil {
+		return err
+	}
+	if !order.TaxInclusive {
+		order.Total = order.Total.Add(order.Tax)
+	}
+	return nil
+}
@@ -2,35 +2,262 @@ package service
 
 import (
 	"backend-challenge/db"
+	"backend-challenge/events"
 	"backend-challenge/models"
+	"backend-challenge/money"
+	"backend-challenge/tax"
 	"context"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 // Service provides business logic operations
 type Service struct {
-	db db.Database
+	db  db.Database
+	now func() time.Time
+	// staticKeys holds API keys from configuration, by hash
+	staticKeys     map[string]*models.APIKey
+	idempotencyTTL time.Duration
+	// events carries order status changes to open event streams
+	events *events.Bus
+	// rates converts prices into currencies products have no price set in
+	rates *money.Rates
+	// taxes holds each store's tax rates; nil means orders carry no tax
+	taxes *tax.Config
 }
 
 // New creates a new Service
 func New(database db.Database) *Service {
-	return &Service{db: database}
+	return &Service{db: database, now: time.Now, idempotencyTTL: DefaultIdempotencyTTL, events: events.NewBus()}
 }
 
-// GetAllProducts retrieves all products with optional pagination
-func (s *Service) GetAllProducts(ctx context.Context, limit, offset int) ([]models.Product, error) {
-	return s.db.GetAllProducts(ctx, limit, offset)
+// GetAllProducts retrieves the products that match filter with optional
+// pagination, priced in currency. An empty currency leaves each product in
+// its own.
+func (s *Service) GetAllProducts(ctx context.Context, filter models.ProductFilter, limit, offset int, currency string) ([]models.Product, error) {
+	if err := checkCurrency(currency); err != nil {
+		return nil, err
+	}
+	products, err := s.db.GetAllProducts(ctx, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := range products {
+		if err := s.priceIn(&products[i], currency); err != nil {
+			return nil, err
+		}
+	}
+	return products, nil
+}
+
+// GetProductByID retrieves a single product by ID, priced in currency. An
+// empty currency leaves the product in its own.
+func (s *Service) GetProductByID(ctx context.Context, id, currency string) (*models.Product, error) {
+	if err := checkCurrency(currency); err != nil {
+		return nil, err
+	}
+	product, err := s.db.GetProductByID(ctx, id)
+	if err != nil || product == nil {
+		return nil, err
+	}
+	if err := s.priceIn(product, currency); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// CreateProduct validates and stores a new product
+func (s *Service) CreateProduct(ctx context.Context, product models.Product) (*models.Product, error) {
+	if err := s.validateProduct(&product); err != nil {
+		return nil, err
+	}
+	if err := s.db.CreateProduct(ctx, &product); err != nil {
+		if errors.Is(err, db.ErrProductExists) {
+			return nil, ErrProductExists
+		}
+		return nil, err
+	}
+	product.SoldOut = product.OutOfStock()
+	return &product, nil
+}
+
+// ReplaceProduct validates and overwrites every field of an existing product
+// except its stock, which only SetProductStock changes. The stored product is
+// returned so the stock is current.
+func (s *Service) ReplaceProduct(ctx context.Context, product models.Product) (*models.Product, error) {
+	if err := s.validateProduct(&product); err != nil {
+		return nil, err
+	}
+	if err := s.updateProduct(ctx, &product); err != nil {
+		return nil, err
+	}
+	return s.storedProduct(ctx, product.ID)
+}
+
+// PatchProduct changes the fields set in patch and validates the result
+func (s *Service) PatchProduct(ctx context.Context, id string, patch models.ProductPatch) (*models.Product, error) {
+	product, err := s.db.GetProductByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+
+	patch.Apply(product)
+	if err := s.validateProduct(product); err != nil {
+		return nil, err
+	}
+	if err := s.updateProduct(ctx, product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// DeleteProduct removes a product from the catalogue. Past orders keep resolving it.
+func (s *Service) DeleteProduct(ctx context.Context, id string) error {
+	if err := s.db.DeleteProduct(ctx, id); err != nil {
+		if errors.Is(err, db.ErrProductNotFound) {
+			return ErrProductNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// SetProductStock sets the units of a product left to sell; a nil stock stops tracking it
+func (s *Service) SetProductStock(ctx context.Context, id string, stock *int) (*models.Product, error) {
+	if stock != nil && *stock < 0 {
+		return nil, &InvalidProductError{Reason: "stock must not be negative"}
+	}
+	if err := s.db.SetProductStock(ctx, id, stock); err != nil {
+		if errors.Is(err, db.ErrProductNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	return s.storedProduct(ctx, id)
+}
+
+// validateProduct checks a product before it is stored, putting it in the
+// standard tax category if it names none
+func (s *Service) validateProduct(product *models.Product) error {
+	if err := product.Validate(); err != nil {
+		return &InvalidProductError{Reason: err.Error()}
+	}
+	if product.TaxCategory == "" {
+		product.TaxCategory = tax.Standard
+	}
+	return s.checkTaxCategory(*product)
+}
+
+// storedProduct reads back a product that was just written
+func (s *Service) storedProduct(ctx context.Context, id string) (*models.Product, error) {
+	product, err := s.db.GetProductByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		// Deleted since it was written
+		return nil, ErrProductNotFound
+	}
+	return product, nil
+}
+
+func (s *Service) updateProduct(ctx context.Context, product *models.Product) error {
+	if err := s.db.UpdateProduct(ctx, product); err != nil {
+		if errors.Is(err, db.ErrProductNotFound) {
+			return ErrProductNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// ListCoupons retrieves coupons with their redemption counts, with optional pagination
+func (s *Service) ListCoupons(ctx context.Context, limit, offset int) ([]models.Coupon, error) {
+	return s.db.ListCoupons(ctx, limit, offset)
+}
+
+// CreateCoupon validates and stores a new coupon with its rule and limits
+func (s *Service) CreateCoupon(ctx context.Context, coupon models.Coupon) (*models.Coupon, error) {
+	if err := s.validateCoupon(ctx, &coupon); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.CreateCoupon(ctx, &coupon); err != nil {
+		switch {
+		case errors.Is(err, db.ErrCouponCodeLength):
+			return nil, &MalformedCouponError{Reason: "code length is not allowed by the coupon policy"}
+		case errors.Is(err, db.ErrCouponExists):
+			return nil, ErrCouponExists
+		}
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// DeactivateCoupon withdraws a coupon so new orders can no longer use it
+func (s *Service) DeactivateCoupon(ctx context.Context, code string) error {
+	if err := s.db.DeactivateCoupon(ctx, code); err != nil {
+		// Codes the policy rejects can never have been stored
+		if errors.Is(err, db.ErrCouponNotFound) || errors.Is(err, db.ErrCouponCodeLength) {
+			return ErrCouponNotFound
+		}
+		return err
+	}
+	return nil
 }
 
-// GetProductByID retrieves a single product by ID
-func (s *Service) GetProductByID(ctx context.Context, id string) (*models.Product, error) {
-	return s.db.GetProductByID(ctx, id)
+// validateCoupon checks a new coupon's rule and limits. Redemption state is
+// owned by the database and is cleared.
+func (s *Service) validateCoupon(ctx context.Context, coupon *models.Coupon) error {
+	coupon.Redemptions = 0
+	coupon.DeactivatedAt = nil
+
+	switch {
+	case coupon.Code == "":
+		return &MalformedCouponError{Reason: "code is required"}
+	case coupon.StartsAt != nil && coupon.EndsAt != nil && !coupon.StartsAt.Before(*coupon.EndsAt):
+		return &MalformedCouponError{Reason: "startsAt must be before endsAt"}
+	case coupon.MaxRedemptions < 0 || coupon.MaxPerCustomer < 0:
+		return &MalformedCouponError{Reason: "redemption limits must not be negative"}
+	}
+
+	if coupon.Rule == nil {
+		return nil
+	}
+	coupon.Rule.Code = coupon.Code
+	if _, err := NewDiscountRule(*coupon.Rule, money.DefaultCurrency, nil); err != nil {
+		return &MalformedCouponError{Reason: err.Error()}
+	}
+	if coupon.Rule.Type == models.CouponRuleFreeItem {
+		product, err := s.db.GetProductByID(ctx, coupon.Rule.ProductID)
+		if err != nil {
+			return err
+		}
+		if product == nil {
+			return &MalformedCouponError{Reason: "product " + coupon.Rule.ProductID + " does not exist"}
+		}
+	}
+	return nil
 }
 
-// PlaceOrder processes an order request
+// PlaceOrder processes an order request, pricing it in the currency asked
+// for or the store currency
 func (s *Service) PlaceOrder(ctx context.Context, req models.OrderReq) (*models.Order, error) {
+	currency := req.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	if err := checkCurrency(currency); err != nil {
+		return nil, err
+	}
+
 	// Validate coupon if provided
+	var rule DiscountRule
 	if req.CouponCode != "" {
 		valid, err := s.db.IsCouponValid(ctx, req.CouponCode)
 		if err != nil {
@@ -39,6 +266,11 @@ func (s *Service) PlaceOrder(ctx context.Context, req models.OrderReq) (*models.
 		if !valid {
 			return nil, ErrInvalidCoupon
 		}
+
+		rule, err = s.redeemableCoupon(ctx, req.CouponCode, req.CustomerID, currency)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Fetch products for order
@@ -51,17 +283,135 @@ func (s *Service) PlaceOrder(ctx context.Context, req models.OrderReq) (*models.
 		if product == nil {
 			return nil, ErrProductNotFound
 		}
+		if err := s.priceIn(product, currency); err != nil {
+			return nil, err
+		}
 		products = append(products, *product)
 	}
+	if short := shortProducts(req.Items, products); len(short) > 0 {
+		return nil, &InsufficientStockError{ProductIDs: short}
+	}
 
-	// Generate order
-	// The order is not stored or will not persist anywhere for the purposes of this demo
+	// Generate and store order
+	now := s.now().UTC()
 	order := &models.Order{
 		ID:         uuid.New().String(),
 		Items:      req.Items,
 		Products:   products,
 		CouponCode: req.CouponCode,
+		CustomerID: req.CustomerID,
+		Status:     models.OrderPlaced,
+		History:    []models.OrderStatusChange{{To: models.OrderPlaced, Actor: req.CustomerID, At: now}},
+		CreatedAt:  now,
+	}
+	if err := priceOrder(order, currency, rule, s.taxes); err != nil {
+		return nil, err
 	}
 
+	// The coupon redemption and stock reservation are recorded with the order,
+	// which enforces the caps and stock atomically in case concurrent orders
+	// raced past the checks above
+	if err := s.db.CreateOrder(ctx, order); err != nil {
+		var stockErr *db.InsufficientStockError
+		switch {
+		case errors.As(err, &stockErr):
+			return nil, &InsufficientStockError{ProductIDs: stockErr.ProductIDs}
+		case errors.Is(err, db.ErrRedemptionLimit):
+			return nil, ErrCouponExhausted
+		case errors.Is(err, db.ErrCustomerRedemptionLimit):
+			return nil, ErrCouponAlreadyUsed
+		case errors.Is(err, db.ErrCustomerRequired):
+			return nil, ErrCustomerRequired
+		case errors.Is(err, db.ErrCouponDeactivated):
+			return nil, ErrInvalidCoupon
+		}
+		return nil, err
+	}
+
+	s.publishChange(order, "", models.OrderPlaced)
 	return order, nil
 }
+
+// GetOrderByID retrieves a placed order by ID. Its products are priced in
+// the order's currency where they can be, and otherwise keep their own.
+func (s *Service) GetOrderByID(ctx context.Context, id string) (*models.Order, error) {
+	order, err := s.db.GetOrderByID(ctx, id)
+	if err != nil || order == nil {
+		return nil, err
+	}
+	for i := range order.Products {
+		// The order's amounts are stored, so a product without a price in
+		// its currency only affects how the product is shown
+		_ = s.priceIn(&order.Products[i], order.Total.Currency)
+	}
+	return order, nil
+}
+
+// shortProducts lists the products, in order of first appearance, whose
+// tracked stock doesn't cover the quantity ordered across all items.
+// products holds the product of each item.
+func shortProducts(items []models.OrderItem, products []models.Product) []string {
+	var ids []string
+	quantities := make(map[string]int)
+	stock := make(map[string]int)
+	for i, item := range items {
+		if products[i].Stock == nil {
+			continue
+		}
+		if _, ok := quantities[item.ProductID]; !ok {
+			ids = append(ids, item.ProductID)
+			stock[item.ProductID] = *products[i].Stock
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	var short []string
+	for _, id := range ids {
+		if quantities[id] > stock[id] {
+			short = append(short, id)
+		}
+	}
+	return short
+}
+
+// redeemableCoupon checks a valid coupon's redemption window and caps and
+// returns its discount rule for orders in currency. Codes without a stored
+// rule carry no discount and return a nil rule.
+func (s *Service) redeemableCoupon(ctx context.Context, code, customerID, currency string) (DiscountRule, error) {
+	coupon, err := s.db.GetCoupon(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if coupon == nil || coupon.DeactivatedAt != nil {
+		return nil, ErrInvalidCoupon
+	}
+
+	now := s.now()
+	if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+		return nil, ErrCouponNotYetActive
+	}
+	if coupon.EndsAt != nil && !now.Before(*coupon.EndsAt) {
+		return nil, ErrCouponExpired
+	}
+	if coupon.MaxRedemptions > 0 && coupon.Redemptions >= coupon.MaxRedemptions {
+		return nil, ErrCouponExhausted
+	}
+	if coupon.MaxPerCustomer > 0 {
+		// Without a customer the cap could be dodged by leaving the ID out
+		if customerID == "" {
+			return nil, ErrCustomerRequired
+		}
+		used, err := s.db.CountCustomerRedemptions(ctx, code, customerID)
+		if err != nil {
+			return nil, err
+		}
+		if used >= coupon.MaxPerCustomer {
+			return nil, ErrCouponAlreadyUsed
+		}
+	}
+
+	if coupon.Rule == nil {
+		return nil, nil
+	}
+	return NewDiscountRule(*coupon.Rule, currency, s.rates)
+}
@@ -1,24 +1,33 @@
 package service
 
 import (
+	"backend-challenge/db"
 	"backend-challenge/db/mocks"
 	"backend-challenge/models"
+	"backend-challenge/money"
+	"backend-challenge/tax"
 	"context"
 	"errors"
+	"reflect"
+	"slices"
 	"testing"
+	"time"
 
 	"go.uber.org/mock/gomock"
 )
 
+// testNow is the fixed clock used by order tests
+var testNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
 func TestGetAllProducts(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockDB := mocks.NewMockDatabase(ctrl)
-	mockDB.EXPECT().GetAllProducts(gomock.Any(), 10, 0).Return([]models.Product{{ID: "1"}}, nil)
+	mockDB.EXPECT().GetAllProducts(gomock.Any(), models.ProductFilter{}, 10, 0).Return([]models.Product{{ID: "1"}}, nil)
 
 	svc := New(mockDB)
-	products, err := svc.GetAllProducts(context.Background(), 10, 0)
+	products, err := svc.GetAllProducts(context.Background(), models.ProductFilter{}, 10, 0, "")
 
 	if err != nil || len(products) != 1 {
 		t.Error("failed")
@@ -33,13 +42,353 @@ func TestGetProductByID(t *testing.T) {
 	mockDB.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1"}, nil)
 
 	svc := New(mockDB)
-	product, err := svc.GetProductByID(context.Background(), "1")
+	product, err := svc.GetProductByID(context.Background(), "1", "")
 
 	if err != nil || product.ID != "1" {
 		t.Error("failed")
 	}
 }
 
+func TestCreateProduct(t *testing.T) {
+	valid := models.Product{ID: "10", Name: "Lemon Tart", Category: "Tart", Price: aud(525)}
+
+	tests := []struct {
+		name      string
+		product   models.Product
+		mockSetup func(*mocks.MockDatabase)
+		wantErr   error
+	}{
+		{
+			name:    "created",
+			product: valid,
+			mockSetup: func(m *mocks.MockDatabase) {
+				want := valid
+				want.TaxCategory = tax.Standard
+				m.EXPECT().CreateProduct(gomock.Any(), &want).Return(nil)
+			},
+		},
+		{
+			name:      "missing name",
+			product:   models.Product{ID: "10", Category: "Tart", Price: aud(525)},
+			mockSetup: func(m *mocks.MockDatabase) {},
+			wantErr:   ErrInvalidProduct,
+		},
+		{
+			name:      "non-positive price",
+			product:   models.Product{ID: "10", Name: "Lemon Tart", Category: "Tart"},
+			mockSetup: func(m *mocks.MockDatabase) {},
+			wantErr:   ErrInvalidProduct,
+		},
+		{
+			name:      "unsupported currency",
+			product:   models.Product{ID: "10", Name: "Lemon Tart", Category: "Tart", Price: money.New(525, "XYZ")},
+			mockSetup: func(m *mocks.MockDatabase) {},
+			wantErr:   ErrInvalidProduct,
+		},
+		{
+			name: "price in unsupported currency",
+			product: models.Product{ID: "10", Name: "Lemon Tart", Category: "Tart", Price: aud(525),
+				Prices: map[string]money.Money{"USD": money.New(350, "USD")}},
+			mockSetup: func(m *mocks.MockDatabase) {},
+			wantErr:   ErrInvalidProduct,
+		},
+		{
+			name: "price repeats own currency",
+			product: models.Product{ID: "10", Name: "Lemon Tart", Category: "Tart", Price: aud(525),
+				Prices: map[string]money.Money{"AUD": aud(500)}},
+			mockSetup: func(m *mocks.MockDatabase) {},
+			wantErr:   ErrInvalidProduct,
+		},
+		{
+			name:    "duplicate ID",
+			product: valid,
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateProduct(gomock.Any(), gomock.Any()).Return(db.ErrProductExists)
+			},
+			wantErr: ErrProductExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			tt.mockSetup(mockDB)
+
+			svc := New(mockDB)
+			product, err := svc.CreateProduct(context.Background(), tt.product)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateProduct() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && product.ID != tt.product.ID {
+				t.Errorf("CreateProduct() = %+v, want ID %s", product, tt.product.ID)
+			}
+		})
+	}
+}
+
+func TestPatchProduct(t *testing.T) {
+	price := aud(800)
+	empty := ""
+
+	tests := []struct {
+		name      string
+		patch     models.ProductPatch
+		mockSetup func(*mocks.MockDatabase)
+		want      *models.Product
+		wantErr   error
+	}{
+		{
+			name:  "changes set fields only",
+			patch: models.ProductPatch{Price: &price},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Name: "Waffle", Category: "Waffle", Price: aud(650)}, nil)
+				m.EXPECT().UpdateProduct(gomock.Any(), &models.Product{ID: "1", Name: "Waffle", Category: "Waffle", Price: aud(800), TaxCategory: tax.Standard}).Return(nil)
+			},
+			want: &models.Product{ID: "1", Name: "Waffle", Category: "Waffle", Price: aud(800), TaxCategory: tax.Standard},
+		},
+		{
+			name:  "result must still be valid",
+			patch: models.ProductPatch{Name: &empty},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Name: "Waffle", Category: "Waffle", Price: aud(650)}, nil)
+			},
+			wantErr: ErrInvalidProduct,
+		},
+		{
+			name:  "not found",
+			patch: models.ProductPatch{Price: &price},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(nil, nil)
+			},
+			wantErr: ErrProductNotFound,
+		},
+		{
+			name:  "deleted while patching",
+			patch: models.ProductPatch{Price: &price},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Name: "Waffle", Category: "Waffle", Price: aud(650)}, nil)
+				m.EXPECT().UpdateProduct(gomock.Any(), gomock.Any()).Return(db.ErrProductNotFound)
+			},
+			wantErr: ErrProductNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			tt.mockSetup(mockDB)
+
+			svc := New(mockDB)
+			product, err := svc.PatchProduct(context.Background(), "1", tt.patch)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PatchProduct() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && !reflect.DeepEqual(product, tt.want) {
+				t.Errorf("PatchProduct() = %+v, want %+v", product, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteProduct(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockDB.EXPECT().DeleteProduct(gomock.Any(), "1").Return(nil)
+	mockDB.EXPECT().DeleteProduct(gomock.Any(), "missing").Return(db.ErrProductNotFound)
+
+	svc := New(mockDB)
+	if err := svc.DeleteProduct(context.Background(), "1"); err != nil {
+		t.Errorf("DeleteProduct() error = %v", err)
+	}
+	if err := svc.DeleteProduct(context.Background(), "missing"); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("DeleteProduct() error = %v, want %v", err, ErrProductNotFound)
+	}
+}
+
+func TestSetProductStock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockDB.EXPECT().SetProductStock(gomock.Any(), "1", intPtr(0)).Return(nil)
+	mockDB.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Stock: intPtr(0), SoldOut: true}, nil)
+	mockDB.EXPECT().SetProductStock(gomock.Any(), "missing", nil).Return(db.ErrProductNotFound)
+
+	svc := New(mockDB)
+	product, err := svc.SetProductStock(context.Background(), "1", intPtr(0))
+	if err != nil || !product.SoldOut {
+		t.Errorf("SetProductStock() = %+v, %v, want sold out product", product, err)
+	}
+	if _, err := svc.SetProductStock(context.Background(), "missing", nil); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("SetProductStock() error = %v, want %v", err, ErrProductNotFound)
+	}
+	if _, err := svc.SetProductStock(context.Background(), "1", intPtr(-1)); !errors.Is(err, ErrInvalidProduct) {
+		t.Errorf("SetProductStock() error = %v, want %v", err, ErrInvalidProduct)
+	}
+}
+
+func TestCreateCoupon(t *testing.T) {
+	startsAt := testNow
+	endsAt := testNow.Add(24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		coupon    models.Coupon
+		mockSetup func(*mocks.MockDatabase)
+		wantErr   error
+	}{
+		{
+			name: "created with rule and limits",
+			coupon: models.Coupon{
+				Code:           "SPRING25",
+				Rule:           &models.CouponRule{Type: models.CouponRulePercentage, Value: 25},
+				StartsAt:       &startsAt,
+				EndsAt:         &endsAt,
+				MaxRedemptions: 100,
+			},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateCoupon(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, c *models.Coupon) error {
+					if c.Rule.Code != "SPRING25" {
+						t.Errorf("Expected rule code to follow the coupon, got %q", c.Rule.Code)
+					}
+					return nil
+				})
+			},
+		},
+		{
+			name:   "created without rule",
+			coupon: models.Coupon{Code: "SPRING25"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateCoupon(gomock.Any(), gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name: "free item product exists",
+			coupon: models.Coupon{
+				Code: "FREEWAFL",
+				Rule: &models.CouponRule{Type: models.CouponRuleFreeItem, ProductID: "1"},
+			},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1"}, nil)
+				m.EXPECT().CreateCoupon(gomock.Any(), gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name: "free item product missing",
+			coupon: models.Coupon{
+				Code: "FREEWAFL",
+				Rule: &models.CouponRule{Type: models.CouponRuleFreeItem, ProductID: "99"},
+			},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "99").Return(nil, nil)
+			},
+			wantErr: ErrMalformedCoupon,
+		},
+		{
+			name: "invalid rule",
+			coupon: models.Coupon{
+				Code: "SPRING25",
+				Rule: &models.CouponRule{Type: models.CouponRulePercentage, Value: 250},
+			},
+			mockSetup: func(m *mocks.MockDatabase) {},
+			wantErr:   ErrMalformedCoupon,
+		},
+		{
+			name:      "window ends before it starts",
+			coupon:    models.Coupon{Code: "SPRING25", StartsAt: &endsAt, EndsAt: &startsAt},
+			mockSetup: func(m *mocks.MockDatabase) {},
+			wantErr:   ErrMalformedCoupon,
+		},
+		{
+			name:      "negative limit",
+			coupon:    models.Coupon{Code: "SPRING25", MaxPerCustomer: -1},
+			mockSetup: func(m *mocks.MockDatabase) {},
+			wantErr:   ErrMalformedCoupon,
+		},
+		{
+			name:   "code length rejected by policy",
+			coupon: models.Coupon{Code: "SHORT"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateCoupon(gomock.Any(), gomock.Any()).Return(db.ErrCouponCodeLength)
+			},
+			wantErr: ErrMalformedCoupon,
+		},
+		{
+			name:   "code taken",
+			coupon: models.Coupon{Code: "HAPPYHRS"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().CreateCoupon(gomock.Any(), gomock.Any()).Return(db.ErrCouponExists)
+			},
+			wantErr: ErrCouponExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			tt.mockSetup(mockDB)
+
+			svc := New(mockDB)
+			coupon, err := svc.CreateCoupon(context.Background(), tt.coupon)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateCoupon() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && coupon.Code != tt.coupon.Code {
+				t.Errorf("CreateCoupon() = %+v, want code %s", coupon, tt.coupon.Code)
+			}
+		})
+	}
+}
+
+func TestDeactivateCoupon(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockDB.EXPECT().DeactivateCoupon(gomock.Any(), "HAPPYHRS").Return(nil)
+	mockDB.EXPECT().DeactivateCoupon(gomock.Any(), "NOTINDB88").Return(db.ErrCouponNotFound)
+	mockDB.EXPECT().DeactivateCoupon(gomock.Any(), "SHORT").Return(db.ErrCouponCodeLength)
+
+	svc := New(mockDB)
+	if err := svc.DeactivateCoupon(context.Background(), "HAPPYHRS"); err != nil {
+		t.Errorf("DeactivateCoupon() error = %v", err)
+	}
+	for _, code := range []string{"NOTINDB88", "SHORT"} {
+		if err := svc.DeactivateCoupon(context.Background(), code); !errors.Is(err, ErrCouponNotFound) {
+			t.Errorf("DeactivateCoupon(%s) error = %v, want %v", code, err, ErrCouponNotFound)
+		}
+	}
+}
+
+func TestGetOrderByID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockDB.EXPECT().GetOrderByID(gomock.Any(), "abc").Return(&models.Order{ID: "abc"}, nil)
+
+	svc := New(mockDB)
+	order, err := svc.GetOrderByID(context.Background(), "abc")
+
+	if err != nil || order.ID != "abc" {
+		t.Error("failed")
+	}
+}
+
 func TestPlaceOrder(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -47,21 +396,204 @@ func TestPlaceOrder(t *testing.T) {
 		mockSetup func(*mocks.MockDatabase)
 		wantErr   bool
 		checkErr  func(error) bool
+		wantTotal models.Order
 	}{
 		{
 			name: "success",
 			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 2}}},
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: 10.0}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
 			},
+			wantTotal: models.Order{Subtotal: aud(2000), Total: aud(2000)},
 		},
 		{
 			name: "valid coupon",
 			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS"},
 			mockSetup: func(m *mocks.MockDatabase) {
 				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
-				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: 10.0}, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", Rule: &models.CouponRule{Code: "HAPPYHRS", Type: models.CouponRulePercentage, Value: 18}}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantTotal: models.Order{Subtotal: aud(1000), Discounts: aud(180), Total: aud(820)},
+		},
+		{
+			name: "valid coupon without discount",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "BIRTHDAY"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "BIRTHDAY").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "BIRTHDAY").Return(&models.Coupon{Code: "BIRTHDAY"}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantTotal: models.Order{Subtotal: aud(1000), Total: aud(1000)},
+		},
+		{
+			name: "discount rounded to cents",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 3}}, CouponCode: "HAPPYHRS"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", Rule: &models.CouponRule{Code: "HAPPYHRS", Type: models.CouponRulePercentage, Value: 18}}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(455)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantTotal: models.Order{Subtotal: aud(1365), Discounts: aud(246), Total: aud(1119)},
+		},
+		{
+			name: "cheapest item free",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}, {ProductID: "2", Quantity: 1}}, CouponCode: "BUYGETON"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "BUYGETON").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "BUYGETON").Return(&models.Coupon{Code: "BUYGETON", Rule: &models.CouponRule{Code: "BUYGETON", Type: models.CouponRuleCheapestFree}}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "2").Return(&models.Product{ID: "2", Price: aud(450)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantTotal: models.Order{Subtotal: aud(1450), Discounts: aud(450), Total: aud(1000)},
+		},
+		{
+			name: "coupon minimum basket not met",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "OVER9000"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "OVER9000").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "OVER9000").Return(&models.Coupon{Code: "OVER9000", Rule: &models.CouponRule{Code: "OVER9000", Type: models.CouponRuleFixedAmount, Amount: 1000, MinSubtotal: 9000}}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+			},
+			wantErr:  true,
+			checkErr: func(err error) bool { return errors.Is(err, ErrCouponNotApplicable) },
+		},
+		{
+			name: "coupon fetch error",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(nil, errors.New("db error"))
+			},
+			wantErr: true,
+		},
+		{
+			name: "coupon not yet active",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				startsAt := testNow.Add(time.Hour)
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", StartsAt: &startsAt}, nil)
 			},
+			wantErr:  true,
+			checkErr: func(err error) bool { return errors.Is(err, ErrCouponNotYetActive) },
+		},
+		{
+			name: "coupon expired",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				endsAt := testNow
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", EndsAt: &endsAt}, nil)
+			},
+			wantErr:  true,
+			checkErr: func(err error) bool { return errors.Is(err, ErrCouponExpired) },
+		},
+		{
+			name: "coupon within window",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				startsAt, endsAt := testNow.Add(-time.Hour), testNow.Add(time.Hour)
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", StartsAt: &startsAt, EndsAt: &endsAt}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantTotal: models.Order{Subtotal: aud(1000), Total: aud(1000)},
+		},
+		{
+			name: "coupon exhausted",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", MaxRedemptions: 5, Redemptions: 5}, nil)
+			},
+			wantErr:  true,
+			checkErr: func(err error) bool { return errors.Is(err, ErrCouponExhausted) },
+		},
+		{
+			name: "coupon already used by customer",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS", CustomerID: "alice"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", MaxPerCustomer: 1}, nil)
+				m.EXPECT().CountCustomerRedemptions(gomock.Any(), "HAPPYHRS", "alice").Return(1, nil)
+			},
+			wantErr:  true,
+			checkErr: func(err error) bool { return errors.Is(err, ErrCouponAlreadyUsed) },
+		},
+		{
+			name: "coupon per-customer cap without a customer",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", MaxPerCustomer: 1}, nil)
+			},
+			wantErr:  true,
+			checkErr: func(err error) bool { return errors.Is(err, ErrCustomerRequired) },
+		},
+		{
+			name: "coupon per-customer cap not reached",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS", CustomerID: "alice"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", MaxPerCustomer: 2, MaxRedemptions: 10, Redemptions: 3}, nil)
+				m.EXPECT().CountCustomerRedemptions(gomock.Any(), "HAPPYHRS", "alice").Return(1, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantTotal: models.Order{Subtotal: aud(1000), Total: aud(1000)},
+		},
+		{
+			name: "coupon cap reached while placing order",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", MaxRedemptions: 1}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(db.ErrRedemptionLimit)
+			},
+			wantErr:  true,
+			checkErr: func(err error) bool { return errors.Is(err, ErrCouponExhausted) },
+		},
+		{
+			name: "customer cap reached while placing order",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS", CustomerID: "alice"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", MaxPerCustomer: 1}, nil)
+				m.EXPECT().CountCustomerRedemptions(gomock.Any(), "HAPPYHRS", "alice").Return(0, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(db.ErrCustomerRedemptionLimit)
+			},
+			wantErr:  true,
+			checkErr: func(err error) bool { return errors.Is(err, ErrCouponAlreadyUsed) },
+		},
+		{
+			name: "coupon deactivated while placing order",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS"}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(db.ErrCouponDeactivated)
+			},
+			wantErr:  true,
+			checkErr: func(err error) bool { return errors.Is(err, ErrInvalidCoupon) },
+		},
+		{
+			name: "unknown coupon rule type",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}, CouponCode: "HAPPYHRS"},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().IsCouponValid(gomock.Any(), "HAPPYHRS").Return(true, nil)
+				m.EXPECT().GetCoupon(gomock.Any(), "HAPPYHRS").Return(&models.Coupon{Code: "HAPPYHRS", Rule: &models.CouponRule{Code: "HAPPYHRS", Type: "bogus"}}, nil)
+			},
+			wantErr: true,
 		},
 		{
 			name: "invalid coupon",
@@ -97,13 +629,53 @@ func TestPlaceOrder(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "order store error",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(errors.New("db error"))
+			},
+			wantErr: true,
+		},
+		{
+			name: "within stock",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}, {ProductID: "1", Quantity: 1}}},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000), Stock: intPtr(2)}, nil).Times(2)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantTotal: models.Order{Subtotal: aud(2000), Total: aud(2000)},
+		},
+		{
+			name: "insufficient stock",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 2}, {ProductID: "2", Quantity: 1}, {ProductID: "1", Quantity: 1}}},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000), Stock: intPtr(2)}, nil).Times(2)
+				m.EXPECT().GetProductByID(gomock.Any(), "2").Return(&models.Product{ID: "2", Price: aud(2000)}, nil)
+			},
+			wantErr:  true,
+			checkErr: stockErrorFor("1"),
+		},
+		{
+			name: "stock taken while placing order",
+			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 1}}},
+			mockSetup: func(m *mocks.MockDatabase) {
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000), Stock: intPtr(1)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(&db.InsufficientStockError{ProductIDs: []string{"1"}})
+			},
+			wantErr:  true,
+			checkErr: stockErrorFor("1"),
+		},
 		{
 			name: "multiple items",
 			req:  models.OrderReq{Items: []models.OrderItem{{ProductID: "1", Quantity: 2}, {ProductID: "2", Quantity: 1}}},
 			mockSetup: func(m *mocks.MockDatabase) {
-				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: 10.0}, nil)
-				m.EXPECT().GetProductByID(gomock.Any(), "2").Return(&models.Product{ID: "2", Price: 20.0}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "1").Return(&models.Product{ID: "1", Price: aud(1000)}, nil)
+				m.EXPECT().GetProductByID(gomock.Any(), "2").Return(&models.Product{ID: "2", Price: aud(2000)}, nil)
+				m.EXPECT().CreateOrder(gomock.Any(), gomock.Any()).Return(nil)
 			},
+			wantTotal: models.Order{Subtotal: aud(4000), Total: aud(4000)},
 		},
 	}
 
@@ -116,6 +688,7 @@ func TestPlaceOrder(t *testing.T) {
 			tt.mockSetup(mockDB)
 
 			svc := New(mockDB)
+			svc.now = func() time.Time { return testNow }
 			order, err := svc.PlaceOrder(context.Background(), tt.req)
 
 			if tt.wantErr {
@@ -128,9 +701,41 @@ func TestPlaceOrder(t *testing.T) {
 				return
 			}
 
-			if err != nil || order.ID == "" || len(order.Products) != len(tt.req.Items) {
-				t.Error("failed")
+			if err != nil || order.ID == "" || len(order.Products) != len(tt.req.Items) || !order.CreatedAt.Equal(testNow) {
+				t.Fatal("failed")
+			}
+
+			if len(order.Lines) != len(tt.req.Items) {
+				t.Errorf("expected %d lines, got %d", len(tt.req.Items), len(order.Lines))
+			}
+			if order.Status != models.OrderPlaced || len(order.History) != 1 || order.History[0].To != models.OrderPlaced {
+				t.Errorf("expected placed order with one history entry, got %s / %+v", order.Status, order.History)
+			}
+			if order.Total.Currency != money.DefaultCurrency {
+				t.Errorf("currency = %q, want %q", order.Total.Currency, money.DefaultCurrency)
+			}
+			if order.Subtotal.Amount != tt.wantTotal.Subtotal.Amount || order.Discounts.Amount != tt.wantTotal.Discounts.Amount || order.Total.Amount != tt.wantTotal.Total.Amount {
+				t.Errorf("totals = %v/%v/%v, want %v/%v/%v",
+					order.Subtotal, order.Discounts, order.Total,
+					tt.wantTotal.Subtotal, tt.wantTotal.Discounts, tt.wantTotal.Total)
 			}
 		})
 	}
 }
+
+// stockErrorFor matches an InsufficientStockError naming productIDs
+func stockErrorFor(productIDs ...string) func(error) bool {
+	return func(err error) bool {
+		var stockErr *InsufficientStockError
+		return errors.As(err, &stockErr) && slices.Equal(stockErr.ProductIDs, productIDs)
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// aud returns an amount in cents of the store currency
+func aud(cents int64) money.Money {
+	return money.New(cents, money.DefaultCurrency)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"backend-challenge/models"
+	"backend-challenge/money"
+	"backend-challenge/tax"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SetTaxConfig sets the tax setup of the stores. Without one, orders carry
+// no tax and products can be in any tax category.
+func (s *Service) SetTaxConfig(taxes *tax.Config) {
+	s.taxes = taxes
+}
+
+// checkTaxCategory checks that the product's tax category has a rate in the stores
+func (s *Service) checkTaxCategory(product models.Product) error {
+	if s.taxes != nil && !s.taxes.ValidCategory(product.TaxCategory) {
+		return &InvalidProductError{Reason: fmt.Sprintf("tax category %q is not one of %s",
+			product.TaxCategory, strings.Join(s.taxes.Categories(), ", "))}
+	}
+	return nil
+}
+
+// applyTax works out the tax on each line of a priced order, on the line's
+// amount less its share of the discounts, and sums it into the order's tax.
+// Orders in a store without taxes carry no tax.
+func applyTax(order *models.Order, rule DiscountRule, taxes *tax.Config) error {
+	order.Tax = money.New(0, order.Subtotal.Currency)
+	if taxes == nil {
+		return nil
+	}
+	store, ok := taxes.Store(order.Subtotal.Currency)
+	if !ok {
+		return nil
+	}
+	order.TaxInclusive = store.Inclusive
+
+	shares := discountShares(order, rule)
+	for i := range order.Lines {
+		line := &order.Lines[i]
+		lineTax, err := store.Tax(line.Amount.Sub(shares[i]), line.TaxCategory)
+		if err != nil {
+			return fmt.Errorf("product %s: %w", line.ProductID, err)
+		}
+		line.Tax = lineTax
+		order.Tax = order.Tax.Add(lineTax)
+	}
+	return nil
+}
+
+// discountShares splits the order's discounts across its lines. A rule that
+// takes its discount off one line, such as a free item, puts it all there.
+// Otherwise each line's share is in proportion to its amount, and the minor
+// units left over from rounding down go to the largest remainders, so the
+// shares add up to the discounts exactly.
+func discountShares(order *models.Order, rule DiscountRule) []money.Money {
+	shares := make([]money.Money, len(order.Lines))
+	for i := range shares {
+		shares[i] = money.New(0, order.Subtotal.Currency)
+	}
+	if order.Discounts.IsZero() {
+		return shares
+	}
+
+	if lr, ok := rule.(lineRule); ok {
+		if i, ok := lr.discountedLine(order); ok {
+			shares[i] = order.Discounts
+			return shares
+		}
+	}
+
+	discounts, subtotal := order.Discounts.Amount, order.Subtotal.Amount
+	remainders := make([]int64, len(order.Lines))
+	left := discounts
+	for i, line := range order.Lines {
+		n := discounts * line.Amount.Amount
+		shares[i].Amount = n / subtotal
+		remainders[i] = n % subtotal
+		left -= shares[i].Amount
+	}
+
+	byRemainder := make([]int, len(order.Lines))
+	for i := range byRemainder {
+		byRemainder[i] = i
+	}
+	// Earlier lines win ties
+	sort.SliceStable(byRemainder, func(a, b int) bool {
+		return remainders[byRemainder[a]] > remainders[byRemainder[b]]
+	})
+	for _, i := range byRemainder[:left] {
+		shares[i].Amount++
+	}
+	return shares
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"backend-challenge/db/mocks"
+	"backend-challenge/models"
+	"backend-challenge/money"
+	"backend-challenge/tax"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+)
+
+// testTaxes has GST-style inclusive AUD prices and VAT-style exclusive GBP
+// prices, with food zero rated in both
+func testTaxes(t *testing.T) *tax.Config {
+	t.Helper()
+	taxes, err := tax.Parse(strings.NewReader(`{
+		"AUD": {"inclusive": true, "rates": {"standard": 10, "food": 0}},
+		"GBP": {"inclusive": false, "rates": {"standard": 20, "food": 0}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return taxes
+}
+
+func TestPriceOrder_Tax(t *testing.T) {
+	// Two waffles at 6.50 and one baklava at 4.00, which is food; wanted
+	// amounts are in minor units
+	order := func(currency string) *models.Order {
+		return &models.Order{
+			Items: []models.OrderItem{{ProductID: "1", Quantity: 2}, {ProductID: "5", Quantity: 1}},
+			Products: []models.Product{
+				{ID: "1", Price: money.New(650, currency), TaxCategory: tax.Standard},
+				{ID: "5", Price: money.New(400, currency), TaxCategory: "food"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		currency      string
+		rule          *models.CouponRule
+		noTaxes       bool
+		wantLineTax   int64
+		wantTax       int64
+		wantTotal     int64
+		wantInclusive bool
+	}{
+		{name: "inclusive", currency: "AUD", wantLineTax: 118, wantTax: 118, wantTotal: 1700, wantInclusive: true},
+		{name: "inclusive after percentage", currency: "AUD", rule: &models.CouponRule{Type: models.CouponRulePercentage, Value: 18},
+			wantLineTax: 97, wantTax: 97, wantTotal: 1394, wantInclusive: true},
+		{name: "free zero rated item", currency: "AUD", rule: &models.CouponRule{Type: models.CouponRuleCheapestFree},
+			wantLineTax: 118, wantTax: 118, wantTotal: 1300, wantInclusive: true},
+		{name: "free taxed item", currency: "AUD", rule: &models.CouponRule{Type: models.CouponRuleFreeItem, ProductID: "1"},
+			wantLineTax: 59, wantTax: 59, wantTotal: 1050, wantInclusive: true},
+		{name: "exclusive", currency: "GBP", wantLineTax: 260, wantTax: 260, wantTotal: 1960},
+		{name: "exclusive after percentage", currency: "GBP", rule: &models.CouponRule{Type: models.CouponRulePercentage, Value: 18},
+			wantLineTax: 213, wantTax: 213, wantTotal: 1607},
+		{name: "store without taxes", currency: "NZD", wantTotal: 1700},
+		{name: "no tax config", currency: "AUD", noTaxes: true, wantTotal: 1700},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rule DiscountRule
+			if tt.rule != nil {
+				var err error
+				if rule, err = NewDiscountRule(*tt.rule, money.DefaultCurrency, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			taxes := testTaxes(t)
+			if tt.noTaxes {
+				taxes = nil
+			}
+
+			o := order(tt.currency)
+			if err := priceOrder(o, tt.currency, rule, taxes); err != nil {
+				t.Fatalf("priceOrder() error = %v", err)
+			}
+
+			if o.Lines[0].Tax != money.New(tt.wantLineTax, tt.currency) || o.Lines[1].Tax != money.New(0, tt.currency) {
+				t.Errorf("line tax = %v, %v, want %d, 0", o.Lines[0].Tax, o.Lines[1].Tax, tt.wantLineTax)
+			}
+			if o.Tax != money.New(tt.wantTax, tt.currency) || o.TaxInclusive != tt.wantInclusive {
+				t.Errorf("tax = %v inclusive %v, want %d inclusive %v", o.Tax, o.TaxInclusive, tt.wantTax, tt.wantInclusive)
+			}
+			if o.Total != money.New(tt.wantTotal, tt.currency) {
+				t.Errorf("total = %v, want %d", o.Total, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestDiscountShares_Remainders(t *testing.T) {
+	// 1.00 off three lines of 1.00 leaves a cent over after thirds, which
+	// goes to the first line
+	order := &models.Order{
+		Lines: []models.OrderLine{
+			{ProductID: "1", Amount: aud(100)},
+			{ProductID: "2", Amount: aud(100)},
+			{ProductID: "3", Amount: aud(100)},
+		},
+		Subtotal:  aud(300),
+		Discounts: aud(100),
+	}
+
+	shares := discountShares(order, nil)
+	if shares[0] != aud(34) || shares[1] != aud(33) || shares[2] != aud(33) {
+		t.Errorf("discountShares() = %v, want 0.34, 0.33, 0.33", shares)
+	}
+}
+
+func TestCreateProduct_TaxCategory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockDB.EXPECT().CreateProduct(gomock.Any(), gomock.Any()).Return(nil)
+
+	svc := New(mockDB)
+	svc.SetTaxConfig(testTaxes(t))
+	product := models.Product{ID: "10", Name: "Lemon Tart", Category: "Tart", Price: aud(525), TaxCategory: "food"}
+	if _, err := svc.CreateProduct(context.Background(), product); err != nil {
+		t.Errorf("CreateProduct() error = %v", err)
+	}
+
+	product.TaxCategory = "luxury"
+	if _, err := svc.CreateProduct(context.Background(), product); !errors.Is(err, ErrInvalidProduct) {
+		t.Errorf("CreateProduct() error = %v, want %v", err, ErrInvalidProduct)
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"backend-challenge/db"
+	"backend-challenge/models"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// webhookSecretPrefix marks webhook signing secrets so they are recognisable
+const webhookSecretPrefix = "whsec_"
+
+// CreateWebhook validates and registers a webhook with a new signing secret,
+// which is only returned here
+func (s *Service) CreateWebhook(ctx context.Context, req models.Webhook) (*models.Webhook, error) {
+	if err := validateWebhook(req); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	webhook := &models.Webhook{
+		ID:        uuid.New().String(),
+		URL:       req.URL,
+		Events:    dedupe(req.Events),
+		Secret:    webhookSecretPrefix + hex.EncodeToString(secret),
+		CreatedAt: s.now().UTC(),
+	}
+	if err := s.db.CreateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// ListWebhooks retrieves the registered webhooks without their secrets
+func (s *Service) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	return s.db.ListWebhooks(ctx)
+}
+
+// DeleteWebhook stops deliveries to a webhook. Its delivery log is kept.
+func (s *Service) DeleteWebhook(ctx context.Context, id string) error {
+	if err := s.db.DeleteWebhook(ctx, id); err != nil {
+		if errors.Is(err, db.ErrWebhookNotFound) {
+			return ErrWebhookNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// ListWebhookDeliveries retrieves a webhook's deliveries, newest first, with optional pagination
+func (s *Service) ListWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) ([]models.WebhookDelivery, error) {
+	deliveries, err := s.db.ListWebhookDeliveries(ctx, webhookID, limit, offset)
+	if errors.Is(err, db.ErrWebhookNotFound) {
+		return nil, ErrWebhookNotFound
+	}
+	return deliveries, err
+}
+
+// validateWebhook checks that a webhook has an absolute http(s) URL and
+// subscribes to known event types
+func validateWebhook(webhook models.Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &InvalidWebhookError{Reason: "url must be an absolute http or https URL"}
+	}
+	if len(webhook.Events) == 0 {
+		return &InvalidWebhookError{Reason: "events must not be empty"}
+	}
+	for _, event := range webhook.Events {
+		if !models.ValidEventType(event) {
+			return &InvalidWebhookError{Reason: "unknown event type " + event}
+		}
+	}
+	return nil
+}
+
+// dedupe returns values without repeats, keeping the first occurrence of each
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"backend-challenge/db"
+	"backend-challenge/db/mocks"
+	"backend-challenge/models"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+)
+
+func TestCreateWebhook(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       models.Webhook
+		expectErr string
+	}{
+		{
+			name: "valid",
+			req:  models.Webhook{URL: "https://fulfilment.example.com/hooks", Events: []string{models.EventOrderPlaced, models.EventCouponRedeemed, models.EventOrderPlaced}},
+		},
+		{
+			name:      "relative url",
+			req:       models.Webhook{URL: "/hooks", Events: []string{models.EventOrderPlaced}},
+			expectErr: "url must be an absolute http or https URL",
+		},
+		{
+			name:      "unsupported scheme",
+			req:       models.Webhook{URL: "ftp://fulfilment.example.com/hooks", Events: []string{models.EventOrderPlaced}},
+			expectErr: "url must be an absolute http or https URL",
+		},
+		{
+			name:      "no events",
+			req:       models.Webhook{URL: "https://fulfilment.example.com/hooks"},
+			expectErr: "events must not be empty",
+		},
+		{
+			name:      "unknown event",
+			req:       models.Webhook{URL: "https://fulfilment.example.com/hooks", Events: []string{"order.eaten"}},
+			expectErr: "unknown event type order.eaten",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDB := mocks.NewMockDatabase(ctrl)
+			if tt.expectErr == "" {
+				mockDB.EXPECT().CreateWebhook(gomock.Any(), gomock.Any()).Return(nil)
+			}
+			svc := New(mockDB)
+
+			webhook, err := svc.CreateWebhook(context.Background(), tt.req)
+			if tt.expectErr != "" {
+				var invalid *InvalidWebhookError
+				if !errors.As(err, &invalid) || invalid.Reason != tt.expectErr {
+					t.Fatalf("Expected invalid webhook %q, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if webhook.ID == "" || !strings.HasPrefix(webhook.Secret, webhookSecretPrefix) {
+				t.Errorf("Expected ID and secret, got %+v", webhook)
+			}
+			if len(webhook.Events) != 2 {
+				t.Errorf("Expected repeated events dropped, got %v", webhook.Events)
+			}
+		})
+	}
+}
+
+func TestDeleteWebhook_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockDB.EXPECT().DeleteWebhook(gomock.Any(), "missing").Return(db.ErrWebhookNotFound)
+	svc := New(mockDB)
+
+	if err := svc.DeleteWebhook(context.Background(), "missing"); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+// Package tax holds the tax setup of each store: whether its prices include
+// tax, and the rate of each tax category products can be in.
+//
+// Tax is worked out per order line on what the customer pays for the line
+// after discounts, and rounded to the nearest minor unit with halves rounded
+// away from zero. The order's tax is the sum of its lines' tax.
+package tax
+
+import (
+	"backend-challenge/money"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// Standard is the category of products that don't name one
+const Standard = "standard"
+
+// basisPoints is the number of basis points in a whole
+const basisPoints = 100 * 100
+
+// Store is the tax setup of one store
+type Store struct {
+	// Inclusive is set when the store's prices include tax, as for GST in
+	// Australia; otherwise tax is added to the order total
+	Inclusive bool
+	// rates holds the rate of each category in basis points
+	rates map[string]int64
+}
+
+// Tax returns the tax on amount, the price paid for goods in category. For
+// tax-inclusive stores it is the part of amount that is tax; otherwise it is
+// the tax to add to amount.
+func (s Store) Tax(amount money.Money, category string) (money.Money, error) {
+	if category == "" {
+		category = Standard
+	}
+	rate, ok := s.rates[category]
+	if !ok {
+		return money.Money{}, fmt.Errorf("tax: no rate for category %q", category)
+	}
+	if s.Inclusive {
+		return amount.MulDiv(rate, basisPoints+rate), nil
+	}
+	return amount.MulDiv(rate, basisPoints), nil
+}
+
+// Config is the tax setup of every store, by the currency the store sells in
+type Config struct {
+	stores     map[string]Store
+	categories []string
+}
+
+// storeJSON is a store as written in the config file
+type storeJSON struct {
+	Inclusive bool `json:"inclusive"`
+	// Rates are percentages, such as 10 for 10%
+	Rates map[string]float64 `json:"rates"`
+}
+
+// Parse reads a tax config in JSON: an object keyed by store currency, each
+// giving whether prices include tax and the percentage rate of each category,
+// such as {"AUD": {"inclusive": true, "rates": {"standard": 10, "food": 0}}}.
+// Every store must have a standard rate and rates for the same categories.
+func Parse(r io.Reader) (*Config, error) {
+	var raw map[string]storeJSON
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("tax: reading config: %w", err)
+	}
+
+	c := &Config{stores: make(map[string]Store)}
+	for currency, store := range raw {
+		if !money.ValidCurrency(currency) {
+			return nil, fmt.Errorf("tax: store currency %q is not supported", currency)
+		}
+		if _, ok := store.Rates[Standard]; !ok {
+			return nil, fmt.Errorf("tax: %s has no %s rate", currency, Standard)
+		}
+
+		rates := make(map[string]int64, len(store.Rates))
+		for category, percent := range store.Rates {
+			if percent < 0 || percent > 100 {
+				return nil, fmt.Errorf("tax: %s rate for %s must be between 0 and 100, got %v", currency, category, percent)
+			}
+			rates[category] = int64(math.Round(percent * 100))
+		}
+		c.stores[currency] = Store{Inclusive: store.Inclusive, rates: rates}
+	}
+
+	// A product's category must mean something in every store
+	for _, store := range c.stores {
+		if c.categories == nil {
+			for category := range store.rates {
+				c.categories = append(c.categories, category)
+			}
+			sort.Strings(c.categories)
+		}
+		if len(store.rates) != len(c.categories) {
+			return nil, fmt.Errorf("tax: every store must have rates for the same categories")
+		}
+		for _, category := range c.categories {
+			if _, ok := store.rates[category]; !ok {
+				return nil, fmt.Errorf("tax: every store must have rates for the same categories")
+			}
+		}
+	}
+	return c, nil
+}
+
+// Load reads a tax config from a file; see Parse
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Store returns the tax setup of the store selling in currency. Stores left
+// out of the config charge no tax.
+func (c *Config) Store(currency string) (Store, bool) {
+	store, ok := c.stores[currency]
+	return store, ok
+}
+
+// ValidCategory reports whether products can be in category. The empty
+// category is the standard one.
+func (c *Config) ValidCategory(category string) bool {
+	if category == "" || category == Standard {
+		return true
+	}
+	i := sort.SearchStrings(c.categories, category)
+	return i < len(c.categories) && c.categories[i] == category
+}
+
+// Categories lists the tax categories, sorted
+func (c *Config) Categories() []string {
+	return c.categories
+}
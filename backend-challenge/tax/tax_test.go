@@ -0,0 +1,84 @@
+package tax
+
+import (
+	"backend-challenge/money"
+	"strings"
+	"testing"
+)
+
+const testConfig = `{
+	"AUD": {"inclusive": true, "rates": {"standard": 10, "food": 0}},
+	"GBP": {"inclusive": false, "rates": {"standard": 20, "food": 0}}
+}`
+
+func TestParse(t *testing.T) {
+	c, err := Parse(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := c.Categories(); len(got) != 2 || got[0] != "food" || got[1] != Standard {
+		t.Errorf("Categories() = %v", got)
+	}
+	for _, category := range []string{"", Standard, "food"} {
+		if !c.ValidCategory(category) {
+			t.Errorf("ValidCategory(%q) = false", category)
+		}
+	}
+	if c.ValidCategory("luxury") {
+		t.Error("ValidCategory(luxury) = true")
+	}
+	if _, ok := c.Store("NZD"); ok {
+		t.Error("expected no NZD store")
+	}
+
+	for _, in := range []string{
+		`{"USD": {"rates": {"standard": 10}}}`,
+		`{"AUD": {"rates": {"food": 0}}}`,
+		`{"AUD": {"rates": {"standard": 110}}}`,
+		`{"AUD": {"rates": {"standard": -1}}}`,
+		`{"AUD": {"rates": {"standard": 10, "food": 0}}, "NZD": {"rates": {"standard": 15}}}`,
+		`{"AUD": {"rates": {"standard": 10}}, "NZD": {"rates": {"standard": 15, "food": 0}}}`,
+		`{"AUD": {"rate": {"standard": 10}}}`,
+		`[]`,
+	} {
+		if _, err := Parse(strings.NewReader(in)); err == nil {
+			t.Errorf("Parse(%s) succeeded, want error", in)
+		}
+	}
+}
+
+func TestStoreTax(t *testing.T) {
+	c, err := Parse(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aud, _ := c.Store("AUD")
+	gbp, _ := c.Store("GBP")
+
+	tests := []struct {
+		name     string
+		store    Store
+		amount   money.Money
+		category string
+		want     money.Money
+	}{
+		{"inclusive", aud, money.New(1100, "AUD"), Standard, money.New(100, "AUD")},
+		{"inclusive rounded", aud, money.New(1300, "AUD"), Standard, money.New(118, "AUD")}, // 118.18
+		{"default category", aud, money.New(605, "AUD"), "", money.New(55, "AUD")},
+		{"inclusive zero rated", aud, money.New(1300, "AUD"), "food", money.New(0, "AUD")},
+		{"exclusive", gbp, money.New(338, "GBP"), Standard, money.New(68, "GBP")},           // 67.6
+		{"exclusive rounded", gbp, money.New(1234, "GBP"), Standard, money.New(247, "GBP")}, // 246.8
+		{"nothing paid", gbp, money.New(0, "GBP"), Standard, money.New(0, "GBP")},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.store.Tax(tt.amount, tt.category)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Tax(%v, %q) = %v, %v, want %v", tt.name, tt.amount, tt.category, got, err, tt.want)
+		}
+	}
+
+	if _, err := aud.Tax(money.New(100, "AUD"), "luxury"); err == nil {
+		t.Error("expected an error for an unknown category")
+	}
+}
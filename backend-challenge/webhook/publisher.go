@@ -0,0 +1,30 @@
+package webhook
+
+import (
+	"backend-challenge/models"
+	"context"
+	"time"
+)
+
+// DeliveryQueue holds the webhook deliveries still to be sent
+type DeliveryQueue interface {
+	EnqueueWebhookDeliveries(ctx context.Context, event models.OutboxEvent, now time.Time) error
+}
+
+// Publisher is an outbox.Publisher that queues a delivery of each event for
+// the webhooks subscribed to its type. The Sender sends each webhook's
+// deliveries separately, so a slow or failing webhook doesn't hold up the
+// outbox, and only delays the other webhooks by the Sender's per-poll budget.
+type Publisher struct {
+	queue DeliveryQueue
+	now   func() time.Time
+}
+
+// NewPublisher returns a publisher queueing deliveries in queue
+func NewPublisher(queue DeliveryQueue) *Publisher {
+	return &Publisher{queue: queue, now: time.Now}
+}
+
+func (p *Publisher) Publish(ctx context.Context, event models.OutboxEvent) error {
+	return p.queue.EnqueueWebhookDeliveries(ctx, event, p.now())
+}
@@ -0,0 +1,201 @@
+// Package webhook delivers outbox events to registered webhooks. Publisher
+// queues a delivery of each event for the webhooks subscribed to it, and
+// Sender sends the deliveries as signed POST requests, retrying failed ones
+// with exponential backoff.
+package webhook
+
+import (
+	"backend-challenge/models"
+	"backend-challenge/outbox"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// pollInterval is how often the sender checks for due deliveries
+	pollInterval = time.Second
+	// batchSize caps the deliveries sent per poll
+	batchSize = 100
+	// requestTimeout bounds each delivery request
+	requestTimeout = 10 * time.Second
+	// sendBudget is how long each webhook gets per poll to start deliveries
+	sendBudget = 5 * time.Second
+)
+
+// Store holds the webhook deliveries
+type Store interface {
+	DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.PendingWebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery) error
+}
+
+// Sender sends the webhook deliveries that are due
+type Sender struct {
+	store  Store
+	client *http.Client
+	retry  outbox.RetryPolicy
+	now    func() time.Time
+}
+
+// NewSender returns a sender retrying failed deliveries with outbox.DefaultRetryPolicy
+func NewSender(store Store) *Sender {
+	return &Sender{
+		store:  store,
+		client: &http.Client{Timeout: requestTimeout},
+		retry:  outbox.DefaultRetryPolicy,
+		now:    time.Now,
+	}
+}
+
+// Run sends deliveries until ctx is cancelled. A delivery interrupted by the
+// cancellation is not recorded and is sent again on the next run.
+func (s *Sender) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Send(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error sending webhooks: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Send makes an attempt at the deliveries that are due. Each webhook's
+// deliveries are sent in order, alongside the other webhooks'. A webhook
+// starts no more deliveries once it has had sendBudget, leaving the rest for
+// the next poll, so a slow receiver holds up the other webhooks' next poll by
+// at most sendBudget plus one request.
+func (s *Sender) Send(ctx context.Context) error {
+	due, err := s.store.DueWebhookDeliveries(ctx, s.now(), batchSize)
+	if err != nil {
+		return err
+	}
+
+	var webhooks []string
+	byWebhook := make(map[string][]models.PendingWebhookDelivery)
+	for _, delivery := range due {
+		if _, ok := byWebhook[delivery.WebhookID]; !ok {
+			webhooks = append(webhooks, delivery.WebhookID)
+		}
+		byWebhook[delivery.WebhookID] = append(byWebhook[delivery.WebhookID], delivery)
+	}
+
+	deadline := s.now().Add(sendBudget)
+	errs := make([]error, len(webhooks))
+	var wg sync.WaitGroup
+	for i, webhookID := range webhooks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.sendAll(ctx, byWebhook[webhookID], deadline)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// sendAll makes an attempt at each of one webhook's due deliveries in turn,
+// until deadline. Deliveries not attempted stay due.
+func (s *Sender) sendAll(ctx context.Context, due []models.PendingWebhookDelivery, deadline time.Time) error {
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !s.now().Before(deadline) {
+			return nil
+		}
+		result := s.send(ctx, delivery)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.store.RecordWebhookAttempt(ctx, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envelope is the body of a delivery request
+type envelope struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// send makes one attempt at a delivery and returns the delivery updated with its outcome
+func (s *Sender) send(ctx context.Context, pending models.PendingWebhookDelivery) models.WebhookDelivery {
+	delivery := pending.WebhookDelivery
+	delivery.Attempts++
+
+	statusCode, err := s.post(ctx, pending)
+	delivery.LastStatusCode = statusCode
+	now := s.now().UTC()
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		return delivery
+	case s.retry.Exhausted(delivery.Attempts):
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(s.retry.Delay(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+	delivery.LastError = outbox.ErrorText(err)
+	return delivery
+}
+
+// post sends the signed delivery request. Any response other than 2xx is an error.
+func (s *Sender) post(ctx context.Context, pending models.PendingWebhookDelivery) (int, error) {
+	body, err := json.Marshal(envelope{
+		ID:        pending.Event.ID,
+		Type:      pending.Event.Type,
+		CreatedAt: pending.Event.CreatedAt,
+		Data:      pending.Event.Data,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pending.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := s.now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, strconv.FormatInt(pending.Event.ID, 10))
+	req.Header.Set(HeaderEventType, pending.Event.Type)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(pending.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, outbox.MaxErrorLength))
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+	}
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,242 @@
+package webhook
+
+import (
+	"backend-challenge/models"
+	"backend-challenge/outbox"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is a Store holding webhook deliveries in memory
+type memoryStore struct {
+	mu         sync.Mutex
+	deliveries []models.PendingWebhookDelivery
+}
+
+// enqueue queues a delivery of event to url, as Publisher does
+func (s *memoryStore) enqueue(url, secret string, event models.OutboxEvent) {
+	s.deliveries = append(s.deliveries, models.PendingWebhookDelivery{
+		WebhookDelivery: models.WebhookDelivery{
+			ID:        int64(len(s.deliveries) + 1),
+			EventID:   event.ID,
+			EventType: event.Type,
+			Status:    models.DeliveryPending,
+		},
+		URL:    url,
+		Secret: secret,
+		Event:  event,
+	})
+}
+
+func (s *memoryStore) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.PendingWebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []models.PendingWebhookDelivery
+	for _, d := range s.deliveries {
+		if d.Status == models.DeliveryPending && (d.NextAttemptAt == nil || !d.NextAttemptAt.After(now)) {
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func (s *memoryStore) RecordWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[delivery.ID-1].WebhookDelivery = delivery
+	return nil
+}
+
+func TestSend_SignsDelivery(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer server.Close()
+
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	store := &memoryStore{}
+	store.enqueue(server.URL, "whsec_test", models.OutboxEvent{
+		ID: 7, Type: models.EventOrderPlaced, Data: json.RawMessage(`{"id":"order-1"}`), CreatedAt: createdAt,
+	})
+
+	if err := NewSender(store).Send(context.Background()); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	r := <-received
+	if r.Header.Get(HeaderEventID) != "7" || r.Header.Get(HeaderEventType) != models.EventOrderPlaced {
+		t.Errorf("Unexpected event headers: %v", r.Header)
+	}
+	unix, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("Invalid timestamp header: %v", err)
+	}
+	if !Verify("whsec_test", time.Unix(unix, 0), body, r.Header.Get(HeaderSignature)) {
+		t.Errorf("Signature %q does not verify", r.Header.Get(HeaderSignature))
+	}
+	if Verify("other", time.Unix(unix, 0), body, r.Header.Get(HeaderSignature)) {
+		t.Error("Signature verified with the wrong secret")
+	}
+
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	if env.ID != 7 || env.Type != models.EventOrderPlaced || !env.CreatedAt.Equal(createdAt) || string(env.Data) != `{"id":"order-1"}` {
+		t.Errorf("Unexpected body: %s", body)
+	}
+
+	delivery := store.deliveries[0]
+	if delivery.Status != models.DeliveryDelivered || delivery.Attempts != 1 || delivery.LastStatusCode != 200 || delivery.DeliveredAt == nil {
+		t.Errorf("Unexpected delivery: %+v", delivery.WebhookDelivery)
+	}
+}
+
+func TestSend_RetriesWithBackoff(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", status)
+	}))
+	defer server.Close()
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	store := &memoryStore{}
+	store.enqueue(server.URL, "whsec_test", models.OutboxEvent{ID: 1, Type: models.EventOrderPlaced, Data: json.RawMessage(`{}`), CreatedAt: now})
+	s := NewSender(store)
+	s.retry = outbox.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	s.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if err := s.Send(ctx); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	delivery := store.deliveries[0].WebhookDelivery
+	if delivery.Status != models.DeliveryPending || delivery.Attempts != 1 || delivery.LastStatusCode != 503 {
+		t.Fatalf("Unexpected delivery after first attempt: %+v", delivery)
+	}
+	if delivery.LastError != "unexpected status 503: down for maintenance" {
+		t.Errorf("Unexpected error: %q", delivery.LastError)
+	}
+	if !delivery.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected retry in a minute, got %v", delivery.NextAttemptAt)
+	}
+
+	// Nothing is sent before the retry is due
+	if err := s.Send(ctx); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if store.deliveries[0].Attempts != 1 {
+		t.Fatalf("Expected no attempt before the retry, got %d", store.deliveries[0].Attempts)
+	}
+
+	now = now.Add(time.Minute)
+	s.Send(ctx)
+	delivery = store.deliveries[0].WebhookDelivery
+	if delivery.Attempts != 2 || !delivery.NextAttemptAt.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("Expected second retry in two minutes, got %+v", delivery)
+	}
+
+	// The last allowed attempt fails the delivery for good
+	now = now.Add(2 * time.Minute)
+	s.Send(ctx)
+	delivery = store.deliveries[0].WebhookDelivery
+	if delivery.Status != models.DeliveryFailed || delivery.Attempts != 3 || delivery.NextAttemptAt != nil {
+		t.Errorf("Expected failed delivery, got %+v", delivery)
+	}
+}
+
+func TestSend_SlowWebhookDoesNotHoldUpOthers(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+
+	store := &memoryStore{}
+	event := models.OutboxEvent{ID: 1, Type: models.EventOrderPlaced, Data: json.RawMessage(`{}`)}
+	store.enqueue(slow.URL, "whsec_slow", event)
+	store.enqueue(fast.URL, "whsec_fast", event)
+	store.enqueue(fast.URL, "whsec_fast", models.OutboxEvent{ID: 2, Type: models.EventOrderPlaced, Data: json.RawMessage(`{}`)})
+	store.deliveries[0].WebhookID = "slow"
+	store.deliveries[1].WebhookID = "fast"
+	store.deliveries[2].WebhookID = "fast"
+
+	sent := make(chan error, 1)
+	go func() { sent <- NewSender(store).Send(context.Background()) }()
+
+	delivered := func(i int) bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return store.deliveries[i].Status == models.DeliveryDelivered
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !delivered(1) || !delivered(2) {
+		if time.Now().After(deadline) {
+			t.Fatal("the fast webhook's deliveries waited for the slow webhook")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if delivered(0) {
+		t.Error("the slow webhook's delivery finished before its response")
+	}
+
+	release <- struct{}{}
+	if err := <-sent; err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if !delivered(0) {
+		t.Errorf("Expected the slow delivery delivered, got %+v", store.deliveries[0].WebhookDelivery)
+	}
+}
+
+func TestSend_StopsWebhookAfterBudget(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	// Each request takes the whole budget
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		now = now.Add(sendBudget)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	store := &memoryStore{}
+	for id := int64(1); id <= 3; id++ {
+		store.enqueue(server.URL, "whsec_test", models.OutboxEvent{ID: id, Type: models.EventOrderPlaced, Data: json.RawMessage(`{}`)})
+	}
+	s := NewSender(store)
+	s.now = clock
+
+	for want := 1; want <= 3; want++ {
+		if err := s.Send(context.Background()); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		delivered := 0
+		for _, d := range store.deliveries {
+			if d.Status == models.DeliveryDelivered {
+				delivered++
+			}
+		}
+		if delivered != want {
+			t.Fatalf("%d deliveries sent after %d polls, want one per poll", delivered, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// Delivery request headers
+const (
+	HeaderEventID   = "Webhook-Id"
+	HeaderEventType = "Webhook-Event"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// signaturePrefix names the signature scheme in the signature header
+const signaturePrefix = "sha256="
+
+// Sign returns the signature header value for a delivery body sent at
+// timestamp: the hex HMAC-SHA256, keyed with the webhook secret, of the Unix
+// timestamp, a dot and the body. Covering the timestamp lets receivers
+// reject replayed deliveries.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is valid for a delivery body sent at
+// timestamp, the check receivers make
+func Verify(secret string, timestamp time.Time, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}